@@ -0,0 +1,128 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/spf13/cobra"
+
+	"gitlab.com/slon/shad-go/distbuild/pkg/build"
+	"gitlab.com/slon/shad-go/distbuild/pkg/client"
+)
+
+var buildCmd = &cobra.Command{
+	Use:   "build [graph.json]",
+	Short: "run build graph on the cluster",
+	Long:  "Run build graph on the cluster. Graph is read from the file, or from stdin if file is not set or is -.",
+	Args:  cobra.MaximumNArgs(1),
+	RunE:  runBuild,
+}
+
+func init() {
+	c := &config.Build
+	flags := buildCmd.Flags()
+	flags.StringVar(&c.Coordinator, "coordinator", c.Coordinator, "URL of the coordinator")
+	flags.StringVar(&c.SourceDir, "source-dir", c.SourceDir, "directory with the source files of the graph")
+	flags.StringVar(&c.Tenant, "tenant", c.Tenant, "tenant of the build")
+	flags.StringVar(&c.Token, "token", c.Token, "token of the tenant")
+
+	rootCmd.AddCommand(buildCmd)
+}
+
+func readGraph(path string) (build.Graph, error) {
+	var graph build.Graph
+
+	in := io.Reader(os.Stdin)
+	if path != "" && path != "-" {
+		f, err := os.Open(path)
+		if err != nil {
+			return graph, err
+		}
+		defer f.Close()
+		in = f
+	}
+
+	if err := json.NewDecoder(in).Decode(&graph); err != nil {
+		return graph, fmt.Errorf("read graph: %w", err)
+	}
+	return graph, nil
+}
+
+func runBuild(cmd *cobra.Command, args []string) error {
+	c := &config.Build
+
+	var path string
+	if len(args) == 1 {
+		path = args[0]
+	}
+
+	graph, err := readGraph(path)
+	if err != nil {
+		return err
+	}
+
+	log, err := newLogger()
+	if err != nil {
+		return err
+	}
+	defer func() { _ = log.Sync() }()
+
+	cl := client.NewClient(log.Named("client"), c.Coordinator, c.SourceDir)
+	cl.SetTenant(c.Tenant, c.Token)
+
+	lsn := &buildListener{graph: &graph, stdout: cmd.OutOrStdout(), stderr: cmd.ErrOrStderr()}
+	if err := cl.Build(cmd.Context(), graph, lsn); err != nil {
+		return err
+	}
+
+	if lsn.failed != 0 {
+		return fmt.Errorf("%d jobs failed", lsn.failed)
+	}
+	return nil
+}
+
+// buildListener prints output of the jobs as it arrives.
+type buildListener struct {
+	graph  *build.Graph
+	stdout io.Writer
+	stderr io.Writer
+
+	failed int
+}
+
+func (l *buildListener) jobName(jobID build.ID) string {
+	for i := range l.graph.Jobs {
+		if l.graph.Jobs[i].ID == jobID && l.graph.Jobs[i].Name != "" {
+			return l.graph.Jobs[i].Name
+		}
+	}
+	return jobID.String()
+}
+
+func (l *buildListener) OnJobStdout(jobID build.ID, stdout []byte) error {
+	_, err := l.stdout.Write(stdout)
+	return err
+}
+
+func (l *buildListener) OnJobStderr(jobID build.ID, stderr []byte) error {
+	_, err := l.stderr.Write(stderr)
+	return err
+}
+
+func (l *buildListener) OnJobFinished(jobID build.ID) error {
+	_, err := fmt.Fprintf(l.stderr, "ok   %s\n", l.jobName(jobID))
+	return err
+}
+
+func (l *buildListener) OnJobFailed(jobID build.ID, code int, error string) error {
+	l.failed++
+
+	msg := fmt.Sprintf("exit code %d", code)
+	if error != "" {
+		msg = error
+	}
+	_, err := fmt.Fprintf(l.stderr, "FAIL %s: %s\n", l.jobName(jobID), msg)
+	return err
+}
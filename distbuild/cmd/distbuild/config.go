@@ -0,0 +1,175 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+	"gopkg.in/yaml.v2"
+
+	"gitlab.com/slon/shad-go/distbuild/pkg/dist"
+	"gitlab.com/slon/shad-go/distbuild/pkg/scheduler"
+	"gitlab.com/slon/shad-go/distbuild/pkg/worker"
+)
+
+// Config is the content of the YAML config. Every subcommand reads its own section.
+type Config struct {
+	Coordinator CoordinatorConfig `yaml:"coordinator"`
+	Worker      WorkerConfig      `yaml:"worker"`
+	Build       BuildConfig       `yaml:"build"`
+}
+
+type CoordinatorConfig struct {
+	// Listen is the address of the HTTP server.
+	Listen   string `yaml:"listen"`
+	CacheDir string `yaml:"cache_dir"`
+	Journal  string `yaml:"journal"`
+	TraceDir string `yaml:"trace_dir"`
+
+	Scheduler SchedulerConfig         `yaml:"scheduler"`
+	Tenants   map[string]TenantConfig `yaml:"tenants"`
+
+	// AdminToken is required by /admin endpoints. Admin endpoints are disabled when it is empty.
+	AdminToken string `yaml:"admin_token"`
+}
+
+type SchedulerConfig struct {
+	CacheTimeout        time.Duration `yaml:"cache_timeout"`
+	DepsTimeout         time.Duration `yaml:"deps_timeout"`
+	HeartbeatTimeout    time.Duration `yaml:"heartbeat_timeout"`
+	MaxAttempts         int           `yaml:"max_attempts"`
+	QuarantineThreshold int           `yaml:"quarantine_threshold"`
+	QuarantineDuration  time.Duration `yaml:"quarantine_duration"`
+}
+
+type TenantConfig struct {
+	Weight         float64 `yaml:"weight"`
+	MaxRunningJobs int     `yaml:"max_running_jobs"`
+
+	// Token is required from the clients of the tenant. If no tenant has a token, tokens are not checked.
+	Token string `yaml:"token"`
+}
+
+type WorkerConfig struct {
+	Listen string `yaml:"listen"`
+	// Endpoint is the URL of the worker, reachable by the coordinator and other workers. It is also the worker ID.
+	Endpoint    string `yaml:"endpoint"`
+	Coordinator string `yaml:"coordinator"`
+	CacheDir    string `yaml:"cache_dir"`
+	Slots       int    `yaml:"slots"`
+
+	// CacheQuota limits total size of the artifacts in bytes. Zero means no limit.
+	CacheQuota int64 `yaml:"cache_quota"`
+
+	CPUTime  time.Duration `yaml:"cpu_time"`
+	WallTime time.Duration `yaml:"wall_time"`
+	Memory   int64         `yaml:"memory"`
+	Cgroup   string        `yaml:"cgroup"`
+}
+
+type BuildConfig struct {
+	Coordinator string `yaml:"coordinator"`
+	SourceDir   string `yaml:"source_dir"`
+	Tenant      string `yaml:"tenant"`
+	Token       string `yaml:"token"`
+}
+
+// config holds defaults, overridden by the config file and then by the flags.
+var config = Config{
+	Coordinator: CoordinatorConfig{
+		Listen:   ":8080",
+		CacheDir: "coordinator",
+		Scheduler: SchedulerConfig{
+			CacheTimeout:        dist.DefaultSchedulerConfig.CacheTimeout,
+			DepsTimeout:         dist.DefaultSchedulerConfig.DepsTimeout,
+			HeartbeatTimeout:    dist.DefaultSchedulerConfig.HeartbeatTimeout,
+			MaxAttempts:         dist.DefaultSchedulerConfig.MaxAttempts,
+			QuarantineThreshold: dist.DefaultSchedulerConfig.QuarantineThreshold,
+			QuarantineDuration:  dist.DefaultSchedulerConfig.QuarantineDuration,
+		},
+	},
+	Worker: WorkerConfig{
+		Listen:      ":8081",
+		Endpoint:    "http://localhost:8081",
+		Coordinator: "http://localhost:8080",
+		CacheDir:    "worker",
+		Slots:       1,
+	},
+	Build: BuildConfig{
+		Coordinator: "http://localhost:8080",
+		SourceDir:   ".",
+	},
+}
+
+// loadConfig reads the config file into config.
+//
+// Flags are bound to the fields of config, so values of the flags set on the command line are saved
+// before reading the file and applied again after it.
+func loadConfig(cmd *cobra.Command) error {
+	if rootFlags.config == "" {
+		return nil
+	}
+
+	changed := map[string]string{}
+	cmd.Flags().Visit(func(f *pflag.Flag) {
+		changed[f.Name] = f.Value.String()
+	})
+
+	content, err := os.ReadFile(rootFlags.config)
+	if err != nil {
+		return err
+	}
+
+	if err := yaml.UnmarshalStrict(content, &config); err != nil {
+		return fmt.Errorf("parse config %s: %w", rootFlags.config, err)
+	}
+
+	for name, value := range changed {
+		if err := cmd.Flags().Set(name, value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (c *SchedulerConfig) bindFlags(flags *pflag.FlagSet) {
+	flags.DurationVar(&c.CacheTimeout, "cache-timeout", c.CacheTimeout, "how long job waits for the worker that has its result cached")
+	flags.DurationVar(&c.DepsTimeout, "deps-timeout", c.DepsTimeout, "how long job waits for the worker that has its dependencies")
+	flags.DurationVar(&c.HeartbeatTimeout, "heartbeat-timeout", c.HeartbeatTimeout, "silence after which worker is considered lost")
+	flags.IntVar(&c.MaxAttempts, "max-attempts", c.MaxAttempts, "number of attempts of the job failed with transient error")
+	flags.IntVar(&c.QuarantineThreshold, "quarantine-threshold", c.QuarantineThreshold, "consecutive transient failures after which worker is quarantined")
+	flags.DurationVar(&c.QuarantineDuration, "quarantine-duration", c.QuarantineDuration, "how long quarantined worker gets no jobs")
+}
+
+func (c *SchedulerConfig) scheduler() scheduler.Config {
+	return scheduler.Config{
+		CacheTimeout:        c.CacheTimeout,
+		DepsTimeout:         c.DepsTimeout,
+		HeartbeatTimeout:    c.HeartbeatTimeout,
+		MaxAttempts:         c.MaxAttempts,
+		QuarantineThreshold: c.QuarantineThreshold,
+		QuarantineDuration:  c.QuarantineDuration,
+	}
+}
+
+func (c *CoordinatorConfig) tenants() (map[string]scheduler.TenantConfig, dist.TokenValidator) {
+	tenants := make(map[string]scheduler.TenantConfig, len(c.Tenants))
+	tokens := dist.StaticTokens{}
+	for name, tenant := range c.Tenants {
+		tenants[name] = scheduler.TenantConfig{Weight: tenant.Weight, MaxRunningJobs: tenant.MaxRunningJobs}
+		if tenant.Token != "" {
+			tokens[name] = tenant.Token
+		}
+	}
+
+	if len(tokens) == 0 {
+		return tenants, nil
+	}
+	return tenants, tokens
+}
+
+func (c *WorkerConfig) limits() worker.Limits {
+	return worker.Limits{CPUTime: c.CPUTime, WallTime: c.WallTime, Memory: c.Memory, Cgroup: c.Cgroup}
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"gitlab.com/slon/shad-go/distbuild/pkg/dist"
+	"gitlab.com/slon/shad-go/distbuild/pkg/scheduler"
+)
+
+func TestLoadConfig(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	require.NoError(t, os.WriteFile(path, []byte(`
+coordinator:
+  listen: :9000
+  cache_dir: /var/cache/distbuild
+  scheduler:
+    heartbeat_timeout: 30s
+  tenants:
+    team-a:
+      weight: 2
+      token: secret
+    team-b:
+      max_running_jobs: 10
+  admin_token: admin-secret
+`), 0666))
+
+	defer func(saved Config) { config = saved }(config)
+	rootFlags.config = path
+	defer func() { rootFlags.config = "" }()
+
+	require.NoError(t, coordinatorCmd.ParseFlags([]string{"--listen", ":9001", "--max-attempts", "5"}))
+	require.NoError(t, loadConfig(coordinatorCmd))
+
+	c := config.Coordinator
+	require.Equal(t, ":9001", c.Listen)
+	require.Equal(t, "/var/cache/distbuild", c.CacheDir)
+
+	expected := dist.DefaultSchedulerConfig
+	expected.HeartbeatTimeout = 30 * time.Second
+	expected.MaxAttempts = 5
+	require.Equal(t, expected, c.Scheduler.scheduler())
+
+	tenants, tokens := c.tenants()
+	require.Equal(t, map[string]scheduler.TenantConfig{
+		"team-a": {Weight: 2},
+		"team-b": {MaxRunningJobs: 10},
+	}, tenants)
+	require.Equal(t, dist.StaticTokens{"team-a": "secret"}, tokens)
+	require.Equal(t, "admin-secret", c.AdminToken)
+}
+
+func TestLoadConfigUnknownField(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	require.NoError(t, os.WriteFile(path, []byte("worker:\n  slot: 4\n"), 0666))
+
+	defer func(saved Config) { config = saved }(config)
+	rootFlags.config = path
+	defer func() { rootFlags.config = "" }()
+
+	require.Error(t, loadConfig(workerCmd))
+}
+
+func TestLoadWorkerConfig(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	require.NoError(t, os.WriteFile(path, []byte("worker:\n  cache_quota: 1024\n  slots: 4\n"), 0666))
+
+	defer func(saved Config) { config = saved }(config)
+	rootFlags.config = path
+	defer func() { rootFlags.config = "" }()
+
+	require.NoError(t, workerCmd.ParseFlags([]string{"--cache-quota", "2048"}))
+	require.NoError(t, loadConfig(workerCmd))
+
+	require.Equal(t, int64(2048), config.Worker.CacheQuota)
+	require.Equal(t, 4, config.Worker.Slots)
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"github.com/spf13/cobra"
+	"go.uber.org/zap"
+
+	"gitlab.com/slon/shad-go/distbuild/pkg/dist"
+	"gitlab.com/slon/shad-go/distbuild/pkg/filecache"
+)
+
+var coordinatorCmd = &cobra.Command{
+	Use:   "coordinator",
+	Short: "run coordinator",
+	Args:  cobra.NoArgs,
+	RunE:  runCoordinator,
+}
+
+func init() {
+	c := &config.Coordinator
+	flags := coordinatorCmd.Flags()
+	flags.StringVar(&c.Listen, "listen", c.Listen, "address of the HTTP server")
+	flags.StringVar(&c.CacheDir, "cache-dir", c.CacheDir, "directory of the source file cache")
+	flags.StringVar(&c.Journal, "journal", c.Journal, "path of the journal; builds are resumed after restart if set")
+	flags.StringVar(&c.TraceDir, "trace-dir", c.TraceDir, "directory for traces of the finished builds")
+	c.Scheduler.bindFlags(flags)
+
+	rootCmd.AddCommand(coordinatorCmd)
+}
+
+func runCoordinator(cmd *cobra.Command, args []string) error {
+	c := &config.Coordinator
+
+	log, err := newLogger()
+	if err != nil {
+		return err
+	}
+	defer func() { _ = log.Sync() }()
+
+	fileCache, err := filecache.New(c.CacheDir)
+	if err != nil {
+		return err
+	}
+
+	tenants, tokens := c.tenants()
+	coordinator, err := dist.OpenCoordinator(log.Named("coordinator"), fileCache, dist.Config{
+		Scheduler:   c.Scheduler.scheduler(),
+		JournalPath: c.Journal,
+		TraceDir:    c.TraceDir,
+		Tenants:     tenants,
+		Tokens:      tokens,
+		AdminToken:  c.AdminToken,
+	})
+	if err != nil {
+		return err
+	}
+	defer coordinator.Stop()
+
+	log.Info("coordinator started", zap.String("cache_dir", c.CacheDir), zap.String("journal", c.Journal))
+	return serve(cmd.Context(), log, c.Listen, coordinator)
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+
+	"github.com/spf13/cobra"
+
+	"gitlab.com/slon/shad-go/distbuild/pkg/plan"
+)
+
+var planFlags struct {
+	goBinary string
+	output   string
+}
+
+var planCmd = &cobra.Command{
+	Use:   "plan [module-dir]",
+	Short: "generate build graph for go module",
+	Args:  cobra.MaximumNArgs(1),
+	RunE:  runPlan,
+}
+
+func init() {
+	planCmd.Flags().StringVar(&planFlags.goBinary, "go", "go", "go binary used by the build jobs")
+	planCmd.Flags().StringVarP(&planFlags.output, "output", "o", "", "write graph to file instead of stdout")
+
+	rootCmd.AddCommand(planCmd)
+}
+
+func runPlan(cmd *cobra.Command, args []string) error {
+	moduleDir := "."
+	if len(args) == 1 {
+		moduleDir = args[0]
+	}
+
+	graph, err := plan.Generate(cmd.Context(), moduleDir, plan.Options{GoBinary: planFlags.goBinary})
+	if err != nil {
+		return err
+	}
+
+	out := os.Stdout
+	if planFlags.output != "" {
+		f, err := os.Create(planFlags.output)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		out = f
+	}
+
+	enc := json.NewEncoder(out)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(graph); err != nil {
+		return err
+	}
+
+	if out != os.Stdout {
+		return out.Close()
+	}
+	return nil
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+
+	"github.com/spf13/cobra"
+	"go.uber.org/zap"
+	"golang.org/x/sync/errgroup"
+
+	"gitlab.com/slon/shad-go/distbuild/pkg/api"
+	"gitlab.com/slon/shad-go/distbuild/pkg/artifact"
+	"gitlab.com/slon/shad-go/distbuild/pkg/filecache"
+	"gitlab.com/slon/shad-go/distbuild/pkg/worker"
+)
+
+var workerCmd = &cobra.Command{
+	Use:   "worker",
+	Short: "run worker",
+	Args:  cobra.NoArgs,
+	RunE:  runWorker,
+}
+
+func init() {
+	c := &config.Worker
+	flags := workerCmd.Flags()
+	flags.StringVar(&c.Listen, "listen", c.Listen, "address of the HTTP server")
+	flags.StringVar(&c.Endpoint, "endpoint", c.Endpoint, "URL of the worker, reachable by the coordinator and other workers")
+	flags.StringVar(&c.Coordinator, "coordinator", c.Coordinator, "URL of the coordinator")
+	flags.StringVar(&c.CacheDir, "cache-dir", c.CacheDir, "directory of the file and artifact caches")
+	flags.IntVar(&c.Slots, "slots", c.Slots, "number of jobs running at the same time")
+	flags.Int64Var(&c.CacheQuota, "cache-quota", c.CacheQuota, "total size of the cached artifacts in bytes, least recently used are evicted; 0 means no limit")
+	flags.DurationVar(&c.CPUTime, "cpu-time", c.CPUTime, "CPU time limit of every job")
+	flags.DurationVar(&c.WallTime, "wall-time", c.WallTime, "duration limit of every job")
+	flags.Int64Var(&c.Memory, "memory", c.Memory, "resident memory limit of every job, in bytes")
+	flags.StringVar(&c.Cgroup, "cgroup", c.Cgroup, "cgroup v2 directory delegated to the worker, jobs run in its child cgroups")
+
+	rootCmd.AddCommand(workerCmd)
+}
+
+func runWorker(cmd *cobra.Command, args []string) error {
+	c := &config.Worker
+
+	log, err := newLogger()
+	if err != nil {
+		return err
+	}
+	defer func() { _ = log.Sync() }()
+
+	fileCache, err := filecache.New(filepath.Join(c.CacheDir, "filecache"))
+	if err != nil {
+		return err
+	}
+
+	artifacts, err := artifact.NewCacheWithQuota(filepath.Join(c.CacheDir, "artifacts"), c.CacheQuota)
+	if err != nil {
+		return err
+	}
+
+	w := worker.New(api.WorkerID(c.Endpoint), c.Coordinator, log.Named("worker"), fileCache, artifacts)
+	w.SetSlots(c.Slots)
+	w.SetLimits(c.limits())
+
+	log.Info("worker started", zap.String("endpoint", c.Endpoint), zap.String("coordinator", c.Coordinator))
+
+	g, ctx := errgroup.WithContext(cmd.Context())
+	g.Go(func() error {
+		return serve(ctx, log, c.Listen, w)
+	})
+	g.Go(func() error {
+		err := w.Run(ctx)
+		if errors.Is(err, context.Canceled) {
+			return nil
+		}
+		return err
+	})
+	return g.Wait()
+}
@@ -0,0 +1,79 @@
+package disttest
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"gitlab.com/slon/shad-go/distbuild/pkg/build"
+)
+
+// metricValue returns value of the metric from the text exposition format.
+func metricValue(t *testing.T, metrics, name string) float64 {
+	t.Helper()
+
+	s := bufio.NewScanner(strings.NewReader(metrics))
+	for s.Scan() {
+		if value, ok := strings.CutPrefix(s.Text(), name+" "); ok {
+			v, err := strconv.ParseFloat(value, 64)
+			require.NoError(t, err)
+			return v
+		}
+	}
+	return 0
+}
+
+func TestChunkedUpload(t *testing.T) {
+	env := newEnv(t, singleWorkerConfig)
+
+	// Source file is too large to be stored in the repository, so it is generated by the test.
+	sourceDir := filepath.Join("testdata", t.Name())
+	require.NoError(t, os.MkdirAll(sourceDir, 0777))
+	t.Cleanup(func() { _ = os.RemoveAll(sourceDir) })
+
+	var lines []string
+	for i := 0; i < 100000; i++ {
+		lines = append(lines, fmt.Sprintf("line %d\n", i))
+	}
+
+	const uploaded = `distbuild_http_received_bytes_total{handler="PUT /file"}`
+
+	checksum := func(i int, content string) float64 {
+		require.NoError(t, os.WriteFile(filepath.Join(sourceDir, "big.txt"), []byte(content), 0666))
+
+		graph := build.Graph{
+			SourceFiles: map[build.ID]string{{'f', byte(i)}: "big.txt"},
+			Jobs: []build.Job{
+				{
+					ID:     build.ID{'a', byte(i)},
+					Name:   "sha1sum",
+					Inputs: []string{"big.txt"},
+					Cmds: []build.Cmd{
+						{Exec: []string{"bash", "-c", `sha1sum < "$1"`, "bash", "{{.SourceDir}}/big.txt"}},
+					},
+				},
+			},
+		}
+
+		before := metricValue(t, scrape(t, env.Coordinator), uploaded)
+
+		recorder := NewRecorder()
+		require.NoError(t, env.Client.Build(env.Ctx, graph, recorder))
+		require.Equal(t, fmt.Sprintf("%x  -\n", sha1.Sum([]byte(content))), recorder.Jobs[build.ID{'a', byte(i)}].Stdout)
+
+		return metricValue(t, scrape(t, env.Coordinator), uploaded) - before
+	}
+
+	content := strings.Join(lines, "")
+	require.GreaterOrEqual(t, checksum(0, content), float64(len(content)))
+
+	lines[len(lines)/2] = "changed line\n"
+	require.Less(t, checksum(1, strings.Join(lines, "")), float64(len(content)/4))
+}
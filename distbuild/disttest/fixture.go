@@ -21,6 +21,7 @@ import (
 	"gitlab.com/slon/shad-go/distbuild/pkg/client"
 	"gitlab.com/slon/shad-go/distbuild/pkg/dist"
 	"gitlab.com/slon/shad-go/distbuild/pkg/filecache"
+	"gitlab.com/slon/shad-go/distbuild/pkg/scheduler"
 	"gitlab.com/slon/shad-go/distbuild/pkg/worker"
 	"gitlab.com/slon/shad-go/tools/testtool"
 
@@ -38,6 +39,9 @@ type env struct {
 	Workers     []*worker.Worker
 	WorkerCache []*artifact.Cache
 
+	// TraceDir is the directory with build traces, if Config.TraceBuilds is set.
+	TraceDir string
+
 	HTTP *http.Server
 }
 
@@ -47,6 +51,17 @@ const (
 
 type Config struct {
 	WorkerCount int
+
+	// WorkerLimits sets resource limits of the jobs on every worker.
+	WorkerLimits worker.Limits
+
+	// TraceBuilds enables writing of build traces into env.TraceDir.
+	TraceBuilds bool
+
+	// Tenants, Tokens and AdminToken are passed to the coordinator config.
+	Tenants    map[string]scheduler.TenantConfig
+	Tokens     dist.TokenValidator
+	AdminToken string
 }
 
 func newEnv(t *testing.T, config *Config) (e *env) {
@@ -117,10 +132,21 @@ func newEnv(t *testing.T, config *Config) (e *env) {
 	coordinatorCache, err := filecache.New(filepath.Join(env.RootDir, "coordinator", "filecache"))
 	require.NoError(t, err)
 
-	env.Coordinator = dist.NewCoordinator(
+	if config.TraceBuilds {
+		env.TraceDir = filepath.Join(env.RootDir, "coordinator", "traces")
+	}
+
+	env.Coordinator, err = dist.OpenCoordinator(
 		env.Logger.Named("coordinator"),
 		coordinatorCache,
+		dist.Config{
+			TraceDir:   env.TraceDir,
+			Tenants:    config.Tenants,
+			Tokens:     config.Tokens,
+			AdminToken: config.AdminToken,
+		},
 	)
+	require.NoError(t, err)
 	t.Cleanup(env.Coordinator.Stop)
 
 	router := http.NewServeMux()
@@ -148,6 +174,7 @@ func newEnv(t *testing.T, config *Config) (e *env) {
 			fileCache,
 			artifacts,
 		)
+		w.SetLimits(config.WorkerLimits)
 
 		env.Workers = append(env.Workers, w)
 		env.WorkerCache = append(env.WorkerCache, artifacts)
@@ -0,0 +1,14 @@
+package disttest
+
+import (
+	"os"
+	"testing"
+
+	"gitlab.com/slon/shad-go/distbuild/pkg/worker"
+)
+
+func TestMain(m *testing.M) {
+	worker.MaybeRunSandboxExec()
+
+	os.Exit(m.Run())
+}
@@ -0,0 +1,103 @@
+package disttest
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"gitlab.com/slon/shad-go/distbuild/pkg/build"
+	"gitlab.com/slon/shad-go/distbuild/pkg/trace"
+)
+
+func scrape(t *testing.T, h http.Handler) string {
+	t.Helper()
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	require.Equal(t, http.StatusOK, rec.Code)
+	return rec.Body.String()
+}
+
+func TestMetrics(t *testing.T) {
+	env := newEnv(t, singleWorkerConfig)
+
+	graph := build.Graph{
+		SourceFiles: map[build.ID]string{{'a'}: "a.txt"},
+		Jobs: []build.Job{
+			{
+				ID:     build.ID{'a'},
+				Name:   "cat",
+				Inputs: []string{"a.txt"},
+				Cmds: []build.Cmd{
+					{Exec: []string{"cat", "{{.SourceDir}}/a.txt"}},
+				},
+			},
+		},
+	}
+
+	require.NoError(t, env.Client.Build(env.Ctx, graph, NewRecorder()))
+
+	coordinator := scrape(t, env.Coordinator)
+	require.Contains(t, coordinator, `distbuild_scheduler_jobs_total{cache="miss"} 1`)
+	require.Contains(t, coordinator, `distbuild_scheduler_queue_length{queue="global"} 0`)
+	require.Contains(t, coordinator, `distbuild_job_duration_seconds_count{status="ok"} 1`)
+	require.Contains(t, coordinator, `distbuild_builds_total{status="finished"} 1`)
+	require.Contains(t, coordinator, `distbuild_http_received_bytes_total{handler="PUT /file"} 3`)
+	require.Contains(t, coordinator, `distbuild_http_sent_bytes_total{handler="GET /file"} 3`)
+	require.Contains(t, coordinator, `distbuild_heartbeat_duration_seconds_count`)
+
+	worker := scrape(t, env.Workers[0])
+	require.Contains(t, worker, `distbuild_worker_job_duration_seconds_count{status="ok"} 1`)
+	require.Contains(t, worker, `distbuild_worker_slots 1`)
+	require.Contains(t, worker, `distbuild_worker_heartbeat_duration_seconds_count`)
+}
+
+func TestBuildTrace(t *testing.T) {
+	env := newEnv(t, &Config{WorkerCount: 1, TraceBuilds: true})
+
+	require.NoError(t, env.Client.Build(env.Ctx, artifactTransferGraph, NewRecorder()))
+
+	// Trace is written by the coordinator after the final status is sent to the client.
+	var files []string
+	require.Eventually(t, func() bool {
+		files, _ = filepath.Glob(filepath.Join(env.TraceDir, "*.json"))
+		return len(files) == 1
+	}, time.Second, 10*time.Millisecond)
+
+	content, err := os.ReadFile(files[0])
+	require.NoError(t, err)
+
+	var file struct {
+		TraceID string       `json:"traceId"`
+		Spans   []trace.Span `json:"spans"`
+	}
+	require.NoError(t, json.Unmarshal(content, &file))
+
+	spans := map[string]trace.Span{}
+	for _, span := range file.Spans {
+		require.Equal(t, file.TraceID, span.TraceID)
+		spans[span.Name] = span
+	}
+	require.Len(t, spans, 4)
+
+	root := spans["build"]
+	require.Empty(t, root.ParentSpanID)
+	require.Equal(t, trace.StatusOK, root.Status)
+
+	for _, name := range []string{"upload", "job write", "job cat"} {
+		span, ok := spans[name]
+		require.True(t, ok, name)
+		require.Equal(t, root.SpanID, span.ParentSpanID)
+		require.Equal(t, trace.StatusOK, span.Status)
+		require.LessOrEqual(t, span.StartTimeUnixNano, span.EndTimeUnixNano)
+	}
+
+	require.Equal(t, build.ID{'b'}.String(), spans["job cat"].Attributes["job_id"])
+	require.LessOrEqual(t, spans["job write"].EndTimeUnixNano, spans["job cat"].StartTimeUnixNano)
+}
@@ -0,0 +1,66 @@
+package disttest
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"gitlab.com/slon/shad-go/distbuild/pkg/build"
+	"gitlab.com/slon/shad-go/distbuild/pkg/worker"
+)
+
+// streamingRecorder unblocks the job as soon as the first line of its output is received.
+type streamingRecorder struct {
+	*Recorder
+	unblock string
+}
+
+func (r *streamingRecorder) OnJobStdout(jobID build.ID, stdout []byte) error {
+	if err := r.Recorder.OnJobStdout(jobID, stdout); err != nil {
+		return err
+	}
+
+	if r.Jobs[jobID].Code == nil && strings.HasPrefix(r.Jobs[jobID].Stdout, "first\n") {
+		return os.WriteFile(r.unblock, nil, 0666)
+	}
+	return nil
+}
+
+func TestStreamingOutput(t *testing.T) {
+	env := newEnv(t, singleWorkerConfig)
+
+	unblock := filepath.Join(env.RootDir, "unblock")
+
+	// Job waits until the client receives the first line, so the build finishes only if the output is streamed.
+	script := `echo first; for i in $(seq 500); do [ -f "$1" ] && echo second && exit 0; sleep 0.01; done; echo timeout`
+	graph := build.Graph{
+		Jobs: []build.Job{
+			{
+				ID:   build.ID{'a'},
+				Name: "stream",
+				Cmds: []build.Cmd{
+					{Exec: []string{"bash", "-c", script, "bash", unblock}},
+				},
+			},
+		},
+	}
+
+	recorder := &streamingRecorder{Recorder: NewRecorder(), unblock: unblock}
+	require.NoError(t, env.Client.Build(env.Ctx, graph, recorder))
+
+	assert.Equal(t, &JobResult{Stdout: "first\nsecond\n", Code: new(int)}, recorder.Jobs[build.ID{'a'}])
+}
+
+func TestOutputLimit(t *testing.T) {
+	config := &Config{
+		WorkerCount:  1,
+		WorkerLimits: worker.Limits{Output: 10},
+	}
+
+	res := runSingleJob(t, config, build.Cmd{Exec: []string{"bash", "-c", "printf '%0100d' 0"}})
+	assert.Equal(t, &JobResult{Stdout: "0000000000\n[output truncated]\n", Code: new(int)}, res)
+}
@@ -0,0 +1,105 @@
+package disttest
+
+import (
+	"os"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"gitlab.com/slon/shad-go/distbuild/pkg/build"
+	"gitlab.com/slon/shad-go/distbuild/pkg/worker"
+)
+
+var limitedWorkerConfig = &Config{
+	WorkerCount: 1,
+	WorkerLimits: worker.Limits{
+		CPUTime:  time.Second,
+		Memory:   64 << 20,
+		WallTime: time.Second * 3,
+	},
+}
+
+func runSingleJob(t *testing.T, config *Config, cmds ...build.Cmd) *JobResult {
+	env := newEnv(t, config)
+
+	graph := build.Graph{
+		Jobs: []build.Job{
+			{ID: build.ID{'a'}, Name: "job", Cmds: cmds},
+		},
+	}
+
+	recorder := NewRecorder()
+	_ = env.Client.Build(env.Ctx, graph, recorder)
+
+	require.Contains(t, recorder.Jobs, build.ID{'a'})
+	return recorder.Jobs[build.ID{'a'}]
+}
+
+func TestSandboxEnviron(t *testing.T) {
+	t.Setenv("DISTBUILD_LEAK", "1")
+
+	res := runSingleJob(t, singleWorkerConfig, build.Cmd{Exec: []string{"env"}, Environ: []string{"FOO=bar", "HOME=/nonexistent"}})
+	require.Equal(t, 0, *res.Code)
+
+	env := strings.Split(strings.TrimSpace(res.Stdout), "\n")
+	require.Len(t, env, 3)
+	assert.Equal(t, []string{"FOO=bar", "HOME=/nonexistent"}, env[:2])
+	assert.True(t, strings.HasPrefix(env[2], "TMPDIR="), env[2])
+}
+
+func TestSandboxPrivateDirs(t *testing.T) {
+	res := runSingleJob(t, singleWorkerConfig, build.Cmd{
+		Exec: []string{"bash", "-c", `touch "$TMPDIR/x" "$HOME/.cache" && dirname "$TMPDIR" && dirname "$HOME"`},
+	})
+	require.Equal(t, 0, *res.Code, res.Stderr)
+
+	dirs := strings.Fields(res.Stdout)
+	require.Len(t, dirs, 2)
+	assert.Equal(t, dirs[0], dirs[1], "TMPDIR and HOME are inside the job directory")
+	assert.NotEqual(t, os.TempDir(), dirs[0])
+}
+
+func TestSandboxWriteOutsideOutput(t *testing.T) {
+	res := runSingleJob(t, singleWorkerConfig, build.Cmd{CatTemplate: "x", CatOutput: "{{.SourceDir}}/x.txt"})
+	assert.Contains(t, res.Error, "write outside of output directory")
+}
+
+func TestSandboxWallTimeLimit(t *testing.T) {
+	res := runSingleJob(t, limitedWorkerConfig, build.Cmd{Exec: []string{"sleep", "60"}})
+	assert.Equal(t, "wall clock limit exceeded", res.Error)
+}
+
+func TestSandboxCPULimit(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("rlimits are applied only on linux")
+	}
+
+	res := runSingleJob(t, limitedWorkerConfig, build.Cmd{Exec: []string{"bash", "-c", "while :; do :; done"}})
+	assert.Equal(t, "cpu time limit exceeded", res.Error)
+}
+
+func TestSandboxCPULimitChildren(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("cpu time is accounted only on linux")
+	}
+
+	// Every child stays below the limit, but together they exceed it.
+	res := runSingleJob(t, limitedWorkerConfig, build.Cmd{
+		Exec: []string{"bash", "-c", "for i in 1 2 3 4; do bash -c 'while :; do :; done' & done; wait"},
+	})
+	assert.Equal(t, "cpu time limit exceeded", res.Error)
+}
+
+func TestSandboxMemoryLimit(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("memory is accounted only on linux")
+	}
+
+	// tail keeps the whole line in memory, and /dev/zero has no line breaks.
+	res := runSingleJob(t, limitedWorkerConfig, build.Cmd{Exec: []string{"tail", "/dev/zero"}})
+	assert.Equal(t, "memory limit exceeded", res.Error)
+}
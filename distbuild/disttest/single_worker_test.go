@@ -1,10 +1,16 @@
 package disttest
 
 import (
+	"context"
 	"fmt"
 	"io"
 	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -131,3 +137,114 @@ func TestArtifactTransferBetweenJobs(t *testing.T) {
 	assert.Len(t, recorder.Jobs, 2)
 	assert.Equal(t, &JobResult{Stdout: "OK", Code: new(int)}, recorder.Jobs[build.ID{'b'}])
 }
+
+func TestBuildCancel(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("test relies on /proc")
+	}
+
+	env := newEnv(t, singleWorkerConfig)
+
+	pidFile := filepath.Join(env.RootDir, "sleep.pid")
+	graph := build.Graph{
+		Jobs: []build.Job{
+			{
+				ID:   build.ID{'a'},
+				Name: "sleep",
+				Cmds: []build.Cmd{
+					{Exec: []string{"bash", "-c", fmt.Sprintf("sleep 60 & echo $! > %s; wait", pidFile)}},
+				},
+			},
+		},
+	}
+
+	ctx, cancel := context.WithCancel(env.Ctx)
+	defer cancel()
+
+	buildErr := make(chan error, 1)
+	go func() {
+		buildErr <- env.Client.Build(ctx, graph, NewRecorder())
+	}()
+
+	var pid int
+	require.Eventually(t, func() bool {
+		content, err := os.ReadFile(pidFile)
+		if err != nil {
+			return false
+		}
+
+		pid, err = strconv.Atoi(strings.TrimSpace(string(content)))
+		return err == nil
+	}, time.Second*5, time.Millisecond*10)
+
+	cancel()
+	require.ErrorIs(t, <-buildErr, context.Canceled)
+
+	// Grandchild process of the job must be killed too.
+	require.Eventually(t, func() bool {
+		stat, err := os.ReadFile(fmt.Sprintf("/proc/%d/stat", pid))
+		if err != nil {
+			return true
+		}
+
+		fields := strings.Fields(string(stat))
+		return len(fields) > 2 && fields[2] == "Z"
+	}, time.Second*5, time.Millisecond*10)
+}
+
+func TestCachedBuildReplaysOutput(t *testing.T) {
+	env := newEnv(t, singleWorkerConfig)
+
+	graph := build.Graph{
+		SourceFiles: map[build.ID]string{
+			{'a'}: "a.txt",
+		},
+		Jobs: []build.Job{
+			{
+				ID:     build.ID{'a'},
+				Name:   "cat",
+				Inputs: []string{"a.txt"},
+				Cmds: []build.Cmd{
+					{Exec: []string{"cat", "{{.SourceDir}}/a.txt"}},
+					{Exec: []string{"bash", "-c", "echo ERR > /dev/stderr"}},
+					{CatTemplate: "OK", CatOutput: "{{.OutputDir}}/out.txt"},
+				},
+			},
+			{
+				ID:   build.ID{'b'},
+				Name: "cat dep",
+				Deps: []build.ID{{'a'}},
+				Cmds: []build.Cmd{
+					{Exec: []string{"cat", fmt.Sprintf("{{index .Deps %q}}/out.txt", build.ID{'a'})}},
+				},
+			},
+		},
+	}
+
+	first := NewRecorder()
+	require.NoError(t, env.Client.Build(env.Ctx, graph, first))
+
+	second := NewRecorder()
+	require.NoError(t, env.Client.Build(env.Ctx, graph, second))
+
+	require.Equal(t, first.Jobs, second.Jobs)
+	assert.Equal(t, &JobResult{Stdout: "foo\n", Stderr: "ERR\n", Code: new(int)}, second.Jobs[build.ID{'a'}])
+	assert.Equal(t, &JobResult{Stdout: "OK", Code: new(int)}, second.Jobs[build.ID{'b'}])
+}
+
+func TestInvalidGraphRejected(t *testing.T) {
+	env := newEnv(t, singleWorkerConfig)
+
+	graph := build.Graph{
+		Jobs: []build.Job{
+			{ID: build.ID{'a'}, Name: "a", Deps: []build.ID{{'b'}}, Cmds: []build.Cmd{{Exec: []string{"echo", "a"}}}},
+			{ID: build.ID{'b'}, Name: "b", Deps: []build.ID{{'a'}}, Cmds: []build.Cmd{{Exec: []string{"echo", "b"}}}},
+		},
+	}
+
+	recorder := NewRecorder()
+	err := env.Client.Build(env.Ctx, graph, recorder)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "dependency cycle: a -> b -> a")
+	require.Empty(t, recorder.Jobs)
+}
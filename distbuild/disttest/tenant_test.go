@@ -0,0 +1,174 @@
+package disttest
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"gitlab.com/slon/shad-go/distbuild/pkg/api"
+	"gitlab.com/slon/shad-go/distbuild/pkg/build"
+	"gitlab.com/slon/shad-go/distbuild/pkg/dist"
+	"gitlab.com/slon/shad-go/distbuild/pkg/scheduler"
+)
+
+func TestTenantToken(t *testing.T) {
+	env := newEnv(t, &Config{
+		WorkerCount: 1,
+		Tokens:      dist.StaticTokens{"team-a": "secret"},
+	})
+
+	err := env.Client.Build(env.Ctx, echoGraph, NewRecorder())
+	require.ErrorContains(t, err, dist.ErrUnauthorized.Error())
+
+	env.Client.SetTenant("team-a", "wrong")
+	err = env.Client.Build(env.Ctx, echoGraph, NewRecorder())
+	require.ErrorContains(t, err, dist.ErrUnauthorized.Error())
+
+	env.Client.SetTenant("team-a", "secret")
+	require.NoError(t, env.Client.Build(env.Ctx, echoGraph, NewRecorder()))
+}
+
+func TestUnknownTenant(t *testing.T) {
+	env := newEnv(t, &Config{
+		WorkerCount: 1,
+		Tenants:     map[string]scheduler.TenantConfig{"team-a": {Weight: 2}},
+	})
+
+	env.Client.SetTenant("team-b", "")
+	err := env.Client.Build(env.Ctx, echoGraph, NewRecorder())
+	require.ErrorContains(t, err, dist.ErrUnknownTenant.Error())
+
+	env.Client.SetTenant("team-a", "")
+	require.NoError(t, env.Client.Build(env.Ctx, echoGraph, NewRecorder()))
+}
+
+func TestTenantBuildAccess(t *testing.T) {
+	env := newEnv(t, &Config{
+		WorkerCount: 1,
+		Tokens:      dist.StaticTokens{"team-a": "secret-a", "team-b": "secret-b"},
+	})
+
+	c := api.NewBuildClient(env.Logger.Named("api"), "http://"+env.HTTP.Addr+"/coordinator")
+
+	started, r, err := c.StartBuild(env.Ctx, &api.BuildRequest{Graph: echoGraph, Tenant: "team-a", Token: "secret-a"})
+	require.NoError(t, err)
+	defer func() { _ = r.Close() }()
+
+	cancel := &api.SignalRequest{Tenant: "team-a", Token: "wrong", Cancel: &api.Cancel{}}
+	_, err = c.SignalBuild(env.Ctx, started.ID, cancel)
+	require.ErrorContains(t, err, dist.ErrUnauthorized.Error())
+
+	cancel.Tenant, cancel.Token = "team-b", "secret-b"
+	_, err = c.SignalBuild(env.Ctx, started.ID, cancel)
+	require.ErrorContains(t, err, "not found")
+
+	_, err = c.AttachBuild(env.Ctx, started.ID, &api.AttachRequest{Tenant: "team-b", Token: "secret-b"})
+	require.ErrorContains(t, err, "not found")
+
+	attached, err := c.AttachBuild(env.Ctx, started.ID, &api.AttachRequest{Tenant: "team-a", Token: "secret-a"})
+	require.NoError(t, err)
+	require.NoError(t, attached.Close())
+
+	cancel.Tenant, cancel.Token = "team-a", "secret-a"
+	_, err = c.SignalBuild(env.Ctx, started.ID, cancel)
+	require.NoError(t, err)
+
+	u, err := r.Next()
+	require.NoError(t, err)
+	require.NotNil(t, u.BuildFailed)
+}
+
+func getTenants(t *testing.T, h http.Handler) []dist.TenantStatus {
+	t.Helper()
+
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "/admin/tenants", nil)
+	req.Header.Set("Authorization", "Bearer admin-secret")
+	h.ServeHTTP(rec, req)
+	require.Equal(t, http.StatusOK, rec.Code)
+
+	var tenants []dist.TenantStatus
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &tenants))
+	return tenants
+}
+
+// tenantsRecorder checks tenants of the coordinator while the job is running, and then unblocks the job.
+type tenantsRecorder struct {
+	*Recorder
+	unblock string
+	check   func()
+}
+
+func (r *tenantsRecorder) OnJobStdout(jobID build.ID, stdout []byte) error {
+	if err := r.Recorder.OnJobStdout(jobID, stdout); err != nil {
+		return err
+	}
+
+	r.check()
+	return os.WriteFile(r.unblock, nil, 0666)
+}
+
+func TestAdminTenants(t *testing.T) {
+	env := newEnv(t, &Config{
+		WorkerCount: 1,
+		Tenants:     map[string]scheduler.TenantConfig{"team-a": {Weight: 3, MaxRunningJobs: 2}},
+		AdminToken:  "admin-secret",
+	})
+	env.Client.SetTenant("team-a", "")
+
+	unblock := filepath.Join(env.RootDir, "unblock")
+	script := `echo running; for i in $(seq 500); do [ -f "$1" ] && exit 0; sleep 0.01; done; exit 1`
+	graph := build.Graph{
+		Jobs: []build.Job{
+			{
+				ID:   build.ID{'a'},
+				Name: "wait",
+				Cmds: []build.Cmd{
+					{Exec: []string{"bash", "-c", script, "bash", unblock}},
+				},
+			},
+		},
+	}
+
+	var running []dist.TenantStatus
+	recorder := &tenantsRecorder{
+		Recorder: NewRecorder(),
+		unblock:  unblock,
+		check:    func() { running = getTenants(t, env.Coordinator) },
+	}
+	require.NoError(t, env.Client.Build(env.Ctx, graph, recorder))
+
+	require.Len(t, running, 1)
+	require.Equal(t, "team-a", running[0].Tenant)
+	require.Equal(t, 3.0, running[0].Weight)
+	require.Equal(t, 2, running[0].MaxRunningJobs)
+	require.Equal(t, 1.0, running[0].Share)
+	require.Equal(t, 1, running[0].Position)
+	require.Equal(t, 1, running[0].Running)
+	require.Equal(t, 1, running[0].Builds)
+
+	finished := getTenants(t, env.Coordinator)
+	require.Len(t, finished, 1)
+	require.Zero(t, finished[0].Position)
+	require.Zero(t, finished[0].Running)
+	require.Zero(t, finished[0].Builds)
+
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "/admin/tenants", nil)
+	req.Header.Set("Authorization", "Bearer wrong")
+	env.Coordinator.ServeHTTP(rec, req)
+	require.Equal(t, http.StatusUnauthorized, rec.Code)
+}
+
+func TestAdminDisabled(t *testing.T) {
+	env := newEnv(t, &Config{WorkerCount: 1})
+
+	rec := httptest.NewRecorder()
+	env.Coordinator.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/admin/tenants", nil))
+	require.Equal(t, http.StatusNotFound, rec.Code)
+}
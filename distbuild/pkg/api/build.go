@@ -8,10 +8,23 @@ import (
 
 type BuildRequest struct {
 	Graph build.Graph
+
+	// Tenant задаёт, от чьего имени запускается сборка. Token подтверждает право действовать от имени тенанта.
+	Tenant string `json:",omitempty"`
+	Token  string `json:",omitempty"`
+
+	// SourceChunks задаёт разбиение исходных файлов на чанки (см. filecache.Split).
+	//
+	// Файлы, которых нет в SourceChunks, заливаются целиком.
+	SourceChunks map[build.ID][]build.ID `json:",omitempty"`
 }
 
 type BuildStarted struct {
-	ID           build.ID
+	ID build.ID
+
+	// MissingFiles перечисляет файлы и чанки, которых нет на координаторе.
+	//
+	// Для файлов из BuildRequest.SourceChunks координатор запрашивает только недостающие чанки.
 	MissingFiles []build.ID
 }
 
@@ -19,10 +32,18 @@ type StatusUpdate struct {
 	JobFinished   *JobResult
 	BuildFailed   *BuildFailed
 	BuildFinished *BuildFinished
+
+	// JobOutput пересылает вывод работающего джоба.
+	//
+	// Такие обновления не сохраняются в истории сборки и не учитываются в AttachRequest.Offset.
+	JobOutput *JobOutput
 }
 
 type BuildFailed struct {
 	Error string
+
+	// Problems содержит ошибки в графе, если координатор отклонил граф до начала сборки.
+	Problems []build.Problem `json:",omitempty"`
 }
 
 type BuildFinished struct {
@@ -30,13 +51,32 @@ type BuildFinished struct {
 
 type UploadDone struct{}
 
+// Cancel останавливает сборку. Координатор отменяет все ожидающие и бегущие джобы этой сборки.
+type Cancel struct{}
+
 type SignalRequest struct {
+	// Tenant и Token должны совпадать с тенантом, запустившим сборку.
+	Tenant string `json:",omitempty"`
+	Token  string `json:",omitempty"`
+
 	UploadDone *UploadDone
+	Cancel     *Cancel
 }
 
 type SignalResponse struct {
 }
 
+// AttachRequest описывает повторное подключение к потоку статусов уже запущенной сборки.
+type AttachRequest struct {
+	// Tenant и Token должны совпадать с тенантом, запустившим сборку.
+	Tenant string `json:",omitempty"`
+	Token  string `json:",omitempty"`
+
+	// Offset задаёт число обновлений статуса, которые клиент уже получил.
+	// Координатор присылает обновления, начиная с обновления с этим номером.
+	Offset int
+}
+
 type StatusWriter interface {
 	Started(rsp *BuildStarted) error
 	Updated(update *StatusUpdate) error
@@ -45,6 +85,11 @@ type StatusWriter interface {
 type Service interface {
 	StartBuild(ctx context.Context, request *BuildRequest, w StatusWriter) error
 	SignalBuild(ctx context.Context, buildID build.ID, signal *SignalRequest) (*SignalResponse, error)
+
+	// AttachBuild подключается к потоку статусов сборки buildID.
+	//
+	// Сервис должен вызвать w.Started, а затем прислать обновления статуса, начиная с request.Offset.
+	AttachBuild(ctx context.Context, buildID build.ID, request *AttachRequest, w StatusWriter) error
 }
 
 type StatusReader interface {
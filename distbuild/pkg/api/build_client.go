@@ -3,7 +3,13 @@
 package api
 
 import (
+	"bytes"
 	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
 
 	"go.uber.org/zap"
 
@@ -11,16 +17,138 @@ import (
 )
 
 type BuildClient struct {
+	l        *zap.Logger
+	endpoint string
 }
 
 func NewBuildClient(l *zap.Logger, endpoint string) *BuildClient {
-	panic("implement me")
+	return &BuildClient{
+		l:        l,
+		endpoint: endpoint,
+	}
+}
+
+type statusReader struct {
+	body io.ReadCloser
+	dec  *json.Decoder
+}
+
+func (r *statusReader) Close() error {
+	return r.body.Close()
+}
+
+func (r *statusReader) Next() (*StatusUpdate, error) {
+	var u StatusUpdate
+	if err := r.dec.Decode(&u); err != nil {
+		return nil, err
+	}
+	return &u, nil
 }
 
 func (c *BuildClient) StartBuild(ctx context.Context, request *BuildRequest) (*BuildStarted, StatusReader, error) {
-	panic("implement me")
+	c.l.Debug("starting build", zap.Int("jobs", len(request.Graph.Jobs)))
+
+	started, r, err := c.openStream(ctx, c.endpoint+"/build", request)
+	if err != nil {
+		c.l.Error("start build failed", zap.Error(err))
+		return nil, nil, err
+	}
+
+	c.l.Debug("build started", zap.Stringer("build_id", started.ID), zap.Int("missing_files", len(started.MissingFiles)))
+	return started, r, nil
+}
+
+// AttachBuild reconnects to the status stream of the running build.
+func (c *BuildClient) AttachBuild(ctx context.Context, buildID build.ID, request *AttachRequest) (StatusReader, error) {
+	c.l.Debug("attaching to build", zap.Stringer("build_id", buildID), zap.Int("offset", request.Offset))
+
+	_, r, err := c.openStream(ctx, c.endpoint+"/attach?build_id="+buildID.String(), request)
+	if err != nil {
+		c.l.Error("attach build failed", zap.Stringer("build_id", buildID), zap.Error(err))
+		return nil, err
+	}
+	return r, nil
+}
+
+// openStream sends request and reads the first message of the status stream.
+func (c *BuildClient) openStream(ctx context.Context, url string, request any) (*BuildStarted, *statusReader, error) {
+	body, err := json.Marshal(request)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return nil, nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	rsp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if rsp.StatusCode != http.StatusOK {
+		defer rsp.Body.Close()
+		return nil, nil, readError(rsp)
+	}
+
+	r := &statusReader{body: rsp.Body, dec: json.NewDecoder(rsp.Body)}
+
+	var started BuildStarted
+	if err := r.dec.Decode(&started); err != nil {
+		_ = r.Close()
+		return nil, nil, fmt.Errorf("decode build started: %w", err)
+	}
+
+	return &started, r, nil
 }
 
 func (c *BuildClient) SignalBuild(ctx context.Context, buildID build.ID, signal *SignalRequest) (*SignalResponse, error) {
-	panic("implement me")
+	var rsp SignalResponse
+	err := doJSON(ctx, c.endpoint+"/signal?build_id="+buildID.String(), signal, &rsp)
+	if err != nil {
+		c.l.Error("signal build failed", zap.Stringer("build_id", buildID), zap.Error(err))
+		return nil, err
+	}
+	return &rsp, nil
+}
+
+// doJSON sends POST request with json encoded body and decodes json response into rsp.
+func doJSON(ctx context.Context, url string, in, out any) error {
+	body, err := json.Marshal(in)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	rsp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer rsp.Body.Close()
+
+	if rsp.StatusCode != http.StatusOK {
+		return readError(rsp)
+	}
+
+	return json.NewDecoder(rsp.Body).Decode(out)
+}
+
+func readError(rsp *http.Response) error {
+	msg, err := io.ReadAll(rsp.Body)
+	if err != nil {
+		return fmt.Errorf("http status %d: %w", rsp.StatusCode, err)
+	}
+
+	msg = bytes.TrimSpace(msg)
+	if len(msg) == 0 {
+		return fmt.Errorf("http status %d", rsp.StatusCode)
+	}
+	return errors.New(string(msg))
 }
@@ -3,18 +3,157 @@
 package api
 
 import (
+	"encoding/json"
+	"errors"
 	"net/http"
 
 	"go.uber.org/zap"
+
+	"gitlab.com/slon/shad-go/distbuild/pkg/build"
 )
 
 func NewBuildService(l *zap.Logger, s Service) *BuildHandler {
-	panic("implement me")
+	return &BuildHandler{
+		l: l,
+		s: s,
+	}
 }
 
 type BuildHandler struct {
+	l *zap.Logger
+	s Service
 }
 
 func (h *BuildHandler) Register(mux *http.ServeMux) {
-	panic("implement me")
+	mux.HandleFunc("POST /build", h.build)
+	mux.HandleFunc("POST /signal", h.signal)
+	mux.HandleFunc("POST /attach", h.attach)
+}
+
+type statusWriter struct {
+	w       http.ResponseWriter
+	rc      *http.ResponseController
+	enc     *json.Encoder
+	started bool
+}
+
+func (s *statusWriter) write(msg any) error {
+	if err := s.enc.Encode(msg); err != nil {
+		return err
+	}
+	return s.rc.Flush()
+}
+
+func (s *statusWriter) Started(rsp *BuildStarted) error {
+	if s.started {
+		return errors.New("build is already started")
+	}
+
+	s.started = true
+	s.w.Header().Set("Content-Type", "application/json")
+	s.w.WriteHeader(http.StatusOK)
+	return s.write(rsp)
+}
+
+func (s *statusWriter) Updated(update *StatusUpdate) error {
+	if !s.started {
+		return errors.New("build is not started")
+	}
+	return s.write(update)
+}
+
+func (h *BuildHandler) build(w http.ResponseWriter, r *http.Request) {
+	var req BuildRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.l.Error("failed to decode build request", zap.Error(err))
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	h.l.Debug("build request received", zap.Int("jobs", len(req.Graph.Jobs)))
+
+	sw := &statusWriter{
+		w:   w,
+		rc:  http.NewResponseController(w),
+		enc: json.NewEncoder(w),
+	}
+
+	h.finish(w, sw, h.s.StartBuild(r.Context(), &req, sw))
+}
+
+// finish reports error returned by the service to the client.
+func (h *BuildHandler) finish(w http.ResponseWriter, sw *statusWriter, err error) {
+	if err == nil {
+		return
+	}
+
+	h.l.Error("build failed", zap.Error(err))
+	if !sw.started {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if err := sw.Updated(&StatusUpdate{BuildFailed: &BuildFailed{Error: err.Error()}}); err != nil {
+		h.l.Error("failed to send build error", zap.Error(err))
+	}
+}
+
+func (h *BuildHandler) attach(w http.ResponseWriter, r *http.Request) {
+	var buildID build.ID
+	if err := buildID.UnmarshalText([]byte(r.URL.Query().Get("build_id"))); err != nil {
+		h.l.Error("invalid build id", zap.Error(err))
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var req AttachRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.l.Error("failed to decode attach request", zap.Error(err))
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	h.l.Debug("attach request received", zap.Stringer("build_id", buildID), zap.Int("offset", req.Offset))
+
+	sw := &statusWriter{
+		w:   w,
+		rc:  http.NewResponseController(w),
+		enc: json.NewEncoder(w),
+	}
+
+	h.finish(w, sw, h.s.AttachBuild(r.Context(), buildID, &req, sw))
+}
+
+func (h *BuildHandler) signal(w http.ResponseWriter, r *http.Request) {
+	var buildID build.ID
+	if err := buildID.UnmarshalText([]byte(r.URL.Query().Get("build_id"))); err != nil {
+		h.l.Error("invalid build id", zap.Error(err))
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var req SignalRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.l.Error("failed to decode signal request", zap.Error(err))
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	h.l.Debug("signal received", zap.Stringer("build_id", buildID))
+
+	rsp, err := h.s.SignalBuild(r.Context(), buildID, &req)
+	if err != nil {
+		h.l.Error("signal failed", zap.Stringer("build_id", buildID), zap.Error(err))
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(h.l, w, rsp)
+}
+
+func writeJSON(l *zap.Logger, w http.ResponseWriter, rsp any) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(rsp); err != nil {
+		l.Error("failed to write response", zap.Error(err))
+	}
 }
@@ -159,3 +159,40 @@ func TestBuildResultsStreaming(t *testing.T) {
 	defer r.Close()
 	require.Equal(t, started, rsp)
 }
+
+func TestBuildAttach(t *testing.T) {
+	env, stop := newEnv(t)
+	defer stop()
+
+	ctx := context.Background()
+
+	buildID := build.ID{02}
+	req := &api.AttachRequest{Offset: 1}
+	finished := &api.StatusUpdate{BuildFinished: &api.BuildFinished{}}
+
+	env.mock.EXPECT().AttachBuild(gomock.Any(), buildID, req, gomock.Any()).
+		DoAndReturn(func(_ context.Context, _ build.ID, _ *api.AttachRequest, w api.StatusWriter) error {
+			if err := w.Started(&api.BuildStarted{ID: buildID}); err != nil {
+				return err
+			}
+
+			return w.Updated(finished)
+		})
+	env.mock.EXPECT().AttachBuild(gomock.Any(), build.ID{03}, gomock.Any(), gomock.Any()).
+		Return(fmt.Errorf("build not found"))
+
+	r, err := env.client.AttachBuild(ctx, buildID, req)
+	require.NoError(t, err)
+	defer r.Close()
+
+	u, err := r.Next()
+	require.NoError(t, err)
+	require.Equal(t, finished, u)
+
+	_, err = r.Next()
+	require.Equal(t, io.EOF, err)
+
+	_, err = env.client.AttachBuild(ctx, build.ID{03}, &api.AttachRequest{})
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "build not found")
+}
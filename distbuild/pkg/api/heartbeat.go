@@ -18,6 +18,30 @@ type JobResult struct {
 	//
 	// Если Error == nil, значит джоб завершился успешно.
 	Error *string
+
+	// Transient говорит, что ошибка вызвана окружением воркера, а не самим джобом. Например, воркеру
+	// не удалось скачать артефакт зависимости. Такой джоб координатор перезапускает.
+	Transient bool
+
+	// Attempts перечисляет неудачные попытки запуска джоба, после которых координатор его перезапускал.
+	Attempts []JobAttempt
+}
+
+// JobOutput описывает очередную часть вывода работающего джоба.
+//
+// Смещения задают позицию части в полном выводе джоба. Полный вывод всё равно приходит в JobResult,
+// поэтому потерянные части можно не пересылать.
+type JobOutput struct {
+	ID build.ID
+
+	StdoutOffset, StderrOffset int
+	Stdout, Stderr             []byte
+}
+
+// JobAttempt описывает одну неудачную попытку запуска джоба.
+type JobAttempt struct {
+	WorkerID WorkerID
+	Error    string
 }
 
 type WorkerID string
@@ -47,6 +71,16 @@ type HeartbeatRequest struct {
 
 	// AddedArtifacts говорит, какие артефакты появились в кеше на этой итерации цикла.
 	AddedArtifacts []build.ID
+
+	// RemovedArtifacts говорит, какие артефакты были вытеснены из кеша на этой итерации цикла.
+	RemovedArtifacts []build.ID
+
+	// CancelledJobs перечисляет джобы, которые были остановлены по запросу координатора
+	// на этой итерации цикла.
+	CancelledJobs []build.ID
+
+	// JobOutput содержит вывод работающих джобов, появившийся на этой итерации цикла.
+	JobOutput []JobOutput
 }
 
 // JobSpec описывает джоб, который нужно запустить.
@@ -57,11 +91,22 @@ type JobSpec struct {
 	// Artifacts задаёт воркеров, с которых можно скачать артефакты необходимые этому джобу.
 	Artifacts map[build.ID]WorkerID
 
+	// Priority задаёт срочность джоба. Шедулер выдаёт воркерам джобы с большим приоритетом раньше.
+	//
+	// Координатор выставляет приоритет равным длине критического пути, проходящего через этот джоб.
+	Priority int
+
+	// Tenant задаёт тенанта, от имени которого запущена сборка. Шедулер делит воркеров между тенантами.
+	Tenant string `json:",omitempty"`
+
 	build.Job
 }
 
 type HeartbeatResponse struct {
 	JobsToRun map[build.ID]JobSpec
+
+	// JobsToCancel перечисляет джобы, которые воркер должен остановить, убив запущенные процессы.
+	JobsToCancel []build.ID
 }
 
 type HeartbeatService interface {
@@ -9,12 +9,22 @@ import (
 )
 
 type HeartbeatClient struct {
+	l        *zap.Logger
+	endpoint string
 }
 
 func NewHeartbeatClient(l *zap.Logger, endpoint string) *HeartbeatClient {
-	panic("implement me")
+	return &HeartbeatClient{
+		l:        l,
+		endpoint: endpoint,
+	}
 }
 
 func (c *HeartbeatClient) Heartbeat(ctx context.Context, req *HeartbeatRequest) (*HeartbeatResponse, error) {
-	panic("implement me")
+	var rsp HeartbeatResponse
+	if err := doJSON(ctx, c.endpoint+"/heartbeat", req, &rsp); err != nil {
+		c.l.Error("heartbeat failed", zap.Stringer("worker_id", req.WorkerID), zap.Error(err))
+		return nil, err
+	}
+	return &rsp, nil
 }
@@ -3,18 +3,42 @@
 package api
 
 import (
+	"encoding/json"
 	"net/http"
 
 	"go.uber.org/zap"
 )
 
 type HeartbeatHandler struct {
+	l *zap.Logger
+	s HeartbeatService
 }
 
 func NewHeartbeatHandler(l *zap.Logger, s HeartbeatService) *HeartbeatHandler {
-	panic("implement me")
+	return &HeartbeatHandler{
+		l: l,
+		s: s,
+	}
 }
 
 func (h *HeartbeatHandler) Register(mux *http.ServeMux) {
-	panic("implement me")
+	mux.HandleFunc("POST /heartbeat", h.heartbeat)
+}
+
+func (h *HeartbeatHandler) heartbeat(w http.ResponseWriter, r *http.Request) {
+	var req HeartbeatRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.l.Error("failed to decode heartbeat request", zap.Error(err))
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	rsp, err := h.s.Heartbeat(r.Context(), &req)
+	if err != nil {
+		h.l.Error("heartbeat failed", zap.Stringer("worker_id", req.WorkerID), zap.Error(err))
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(h.l, w, rsp)
 }
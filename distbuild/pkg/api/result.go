@@ -0,0 +1,15 @@
+package api
+
+import (
+	"context"
+
+	"gitlab.com/slon/shad-go/distbuild/pkg/build"
+)
+
+// ResultService отдаёт результаты джобов, артефакты которых лежат в кеше воркера.
+//
+// Координатор использует результаты из кеша, чтобы не запускать джобы, которые уже
+// были выполнены на каком-нибудь воркере.
+type ResultService interface {
+	JobResult(ctx context.Context, jobID build.ID) (*JobResult, error)
+}
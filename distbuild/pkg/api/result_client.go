@@ -0,0 +1,50 @@
+//go:build !solution
+
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+
+	"go.uber.org/zap"
+
+	"gitlab.com/slon/shad-go/distbuild/pkg/build"
+)
+
+type ResultClient struct {
+	l        *zap.Logger
+	endpoint string
+}
+
+func NewResultClient(l *zap.Logger, endpoint string) *ResultClient {
+	return &ResultClient{
+		l:        l,
+		endpoint: endpoint,
+	}
+}
+
+func (c *ResultClient) JobResult(ctx context.Context, jobID build.ID) (*JobResult, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.endpoint+"/result?id="+jobID.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	rsp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer rsp.Body.Close()
+
+	if rsp.StatusCode != http.StatusOK {
+		err := readError(rsp)
+		c.l.Debug("job result lookup failed", zap.Stringer("job_id", jobID), zap.Error(err))
+		return nil, err
+	}
+
+	var res JobResult
+	if err := json.NewDecoder(rsp.Body).Decode(&res); err != nil {
+		return nil, err
+	}
+	return &res, nil
+}
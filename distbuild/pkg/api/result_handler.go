@@ -0,0 +1,44 @@
+//go:build !solution
+
+package api
+
+import (
+	"net/http"
+
+	"go.uber.org/zap"
+
+	"gitlab.com/slon/shad-go/distbuild/pkg/build"
+)
+
+type ResultHandler struct {
+	l *zap.Logger
+	s ResultService
+}
+
+func NewResultHandler(l *zap.Logger, s ResultService) *ResultHandler {
+	return &ResultHandler{
+		l: l,
+		s: s,
+	}
+}
+
+func (h *ResultHandler) Register(mux *http.ServeMux) {
+	mux.HandleFunc("GET /result", h.result)
+}
+
+func (h *ResultHandler) result(w http.ResponseWriter, r *http.Request) {
+	var jobID build.ID
+	if err := jobID.UnmarshalText([]byte(r.URL.Query().Get("id"))); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	rsp, err := h.s.JobResult(r.Context(), jobID)
+	if err != nil {
+		h.l.Warn("job result lookup failed", zap.Stringer("job_id", jobID), zap.Error(err))
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+
+	writeJSON(h.l, w, rsp)
+}
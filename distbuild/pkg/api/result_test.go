@@ -0,0 +1,48 @@
+package api_test
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap/zaptest"
+
+	"gitlab.com/slon/shad-go/distbuild/pkg/api"
+	"gitlab.com/slon/shad-go/distbuild/pkg/api/mock"
+	"gitlab.com/slon/shad-go/distbuild/pkg/build"
+)
+
+//go:generate mockgen -package mock -destination mock/result.go . ResultService
+
+func TestJobResult(t *testing.T) {
+	ctrl := gomock.NewController(t)
+
+	l := zaptest.NewLogger(t)
+	m := mock.NewMockResultService(ctrl)
+	mux := http.NewServeMux()
+	api.NewResultHandler(l, m).Register(mux)
+
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	client := api.NewResultClient(l, server.URL)
+
+	res := &api.JobResult{ID: build.ID{0x01}, Stdout: []byte("OK\n")}
+
+	gomock.InOrder(
+		m.EXPECT().JobResult(gomock.Any(), gomock.Eq(build.ID{0x01})).Times(1).Return(res, nil),
+		m.EXPECT().JobResult(gomock.Any(), gomock.Eq(build.ID{0x02})).Times(1).Return(nil, fmt.Errorf("artifact not found")),
+	)
+
+	clientRes, err := client.JobResult(context.Background(), build.ID{0x01})
+	require.NoError(t, err)
+	require.Equal(t, res, clientRes)
+
+	_, err = client.JobResult(context.Background(), build.ID{0x02})
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "artifact not found")
+}
@@ -1,12 +1,16 @@
 package artifact
 
 import (
+	"context"
 	"encoding/hex"
 	"errors"
 	"fmt"
+	"io/fs"
 	"os"
 	"path/filepath"
+	"sort"
 	"sync"
+	"time"
 
 	"gitlab.com/slon/shad-go/distbuild/pkg/build"
 )
@@ -22,12 +26,33 @@ type Cache struct {
 	tmpDir   string
 	cacheDir string
 
+	// quota limits total size of the artifacts in bytes. Zero quota means no limit.
+	quota int64
+
 	mu          sync.Mutex
 	writeLocked map[build.ID]struct{}
 	readLocked  map[build.ID]int
+
+	entries map[build.ID]*entry
+	size    int64
+
+	// overflow is signalled when size of the cache exceeds quota.
+	overflow chan struct{}
+}
+
+type entry struct {
+	size       int64
+	accessTime time.Time
 }
 
 func NewCache(root string) (*Cache, error) {
+	return NewCacheWithQuota(root, 0)
+}
+
+// NewCacheWithQuota creates cache that keeps total size of the artifacts under quota bytes.
+//
+// Least recently used artifacts are removed by RunEvictor.
+func NewCacheWithQuota(root string, quota int64) (*Cache, error) {
 	tmpDir := filepath.Join(root, "tmp")
 
 	if err := os.RemoveAll(tmpDir); err != nil {
@@ -49,12 +74,88 @@ func NewCache(root string) (*Cache, error) {
 		}
 	}
 
-	return &Cache{
+	c := &Cache{
 		tmpDir:      tmpDir,
 		cacheDir:    cacheDir,
+		quota:       quota,
 		writeLocked: make(map[build.ID]struct{}),
 		readLocked:  make(map[build.ID]int),
-	}, nil
+		entries:     make(map[build.ID]*entry),
+		overflow:    make(chan struct{}, 1),
+	}
+
+	err := c.Range(func(id build.ID) error {
+		path := filepath.Join(cacheDir, id.Path())
+
+		st, err := os.Stat(path)
+		if err != nil {
+			return err
+		}
+
+		size, err := dirSize(path)
+		if err != nil {
+			return err
+		}
+
+		c.addLocked(id, size, st.ModTime())
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return c, nil
+}
+
+func dirSize(path string) (int64, error) {
+	var size int64
+	err := filepath.WalkDir(path, func(_ string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		size += info.Size()
+		return nil
+	})
+	return size, err
+}
+
+func (c *Cache) addLocked(id build.ID, size int64, accessTime time.Time) {
+	c.removeLocked(id)
+
+	c.entries[id] = &entry{size: size, accessTime: accessTime}
+	c.size += size
+
+	c.signalOverflowLocked()
+}
+
+// signalOverflowLocked wakes up evictor if the cache is over quota.
+func (c *Cache) signalOverflowLocked() {
+	if c.quota > 0 && c.size > c.quota {
+		select {
+		case c.overflow <- struct{}{}:
+		default:
+		}
+	}
+}
+
+func (c *Cache) removeLocked(id build.ID) {
+	if e, ok := c.entries[id]; ok {
+		c.size -= e.size
+		delete(c.entries, id)
+	}
+}
+
+// Size returns total size of the artifacts stored in the cache.
+func (c *Cache) Size() int64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.size
 }
 
 func (c *Cache) readLock(id build.ID) error {
@@ -76,6 +177,9 @@ func (c *Cache) readUnlock(id build.ID) {
 	c.readLocked[id]--
 	if c.readLocked[id] == 0 {
 		delete(c.readLocked, id)
+
+		// Evict skips locked artifacts, so the artifact might be the one that keeps the cache over quota.
+		c.signalOverflowLocked()
 	}
 }
 
@@ -106,6 +210,7 @@ func (c *Cache) writeUnlock(id build.ID) {
 	defer c.mu.Unlock()
 
 	delete(c.writeLocked, id)
+	c.signalOverflowLocked()
 }
 
 func (c *Cache) Range(artifactFn func(artifact build.ID) error) error {
@@ -141,7 +246,84 @@ func (c *Cache) Remove(artifact build.ID) error {
 	}
 	defer c.writeUnlock(artifact)
 
-	return os.RemoveAll(filepath.Join(c.cacheDir, artifact.Path()))
+	if err := os.RemoveAll(filepath.Join(c.cacheDir, artifact.Path())); err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.removeLocked(artifact)
+	return nil
+}
+
+// Evict removes least recently used artifacts, until size of the cache fits into quota.
+//
+// Artifacts that are locked are skipped. Evict returns the list of removed artifacts.
+func (c *Cache) Evict() ([]build.ID, error) {
+	type candidate struct {
+		id build.ID
+		entry
+	}
+
+	c.mu.Lock()
+	excess := c.size - c.quota
+	if c.quota <= 0 || excess <= 0 {
+		c.mu.Unlock()
+		return nil, nil
+	}
+
+	var candidates []candidate
+	for id, e := range c.entries {
+		candidates = append(candidates, candidate{id: id, entry: *e})
+	}
+	c.mu.Unlock()
+
+	sort.Slice(candidates, func(i, j int) bool {
+		return candidates[i].accessTime.Before(candidates[j].accessTime)
+	})
+
+	var evicted []build.ID
+	for _, e := range candidates {
+		if excess <= 0 {
+			break
+		}
+
+		err := c.Remove(e.id)
+		if errors.Is(err, ErrReadLocked) || errors.Is(err, ErrWriteLocked) {
+			continue
+		} else if err != nil {
+			return evicted, err
+		}
+
+		evicted = append(evicted, e.id)
+		excess -= e.size
+	}
+
+	return evicted, nil
+}
+
+// RunEvictor calls Evict every time the cache grows over quota, until ctx is canceled.
+//
+// If Evict had to skip locked artifacts, it is called again after any artifact is unlocked.
+//
+// onEvict is called with the list of removed artifacts.
+func (c *Cache) RunEvictor(ctx context.Context, onEvict func(evicted []build.ID)) error {
+	for {
+		evicted, err := c.Evict()
+		if len(evicted) != 0 {
+			onEvict(evicted)
+		}
+		if err != nil {
+			return err
+		}
+
+		select {
+		case <-c.overflow:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
 }
 
 func (c *Cache) Create(artifact build.ID) (path string, commit, abort func() error, err error) {
@@ -162,7 +344,21 @@ func (c *Cache) Create(artifact build.ID) (path string, commit, abort func() err
 
 	commit = func() error {
 		defer c.writeUnlock(artifact)
-		return os.Rename(path, filepath.Join(c.cacheDir, artifact.Path()))
+
+		size, err := dirSize(path)
+		if err != nil {
+			return err
+		}
+
+		if err := os.Rename(path, filepath.Join(c.cacheDir, artifact.Path())); err != nil {
+			return err
+		}
+
+		c.mu.Lock()
+		defer c.mu.Unlock()
+
+		c.addLocked(artifact, size, time.Now())
+		return nil
 	}
 
 	return
@@ -183,6 +379,12 @@ func (c *Cache) Get(artifact build.ID) (path string, unlock func(), err error) {
 		return
 	}
 
+	c.mu.Lock()
+	if e, ok := c.entries[artifact]; ok {
+		e.accessTime = time.Now()
+	}
+	c.mu.Unlock()
+
 	unlock = func() {
 		c.readUnlock(artifact)
 	}
@@ -1,10 +1,12 @@
 package artifact_test
 
 import (
+	"context"
 	"errors"
 	"os"
 	"path/filepath"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/require"
 
@@ -96,3 +98,96 @@ func TestArtifactExists(t *testing.T) {
 	_, _, _, err = c.Create(idA)
 	require.Truef(t, errors.Is(err, artifact.ErrExists), "%v", err)
 }
+
+func TestEvict(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	c, err := artifact.NewCacheWithQuota(tmpDir, 20)
+	require.NoError(t, err)
+
+	put := func(id build.ID) {
+		path, commit, _, err := c.Create(id)
+		require.NoError(t, err)
+		require.NoError(t, os.WriteFile(filepath.Join(path, "out"), make([]byte, 10), 0666))
+		require.NoError(t, commit())
+	}
+
+	idA, idB, idC := build.ID{'a'}, build.ID{'b'}, build.ID{'c'}
+	put(idA)
+	put(idB)
+
+	_, unlock, err := c.Get(idA)
+	require.NoError(t, err)
+	unlock()
+
+	put(idC)
+	require.Equal(t, int64(30), c.Size())
+
+	evicted, err := c.Evict()
+	require.NoError(t, err)
+	require.Equal(t, []build.ID{idB}, evicted)
+	require.Equal(t, int64(20), c.Size())
+
+	_, _, err = c.Get(idB)
+	require.Truef(t, errors.Is(err, artifact.ErrNotFound), "%v", err)
+
+	_, unlock, err = c.Get(idA)
+	require.NoError(t, err)
+	defer unlock()
+
+	put(build.ID{'d'})
+
+	evicted, err = c.Evict()
+	require.NoError(t, err)
+	require.Equal(t, []build.ID{idC}, evicted, "read locked artifact must not be evicted")
+
+	reopened, err := artifact.NewCacheWithQuota(tmpDir, 20)
+	require.NoError(t, err)
+	require.Equal(t, int64(20), reopened.Size())
+}
+
+func TestRunEvictorAfterUnlock(t *testing.T) {
+	c, err := artifact.NewCacheWithQuota(t.TempDir(), 10)
+	require.NoError(t, err)
+
+	put := func(id build.ID) {
+		path, commit, _, err := c.Create(id)
+		require.NoError(t, err)
+		require.NoError(t, os.WriteFile(filepath.Join(path, "out"), make([]byte, 10), 0666))
+		require.NoError(t, commit())
+	}
+
+	idA, idB := build.ID{'a'}, build.ID{'b'}
+	put(idA)
+
+	_, unlockA, err := c.Get(idA)
+	require.NoError(t, err)
+
+	put(idB)
+
+	_, unlockB, err := c.Get(idB)
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	evictedCh := make(chan []build.ID, 2)
+	go func() { _ = c.RunEvictor(ctx, func(evicted []build.ID) { evictedCh <- evicted }) }()
+
+	select {
+	case evicted := <-evictedCh:
+		t.Fatalf("locked artifacts evicted: %v", evicted)
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	unlockA()
+	unlockB()
+
+	select {
+	case evicted := <-evictedCh:
+		require.Equal(t, []build.ID{idA}, evicted)
+	case <-time.After(5 * time.Second):
+		t.Fatal("evictor did not retry after unlock")
+	}
+	require.Equal(t, int64(10), c.Size())
+}
@@ -3,12 +3,89 @@
 package artifact
 
 import (
+	"bytes"
 	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
 
 	"gitlab.com/slon/shad-go/distbuild/pkg/build"
+	"gitlab.com/slon/shad-go/distbuild/pkg/tarstream"
 )
 
+const (
+	// downloadAttempts limits number of times interrupted download is resumed.
+	downloadAttempts = 5
+
+	retryDelay = time.Millisecond * 100
+)
+
+// errFatal marks download errors that are not fixed by retrying.
+type errFatal struct {
+	err error
+}
+
+func (e *errFatal) Error() string { return e.err.Error() }
+func (e *errFatal) Unwrap() error { return e.err }
+
 // Download artifact from remote cache into local cache.
+//
+// Interrupted download is resumed from the last received file.
 func Download(ctx context.Context, endpoint string, c *Cache, artifactID build.ID) error {
-	panic("implement me")
+	path, commit, abort, err := c.Create(artifactID)
+	if errors.Is(err, ErrExists) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	r := tarstream.NewReceiver(path)
+	for attempt := 1; ; attempt++ {
+		err = downloadPart(ctx, endpoint, artifactID, r)
+		if err == nil {
+			return commit()
+		}
+
+		var fatal *errFatal
+		if errors.As(err, &fatal) || errors.Is(err, tarstream.ErrChecksum) || attempt == downloadAttempts {
+			break
+		}
+
+		select {
+		case <-time.After(retryDelay):
+		case <-ctx.Done():
+			_ = abort()
+			return ctx.Err()
+		}
+	}
+
+	_ = abort()
+	return err
+}
+
+func downloadPart(ctx context.Context, endpoint string, artifactID build.ID, r *tarstream.Receiver) error {
+	url := endpoint + "/artifact?id=" + artifactID.String() + "&offset=" + strconv.Itoa(r.Offset())
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return &errFatal{err}
+	}
+	req.Header.Set("Accept-Encoding", tarstream.AcceptEncoding)
+
+	rsp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer rsp.Body.Close()
+
+	if rsp.StatusCode != http.StatusOK {
+		msg, _ := io.ReadAll(rsp.Body)
+		return &errFatal{fmt.Errorf("download artifact %s: %s", artifactID, bytes.TrimSpace(msg))}
+	}
+
+	compression := tarstream.Compression(rsp.Header.Get("Content-Encoding"))
+	return r.Receive(rsp.Body, compression)
 }
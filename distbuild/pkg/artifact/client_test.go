@@ -1,7 +1,9 @@
 package artifact_test
 
 import (
+	"bytes"
 	"context"
+	"io"
 	"net/http"
 	"net/http/httptest"
 	"os"
@@ -13,6 +15,7 @@ import (
 
 	"gitlab.com/slon/shad-go/distbuild/pkg/artifact"
 	"gitlab.com/slon/shad-go/distbuild/pkg/build"
+	"gitlab.com/slon/shad-go/distbuild/pkg/tarstream"
 )
 
 func TestArtifactTransfer(t *testing.T) {
@@ -49,3 +52,67 @@ func TestArtifactTransfer(t *testing.T) {
 	err = artifact.Download(ctx, server.URL, localCache.Cache, build.ID{0x02})
 	require.Error(t, err)
 }
+
+type limitedWriter struct {
+	http.ResponseWriter
+	limit int
+}
+
+func (w *limitedWriter) Write(p []byte) (int, error) {
+	if len(p) > w.limit {
+		n, _ := w.ResponseWriter.Write(p[:w.limit])
+		w.limit = 0
+		return n, io.ErrShortWrite
+	}
+
+	w.limit -= len(p)
+	return w.ResponseWriter.Write(p)
+}
+
+func TestArtifactTransferResume(t *testing.T) {
+	remoteCache := newTestCache(t)
+	localCache := newTestCache(t)
+
+	id := build.ID{0x01}
+
+	dir, commit, _, err := remoteCache.Create(id)
+	require.NoError(t, err)
+	for _, name := range []string{"a.txt", "b.txt", "c.txt"} {
+		require.NoError(t, os.WriteFile(filepath.Join(dir, name), bytes.Repeat([]byte(name), 1<<14), 0666))
+	}
+	require.NoError(t, commit())
+
+	h := artifact.NewHandler(zaptest.NewLogger(t), remoteCache.Cache)
+	mux := http.NewServeMux()
+	h.Register(mux)
+
+	var offsets []string
+	var compressions []tarstream.Compression
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		offsets = append(offsets, r.URL.Query().Get("offset"))
+		compressions = append(compressions, tarstream.NegotiateCompression(r.Header.Get("Accept-Encoding")))
+
+		if len(offsets) == 1 {
+			// Первый ответ обрывается после первого файла.
+			w = &limitedWriter{ResponseWriter: w, limit: 2048}
+		}
+		mux.ServeHTTP(w, r)
+	}))
+	defer server.Close()
+
+	require.NoError(t, artifact.Download(context.Background(), server.URL, localCache.Cache, id))
+	require.Len(t, offsets, 2)
+	require.Equal(t, "0", offsets[0])
+	require.NotEqual(t, "0", offsets[1])
+	require.Equal(t, []tarstream.Compression{tarstream.CompressionZstd, tarstream.CompressionZstd}, compressions)
+
+	dir, unlock, err := localCache.Get(id)
+	require.NoError(t, err)
+	defer unlock()
+
+	for _, name := range []string{"a.txt", "b.txt", "c.txt"} {
+		content, err := os.ReadFile(filepath.Join(dir, name))
+		require.NoError(t, err)
+		require.Equal(t, bytes.Repeat([]byte(name), 1<<14), content)
+	}
+}
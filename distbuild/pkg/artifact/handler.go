@@ -3,18 +3,71 @@
 package artifact
 
 import (
+	"errors"
 	"net/http"
+	"strconv"
 
 	"go.uber.org/zap"
+
+	"gitlab.com/slon/shad-go/distbuild/pkg/build"
+	"gitlab.com/slon/shad-go/distbuild/pkg/tarstream"
 )
 
 type Handler struct {
+	l *zap.Logger
+	c *Cache
 }
 
 func NewHandler(l *zap.Logger, c *Cache) *Handler {
-	panic("implement me")
+	return &Handler{
+		l: l,
+		c: c,
+	}
 }
 
 func (h *Handler) Register(mux *http.ServeMux) {
-	panic("implement me")
+	mux.HandleFunc("GET /artifact", h.get)
+}
+
+func (h *Handler) get(w http.ResponseWriter, r *http.Request) {
+	var id build.ID
+	if err := id.UnmarshalText([]byte(r.URL.Query().Get("id"))); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var opts tarstream.Options
+	if offset := r.URL.Query().Get("offset"); offset != "" {
+		var err error
+		if opts.Offset, err = strconv.Atoi(offset); err != nil || opts.Offset < 0 {
+			http.Error(w, "invalid offset", http.StatusBadRequest)
+			return
+		}
+	}
+
+	path, unlock, err := h.c.Get(id)
+	if err != nil {
+		h.l.Error("artifact get failed", zap.Stringer("id", id), zap.Error(err))
+		if errors.Is(err, ErrNotFound) {
+			http.Error(w, err.Error(), http.StatusNotFound)
+		} else {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+		return
+	}
+	defer unlock()
+
+	opts.Compression = tarstream.NegotiateCompression(r.Header.Get("Accept-Encoding"))
+	if opts.Compression != tarstream.CompressionNone {
+		w.Header().Set("Content-Encoding", string(opts.Compression))
+	}
+
+	h.l.Debug("sending artifact",
+		zap.Stringer("id", id),
+		zap.Int("offset", opts.Offset),
+		zap.String("compression", string(opts.Compression)))
+
+	if err := tarstream.SendWithOptions(path, w, opts); err != nil {
+		h.l.Error("artifact send failed", zap.Stringer("id", id), zap.Error(err))
+	}
 }
@@ -0,0 +1,35 @@
+package build
+
+// CriticalPath computes the length of the longest dependency chain that starts at each job.
+//
+// The chain starts at the job itself and goes through jobs that depend on it, so a job that
+// nobody depends on has length 1. Jobs with longer chains should be scheduled first, since
+// the build can't finish before the whole chain is executed.
+//
+// CriticalPath assumes dependency graph contains no cycles.
+func CriticalPath(jobs []Job) map[ID]int {
+	dependents := map[ID][]ID{}
+	for _, job := range jobs {
+		for _, dep := range job.Deps {
+			dependents[dep] = append(dependents[dep], job.ID)
+		}
+	}
+
+	length := make(map[ID]int, len(jobs))
+
+	sorted := TopSort(jobs)
+	for i := len(sorted) - 1; i >= 0; i-- {
+		id := sorted[i].ID
+
+		longest := 0
+		for _, next := range dependents[id] {
+			if length[next] > longest {
+				longest = length[next]
+			}
+		}
+
+		length[id] = longest + 1
+	}
+
+	return length
+}
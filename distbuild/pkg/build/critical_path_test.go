@@ -0,0 +1,37 @@
+package build
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestCriticalPath(t *testing.T) {
+	jobs := []Job{
+		{
+			ID:   ID{'l'},
+			Deps: []ID{{'a'}, {'b'}},
+		},
+		{
+			ID:   ID{'a'},
+			Deps: []ID{{'c'}},
+		},
+		{
+			ID: ID{'b'},
+		},
+		{
+			ID: ID{'c'},
+		},
+		{
+			ID: ID{'v'},
+		},
+	}
+
+	require.Equal(t, map[ID]int{
+		{'l'}: 1,
+		{'a'}: 2,
+		{'b'}: 2,
+		{'c'}: 3,
+		{'v'}: 1,
+	}, CriticalPath(jobs))
+}
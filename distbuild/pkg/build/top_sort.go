@@ -1,6 +1,8 @@
 package build
 
 // TopSort sorts jobs in topological order assuming dependency graph contains no cycles.
+//
+// Graph must be checked with Validate first.
 func TopSort(jobs []Job) []Job {
 	var sorted []Job
 	visited := make([]bool, len(jobs))
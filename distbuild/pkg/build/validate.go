@@ -0,0 +1,290 @@
+package build
+
+import (
+	"fmt"
+	"strings"
+	"text/template"
+	"text/template/parse"
+)
+
+// ProblemKind задаёт тип ошибки в графе сборки.
+type ProblemKind string
+
+const (
+	// ProblemCycle - джобы образуют цикл по Deps.
+	ProblemCycle ProblemKind = "cycle"
+	// ProblemDanglingDep - Deps ссылается на джоб, которого нет в графе.
+	ProblemDanglingDep ProblemKind = "dangling_dep"
+	// ProblemDuplicateID - несколько джобов имеют одинаковый ID.
+	ProblemDuplicateID ProblemKind = "duplicate_id"
+	// ProblemMissingInput - файла из Inputs нет в SourceFiles.
+	ProblemMissingInput ProblemKind = "missing_input"
+	// ProblemBadTemplate - шаблон в Cmd не парсится или ссылается на джоб не из Deps.
+	ProblemBadTemplate ProblemKind = "bad_template"
+)
+
+// Problem описывает одну ошибку в графе сборки.
+type Problem struct {
+	Kind ProblemKind
+
+	// Job задаёт джоб, в котором найдена ошибка.
+	Job  ID
+	Name string
+
+	// Cycle содержит имена джобов, образующих цикл. Первый и последний элементы совпадают.
+	Cycle []string `json:",omitempty"`
+
+	Message string
+}
+
+func (p *Problem) String() string {
+	return fmt.Sprintf("job %q: %s", p.Name, p.Message)
+}
+
+// ValidationError возвращается из Validate и содержит все найденные в графе ошибки.
+type ValidationError struct {
+	Problems []Problem
+}
+
+func (e *ValidationError) Error() string {
+	msgs := make([]string, len(e.Problems))
+	for i := range e.Problems {
+		msgs[i] = e.Problems[i].String()
+	}
+	return "invalid build graph: " + strings.Join(msgs, "; ")
+}
+
+// Validate проверяет, что граф можно исполнить.
+//
+// Validate находит циклы, ссылки на несуществующие джобы, повторяющиеся ID, входные файлы без записи
+// в SourceFiles и некорректные шаблоны команд. Если ошибок нет, Validate возвращает nil,
+// иначе *ValidationError.
+func Validate(g Graph) error {
+	var problems []Problem
+	report := func(job *Job, kind ProblemKind, format string, args ...any) {
+		problems = append(problems, Problem{
+			Kind:    kind,
+			Job:     job.ID,
+			Name:    jobName(job),
+			Message: fmt.Sprintf(format, args...),
+		})
+	}
+
+	jobs := make(map[ID]*Job, len(g.Jobs))
+	for i := range g.Jobs {
+		job := &g.Jobs[i]
+		if other, ok := jobs[job.ID]; ok {
+			report(job, ProblemDuplicateID, "id %s is already used by job %q", job.ID, jobName(other))
+			continue
+		}
+		jobs[job.ID] = job
+	}
+
+	sources := make(map[string]struct{}, len(g.SourceFiles))
+	for _, path := range g.SourceFiles {
+		sources[path] = struct{}{}
+	}
+
+	for i := range g.Jobs {
+		job := &g.Jobs[i]
+
+		for _, dep := range job.Deps {
+			if _, ok := jobs[dep]; !ok {
+				report(job, ProblemDanglingDep, "dependency %s is not in the graph", dep)
+			}
+		}
+
+		for _, input := range job.Inputs {
+			if _, ok := sources[input]; !ok {
+				report(job, ProblemMissingInput, "input %s is not in source files", input)
+			}
+		}
+
+		for _, err := range checkTemplates(job) {
+			report(job, ProblemBadTemplate, "%v", err)
+		}
+	}
+
+	problems = append(problems, findCycles(g.Jobs, jobs)...)
+
+	if len(problems) != 0 {
+		return &ValidationError{Problems: problems}
+	}
+	return nil
+}
+
+func jobName(job *Job) string {
+	if job.Name != "" {
+		return job.Name
+	}
+	return job.ID.String()
+}
+
+// findCycles reports every back edge found by depth first search as a separate cycle.
+func findCycles(order []Job, jobs map[ID]*Job) []Problem {
+	const (
+		unvisited = iota
+		inProgress
+		done
+	)
+
+	var problems []Problem
+	state := make(map[ID]int, len(jobs))
+	var stack []*Job
+
+	var visit func(job *Job)
+	visit = func(job *Job) {
+		state[job.ID] = inProgress
+		stack = append(stack, job)
+
+		for _, dep := range job.Deps {
+			next, ok := jobs[dep]
+			if !ok {
+				continue
+			}
+
+			switch state[dep] {
+			case unvisited:
+				visit(next)
+
+			case inProgress:
+				start := len(stack) - 1
+				for stack[start].ID != dep {
+					start--
+				}
+
+				var cycle []string
+				for _, j := range stack[start:] {
+					cycle = append(cycle, jobName(j))
+				}
+				cycle = append(cycle, jobName(next))
+
+				problems = append(problems, Problem{
+					Kind:    ProblemCycle,
+					Job:     next.ID,
+					Name:    jobName(next),
+					Cycle:   cycle,
+					Message: "dependency cycle: " + strings.Join(cycle, " -> "),
+				})
+			}
+		}
+
+		stack = stack[:len(stack)-1]
+		state[job.ID] = done
+	}
+
+	for i := range order {
+		if job := jobs[order[i].ID]; state[job.ID] == unvisited {
+			visit(job)
+		}
+	}
+	return problems
+}
+
+// checkTemplates renders every command of the job with fake paths and checks that
+// {{index .Deps "..."}} references only dependencies of the job.
+func checkTemplates(job *Job) []error {
+	deps := make(map[ID]string, len(job.Deps))
+	for _, dep := range job.Deps {
+		deps[dep] = "/deps/" + dep.String()
+	}
+
+	ctx := JobContext{SourceDir: "/src", OutputDir: "/out", Deps: deps}
+
+	var errs []error
+	for i := range job.Cmds {
+		cmd := &job.Cmds[i]
+
+		if _, err := cmd.Render(ctx); err != nil {
+			errs = append(errs, fmt.Errorf("cmd #%d: %w", i, err))
+			continue
+		}
+
+		for _, str := range cmdStrings(cmd) {
+			for _, key := range depsKeys(str) {
+				var id ID
+				if err := id.UnmarshalText([]byte(key)); err != nil {
+					errs = append(errs, fmt.Errorf("cmd #%d: invalid dependency id %q", i, key))
+				} else if _, ok := deps[id]; !ok {
+					errs = append(errs, fmt.Errorf("cmd #%d: %s is not a dependency of the job", i, key))
+				}
+			}
+		}
+	}
+	return errs
+}
+
+func cmdStrings(cmd *Cmd) []string {
+	strs := []string{cmd.WorkingDirectory, cmd.CatTemplate, cmd.CatOutput}
+	strs = append(strs, cmd.Exec...)
+	return append(strs, cmd.Environ...)
+}
+
+// depsKeys returns constant keys used in {{index .Deps "key"}} expressions of the template.
+func depsKeys(str string) []string {
+	t, err := template.New("").Parse(str)
+	if err != nil || t.Tree == nil {
+		return nil
+	}
+
+	var keys []string
+	var walk func(node parse.Node)
+	walk = func(node parse.Node) {
+		switch n := node.(type) {
+		case *parse.ListNode:
+			if n == nil {
+				return
+			}
+			for _, child := range n.Nodes {
+				walk(child)
+			}
+
+		case *parse.ActionNode:
+			walk(n.Pipe)
+
+		case *parse.IfNode:
+			walk(&n.BranchNode)
+		case *parse.RangeNode:
+			walk(&n.BranchNode)
+		case *parse.WithNode:
+			walk(&n.BranchNode)
+
+		case *parse.BranchNode:
+			walk(n.Pipe)
+			walk(n.List)
+			walk(n.ElseList)
+
+		case *parse.PipeNode:
+			if n == nil {
+				return
+			}
+			for _, cmd := range n.Cmds {
+				walk(cmd)
+			}
+
+		case *parse.CommandNode:
+			if len(n.Args) == 3 && isIdentifier(n.Args[0], "index") && isDepsField(n.Args[1]) {
+				if key, ok := n.Args[2].(*parse.StringNode); ok {
+					keys = append(keys, key.Text)
+				}
+			}
+
+			for _, arg := range n.Args {
+				walk(arg)
+			}
+		}
+	}
+
+	walk(t.Tree.Root)
+	return keys
+}
+
+func isIdentifier(node parse.Node, name string) bool {
+	id, ok := node.(*parse.IdentifierNode)
+	return ok && id.Ident == name
+}
+
+func isDepsField(node parse.Node) bool {
+	field, ok := node.(*parse.FieldNode)
+	return ok && len(field.Ident) == 1 && field.Ident[0] == "Deps"
+}
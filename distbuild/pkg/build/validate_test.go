@@ -0,0 +1,120 @@
+package build
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func validateProblems(t *testing.T, g Graph) []Problem {
+	t.Helper()
+
+	err := Validate(g)
+	require.Error(t, err)
+
+	var verr *ValidationError
+	require.True(t, errors.As(err, &verr))
+	return verr.Problems
+}
+
+func TestValidateOK(t *testing.T) {
+	g := Graph{
+		SourceFiles: map[ID]string{{'s'}: "a.go"},
+		Jobs: []Job{
+			{
+				ID:     ID{'a'},
+				Name:   "a",
+				Inputs: []string{"a.go"},
+				Cmds: []Cmd{
+					{Exec: []string{"cp", "{{.SourceDir}}/a.go", "{{.OutputDir}}/a.go"}},
+				},
+			},
+			{
+				ID:   ID{'b'},
+				Name: "b",
+				Deps: []ID{{'a'}},
+				Cmds: []Cmd{
+					{
+						CatTemplate: `{{index .Deps "6100000000000000000000000000000000000000"}}/a.go`,
+						CatOutput:   "{{.OutputDir}}/path",
+					},
+				},
+			},
+		},
+	}
+
+	require.NoError(t, Validate(g))
+}
+
+func TestValidateCycle(t *testing.T) {
+	g := Graph{
+		Jobs: []Job{
+			{ID: ID{'a'}, Name: "a", Deps: []ID{{'b'}}},
+			{ID: ID{'b'}, Name: "b", Deps: []ID{{'c'}}},
+			{ID: ID{'c'}, Name: "c", Deps: []ID{{'a'}}},
+			{ID: ID{'d'}, Name: "d", Deps: []ID{{'a'}}},
+		},
+	}
+
+	problems := validateProblems(t, g)
+	require.Len(t, problems, 1)
+	require.Equal(t, ProblemCycle, problems[0].Kind)
+	require.Equal(t, []string{"a", "b", "c", "a"}, problems[0].Cycle)
+	require.Contains(t, problems[0].Message, "a -> b -> c -> a")
+}
+
+func TestValidateSelfLoop(t *testing.T) {
+	g := Graph{
+		Jobs: []Job{
+			{ID: ID{'a'}, Name: "a", Deps: []ID{{'a'}}},
+		},
+	}
+
+	problems := validateProblems(t, g)
+	require.Len(t, problems, 1)
+	require.Equal(t, []string{"a", "a"}, problems[0].Cycle)
+}
+
+func TestValidateProblems(t *testing.T) {
+	g := Graph{
+		SourceFiles: map[ID]string{{'s'}: "a.go"},
+		Jobs: []Job{
+			{
+				ID:     ID{'a'},
+				Name:   "a",
+				Inputs: []string{"a.go", "b.go"},
+				Deps:   []ID{{'x'}},
+			},
+			{
+				ID:   ID{'a'},
+				Name: "a copy",
+			},
+			{
+				ID:   ID{'b'},
+				Name: "b",
+				Cmds: []Cmd{
+					{Exec: []string{"{{.OutputDir"}},
+					{CatTemplate: `{{index .Deps "6100000000000000000000000000000000000000"}}`, CatOutput: "{{.OutputDir}}/a"},
+					{Exec: []string{"{{.Unknown}}"}},
+				},
+			},
+		},
+	}
+
+	problems := validateProblems(t, g)
+
+	kinds := map[ProblemKind][]string{}
+	for _, p := range problems {
+		kinds[p.Kind] = append(kinds[p.Kind], p.Name)
+	}
+
+	require.Equal(t, map[ProblemKind][]string{
+		ProblemDuplicateID:  {"a copy"},
+		ProblemDanglingDep:  {"a"},
+		ProblemMissingInput: {"a"},
+		ProblemBadTemplate:  {"b", "b", "b"},
+	}, kinds)
+
+	require.Contains(t, Validate(g).Error(), `job "a": input b.go is not in source files`)
+}
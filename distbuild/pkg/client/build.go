@@ -4,13 +4,34 @@ package client
 
 import (
 	"context"
+	"fmt"
+	"time"
 
 	"go.uber.org/zap"
 
+	"gitlab.com/slon/shad-go/distbuild/pkg/api"
 	"gitlab.com/slon/shad-go/distbuild/pkg/build"
+	"gitlab.com/slon/shad-go/distbuild/pkg/filecache"
+)
+
+const (
+	// cancelTimeout limits how long client tries to deliver cancel signal to the coordinator.
+	cancelTimeout = time.Second * 5
+
+	// reattachTimeout limits how long client tries to reattach to the build after the status
+	// stream is interrupted, e.g. by the coordinator restart.
+	reattachTimeout  = time.Second * 30
+	reattachInterval = time.Millisecond * 100
 )
 
 type Client struct {
+	l         *zap.Logger
+	build     *api.BuildClient
+	files     *filecache.Client
+	sourceDir string
+
+	tenant string
+	token  string
 }
 
 func NewClient(
@@ -18,7 +39,18 @@ func NewClient(
 	apiEndpoint string,
 	sourceDir string,
 ) *Client {
-	panic("implement me")
+	return &Client{
+		l:         l,
+		build:     api.NewBuildClient(l.Named("api"), apiEndpoint),
+		files:     filecache.NewClient(l.Named("filecache"), apiEndpoint),
+		sourceDir: sourceDir,
+	}
+}
+
+// SetTenant sets tenant, on behalf of which builds are started, and the token of the tenant.
+func (c *Client) SetTenant(tenant, token string) {
+	c.tenant = tenant
+	c.token = token
 }
 
 type BuildListener interface {
@@ -30,5 +62,205 @@ type BuildListener interface {
 }
 
 func (c *Client) Build(ctx context.Context, graph build.Graph, lsn BuildListener) error {
-	panic("implement me")
+	sources, err := c.splitSources(graph)
+	if err != nil {
+		return err
+	}
+
+	started, r, err := c.build.StartBuild(ctx, &api.BuildRequest{
+		Graph:        graph,
+		Tenant:       c.tenant,
+		Token:        c.token,
+		SourceChunks: sources.chunks,
+	})
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	l := c.l.With(zap.Stringer("build_id", started.ID))
+
+	err = c.run(ctx, started, sources, r, lsn)
+	if ctx.Err() != nil {
+		l.Info("build interrupted, cancelling", zap.Error(ctx.Err()))
+		c.cancel(ctx, started.ID)
+		return ctx.Err()
+	}
+	return err
+}
+
+func (c *Client) run(ctx context.Context, started *api.BuildStarted, sources *sourceFiles, r api.StatusReader, lsn BuildListener) error {
+	for _, id := range started.MissingFiles {
+		if err := c.upload(ctx, sources, id); err != nil {
+			return err
+		}
+	}
+
+	_, err := c.build.SignalBuild(ctx, started.ID, &api.SignalRequest{
+		Tenant:     c.tenant,
+		Token:      c.token,
+		UploadDone: &api.UploadDone{},
+	})
+	if err != nil {
+		return err
+	}
+
+	return c.follow(ctx, started.ID, r, lsn)
+}
+
+// follow reads status updates until the build is done.
+//
+// Interrupted stream is reopened from the last received update.
+func (c *Client) follow(ctx context.Context, buildID build.ID, r api.StatusReader, lsn BuildListener) error {
+	defer func() { _ = r.Close() }()
+
+	seen := 0
+	streamed := make(map[build.ID]*streamedOutput)
+	for {
+		u, err := r.Next()
+		if err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+
+			c.l.Warn("build status stream interrupted, reattaching", zap.Stringer("build_id", buildID), zap.Error(err))
+			_ = r.Close()
+
+			r, err = c.reattach(ctx, buildID, seen)
+			if err != nil {
+				return err
+			}
+			continue
+		}
+
+		// Output updates are not part of the build history and don't move the reattach offset.
+		if u.JobOutput != nil {
+			if err := reportOutput(u.JobOutput, streamed, lsn); err != nil {
+				return err
+			}
+			continue
+		}
+		seen++
+
+		switch {
+		case u.JobFinished != nil:
+			if err := reportJob(u.JobFinished, streamed, lsn); err != nil {
+				return err
+			}
+
+		case u.BuildFailed != nil:
+			return fmt.Errorf("build failed: %s", u.BuildFailed.Error)
+
+		case u.BuildFinished != nil:
+			return nil
+		}
+	}
+}
+
+func (c *Client) reattach(ctx context.Context, buildID build.ID, offset int) (api.StatusReader, error) {
+	deadline := time.Now().Add(reattachTimeout)
+	for {
+		r, err := c.build.AttachBuild(ctx, buildID, &api.AttachRequest{Tenant: c.tenant, Token: c.token, Offset: offset})
+		if err == nil {
+			return r, nil
+		}
+
+		if time.Now().After(deadline) {
+			return nil, fmt.Errorf("reattach to build %s: %w", buildID, err)
+		}
+
+		select {
+		case <-time.After(reattachInterval):
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
+
+// cancel asks coordinator to stop the build. ctx is already canceled at this point, so
+// signal is sent with a separate deadline.
+func (c *Client) cancel(ctx context.Context, buildID build.ID) {
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), cancelTimeout)
+	defer cancel()
+
+	_, err := c.build.SignalBuild(ctx, buildID, &api.SignalRequest{Tenant: c.tenant, Token: c.token, Cancel: &api.Cancel{}})
+	if err != nil {
+		c.l.Warn("failed to cancel build", zap.Stringer("build_id", buildID), zap.Error(err))
+	}
+}
+
+// streamedOutput tracks how much of the job output was already passed to the listener.
+type streamedOutput struct {
+	stdout, stderr int
+	finished       bool
+}
+
+// unseen returns part of the chunk starting at offset, that wasn't passed to the listener yet.
+func unseen(chunk []byte, offset, seen int) []byte {
+	if offset > seen || offset+len(chunk) <= seen {
+		return nil
+	}
+	return chunk[seen-offset:]
+}
+
+// reportOutput passes output of the running job to the listener.
+//
+// Chunks may be lost or repeated, so only the continuation of the already reported output is used.
+// The rest is reported when the job is finished.
+func reportOutput(out *api.JobOutput, streamed map[build.ID]*streamedOutput, lsn BuildListener) error {
+	s, ok := streamed[out.ID]
+	if !ok {
+		s = &streamedOutput{}
+		streamed[out.ID] = s
+	}
+
+	if s.finished {
+		return nil
+	}
+
+	if chunk := unseen(out.Stdout, out.StdoutOffset, s.stdout); len(chunk) != 0 {
+		if err := lsn.OnJobStdout(out.ID, chunk); err != nil {
+			return err
+		}
+		s.stdout += len(chunk)
+	}
+
+	if chunk := unseen(out.Stderr, out.StderrOffset, s.stderr); len(chunk) != 0 {
+		if err := lsn.OnJobStderr(out.ID, chunk); err != nil {
+			return err
+		}
+		s.stderr += len(chunk)
+	}
+	return nil
+}
+
+func reportJob(res *api.JobResult, streamed map[build.ID]*streamedOutput, lsn BuildListener) error {
+	s, ok := streamed[res.ID]
+	if !ok {
+		s = &streamedOutput{}
+		streamed[res.ID] = s
+	}
+	s.finished = true
+
+	if stdout := unseen(res.Stdout, 0, s.stdout); len(stdout) != 0 {
+		if err := lsn.OnJobStdout(res.ID, stdout); err != nil {
+			return err
+		}
+	}
+
+	if stderr := unseen(res.Stderr, 0, s.stderr); len(stderr) != 0 {
+		if err := lsn.OnJobStderr(res.ID, stderr); err != nil {
+			return err
+		}
+	}
+
+	if res.Error != nil || res.ExitCode != 0 {
+		var errorString string
+		if res.Error != nil {
+			errorString = *res.Error
+		}
+		return lsn.OnJobFailed(res.ID, res.ExitCode, errorString)
+	}
+
+	return lsn.OnJobFinished(res.ID)
 }
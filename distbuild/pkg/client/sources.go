@@ -0,0 +1,89 @@
+//go:build !solution
+
+package client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"gitlab.com/slon/shad-go/distbuild/pkg/build"
+	"gitlab.com/slon/shad-go/distbuild/pkg/filecache"
+)
+
+// sourceFiles indexes source files of the build and chunks of the large files.
+type sourceFiles struct {
+	files map[build.ID]string
+
+	// chunks lists chunks of the files uploaded in chunks.
+	chunks map[build.ID][]build.ID
+	// chunkSources maps chunk to the file it is read from.
+	chunkSources map[build.ID]chunkSource
+}
+
+type chunkSource struct {
+	path  string
+	chunk filecache.Chunk
+}
+
+// splitSources splits source files larger than a single chunk into chunks.
+//
+// Smaller files are uploaded whole, since chunking gives nothing for them.
+func (c *Client) splitSources(graph build.Graph) (*sourceFiles, error) {
+	sources := &sourceFiles{
+		files:        graph.SourceFiles,
+		chunkSources: make(map[build.ID]chunkSource),
+	}
+
+	for id, path := range graph.SourceFiles {
+		path = filepath.Join(c.sourceDir, path)
+
+		// Missing file is reported only if coordinator requests it.
+		st, err := os.Stat(path)
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+		if st.Size() <= filecache.MaxChunkSize {
+			continue
+		}
+
+		chunks, err := filecache.SplitFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("split %s: %w", path, err)
+		}
+
+		if sources.chunks == nil {
+			sources.chunks = make(map[build.ID][]build.ID)
+		}
+		for _, chunk := range chunks {
+			sources.chunks[id] = append(sources.chunks[id], chunk.ID)
+			sources.chunkSources[chunk.ID] = chunkSource{path: path, chunk: chunk}
+		}
+	}
+
+	return sources, nil
+}
+
+// upload uploads file or chunk requested by the coordinator.
+func (c *Client) upload(ctx context.Context, sources *sourceFiles, id build.ID) error {
+	if path, ok := sources.files[id]; ok {
+		if err := c.files.Upload(ctx, id, filepath.Join(c.sourceDir, path)); err != nil {
+			return fmt.Errorf("upload %s: %w", path, err)
+		}
+		return nil
+	}
+
+	src, ok := sources.chunkSources[id]
+	if !ok {
+		return fmt.Errorf("coordinator requested unknown file %s", id)
+	}
+
+	if err := c.files.UploadChunk(ctx, src.path, src.chunk); err != nil {
+		return fmt.Errorf("upload chunk of %s: %w", src.path, err)
+	}
+	return nil
+}
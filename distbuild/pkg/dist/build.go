@@ -0,0 +1,601 @@
+//go:build !solution
+
+package dist
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+
+	"gitlab.com/slon/shad-go/distbuild/pkg/api"
+	"gitlab.com/slon/shad-go/distbuild/pkg/build"
+	"gitlab.com/slon/shad-go/distbuild/pkg/scheduler"
+	"gitlab.com/slon/shad-go/distbuild/pkg/trace"
+)
+
+// detachTimeout is how long build keeps running after the last client disconnected.
+// Client may reattach to the build during this time.
+const detachTimeout = time.Second * 10
+
+// scheduledJob is a job of the build, which is passed to the scheduler and is not finished yet.
+type scheduledJob struct {
+	pending *scheduler.PendingJob
+	span    *trace.ActiveSpan
+	start   time.Time
+}
+
+type Build struct {
+	ID    build.ID
+	Graph *build.Graph
+
+	// Tenant is the tenant that started the build. Jobs of the build are accounted to this tenant.
+	Tenant string
+
+	c     *Coordinator
+	l     *zap.Logger
+	trace *trace.Trace
+
+	// sourceChunks lists chunks of the source files, which client uploads in chunks.
+	sourceChunks map[build.ID][]build.ID
+
+	uploadDone     chan struct{}
+	uploadDoneOnce sync.Once
+
+	cancelled     chan struct{}
+	cancelledOnce sync.Once
+
+	// finished holds results of the jobs that are known before the build is executed. Such results are
+	// either recovered from the journal, or found in the artifact cache of the workers.
+	finished map[build.ID]*api.JobResult
+
+	mu sync.Mutex
+	// updates is the history of the status stream. Clients attach to the build at arbitrary offset.
+	updates []*api.StatusUpdate
+	done    bool
+	// changed is closed and replaced every time updates are appended.
+	changed chan struct{}
+
+	// live holds output of the running jobs. Unlike updates, it is not journaled and every attached
+	// client receives it from the beginning. Output of the job is dropped, when the job is finished,
+	// since JobFinished carries its whole stdout and stderr.
+	live map[build.ID][]*api.StatusUpdate
+	// streaming is the set of jobs, which output is forwarded to the clients.
+	streaming map[build.ID]bool
+
+	clients     int
+	detachTimer *time.Timer
+}
+
+func newBuild(c *Coordinator, id build.ID, graph *build.Graph) *Build {
+	return &Build{
+		ID:    id,
+		Graph: graph,
+		c:     c,
+		l:     c.log.With(zap.Stringer("build_id", id)),
+		trace: trace.New("build", map[string]string{
+			"build_id": id.String(),
+			"jobs":     strconv.Itoa(len(graph.Jobs)),
+		}),
+		uploadDone: make(chan struct{}),
+		cancelled:  make(chan struct{}),
+		finished:   make(map[build.ID]*api.JobResult),
+		changed:    make(chan struct{}),
+		live:       make(map[build.ID][]*api.StatusUpdate),
+		streaming:  make(map[build.ID]bool),
+	}
+}
+
+// recover restores progress of the build from the journal.
+func (b *Build) recover(rb *recoveredBuild) {
+	b.Tenant = rb.Tenant
+	b.sourceChunks = rb.SourceChunks
+
+	if rb.UploadDone {
+		b.onUploadDone()
+	}
+
+	for i := range rb.Results {
+		res := &rb.Results[i]
+		b.finished[res.ID] = res
+		b.updates = append(b.updates, &api.StatusUpdate{JobFinished: res})
+
+		span := b.startJobSpan(res.ID)
+		span.SetAttribute("recovered", "true")
+		endJobSpan(span, res)
+	}
+
+	// Nobody is attached to the recovered build yet.
+	b.detach()
+}
+
+// skipCached marks jobs, which results are found in the artifact cache, as finished.
+func (b *Build) skipCached(results []*api.JobResult) error {
+	for _, res := range results {
+		if err := b.publish(&api.StatusUpdate{JobFinished: res}); err != nil {
+			return err
+		}
+		b.finished[res.ID] = res
+
+		span := b.startJobSpan(res.ID)
+		span.SetAttribute("cached", "true")
+		endJobSpan(span, res)
+	}
+	return nil
+}
+
+func (b *Build) jobName(jobID build.ID) string {
+	for i := range b.Graph.Jobs {
+		if b.Graph.Jobs[i].ID == jobID {
+			return b.Graph.Jobs[i].Name
+		}
+	}
+	return jobID.String()
+}
+
+func (b *Build) startJobSpan(jobID build.ID) *trace.ActiveSpan {
+	name := b.jobName(jobID)
+	return b.trace.Start("job "+name, map[string]string{
+		"job_id": jobID.String(),
+		"name":   name,
+	})
+}
+
+func endJobSpan(span *trace.ActiveSpan, res *api.JobResult) {
+	span.SetAttribute("exit_code", strconv.Itoa(res.ExitCode))
+
+	switch {
+	case res.Error != nil:
+		span.End(errors.New(*res.Error))
+	case res.ExitCode != 0:
+		span.End(fmt.Errorf("exit code %d", res.ExitCode))
+	default:
+		span.End(nil)
+	}
+}
+
+func (b *Build) onUploadDone() {
+	b.uploadDoneOnce.Do(func() {
+		close(b.uploadDone)
+	})
+}
+
+func (b *Build) onCancel() {
+	b.cancelledOnce.Do(func() {
+		close(b.cancelled)
+	})
+}
+
+func (b *Build) attach() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.clients++
+	if b.detachTimer != nil {
+		b.detachTimer.Stop()
+		b.detachTimer = nil
+	}
+}
+
+// detach cancels the build, if no client attaches to it during detachTimeout.
+func (b *Build) detach() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.clients > 0 {
+		b.clients--
+	}
+
+	if b.clients > 0 || b.done || b.detachTimer != nil {
+		return
+	}
+
+	b.detachTimer = time.AfterFunc(detachTimeout, func() {
+		b.mu.Lock()
+		orphaned := b.clients == 0 && !b.done
+		b.mu.Unlock()
+
+		if orphaned {
+			b.l.Info("all clients detached from the build, cancelling")
+			b.onCancel()
+		}
+	})
+}
+
+// publish appends update to the status stream.
+//
+// Finished job is written to the journal before it becomes visible to the clients.
+func (b *Build) publish(u *api.StatusUpdate) error {
+	if u.JobFinished != nil {
+		err := b.c.journal.append(journalRecord{JobFinished: &journalJob{BuildID: b.ID, Result: *u.JobFinished}})
+		if err != nil {
+			return fmt.Errorf("write journal: %w", err)
+		}
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.updates = append(b.updates, u)
+	if u.JobFinished != nil {
+		delete(b.live, u.JobFinished.ID)
+	}
+	if u.BuildFailed != nil || u.BuildFinished != nil {
+		if u.BuildFailed != nil {
+			b.c.metrics.builds.WithLabelValues("failed").Inc()
+			b.trace.Root().End(errors.New(u.BuildFailed.Error))
+		} else {
+			b.c.metrics.builds.WithLabelValues("finished").Inc()
+			b.trace.Root().End(nil)
+		}
+
+		b.done = true
+		clear(b.live)
+		if b.detachTimer != nil {
+			b.detachTimer.Stop()
+			b.detachTimer = nil
+		}
+	}
+
+	close(b.changed)
+	b.changed = make(chan struct{})
+	return nil
+}
+
+// setStreaming enables or disables forwarding of the job output.
+func (b *Build) setStreaming(jobID build.ID, enabled bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if enabled {
+		b.streaming[jobID] = true
+	} else {
+		delete(b.streaming, jobID)
+	}
+}
+
+// forwardOutput sends output of the running job to the attached clients.
+func (b *Build) forwardOutput(out *api.JobOutput) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if !b.streaming[out.ID] {
+		return
+	}
+
+	b.live[out.ID] = append(b.live[out.ID], &api.StatusUpdate{JobOutput: out})
+	close(b.changed)
+	b.changed = make(chan struct{})
+}
+
+// isDone reports whether the final update of the build is published.
+func (b *Build) isDone() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return b.done
+}
+
+// stream writes status updates starting at offset from, until the build is done.
+//
+// If coordinator stops, stream is closed without the final update and client is expected to reattach.
+func (b *Build) stream(ctx context.Context, from int, w api.StatusWriter) error {
+	b.attach()
+	defer b.detach()
+
+	// sent counts output chunks of the running jobs, that are already written to the client.
+	sent := make(map[build.ID]int)
+	for {
+		b.mu.Lock()
+		var updates []*api.StatusUpdate
+		if from < len(b.updates) {
+			updates = b.updates[from:]
+		}
+
+		var live []*api.StatusUpdate
+		for id := range sent {
+			if _, ok := b.live[id]; !ok {
+				delete(sent, id)
+			}
+		}
+		for id, chunks := range b.live {
+			live = append(live, chunks[sent[id]:]...)
+			sent[id] = len(chunks)
+		}
+		done, changed := b.done, b.changed
+		b.mu.Unlock()
+
+		for _, u := range updates {
+			if err := w.Updated(u); err != nil {
+				return err
+			}
+		}
+		from += len(updates)
+
+		if !done {
+			for _, u := range live {
+				if err := w.Updated(u); err != nil {
+					return err
+				}
+			}
+		}
+
+		if done {
+			return nil
+		}
+
+		select {
+		case <-changed:
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-b.c.ctx.Done():
+			return nil
+		}
+	}
+}
+
+var (
+	errBuildCancelled = errors.New("build cancelled")
+	errJobCancelled   = errors.New("job cancelled")
+)
+
+func (b *Build) failCancelled() error {
+	return b.publish(&api.StatusUpdate{BuildFailed: &api.BuildFailed{Error: errBuildCancelled.Error()}})
+}
+
+// neededFiles returns source files required by the unfinished jobs.
+func (b *Build) neededFiles() []build.ID {
+	needed := make(map[string]struct{})
+	for _, job := range b.Graph.Jobs {
+		if _, ok := b.finished[job.ID]; ok {
+			continue
+		}
+
+		for _, path := range job.Inputs {
+			needed[path] = struct{}{}
+		}
+	}
+
+	var files []build.ID
+	for id, path := range b.Graph.SourceFiles {
+		if _, ok := needed[path]; ok {
+			files = append(files, id)
+		}
+	}
+	return files
+}
+
+// missingFiles returns source files and chunks that are not present in the coordinator cache.
+//
+// Inputs of the finished jobs are not needed. Files uploaded in chunks are assembled after the upload.
+func (b *Build) missingFiles() []build.ID {
+	var missing []build.ID
+	requested := make(map[build.ID]struct{})
+	request := func(id build.ID) {
+		if _, ok := requested[id]; ok {
+			return
+		}
+		requested[id] = struct{}{}
+
+		_, unlock, err := b.c.fileCache.Get(id)
+		if err != nil {
+			missing = append(missing, id)
+			return
+		}
+		unlock()
+	}
+
+	for _, id := range b.neededFiles() {
+		chunks, ok := b.sourceChunks[id]
+		if !ok {
+			request(id)
+			continue
+		}
+
+		if _, unlock, err := b.c.fileCache.Get(id); err == nil {
+			unlock()
+			continue
+		}
+
+		for _, chunk := range chunks {
+			request(chunk)
+		}
+	}
+	return missing
+}
+
+// assembleFiles assembles source files uploaded in chunks.
+func (b *Build) assembleFiles() error {
+	for _, id := range b.neededFiles() {
+		chunks, ok := b.sourceChunks[id]
+		if !ok {
+			continue
+		}
+
+		if err := b.c.fileCache.Assemble(id, chunks); err != nil {
+			return fmt.Errorf("source file %s: %w", b.Graph.SourceFiles[id], err)
+		}
+	}
+	return nil
+}
+
+// run executes the build and reports whether it is done.
+//
+// Build interrupted by the coordinator stop is not done and is resumed after restart.
+func (b *Build) run(ctx context.Context) bool {
+	err := b.execute(ctx)
+	if ctx.Err() != nil {
+		return false
+	}
+
+	if err != nil {
+		b.l.Error("build failed", zap.Error(err))
+		if err := b.publish(&api.StatusUpdate{BuildFailed: &api.BuildFailed{Error: err.Error()}}); err != nil {
+			b.l.Error("failed to publish build failure", zap.Error(err))
+		}
+	}
+	return true
+}
+
+// execute schedules every job as soon as all of its dependencies are finished.
+//
+// If build stops before all jobs are finished, unfinished jobs are cancelled in the scheduler.
+func (b *Build) execute(ctx context.Context) error {
+	b.l.Debug("waiting for source files upload")
+	upload := b.trace.Start("upload", nil)
+	select {
+	case <-b.uploadDone:
+		err := b.assembleFiles()
+		upload.End(err)
+		if err != nil {
+			return err
+		}
+	case <-b.cancelled:
+		upload.End(errBuildCancelled)
+		return b.failCancelled()
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	scheduled := make(map[build.ID]*scheduledJob)
+	defer func() {
+		for _, job := range scheduled {
+			b.c.scheduler.CancelJob(job.pending)
+			job.span.End(errJobCancelled)
+		}
+	}()
+
+	jobs := b.Graph.Jobs
+	priority := build.CriticalPath(jobs)
+
+	inputs := make(map[string]build.ID, len(b.Graph.SourceFiles))
+	for id, path := range b.Graph.SourceFiles {
+		inputs[path] = id
+	}
+
+	for _, res := range b.finished {
+		if res.Error != nil || res.ExitCode != 0 {
+			return b.failJob(res.ID)
+		}
+	}
+
+	remaining := 0
+	waiting := make(map[build.ID]int, len(jobs))
+	dependents := make(map[build.ID][]*build.Job)
+	for i := range jobs {
+		job := &jobs[i]
+		if _, ok := b.finished[job.ID]; ok {
+			continue
+		}
+
+		remaining++
+		for _, dep := range job.Deps {
+			if _, ok := b.finished[dep]; !ok {
+				waiting[job.ID]++
+				dependents[dep] = append(dependents[dep], job)
+			}
+		}
+	}
+
+	finished := make(chan *scheduler.PendingJob, len(jobs))
+	schedule := func(job *build.Job) {
+		spec := &api.JobSpec{
+			SourceFiles: make(map[build.ID]string, len(job.Inputs)),
+			Artifacts:   make(map[build.ID]api.WorkerID, len(job.Deps)),
+			Priority:    priority[job.ID],
+			Tenant:      b.Tenant,
+			Job:         *job,
+		}
+
+		for _, path := range job.Inputs {
+			if id, ok := inputs[path]; ok {
+				spec.SourceFiles[id] = path
+			}
+		}
+
+		for _, dep := range job.Deps {
+			if workerID, ok := b.c.scheduler.LocateArtifact(dep); ok {
+				spec.Artifacts[dep] = workerID
+			}
+		}
+
+		b.l.Debug("scheduling job", zap.Stringer("job_id", job.ID), zap.String("name", job.Name), zap.Int("priority", spec.Priority))
+		pending := b.c.scheduler.ScheduleJob(spec)
+		b.setStreaming(job.ID, true)
+		scheduled[job.ID] = &scheduledJob{
+			pending: pending,
+			span:    b.startJobSpan(job.ID),
+			start:   time.Now(),
+		}
+		go func() {
+			select {
+			case <-pending.Finished:
+				finished <- pending
+			case <-ctx.Done():
+			}
+		}()
+	}
+
+	for i := range jobs {
+		if _, ok := b.finished[jobs[i].ID]; !ok && waiting[jobs[i].ID] == 0 {
+			schedule(&jobs[i])
+		}
+	}
+
+	for ; remaining > 0; remaining-- {
+		var pending *scheduler.PendingJob
+		select {
+		case pending = <-finished:
+		case <-b.cancelled:
+			return b.failCancelled()
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+		job := scheduled[pending.Job.ID]
+		delete(scheduled, pending.Job.ID)
+		b.setStreaming(pending.Job.ID, false)
+
+		res := pending.Result
+		endJobSpan(job.span, res)
+
+		status := "ok"
+		if res.Error != nil || res.ExitCode != 0 {
+			status = "failed"
+		}
+		b.c.metrics.jobDuration.WithLabelValues(status).Observe(time.Since(job.start).Seconds())
+
+		if err := b.publish(&api.StatusUpdate{JobFinished: res}); err != nil {
+			return err
+		}
+
+		if res.Error != nil || res.ExitCode != 0 {
+			return b.failJob(res.ID)
+		}
+
+		for _, job := range dependents[pending.Job.ID] {
+			waiting[job.ID]--
+			if waiting[job.ID] == 0 {
+				schedule(job)
+			}
+		}
+	}
+
+	b.l.Info("build finished")
+	return b.publish(&api.StatusUpdate{BuildFinished: &api.BuildFinished{}})
+}
+
+func (b *Build) failJob(jobID build.ID) error {
+	name := b.jobName(jobID)
+
+	b.l.Info("build failed", zap.Stringer("job_id", jobID))
+	return b.publish(&api.StatusUpdate{
+		BuildFailed: &api.BuildFailed{Error: fmt.Sprintf("job %q failed", name)},
+	})
+}
@@ -0,0 +1,84 @@
+//go:build !solution
+
+package dist
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap/zaptest"
+
+	"gitlab.com/slon/shad-go/distbuild/pkg/api"
+	"gitlab.com/slon/shad-go/distbuild/pkg/build"
+	"gitlab.com/slon/shad-go/distbuild/pkg/filecache"
+)
+
+type updateRecorder struct {
+	updates chan *api.StatusUpdate
+}
+
+func (r *updateRecorder) Started(rsp *api.BuildStarted) error { return nil }
+
+func (r *updateRecorder) Updated(u *api.StatusUpdate) error {
+	r.updates <- u
+	return nil
+}
+
+func (r *updateRecorder) next(t *testing.T) *api.StatusUpdate {
+	select {
+	case u := <-r.updates:
+		return u
+	case <-time.After(5 * time.Second):
+		t.Fatal("status update is not received")
+		return nil
+	}
+}
+
+func TestBuildLiveOutput(t *testing.T) {
+	fileCache, err := filecache.New(t.TempDir())
+	require.NoError(t, err)
+
+	c := NewCoordinator(zaptest.NewLogger(t), fileCache)
+	defer c.Stop()
+
+	jobA, jobB := build.ID{'a'}, build.ID{'b'}
+	b := newBuild(c, build.NewID(), &build.Graph{Jobs: []build.Job{{ID: jobA}, {ID: jobB}}})
+	b.setStreaming(jobA, true)
+	b.setStreaming(jobB, true)
+
+	b.forwardOutput(&api.JobOutput{ID: jobA, Stdout: []byte("a1")})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	r := &updateRecorder{updates: make(chan *api.StatusUpdate, 16)}
+	go func() { _ = b.stream(ctx, 0, r) }()
+
+	require.Equal(t, []byte("a1"), r.next(t).JobOutput.Stdout)
+
+	b.forwardOutput(&api.JobOutput{ID: jobA, Stdout: []byte("a2")})
+	require.Equal(t, []byte("a2"), r.next(t).JobOutput.Stdout)
+
+	require.NoError(t, b.publish(&api.StatusUpdate{JobFinished: &api.JobResult{ID: jobA, Stdout: []byte("a1a2")}}))
+	require.Equal(t, jobA, r.next(t).JobFinished.ID)
+
+	b.mu.Lock()
+	require.NotContains(t, b.live, jobA, "output of the finished job must be dropped")
+	b.mu.Unlock()
+
+	b.forwardOutput(&api.JobOutput{ID: jobB, Stdout: []byte("b1")})
+	require.Equal(t, []byte("b1"), r.next(t).JobOutput.Stdout)
+
+	// Client attached later receives history of the updates and output of the running jobs only.
+	late := &updateRecorder{updates: make(chan *api.StatusUpdate, 16)}
+	go func() { _ = b.stream(ctx, 0, late) }()
+
+	require.Equal(t, jobA, late.next(t).JobFinished.ID)
+	require.Equal(t, []byte("b1"), late.next(t).JobOutput.Stdout)
+
+	require.NoError(t, b.publish(&api.StatusUpdate{BuildFinished: &api.BuildFinished{}}))
+	require.NotNil(t, r.next(t).BuildFinished)
+	require.NotNil(t, late.next(t).BuildFinished)
+}
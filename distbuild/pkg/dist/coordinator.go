@@ -3,32 +3,521 @@
 package dist
 
 import (
+	"context"
+	"errors"
+	"fmt"
 	"net/http"
+	"path/filepath"
+	"sync"
 	"time"
 
 	"go.uber.org/zap"
+	"golang.org/x/sync/errgroup"
 
+	"gitlab.com/slon/shad-go/distbuild/pkg/api"
+	"gitlab.com/slon/shad-go/distbuild/pkg/build"
 	"gitlab.com/slon/shad-go/distbuild/pkg/filecache"
+	"gitlab.com/slon/shad-go/distbuild/pkg/metrics"
 	"gitlab.com/slon/shad-go/distbuild/pkg/scheduler"
 )
 
 type Coordinator struct {
+	log       *zap.Logger
+	fileCache *filecache.Cache
+	scheduler *scheduler.Scheduler
+	journal   *journal
+	metrics   *coordinatorMetrics
+	mux       *http.ServeMux
+	handler   http.Handler
+
+	tokens  TokenValidator
+	tenants map[string]scheduler.TenantConfig
+	results *resultCache
+
+	// traceDir is where traces of the finished builds are written. Empty means tracing is disabled.
+	traceDir string
+
+	// ctx is canceled when coordinator stops. Builds are running inside this context.
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+
+	mu     sync.Mutex
+	builds map[build.ID]*Build
+}
+
+// Config describes coordinator settings.
+type Config struct {
+	Scheduler scheduler.Config
+
+	// JournalPath sets location of the write-ahead journal of the coordinator state.
+	//
+	// Builds found in the journal are resumed on start. Empty path disables persistence.
+	JournalPath string
+
+	// TraceDir sets directory, where trace of every finished build is written as <build id>.json.
+	// Empty directory disables tracing.
+	TraceDir string
+
+	// Tenants sets shares of the tenants in the scheduler. When Tenants is not empty, builds of other
+	// tenants are rejected with ErrUnknownTenant.
+	Tenants map[string]scheduler.TenantConfig
+
+	// Tokens checks tenant and token passed in the requests of the clients. Nil validator accepts any tenant.
+	Tokens TokenValidator
+
+	// AdminToken is required in the Authorization header of the /admin requests.
+	// Empty token disables /admin endpoints.
+	AdminToken string
 }
 
-var defaultConfig = scheduler.Config{
+// DefaultSchedulerConfig is used by coordinator, when scheduler config is not set.
+var DefaultSchedulerConfig = scheduler.Config{
 	CacheTimeout: time.Millisecond * 10,
 	DepsTimeout:  time.Millisecond * 100,
+
+	HeartbeatTimeout:    time.Second * 5,
+	MaxAttempts:         3,
+	QuarantineThreshold: 3,
+	QuarantineDuration:  time.Minute,
 }
 
+const (
+	// heartbeatTimeout limits how long heartbeat waits for a new job when worker has free slots.
+	heartbeatTimeout = time.Millisecond * 100
+
+	// finishedBuildTTL is how long finished build is kept in memory, so that clients may reattach to it.
+	finishedBuildTTL = time.Minute
+
+	// cachedResultTimeout limits how long StartBuild waits for results of the cached jobs from workers.
+	cachedResultTimeout     = time.Second
+	cachedResultConcurrency = 16
+)
+
 func NewCoordinator(
 	log *zap.Logger,
 	fileCache *filecache.Cache,
 ) *Coordinator {
-	panic("implement me")
+	return newCoordinator(log, fileCache, Config{Scheduler: DefaultSchedulerConfig}, nil)
+}
+
+// OpenCoordinator creates coordinator and resumes builds stored in the journal.
+//
+// Zero config.Scheduler is replaced with the default scheduler settings.
+func OpenCoordinator(
+	log *zap.Logger,
+	fileCache *filecache.Cache,
+	config Config,
+) (*Coordinator, error) {
+	if config.Scheduler == (scheduler.Config{}) {
+		config.Scheduler = DefaultSchedulerConfig
+	}
+
+	if config.JournalPath == "" {
+		return newCoordinator(log, fileCache, config, nil), nil
+	}
+
+	j, records, err := openJournal(config.JournalPath)
+	if err != nil {
+		return nil, fmt.Errorf("open journal: %w", err)
+	}
+
+	state := replayJournal(records)
+	if err := j.rewrite(state.records()); err != nil {
+		_ = j.close()
+		return nil, fmt.Errorf("compact journal: %w", err)
+	}
+
+	c := newCoordinator(log, fileCache, config, j)
+	c.recover(state)
+	return c, nil
+}
+
+func newCoordinator(
+	log *zap.Logger,
+	fileCache *filecache.Cache,
+	config Config,
+	j *journal,
+) *Coordinator {
+	c := &Coordinator{
+		log:       log,
+		fileCache: fileCache,
+		scheduler: scheduler.NewScheduler(log.Named("scheduler"), config.Scheduler, time.After),
+		journal:   j,
+		mux:       http.NewServeMux(),
+		tokens:    config.Tokens,
+		tenants:   config.Tenants,
+		results:   newResultCache(),
+		traceDir:  config.TraceDir,
+		builds:    make(map[build.ID]*Build),
+	}
+	c.ctx, c.cancel = context.WithCancel(context.Background())
+	for name, tenant := range config.Tenants {
+		c.scheduler.SetTenant(name, tenant)
+	}
+	c.metrics = newCoordinatorMetrics(c.scheduler)
+	c.handler = metrics.CountBytes(c.mux, c.metrics.registry)
+
+	api.NewBuildService(log.Named("build"), c).Register(c.mux)
+	api.NewHeartbeatHandler(log.Named("heartbeat"), c).Register(c.mux)
+	filecache.NewHandler(log.Named("filecache"), fileCache).Register(c.mux)
+	c.mux.Handle("GET /metrics", metrics.Handler(c.metrics.registry))
+	if config.AdminToken != "" {
+		c.mux.Handle("GET /admin/tenants", c.requireAdmin(config.AdminToken, c.getTenants))
+	}
+
+	return c
+}
+
+func (c *Coordinator) recover(state *journalState) {
+	for _, a := range state.artifacts {
+		c.scheduler.RegisterArtifact(a.WorkerID, a.ID)
+	}
+
+	for _, rb := range state.builds {
+		b := newBuild(c, rb.ID, &rb.Graph)
+		b.recover(rb)
+
+		c.log.Info("resuming build",
+			zap.Stringer("build_id", b.ID),
+			zap.Bool("upload_done", rb.UploadDone),
+			zap.Int("finished_jobs", len(rb.Results)))
+
+		c.startBuild(b)
+	}
 }
 
-func (c *Coordinator) Stop() {}
+func (c *Coordinator) Stop() {
+	c.cancel()
+	c.wg.Wait()
+	c.scheduler.Stop()
+
+	if err := c.journal.close(); err != nil {
+		c.log.Error("failed to close journal", zap.Error(err))
+	}
+}
 
 func (c *Coordinator) ServeHTTP(w http.ResponseWriter, r *http.Request) {
-	panic("implement me")
+	c.handler.ServeHTTP(w, r)
+}
+
+func (c *Coordinator) startBuild(b *Build) {
+	c.mu.Lock()
+	c.builds[b.ID] = b
+	c.mu.Unlock()
+
+	c.wg.Add(1)
+	go func() {
+		defer c.wg.Done()
+
+		if !b.run(c.ctx) {
+			return
+		}
+
+		if err := c.journal.append(journalRecord{BuildDone: &b.ID}); err != nil {
+			c.log.Error("failed to write journal", zap.Error(err))
+		}
+
+		c.writeTrace(b)
+		c.expireBuild(b.ID)
+	}()
+}
+
+// writeTrace saves trace of the finished build into the trace directory.
+func (c *Coordinator) writeTrace(b *Build) {
+	if c.traceDir == "" {
+		return
+	}
+
+	path := filepath.Join(c.traceDir, b.ID.String()+".json")
+	if err := b.trace.WriteFile(path); err != nil {
+		c.log.Error("failed to write build trace", zap.Stringer("build_id", b.ID), zap.Error(err))
+	}
+}
+
+// expireBuild removes finished build from memory after finishedBuildTTL.
+func (c *Coordinator) expireBuild(buildID build.ID) {
+	time.AfterFunc(finishedBuildTTL, func() {
+		c.mu.Lock()
+		delete(c.builds, buildID)
+		c.mu.Unlock()
+	})
+}
+
+// forwardOutput sends output of the running jobs to the builds waiting for them.
+func (c *Coordinator) forwardOutput(output []api.JobOutput) {
+	c.mu.Lock()
+	builds := make([]*Build, 0, len(c.builds))
+	for _, b := range c.builds {
+		builds = append(builds, b)
+	}
+	c.mu.Unlock()
+
+	for i := range output {
+		for _, b := range builds {
+			b.forwardOutput(&output[i])
+		}
+	}
+}
+
+func (c *Coordinator) validateToken(ctx context.Context, tenant, token string) error {
+	if c.tokens == nil {
+		return nil
+	}
+
+	if err := c.tokens.ValidateToken(ctx, tenant, token); err != nil {
+		c.log.Warn("request rejected", zap.String("tenant", tenant), zap.Error(err))
+		return fmt.Errorf("tenant %q: %w", tenant, err)
+	}
+	return nil
+}
+
+// lookupBuild returns the build started by the tenant.
+//
+// Builds of other tenants are reported as missing, so that clients can't probe build IDs.
+func (c *Coordinator) lookupBuild(ctx context.Context, buildID build.ID, tenant, token string) (*Build, error) {
+	if err := c.validateToken(ctx, tenant, token); err != nil {
+		return nil, err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	b, ok := c.builds[buildID]
+	if !ok || b.Tenant != tenant {
+		return nil, fmt.Errorf("build %s not found", buildID)
+	}
+	return b, nil
+}
+
+func (c *Coordinator) StartBuild(ctx context.Context, request *api.BuildRequest, w api.StatusWriter) error {
+	if err := c.validateToken(ctx, request.Tenant, request.Token); err != nil {
+		return err
+	}
+
+	if err := c.checkTenant(request.Tenant); err != nil {
+		return err
+	}
+
+	b := newBuild(c, build.NewID(), &request.Graph)
+	b.Tenant = request.Tenant
+	b.sourceChunks = request.SourceChunks
+
+	if err := build.Validate(request.Graph); err != nil {
+		return c.rejectBuild(ctx, b, err, w)
+	}
+
+	err := c.journal.append(journalRecord{BuildStarted: &journalBuild{
+		ID:           b.ID,
+		Graph:        request.Graph,
+		Tenant:       request.Tenant,
+		SourceChunks: request.SourceChunks,
+	}})
+	if err != nil {
+		return fmt.Errorf("write journal: %w", err)
+	}
+
+	if err := b.skipCached(c.cachedResults(ctx, request.Graph.Jobs)); err != nil {
+		return err
+	}
+
+	started := &api.BuildStarted{
+		ID:           b.ID,
+		MissingFiles: b.missingFiles(),
+	}
+
+	c.log.Info("build started",
+		zap.Stringer("build_id", b.ID),
+		zap.String("tenant", b.Tenant),
+		zap.Int("jobs", len(request.Graph.Jobs)),
+		zap.Int("cached_jobs", len(b.finished)))
+	c.startBuild(b)
+
+	if err := w.Started(started); err != nil {
+		b.detach()
+		return err
+	}
+
+	return b.stream(ctx, 0, w)
+}
+
+// rejectBuild fails the build with invalid graph before anything runs.
+//
+// Rejected build is not journaled, but it is kept in memory for a while, so that client follows it as usual.
+func (c *Coordinator) rejectBuild(ctx context.Context, b *Build, err error, w api.StatusWriter) error {
+	c.log.Info("build rejected", zap.Stringer("build_id", b.ID), zap.Error(err))
+
+	failed := &api.BuildFailed{Error: err.Error()}
+	var verr *build.ValidationError
+	if errors.As(err, &verr) {
+		failed.Problems = verr.Problems
+	}
+
+	if err := b.publish(&api.StatusUpdate{BuildFailed: failed}); err != nil {
+		return err
+	}
+	c.writeTrace(b)
+
+	c.mu.Lock()
+	c.builds[b.ID] = b
+	c.mu.Unlock()
+	c.expireBuild(b.ID)
+
+	if err := w.Started(&api.BuildStarted{ID: b.ID}); err != nil {
+		return err
+	}
+	return b.stream(ctx, 0, w)
+}
+
+// cachedResults returns results of the jobs, which artifacts are stored on some worker.
+//
+// Results of the jobs finished since coordinator start are kept in memory. The rest of the results,
+// e.g. for artifacts that were cached before restart of the coordinator, are fetched from
+// the workers holding the artifacts. Jobs which results can't be fetched quickly are executed as usual.
+func (c *Coordinator) cachedResults(ctx context.Context, jobs []build.Job) []*api.JobResult {
+	ctx, cancel := context.WithTimeout(ctx, cachedResultTimeout)
+	defer cancel()
+
+	results := make([]*api.JobResult, len(jobs))
+
+	var g errgroup.Group
+	g.SetLimit(cachedResultConcurrency)
+	for i := range jobs {
+		workerID, ok := c.scheduler.LocateArtifact(jobs[i].ID)
+		if !ok {
+			continue
+		}
+
+		if res, ok := c.results.get(jobs[i].ID); ok {
+			results[i] = res
+			continue
+		}
+
+		g.Go(func() error {
+			res, err := api.NewResultClient(c.log.Named("result"), workerID.String()).JobResult(ctx, jobs[i].ID)
+			if err == nil && res.ID == jobs[i].ID {
+				c.results.add(res)
+				results[i] = res
+			}
+			return nil
+		})
+	}
+	_ = g.Wait()
+
+	found := results[:0]
+	for _, res := range results {
+		if res != nil {
+			found = append(found, res)
+		}
+	}
+	return found
+}
+
+func (c *Coordinator) AttachBuild(ctx context.Context, buildID build.ID, request *api.AttachRequest, w api.StatusWriter) error {
+	b, err := c.lookupBuild(ctx, buildID, request.Tenant, request.Token)
+	if err != nil {
+		return err
+	}
+
+	c.log.Info("client attached", zap.Stringer("build_id", buildID), zap.Int("offset", request.Offset))
+	if err := w.Started(&api.BuildStarted{ID: b.ID}); err != nil {
+		return err
+	}
+
+	return b.stream(ctx, request.Offset, w)
+}
+
+func (c *Coordinator) SignalBuild(ctx context.Context, buildID build.ID, signal *api.SignalRequest) (*api.SignalResponse, error) {
+	b, err := c.lookupBuild(ctx, buildID, signal.Tenant, signal.Token)
+	if err != nil {
+		return nil, err
+	}
+
+	if signal.UploadDone != nil {
+		if err := c.journal.append(journalRecord{UploadDone: &buildID}); err != nil {
+			return nil, fmt.Errorf("write journal: %w", err)
+		}
+
+		b.onUploadDone()
+	}
+
+	if signal.Cancel != nil {
+		c.log.Info("build cancelled", zap.Stringer("build_id", buildID))
+		b.onCancel()
+	}
+
+	return &api.SignalResponse{}, nil
+}
+
+func (c *Coordinator) Heartbeat(ctx context.Context, req *api.HeartbeatRequest) (*api.HeartbeatResponse, error) {
+	start := time.Now()
+	defer func() {
+		c.metrics.heartbeatDuration.Observe(time.Since(start).Seconds())
+	}()
+
+	var records []journalRecord
+	for _, id := range req.AddedArtifacts {
+		records = append(records, journalRecord{ArtifactAdded: &journalArtifact{WorkerID: req.WorkerID, ID: id}})
+	}
+	for _, res := range req.FinishedJob {
+		if res.Error == nil && res.ExitCode == 0 {
+			records = append(records, journalRecord{ArtifactAdded: &journalArtifact{WorkerID: req.WorkerID, ID: res.ID}})
+		}
+	}
+	for _, id := range req.RemovedArtifacts {
+		records = append(records, journalRecord{ArtifactRemoved: &journalArtifact{WorkerID: req.WorkerID, ID: id}})
+	}
+
+	if err := c.journal.append(records...); err != nil {
+		return nil, fmt.Errorf("write journal: %w", err)
+	}
+
+	c.scheduler.RegisterWorker(req.WorkerID)
+
+	for _, id := range req.AddedArtifacts {
+		c.scheduler.RegisterArtifact(req.WorkerID, id)
+	}
+
+	for i := range req.FinishedJob {
+		res := &req.FinishedJob[i]
+		c.results.add(res)
+		c.scheduler.OnJobComplete(req.WorkerID, res.ID, res)
+	}
+
+	for _, id := range req.RemovedArtifacts {
+		c.scheduler.RemoveArtifact(req.WorkerID, id)
+		if _, ok := c.scheduler.LocateArtifact(id); !ok {
+			c.results.remove(id)
+		}
+	}
+
+	for _, id := range req.CancelledJobs {
+		c.log.Debug("job stopped on worker", zap.Stringer("job_id", id), zap.Stringer("worker_id", req.WorkerID))
+	}
+
+	if len(req.JobOutput) != 0 {
+		c.forwardOutput(req.JobOutput)
+	}
+
+	rsp := &api.HeartbeatResponse{
+		JobsToRun:    map[build.ID]api.JobSpec{},
+		JobsToCancel: c.scheduler.TakeCancelledJobs(req.WorkerID),
+	}
+
+	// Only the first job is waited for. The rest of free slots are filled with jobs that are
+	// already available.
+	pickCtx, cancel := context.WithTimeout(ctx, heartbeatTimeout)
+	defer cancel()
+
+	for i := 0; i < req.FreeSlots; i++ {
+		job := c.scheduler.PickJob(pickCtx, req.WorkerID)
+		if job == nil {
+			break
+		}
+
+		rsp.JobsToRun[job.Job.ID] = *job.Job
+		cancel()
+	}
+
+	return rsp, nil
 }
@@ -0,0 +1,293 @@
+//go:build !solution
+
+package dist
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"io"
+	"os"
+	"sync"
+
+	"gitlab.com/slon/shad-go/distbuild/pkg/api"
+	"gitlab.com/slon/shad-go/distbuild/pkg/build"
+)
+
+// journalRecord describes single change of the coordinator state.
+//
+// Exactly one field of the record is set.
+type journalRecord struct {
+	BuildStarted  *journalBuild    `json:",omitempty"`
+	UploadDone    *build.ID        `json:",omitempty"`
+	JobFinished   *journalJob      `json:",omitempty"`
+	BuildDone     *build.ID        `json:",omitempty"`
+	ArtifactAdded *journalArtifact `json:",omitempty"`
+
+	ArtifactRemoved *journalArtifact `json:",omitempty"`
+}
+
+type journalBuild struct {
+	ID           build.ID
+	Graph        build.Graph
+	Tenant       string                  `json:",omitempty"`
+	SourceChunks map[build.ID][]build.ID `json:",omitempty"`
+}
+
+type journalJob struct {
+	BuildID build.ID
+	Result  api.JobResult
+}
+
+type journalArtifact struct {
+	WorkerID api.WorkerID
+	ID       build.ID
+}
+
+// journal is a write-ahead log of the coordinator state.
+//
+// Records are stored as json lines. Every append is synced to disk before it returns.
+// All methods of nil *journal are no-op.
+type journal struct {
+	path string
+
+	mu sync.Mutex
+	f  *os.File
+}
+
+// openJournal opens journal at path and returns all records stored in it.
+//
+// Incomplete record at the end of the file, left by the crash in the middle of the write, is ignored.
+func openJournal(path string) (*journal, []journalRecord, error) {
+	records, size, err := readJournal(path)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0666)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if err := f.Truncate(size); err != nil {
+		_ = f.Close()
+		return nil, nil, err
+	}
+
+	return &journal{path: path, f: f}, records, nil
+}
+
+// readJournal returns records stored in the journal and the size of the complete part of the file.
+func readJournal(path string) ([]journalRecord, int64, error) {
+	f, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, 0, nil
+	} else if err != nil {
+		return nil, 0, err
+	}
+	defer f.Close()
+
+	var (
+		records []journalRecord
+		size    int64
+	)
+
+	r := bufio.NewReader(f)
+	for {
+		line, err := r.ReadBytes('\n')
+		if errors.Is(err, io.EOF) {
+			return records, size, nil
+		} else if err != nil {
+			return nil, 0, err
+		}
+
+		var record journalRecord
+		if err := json.Unmarshal(line, &record); err != nil {
+			return nil, 0, err
+		}
+		records = append(records, record)
+		size += int64(len(line))
+	}
+}
+
+func (j *journal) append(records ...journalRecord) error {
+	if j == nil || len(records) == 0 {
+		return nil
+	}
+
+	var buf []byte
+	for i := range records {
+		line, err := json.Marshal(&records[i])
+		if err != nil {
+			return err
+		}
+		buf = append(buf, line...)
+		buf = append(buf, '\n')
+	}
+
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	if _, err := j.f.Write(buf); err != nil {
+		return err
+	}
+	return j.f.Sync()
+}
+
+// rewrite atomically replaces content of the journal with records.
+func (j *journal) rewrite(records []journalRecord) error {
+	if j == nil {
+		return nil
+	}
+
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	tmpPath := j.path + ".tmp"
+	err := func() error {
+		f, err := os.Create(tmpPath)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+
+		w := bufio.NewWriter(f)
+		enc := json.NewEncoder(w)
+		for i := range records {
+			if err := enc.Encode(&records[i]); err != nil {
+				return err
+			}
+		}
+
+		if err := w.Flush(); err != nil {
+			return err
+		}
+		return f.Sync()
+	}()
+	if err != nil {
+		_ = os.Remove(tmpPath)
+		return err
+	}
+
+	if err := os.Rename(tmpPath, j.path); err != nil {
+		return err
+	}
+
+	f, err := os.OpenFile(j.path, os.O_WRONLY|os.O_APPEND, 0666)
+	if err != nil {
+		return err
+	}
+
+	_ = j.f.Close()
+	j.f = f
+	return nil
+}
+
+func (j *journal) close() error {
+	if j == nil {
+		return nil
+	}
+
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	return j.f.Close()
+}
+
+// journalState is the coordinator state restored from the journal.
+type journalState struct {
+	// builds lists unfinished builds in the order they were started.
+	builds    []*recoveredBuild
+	artifacts []journalArtifact
+}
+
+type recoveredBuild struct {
+	ID           build.ID
+	Graph        build.Graph
+	Tenant       string
+	SourceChunks map[build.ID][]build.ID
+	UploadDone   bool
+	Results      []api.JobResult
+}
+
+func replayJournal(records []journalRecord) *journalState {
+	state := &journalState{}
+	builds := map[build.ID]*recoveredBuild{}
+	artifacts := map[journalArtifact]struct{}{}
+	var added []journalArtifact
+
+	for _, record := range records {
+		switch {
+		case record.BuildStarted != nil:
+			b := &recoveredBuild{
+				ID:           record.BuildStarted.ID,
+				Graph:        record.BuildStarted.Graph,
+				Tenant:       record.BuildStarted.Tenant,
+				SourceChunks: record.BuildStarted.SourceChunks,
+			}
+			builds[b.ID] = b
+			state.builds = append(state.builds, b)
+
+		case record.UploadDone != nil:
+			if b, ok := builds[*record.UploadDone]; ok {
+				b.UploadDone = true
+			}
+
+		case record.JobFinished != nil:
+			if b, ok := builds[record.JobFinished.BuildID]; ok {
+				b.Results = append(b.Results, record.JobFinished.Result)
+			}
+
+		case record.BuildDone != nil:
+			delete(builds, *record.BuildDone)
+
+		case record.ArtifactAdded != nil:
+			if _, ok := artifacts[*record.ArtifactAdded]; !ok {
+				artifacts[*record.ArtifactAdded] = struct{}{}
+				added = append(added, *record.ArtifactAdded)
+			}
+
+		case record.ArtifactRemoved != nil:
+			delete(artifacts, *record.ArtifactRemoved)
+		}
+	}
+
+	for _, a := range added {
+		if _, ok := artifacts[a]; ok {
+			delete(artifacts, a)
+			state.artifacts = append(state.artifacts, a)
+		}
+	}
+
+	live := state.builds[:0]
+	for _, b := range state.builds {
+		if _, ok := builds[b.ID]; ok {
+			live = append(live, b)
+		}
+	}
+	state.builds = live
+
+	return state
+}
+
+// records returns minimal list of records that restores the same state.
+func (s *journalState) records() []journalRecord {
+	var records []journalRecord
+
+	for i := range s.artifacts {
+		records = append(records, journalRecord{ArtifactAdded: &s.artifacts[i]})
+	}
+
+	for _, b := range s.builds {
+		started := &journalBuild{ID: b.ID, Graph: b.Graph, Tenant: b.Tenant, SourceChunks: b.SourceChunks}
+		records = append(records, journalRecord{BuildStarted: started})
+		if b.UploadDone {
+			records = append(records, journalRecord{UploadDone: &b.ID})
+		}
+		for _, res := range b.Results {
+			records = append(records, journalRecord{JobFinished: &journalJob{BuildID: b.ID, Result: res}})
+		}
+	}
+
+	return records
+}
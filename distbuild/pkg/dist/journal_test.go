@@ -0,0 +1,93 @@
+//go:build !solution
+
+package dist
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"gitlab.com/slon/shad-go/distbuild/pkg/api"
+	"gitlab.com/slon/shad-go/distbuild/pkg/build"
+)
+
+func TestJournalReplay(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "journal")
+
+	j, records, err := openJournal(path)
+	require.NoError(t, err)
+	require.Empty(t, records)
+
+	done := build.ID{'d'}
+	running := build.ID{'r'}
+	chunks := map[build.ID][]build.ID{{'f'}: {{'c', 0}, {'c', 1}}}
+	artifact := journalArtifact{WorkerID: "w0", ID: build.ID{'a'}}
+	evicted := journalArtifact{WorkerID: "w1", ID: build.ID{'a'}}
+
+	require.NoError(t, j.append(
+		journalRecord{BuildStarted: &journalBuild{ID: done}},
+		journalRecord{BuildStarted: &journalBuild{ID: running, SourceChunks: chunks}},
+		journalRecord{ArtifactAdded: &artifact},
+		journalRecord{ArtifactAdded: &evicted},
+		journalRecord{UploadDone: &running},
+		journalRecord{JobFinished: &journalJob{BuildID: running, Result: api.JobResult{ID: build.ID{'a'}}}},
+		journalRecord{BuildDone: &done},
+		journalRecord{ArtifactAdded: &artifact},
+		journalRecord{ArtifactRemoved: &evicted},
+	))
+	require.NoError(t, j.close())
+
+	j, records, err = openJournal(path)
+	require.NoError(t, err)
+	defer func() { _ = j.close() }()
+
+	state := replayJournal(records)
+	require.Equal(t, []journalArtifact{artifact}, state.artifacts)
+	require.Len(t, state.builds, 1)
+	require.Equal(t, running, state.builds[0].ID)
+	require.True(t, state.builds[0].UploadDone)
+	require.Equal(t, chunks, state.builds[0].SourceChunks)
+	require.Equal(t, []api.JobResult{{ID: build.ID{'a'}}}, state.builds[0].Results)
+
+	require.NoError(t, j.rewrite(state.records()))
+
+	compacted, _, err := readJournal(path)
+	require.NoError(t, err)
+	require.Len(t, compacted, 4)
+	require.Equal(t, state, replayJournal(compacted))
+}
+
+func TestJournalTruncatedTail(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "journal")
+
+	j, _, err := openJournal(path)
+	require.NoError(t, err)
+
+	first := build.ID{'1'}
+	require.NoError(t, j.append(journalRecord{BuildStarted: &journalBuild{ID: first}}))
+	require.NoError(t, j.close())
+
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0666)
+	require.NoError(t, err)
+	_, err = f.WriteString(`{"BuildStarted":{"ID":`)
+	require.NoError(t, err)
+	require.NoError(t, f.Close())
+
+	j, records, err := openJournal(path)
+	require.NoError(t, err)
+	require.Len(t, records, 1)
+
+	second := build.ID{'2'}
+	require.NoError(t, j.append(journalRecord{BuildStarted: &journalBuild{ID: second}}))
+	require.NoError(t, j.close())
+
+	records, _, err = readJournal(path)
+	require.NoError(t, err)
+
+	state := replayJournal(records)
+	require.Len(t, state.builds, 2)
+	require.Equal(t, first, state.builds[0].ID)
+	require.Equal(t, second, state.builds[1].ID)
+}
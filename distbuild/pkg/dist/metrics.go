@@ -0,0 +1,105 @@
+//go:build !solution
+
+package dist
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+
+	"gitlab.com/slon/shad-go/distbuild/pkg/scheduler"
+)
+
+// durationBuckets cover durations from 10ms to about 5 minutes.
+var durationBuckets = prometheus.ExponentialBuckets(0.01, 2, 16)
+
+type coordinatorMetrics struct {
+	registry *prometheus.Registry
+
+	builds            *prometheus.CounterVec
+	jobDuration       *prometheus.HistogramVec
+	heartbeatDuration prometheus.Histogram
+}
+
+func newCoordinatorMetrics(s *scheduler.Scheduler) *coordinatorMetrics {
+	m := &coordinatorMetrics{
+		registry: prometheus.NewRegistry(),
+
+		builds: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: "distbuild",
+			Name:      "builds_total",
+			Help:      "Finished builds.",
+		}, []string{"status"}),
+
+		jobDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: "distbuild",
+			Name:      "job_duration_seconds",
+			Help:      "Time from scheduling of the job until its result is received.",
+			Buckets:   durationBuckets,
+		}, []string{"status"}),
+
+		heartbeatDuration: prometheus.NewHistogram(prometheus.HistogramOpts{
+			Namespace: "distbuild",
+			Name:      "heartbeat_duration_seconds",
+			Help:      "Time spent handling worker heartbeats, including wait for new jobs.",
+			Buckets:   prometheus.ExponentialBuckets(0.001, 2, 12),
+		}),
+	}
+
+	stat := func(f func(st scheduler.Stats) float64) func() float64 {
+		return func() float64 {
+			return f(s.Stats())
+		}
+	}
+
+	queue := func(name string, f func(st scheduler.Stats) int) prometheus.Collector {
+		return prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+			Namespace:   "distbuild",
+			Name:        "scheduler_queue_length",
+			Help:        "Jobs waiting in the scheduler queues. Local queues are summed over all workers.",
+			ConstLabels: prometheus.Labels{"queue": name},
+		}, stat(func(st scheduler.Stats) float64 { return float64(f(st)) }))
+	}
+
+	scheduled := func(result string, f func(st scheduler.Stats) uint64) prometheus.Collector {
+		return prometheus.NewCounterFunc(prometheus.CounterOpts{
+			Namespace:   "distbuild",
+			Name:        "scheduler_jobs_total",
+			Help:        "New jobs passed to the scheduler, by whether their artifact was already cached on some worker.",
+			ConstLabels: prometheus.Labels{"cache": result},
+		}, stat(func(st scheduler.Stats) float64 { return float64(f(st)) }))
+	}
+
+	m.registry.MustRegister(
+		collectors.NewGoCollector(),
+		m.builds,
+		m.jobDuration,
+		m.heartbeatDuration,
+
+		queue("global", func(st scheduler.Stats) int { return st.GlobalQueue }),
+		queue("cached", func(st scheduler.Stats) int { return st.CachedQueue }),
+		queue("deps", func(st scheduler.Stats) int { return st.DepsQueue }),
+
+		scheduled("hit", func(st scheduler.Stats) uint64 { return st.CacheHits }),
+		scheduled("miss", func(st scheduler.Stats) uint64 { return st.CacheMisses }),
+
+		prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+			Namespace: "distbuild",
+			Name:      "scheduler_pending_jobs",
+			Help:      "Scheduled jobs that are not finished yet.",
+		}, stat(func(st scheduler.Stats) float64 { return float64(st.Pending) })),
+
+		prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+			Namespace: "distbuild",
+			Name:      "workers",
+			Help:      "Workers known to the scheduler.",
+		}, stat(func(st scheduler.Stats) float64 { return float64(st.Workers) })),
+
+		prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+			Namespace: "distbuild",
+			Name:      "quarantined_workers",
+			Help:      "Workers that get no jobs because of repeated transient failures.",
+		}, stat(func(st scheduler.Stats) float64 { return float64(st.Quarantined) })),
+	)
+
+	return m
+}
@@ -0,0 +1,90 @@
+//go:build !solution
+
+package dist
+
+import (
+	"container/list"
+	"sync"
+
+	"gitlab.com/slon/shad-go/distbuild/pkg/api"
+	"gitlab.com/slon/shad-go/distbuild/pkg/build"
+)
+
+// resultCacheSize limits total size of stdout and stderr kept by resultCache.
+const resultCacheSize = 64 << 20
+
+// resultCache keeps results of the successful jobs reported by the workers, so that StartBuild
+// replays cached jobs without asking workers.
+//
+// Results are kept in memory only. Least recently used results are evicted, when cache is full.
+// Result missing from the cache is fetched from the worker that holds the artifact.
+type resultCache struct {
+	mu      sync.Mutex
+	size    int
+	lru     *list.List
+	results map[build.ID]*list.Element
+}
+
+func newResultCache() *resultCache {
+	return &resultCache{
+		lru:     list.New(),
+		results: make(map[build.ID]*list.Element),
+	}
+}
+
+func resultSize(res *api.JobResult) int {
+	return len(res.Stdout) + len(res.Stderr)
+}
+
+// add stores result of the successful job. Failed results are ignored, since they leave no artifact.
+func (c *resultCache) add(res *api.JobResult) {
+	if res.Error != nil || res.ExitCode != 0 || resultSize(res) > resultCacheSize {
+		return
+	}
+
+	// Attempts describe the run of a particular build and are not replayed.
+	res = &api.JobResult{ID: res.ID, Stdout: res.Stdout, Stderr: res.Stderr}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.removeLocked(res.ID)
+	c.results[res.ID] = c.lru.PushFront(res)
+	c.size += resultSize(res)
+
+	for c.size > resultCacheSize {
+		c.removeLocked(c.lru.Back().Value.(*api.JobResult).ID)
+	}
+}
+
+func (c *resultCache) get(id build.ID) (*api.JobResult, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	e, ok := c.results[id]
+	if !ok {
+		return nil, false
+	}
+	c.lru.MoveToFront(e)
+
+	res := *e.Value.(*api.JobResult)
+	return &res, true
+}
+
+func (c *resultCache) remove(id build.ID) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.removeLocked(id)
+}
+
+func (c *resultCache) removeLocked(id build.ID) {
+	e, ok := c.results[id]
+	if !ok {
+		return
+	}
+
+	c.lru.Remove(e)
+	delete(c.results, id)
+	c.size -= resultSize(e.Value.(*api.JobResult))
+}
@@ -0,0 +1,97 @@
+//go:build !solution
+
+package dist
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap/zaptest"
+
+	"gitlab.com/slon/shad-go/distbuild/pkg/api"
+	"gitlab.com/slon/shad-go/distbuild/pkg/api/mock"
+	"gitlab.com/slon/shad-go/distbuild/pkg/build"
+	"gitlab.com/slon/shad-go/distbuild/pkg/filecache"
+)
+
+func TestResultCache(t *testing.T) {
+	c := newResultCache()
+
+	ok := &api.JobResult{ID: build.NewID(), Stdout: []byte("out"), Attempts: []api.JobAttempt{{}}}
+	failed := &api.JobResult{ID: build.NewID(), ExitCode: 1}
+	c.add(ok)
+	c.add(failed)
+
+	res, found := c.get(ok.ID)
+	require.True(t, found)
+	require.Equal(t, &api.JobResult{ID: ok.ID, Stdout: []byte("out")}, res)
+
+	_, found = c.get(failed.ID)
+	require.False(t, found)
+
+	c.remove(ok.ID)
+	_, found = c.get(ok.ID)
+	require.False(t, found)
+	require.Zero(t, c.size)
+}
+
+func TestResultCacheEviction(t *testing.T) {
+	c := newResultCache()
+
+	first := &api.JobResult{ID: build.NewID(), Stdout: make([]byte, resultCacheSize/2)}
+	second := &api.JobResult{ID: build.NewID(), Stdout: make([]byte, resultCacheSize/2)}
+	third := &api.JobResult{ID: build.NewID(), Stdout: make([]byte, resultCacheSize/2)}
+
+	c.add(first)
+	c.add(second)
+	_, found := c.get(first.ID)
+	require.True(t, found)
+
+	c.add(third)
+
+	_, found = c.get(second.ID)
+	require.False(t, found)
+	_, found = c.get(first.ID)
+	require.True(t, found)
+	require.LessOrEqual(t, c.size, resultCacheSize)
+}
+
+func TestCachedResultsFromWorker(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	known := &api.JobResult{ID: build.ID{'a'}, Stdout: []byte("known")}
+	unknown := &api.JobResult{ID: build.ID{'b'}, Stdout: []byte("unknown")}
+
+	service := mock.NewMockResultService(ctrl)
+	service.EXPECT().JobResult(gomock.Any(), gomock.Eq(unknown.ID)).Times(1).Return(unknown, nil)
+
+	mux := http.NewServeMux()
+	api.NewResultHandler(zaptest.NewLogger(t), service).Register(mux)
+	worker := httptest.NewServer(mux)
+	defer worker.Close()
+
+	fileCache, err := filecache.New(t.TempDir())
+	require.NoError(t, err)
+
+	c := NewCoordinator(zaptest.NewLogger(t), fileCache)
+	defer c.Stop()
+
+	// Artifact of the unknown job was in the cache of the worker before it connected.
+	_, err = c.Heartbeat(context.Background(), &api.HeartbeatRequest{
+		WorkerID:       api.WorkerID(worker.URL),
+		FinishedJob:    []api.JobResult{*known},
+		AddedArtifacts: []build.ID{unknown.ID},
+	})
+	require.NoError(t, err)
+
+	jobs := []build.Job{{ID: known.ID}, {ID: unknown.ID}, {ID: build.ID{'c'}}}
+	require.Equal(t, []*api.JobResult{known, unknown}, c.cachedResults(context.Background(), jobs))
+
+	// Fetched result is remembered.
+	require.Equal(t, []*api.JobResult{known, unknown}, c.cachedResults(context.Background(), jobs))
+}
@@ -0,0 +1,103 @@
+//go:build !solution
+
+package dist
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"go.uber.org/zap"
+
+	"gitlab.com/slon/shad-go/distbuild/pkg/scheduler"
+)
+
+var (
+	// ErrUnauthorized is returned when token of the tenant is rejected.
+	ErrUnauthorized = errors.New("unauthorized")
+
+	// ErrUnknownTenant is returned from StartBuild when tenant is missing in Config.Tenants.
+	ErrUnknownTenant = errors.New("unknown tenant")
+)
+
+// TokenValidator checks that the client acts on behalf of the tenant.
+type TokenValidator interface {
+	ValidateToken(ctx context.Context, tenant, token string) error
+}
+
+// StaticTokens is TokenValidator with fixed token for every tenant.
+//
+// Tenants that are not in the map are rejected.
+type StaticTokens map[string]string
+
+func (s StaticTokens) ValidateToken(ctx context.Context, tenant, token string) error {
+	expected, ok := s[tenant]
+	if !ok || subtle.ConstantTimeCompare([]byte(expected), []byte(token)) != 1 {
+		return ErrUnauthorized
+	}
+	return nil
+}
+
+// checkTenant rejects tenants missing in the config, unless config lists no tenants at all.
+func (c *Coordinator) checkTenant(tenant string) error {
+	if len(c.tenants) == 0 {
+		return nil
+	}
+
+	if _, ok := c.tenants[tenant]; !ok {
+		c.log.Warn("build request rejected", zap.String("tenant", tenant), zap.Error(ErrUnknownTenant))
+		return fmt.Errorf("tenant %q: %w", tenant, ErrUnknownTenant)
+	}
+	return nil
+}
+
+// TenantStatus describes share of the tenant in the cluster.
+type TenantStatus struct {
+	scheduler.TenantStats
+
+	// Builds is the number of running builds of the tenant.
+	Builds int
+}
+
+// Tenants returns status of the tenants, in the order they are served by the scheduler.
+func (c *Coordinator) Tenants() []TenantStatus {
+	builds := make(map[string]int)
+
+	c.mu.Lock()
+	for _, b := range c.builds {
+		if !b.isDone() {
+			builds[b.Tenant]++
+		}
+	}
+	c.mu.Unlock()
+
+	var tenants []TenantStatus
+	for _, stats := range c.scheduler.Tenants() {
+		tenants = append(tenants, TenantStatus{TenantStats: stats, Builds: builds[stats.Tenant]})
+	}
+	return tenants
+}
+
+// requireAdmin rejects requests without admin token in the Authorization header.
+func (c *Coordinator) requireAdmin(token string, next http.HandlerFunc) http.Handler {
+	expected := []byte("Bearer " + token)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if subtle.ConstantTimeCompare([]byte(r.Header.Get("Authorization")), expected) != 1 {
+			c.log.Warn("admin request rejected", zap.String("path", r.URL.Path))
+			http.Error(w, ErrUnauthorized.Error(), http.StatusUnauthorized)
+			return
+		}
+
+		next(w, r)
+	})
+}
+
+func (c *Coordinator) getTenants(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(c.Tenants()); err != nil {
+		c.log.Error("failed to send tenants", zap.Error(err))
+	}
+}
@@ -0,0 +1,214 @@
+//go:build !solution
+
+package filecache
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+
+	"gitlab.com/slon/shad-go/distbuild/pkg/build"
+)
+
+const (
+	// MinChunkSize и MaxChunkSize ограничивают размер чанка. Средний размер чанка около 10KiB.
+	MinChunkSize = 2 << 10
+	MaxChunkSize = 64 << 10
+
+	// chunkMask sets average distance between content defined boundaries to 8KiB.
+	chunkMask = 1<<13 - 1
+
+	chunksFileName = "chunks.json"
+
+	// assembleRetryInterval is how often Assemble checks the file, which is written by someone else.
+	assembleRetryInterval = 10 * time.Millisecond
+	// assembleLockTimeout limits how long Assemble waits for the other writer of the file.
+	assembleLockTimeout = time.Minute
+)
+
+// Chunk описывает кусок файла.
+//
+// ID чанка - sha1 от его содержимого, поэтому одинаковые куски разных файлов имеют одинаковый ID.
+type Chunk struct {
+	ID     build.ID
+	Offset int64
+	Size   int64
+}
+
+// gear is the table of random values used by the rolling hash.
+var gear = func() (table [256]uint64) {
+	// splitmix64 with fixed seed. Table must never change, otherwise chunk boundaries change too.
+	state := uint64(0x5eed_d157_b01d_0001)
+	for i := range table {
+		state += 0x9e3779b97f4a7c15
+		z := state
+		z = (z ^ (z >> 30)) * 0xbf58476d1ce4e5b9
+		z = (z ^ (z >> 27)) * 0x94d049bb133111eb
+		table[i] = z ^ (z >> 31)
+	}
+	return
+}()
+
+// Split разбивает поток на чанки по содержимому.
+//
+// Границы чанков выбираются скользящим хешем (gear hash), поэтому вставка или удаление байт
+// меняет только чанки рядом с местом изменения.
+func Split(r io.Reader) ([]Chunk, error) {
+	br := bufio.NewReaderSize(r, MaxChunkSize)
+
+	var (
+		chunks []Chunk
+		offset int64
+		hash   uint64
+		buf    = make([]byte, 0, MaxChunkSize)
+	)
+
+	cut := func() {
+		chunks = append(chunks, Chunk{ID: sha1.Sum(buf), Offset: offset, Size: int64(len(buf))})
+		offset += int64(len(buf))
+		buf = buf[:0]
+	}
+
+	for {
+		c, err := br.ReadByte()
+		if errors.Is(err, io.EOF) {
+			break
+		} else if err != nil {
+			return nil, err
+		}
+
+		buf = append(buf, c)
+		hash = hash<<1 + gear[c]
+
+		if len(buf) >= MinChunkSize && hash&chunkMask == 0 || len(buf) == MaxChunkSize {
+			cut()
+		}
+	}
+
+	if len(buf) != 0 {
+		cut()
+	}
+	return chunks, nil
+}
+
+// SplitFile разбивает файл на чанки.
+func SplitFile(path string) ([]Chunk, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	return Split(f)
+}
+
+// Assemble собирает файл из чанков, которые уже лежат в кеше.
+//
+// Список чанков запоминается вместе с файлом и возвращается из Chunks. Если файл уже есть в кеше,
+// Assemble ничего не делает. Если чанка нет в кеше, возвращается ошибка ErrNotFound.
+//
+// Если файл в этот момент записывается кем-то другим (например, его собирает параллельная сборка),
+// Assemble дожидается окончания записи.
+func (c *Cache) Assemble(file build.ID, chunks []build.ID) error {
+	deadline := time.Now().Add(assembleLockTimeout)
+	for {
+		path, commit, abort, err := c.cache.Create(file)
+		if err != nil {
+			err = convertErr(err)
+			if errors.Is(err, ErrExists) {
+				return nil
+			}
+
+			if errors.Is(err, ErrWriteLocked) && time.Now().Before(deadline) {
+				time.Sleep(assembleRetryInterval)
+				continue
+			}
+			return err
+		}
+
+		if err := c.assemble(path, chunks); err != nil {
+			_ = abort()
+			return fmt.Errorf("assemble file %s: %w", file, err)
+		}
+		return commit()
+	}
+}
+
+func (c *Cache) assemble(dir string, chunks []build.ID) error {
+	f, err := os.Create(filepath.Join(dir, fileName))
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	for _, id := range chunks {
+		if err := c.appendChunk(f, id); err != nil {
+			return err
+		}
+	}
+
+	if err := f.Close(); err != nil {
+		return err
+	}
+
+	list, err := json.Marshal(chunks)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(dir, chunksFileName), list, 0666)
+}
+
+func (c *Cache) appendChunk(w io.Writer, id build.ID) error {
+	path, unlock, err := c.Get(id)
+	if err != nil {
+		return fmt.Errorf("chunk %s: %w", id, err)
+	}
+	defer unlock()
+
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	// Chunks are uploaded by clients under the id they choose, so content is verified here.
+	h := sha1.New()
+	if _, err := io.Copy(io.MultiWriter(w, h), f); err != nil {
+		return err
+	}
+
+	if build.ID(h.Sum(nil)) != id {
+		return fmt.Errorf("chunk %s: content does not match id", id)
+	}
+	return nil
+}
+
+// Chunks возвращает список чанков файла, собранного через Assemble.
+//
+// Для файлов, записанных целиком, возвращается ErrNotFound.
+func (c *Cache) Chunks(file build.ID) ([]build.ID, error) {
+	root, unlock, err := c.cache.Get(file)
+	if err != nil {
+		return nil, convertErr(err)
+	}
+	defer unlock()
+
+	list, err := os.ReadFile(filepath.Join(root, chunksFileName))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, ErrNotFound
+	} else if err != nil {
+		return nil, err
+	}
+
+	var chunks []build.ID
+	if err := json.Unmarshal(list, &chunks); err != nil {
+		return nil, err
+	}
+	return chunks, nil
+}
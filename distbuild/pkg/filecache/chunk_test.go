@@ -0,0 +1,154 @@
+package filecache_test
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"errors"
+	"math/rand"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"gitlab.com/slon/shad-go/distbuild/pkg/build"
+	"gitlab.com/slon/shad-go/distbuild/pkg/filecache"
+)
+
+func randomContent(size int) []byte {
+	content := make([]byte, size)
+	_, _ = rand.New(rand.NewSource(42)).Read(content)
+	return content
+}
+
+func split(t *testing.T, content []byte) []filecache.Chunk {
+	t.Helper()
+
+	chunks, err := filecache.Split(bytes.NewReader(content))
+	require.NoError(t, err)
+	return chunks
+}
+
+func TestSplit(t *testing.T) {
+	content := randomContent(1 << 20)
+	chunks := split(t, content)
+
+	var offset int64
+	for i, chunk := range chunks {
+		require.Equal(t, offset, chunk.Offset)
+		require.LessOrEqual(t, chunk.Size, int64(filecache.MaxChunkSize))
+		if i != len(chunks)-1 {
+			require.GreaterOrEqual(t, chunk.Size, int64(filecache.MinChunkSize))
+		}
+
+		data := content[chunk.Offset : chunk.Offset+chunk.Size]
+		require.Equal(t, build.ID(sha1.Sum(data)), chunk.ID)
+		offset += chunk.Size
+	}
+	require.Equal(t, int64(len(content)), offset)
+
+	require.Equal(t, chunks, split(t, content))
+	require.Empty(t, split(t, nil))
+}
+
+func TestSplitLocalChange(t *testing.T) {
+	content := randomContent(1 << 20)
+	chunks := split(t, content)
+
+	changed := append([]byte(nil), content[:len(content)/2]...)
+	changed = append(changed, "inserted line\n"...)
+	changed = append(changed, content[len(content)/2:]...)
+
+	old := map[build.ID]bool{}
+	for _, chunk := range chunks {
+		old[chunk.ID] = true
+	}
+
+	newChunks := 0
+	for _, chunk := range split(t, changed) {
+		if !old[chunk.ID] {
+			newChunks++
+		}
+	}
+
+	require.NotZero(t, newChunks)
+	require.LessOrEqual(t, newChunks, 2)
+}
+
+func TestAssemble(t *testing.T) {
+	cache := newCache(t)
+	content := randomContent(200 << 10)
+
+	var ids []build.ID
+	for _, chunk := range split(t, content) {
+		w, _, err := cache.Write(chunk.ID)
+		require.NoError(t, err)
+		_, err = w.Write(content[chunk.Offset : chunk.Offset+chunk.Size])
+		require.NoError(t, err)
+		require.NoError(t, w.Close())
+
+		ids = append(ids, chunk.ID)
+	}
+
+	t.Run("Assemble", func(t *testing.T) {
+		require.NoError(t, cache.Assemble(build.ID{0x01}, ids))
+		require.NoError(t, cache.Assemble(build.ID{0x01}, ids))
+
+		path, unlock, err := cache.Get(build.ID{0x01})
+		require.NoError(t, err)
+		defer unlock()
+
+		actual, err := os.ReadFile(path)
+		require.NoError(t, err)
+		require.Equal(t, content, actual)
+
+		chunks, err := cache.Chunks(build.ID{0x01})
+		require.NoError(t, err)
+		require.Equal(t, ids, chunks)
+	})
+
+	t.Run("MissingChunk", func(t *testing.T) {
+		err := cache.Assemble(build.ID{0x02}, append(ids, build.ID{0xff}))
+		require.Truef(t, errors.Is(err, filecache.ErrNotFound), "%v", err)
+
+		_, _, err = cache.Get(build.ID{0x02})
+		require.Truef(t, errors.Is(err, filecache.ErrNotFound), "%v", err)
+	})
+
+	t.Run("CorruptedChunk", func(t *testing.T) {
+		w, _, err := cache.Write(build.ID{0x03})
+		require.NoError(t, err)
+		_, err = w.Write([]byte("foo"))
+		require.NoError(t, err)
+		require.NoError(t, w.Close())
+
+		require.Error(t, cache.Assemble(build.ID{0x04}, []build.ID{{0x03}}))
+	})
+
+	t.Run("Concurrent", func(t *testing.T) {
+		// Another writer holds the file, e.g. parallel build assembles it.
+		_, abort, err := cache.Write(build.ID{0x05})
+		require.NoError(t, err)
+
+		done := make(chan error, 1)
+		go func() { done <- cache.Assemble(build.ID{0x05}, ids) }()
+
+		select {
+		case err := <-done:
+			t.Fatalf("assemble did not wait for the other writer: %v", err)
+		case <-time.After(50 * time.Millisecond):
+		}
+
+		require.NoError(t, abort())
+		require.NoError(t, <-done)
+
+		chunks, err := cache.Chunks(build.ID{0x05})
+		require.NoError(t, err)
+		require.Equal(t, ids, chunks)
+	})
+
+	t.Run("WholeFile", func(t *testing.T) {
+		_, err := cache.Chunks(ids[0])
+		require.Truef(t, errors.Is(err, filecache.ErrNotFound), "%v", err)
+	})
+}
@@ -3,7 +3,14 @@
 package filecache
 
 import (
+	"bytes"
 	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
 
 	"go.uber.org/zap"
 
@@ -11,16 +18,155 @@ import (
 )
 
 type Client struct {
+	l        *zap.Logger
+	endpoint string
 }
 
 func NewClient(l *zap.Logger, endpoint string) *Client {
-	panic("implement me")
+	return &Client{
+		l:        l,
+		endpoint: endpoint,
+	}
 }
 
 func (c *Client) Upload(ctx context.Context, id build.ID, localPath string) error {
-	panic("implement me")
+	f, err := os.Open(localPath)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	c.l.Debug("uploading file", zap.Stringer("id", id), zap.String("path", localPath))
+	return c.upload(ctx, id, f)
+}
+
+// UploadChunk заливает кусок локального файла. На сервере чанк хранится как файл с ID chunk.ID.
+func (c *Client) UploadChunk(ctx context.Context, localPath string, chunk Chunk) error {
+	f, err := os.Open(localPath)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	c.l.Debug("uploading chunk", zap.Stringer("id", chunk.ID), zap.String("path", localPath), zap.Int64("offset", chunk.Offset))
+	return c.upload(ctx, chunk.ID, io.NewSectionReader(f, chunk.Offset, chunk.Size))
+}
+
+func (c *Client) upload(ctx context.Context, id build.ID, body io.Reader) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, c.endpoint+"/file?id="+id.String(), body)
+	if err != nil {
+		return err
+	}
+
+	rsp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer rsp.Body.Close()
+
+	if rsp.StatusCode != http.StatusOK {
+		err := readError(rsp)
+		c.l.Error("file upload failed", zap.Stringer("id", id), zap.Error(err))
+		return err
+	}
+
+	return nil
 }
 
+// Download скачивает файл в локальный кеш.
+//
+// Файл, собранный на сервере из чанков, собирается из чанков и локально. Скачиваются только чанки,
+// которых нет в локальном кеше.
 func (c *Client) Download(ctx context.Context, localCache *Cache, id build.ID) error {
-	panic("implement me")
+	chunks, err := c.chunks(ctx, id)
+	if err != nil {
+		return err
+	}
+
+	if chunks == nil {
+		return c.download(ctx, localCache, id)
+	}
+
+	for _, chunk := range chunks {
+		_, unlock, err := localCache.Get(chunk)
+		if err == nil {
+			unlock()
+			continue
+		}
+
+		if err := c.download(ctx, localCache, chunk); err != nil {
+			return err
+		}
+	}
+
+	return localCache.Assemble(id, chunks)
+}
+
+// chunks returns list of chunks of the remote file, or nil if the file is stored whole.
+func (c *Client) chunks(ctx context.Context, id build.ID) ([]build.ID, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.endpoint+"/file/chunks?id="+id.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	rsp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer rsp.Body.Close()
+
+	switch rsp.StatusCode {
+	case http.StatusOK:
+	case http.StatusNotFound:
+		return nil, nil
+	default:
+		err := readError(rsp)
+		c.l.Error("file chunks download failed", zap.Stringer("id", id), zap.Error(err))
+		return nil, err
+	}
+
+	chunks := []build.ID{}
+	if err := json.NewDecoder(rsp.Body).Decode(&chunks); err != nil {
+		return nil, err
+	}
+	return chunks, nil
+}
+
+func (c *Client) download(ctx context.Context, localCache *Cache, id build.ID) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.endpoint+"/file?id="+id.String(), nil)
+	if err != nil {
+		return err
+	}
+
+	c.l.Debug("downloading file", zap.Stringer("id", id))
+	rsp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer rsp.Body.Close()
+
+	if rsp.StatusCode != http.StatusOK {
+		err := readError(rsp)
+		c.l.Error("file download failed", zap.Stringer("id", id), zap.Error(err))
+		return err
+	}
+
+	w, abort, err := localCache.Write(id)
+	if errors.Is(err, ErrExists) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	if _, err := io.Copy(w, rsp.Body); err != nil {
+		_ = abort()
+		return err
+	}
+
+	return w.Close()
+}
+
+func readError(rsp *http.Response) error {
+	msg, _ := io.ReadAll(rsp.Body)
+	return fmt.Errorf("http status %d: %s", rsp.StatusCode, bytes.TrimSpace(msg))
 }
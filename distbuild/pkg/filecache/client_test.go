@@ -127,3 +127,40 @@ func TestFileDownload(t *testing.T) {
 	require.NoError(t, err)
 	require.Equal(t, []byte("foobar"), content)
 }
+
+func TestChunkedDownload(t *testing.T) {
+	env := newEnv(t)
+	localCache := newCache(t)
+
+	content := bytes.Repeat([]byte("foobar\n"), 64*1024)
+	tmpFilePath := filepath.Join(env.cache.tmpDir, "foo.txt")
+	require.NoError(t, os.WriteFile(tmpFilePath, content, 0666))
+
+	chunks, err := filecache.SplitFile(tmpFilePath)
+	require.NoError(t, err)
+
+	ctx := context.Background()
+
+	var ids []build.ID
+	for _, chunk := range chunks {
+		require.NoError(t, env.client.UploadChunk(ctx, tmpFilePath, chunk))
+		ids = append(ids, chunk.ID)
+	}
+
+	id := build.ID{0x01}
+	require.NoError(t, env.cache.Assemble(id, ids))
+
+	require.NoError(t, env.client.Download(ctx, localCache.Cache, id))
+
+	path, unlock, err := localCache.Get(id)
+	require.NoError(t, err)
+	defer unlock()
+
+	actualContent, err := os.ReadFile(path)
+	require.NoError(t, err)
+	require.Equal(t, content, actualContent)
+
+	localChunks, err := localCache.Chunks(id)
+	require.NoError(t, err)
+	require.Equal(t, ids, localChunks)
+}
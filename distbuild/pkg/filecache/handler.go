@@ -3,18 +3,133 @@
 package filecache
 
 import (
+	"encoding/json"
+	"errors"
+	"io"
 	"net/http"
+	"os"
 
 	"go.uber.org/zap"
+	"golang.org/x/sync/singleflight"
+
+	"gitlab.com/slon/shad-go/distbuild/pkg/build"
 )
 
 type Handler struct {
+	l     *zap.Logger
+	cache *Cache
+
+	uploads singleflight.Group
 }
 
 func NewHandler(l *zap.Logger, cache *Cache) *Handler {
-	panic("implement me")
+	return &Handler{
+		l:     l,
+		cache: cache,
+	}
 }
 
 func (h *Handler) Register(mux *http.ServeMux) {
-	panic("implement me")
+	mux.HandleFunc("GET /file", h.get)
+	mux.HandleFunc("PUT /file", h.put)
+	mux.HandleFunc("GET /file/chunks", h.getChunks)
+}
+
+func parseID(r *http.Request) (build.ID, error) {
+	var id build.ID
+	err := id.UnmarshalText([]byte(r.URL.Query().Get("id")))
+	return id, err
+}
+
+func (h *Handler) get(w http.ResponseWriter, r *http.Request) {
+	id, err := parseID(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	path, unlock, err := h.cache.Get(id)
+	if err != nil {
+		h.l.Error("file get failed", zap.Stringer("id", id), zap.Error(err))
+		if errors.Is(err, ErrNotFound) {
+			http.Error(w, err.Error(), http.StatusNotFound)
+		} else {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+		return
+	}
+	defer unlock()
+
+	f, err := os.Open(path)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer f.Close()
+
+	h.l.Debug("sending file", zap.Stringer("id", id))
+	if _, err := io.Copy(w, f); err != nil {
+		h.l.Error("file send failed", zap.Stringer("id", id), zap.Error(err))
+	}
+}
+
+// getChunks returns list of chunks of the file, if the file was assembled from chunks.
+func (h *Handler) getChunks(w http.ResponseWriter, r *http.Request) {
+	id, err := parseID(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	chunks, err := h.cache.Chunks(id)
+	if errors.Is(err, ErrNotFound) {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	} else if err != nil {
+		h.l.Error("file chunks get failed", zap.Stringer("id", id), zap.Error(err))
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(chunks)
+}
+
+func (h *Handler) put(w http.ResponseWriter, r *http.Request) {
+	id, err := parseID(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// Concurrent uploads of the same file are merged into one. Everyone else
+	// waits for the first upload to finish.
+	_, err, _ = h.uploads.Do(id.String(), func() (any, error) {
+		return nil, h.write(id, r.Body)
+	})
+
+	if err != nil {
+		h.l.Error("file upload failed", zap.Stringer("id", id), zap.Error(err))
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	h.l.Debug("file uploaded", zap.Stringer("id", id))
+	w.WriteHeader(http.StatusOK)
+}
+
+func (h *Handler) write(id build.ID, r io.Reader) error {
+	fw, abort, err := h.cache.Write(id)
+	if errors.Is(err, ErrExists) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	if _, err := io.Copy(fw, r); err != nil {
+		_ = abort()
+		return err
+	}
+
+	return fw.Close()
 }
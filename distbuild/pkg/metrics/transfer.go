@@ -0,0 +1,79 @@
+// Package metrics содержит общие для координатора и воркера метрики.
+package metrics
+
+import (
+	"io"
+	"net/http"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// Handler возвращает обработчик /metrics для реестра reg.
+func Handler(reg *prometheus.Registry) http.Handler {
+	return promhttp.HandlerFor(reg, promhttp.HandlerOpts{Registry: reg})
+}
+
+// CountBytes оборачивает mux и считает байты в телах запросов и ответов.
+//
+// Метрики размечены паттерном обработчика из mux, например "GET /artifact" или "PUT /file".
+// Запросы, для которых в mux нет обработчика, не учитываются.
+func CountBytes(mux *http.ServeMux, reg prometheus.Registerer) http.Handler {
+	received := prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "distbuild",
+		Name:      "http_received_bytes_total",
+		Help:      "Bytes received in request bodies.",
+	}, []string{"handler"})
+
+	sent := prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "distbuild",
+		Name:      "http_sent_bytes_total",
+		Help:      "Bytes sent in response bodies.",
+	}, []string{"handler"})
+
+	reg.MustRegister(received, sent)
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, pattern := mux.Handler(r)
+		if pattern == "" {
+			mux.ServeHTTP(w, r)
+			return
+		}
+
+		body := &countingReader{ReadCloser: r.Body}
+		r.Body = body
+
+		cw := &countingWriter{ResponseWriter: w}
+		mux.ServeHTTP(cw, r)
+
+		received.WithLabelValues(pattern).Add(float64(body.n))
+		sent.WithLabelValues(pattern).Add(float64(cw.n))
+	})
+}
+
+type countingReader struct {
+	io.ReadCloser
+	n int64
+}
+
+func (r *countingReader) Read(p []byte) (int, error) {
+	n, err := r.ReadCloser.Read(p)
+	r.n += int64(n)
+	return n, err
+}
+
+type countingWriter struct {
+	http.ResponseWriter
+	n int64
+}
+
+func (w *countingWriter) Write(p []byte) (int, error) {
+	n, err := w.ResponseWriter.Write(p)
+	w.n += int64(n)
+	return n, err
+}
+
+// Unwrap allows http.ResponseController to flush the underlying writer.
+func (w *countingWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
@@ -0,0 +1,48 @@
+package metrics
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCountBytes(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("PUT /file", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.Copy(io.Discard, r.Body)
+	})
+	mux.HandleFunc("GET /file", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("hello"))
+		http.NewResponseController(w).Flush()
+	})
+
+	reg := prometheus.NewRegistry()
+	h := CountBytes(mux, reg)
+
+	for _, r := range []*http.Request{
+		httptest.NewRequest(http.MethodPut, "/file?id=1", strings.NewReader("content")),
+		httptest.NewRequest(http.MethodGet, "/file?id=1", nil),
+		httptest.NewRequest(http.MethodGet, "/unknown", strings.NewReader("ignored")),
+	} {
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, r)
+	}
+
+	expected := `
+# HELP distbuild_http_received_bytes_total Bytes received in request bodies.
+# TYPE distbuild_http_received_bytes_total counter
+distbuild_http_received_bytes_total{handler="GET /file"} 0
+distbuild_http_received_bytes_total{handler="PUT /file"} 7
+# HELP distbuild_http_sent_bytes_total Bytes sent in response bodies.
+# TYPE distbuild_http_sent_bytes_total counter
+distbuild_http_sent_bytes_total{handler="GET /file"} 5
+distbuild_http_sent_bytes_total{handler="PUT /file"} 0
+`
+	require.NoError(t, testutil.GatherAndCompare(reg, strings.NewReader(expected)))
+}
@@ -0,0 +1,461 @@
+// Package plan генерирует граф сборки для go модуля.
+package plan
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha1"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"gitlab.com/slon/shad-go/distbuild/pkg/build"
+)
+
+// Options задаёт параметры генерации графа.
+type Options struct {
+	// GoBinary задаёт go, который запускается на воркерах. По умолчанию "go".
+	GoBinary string
+
+	// Environ задаёт окружение команд сборки.
+	//
+	// По умолчанию, берутся PATH и HOME планировщика, а также GOCACHE, GOMODCACHE и GOPATH из go env.
+	// Окружение входит в ID джобов.
+	Environ []string
+}
+
+// goPackage описывает часть вывода go list -json, нужную для построения графа.
+type goPackage struct {
+	Dir        string
+	ImportPath string
+	Name       string
+
+	GoFiles      []string
+	CgoFiles     []string
+	EmbedFiles   []string
+	TestGoFiles  []string
+	XTestGoFiles []string
+
+	TestEmbedFiles  []string
+	XTestEmbedFiles []string
+
+	Imports      []string
+	Deps         []string
+	TestImports  []string
+	XTestImports []string
+
+	Error *struct {
+		Err string
+	}
+}
+
+func (p *goPackage) files() []string {
+	return concat(p.GoFiles, p.CgoFiles, p.EmbedFiles)
+}
+
+func (p *goPackage) testFiles() []string {
+	return concat(p.TestGoFiles, p.XTestGoFiles, p.TestEmbedFiles, p.XTestEmbedFiles)
+}
+
+func (p *goPackage) hasTests() bool {
+	return len(p.TestGoFiles) != 0 || len(p.XTestGoFiles) != 0
+}
+
+func concat(lists ...[]string) []string {
+	var out []string
+	for _, l := range lists {
+		out = append(out, l...)
+	}
+	return out
+}
+
+type planner struct {
+	root string
+	opts Options
+
+	packages map[string]*goPackage
+	// sourceIDs maps path relative to the module root into ID of the source file.
+	sourceIDs map[string]build.ID
+
+	graph   build.Graph
+	compile map[string]build.ID
+}
+
+// Generate читает пакеты модуля из moduleDir через go list и строит граф сборки.
+//
+// Для каждого пакета создаются джобы build и vet, а для пакетов с тестами ещё и test.
+// ID джобов вычисляются из содержимого входных файлов, команд и ID зависимостей, поэтому
+// повторная генерация для того же состояния модуля даёт тот же граф.
+func Generate(ctx context.Context, moduleDir string, opts Options) (*build.Graph, error) {
+	root, err := filepath.Abs(moduleDir)
+	if err != nil {
+		return nil, err
+	}
+
+	if opts.GoBinary == "" {
+		opts.GoBinary = "go"
+	}
+
+	if opts.Environ == nil {
+		if opts.Environ, err = defaultEnviron(ctx, root, opts.GoBinary); err != nil {
+			return nil, err
+		}
+	}
+
+	packages, err := listPackages(ctx, root, opts.GoBinary)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &planner{
+		root:      root,
+		opts:      opts,
+		packages:  make(map[string]*goPackage, len(packages)),
+		sourceIDs: make(map[string]build.ID),
+		graph:     build.Graph{SourceFiles: make(map[build.ID]string)},
+		compile:   make(map[string]build.ID),
+	}
+
+	for _, pkg := range packages {
+		if pkg.Error != nil {
+			return nil, fmt.Errorf("package %s: %s", pkg.ImportPath, pkg.Error.Err)
+		}
+		p.packages[pkg.ImportPath] = pkg
+	}
+
+	if err := p.addSource("go.mod"); err != nil {
+		return nil, fmt.Errorf("%s is not a module root: %w", root, err)
+	}
+
+	if err := p.addSource("go.sum"); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return nil, err
+	}
+
+	for _, pkg := range packages {
+		if err := p.addPackage(pkg); err != nil {
+			return nil, err
+		}
+	}
+
+	return &p.graph, nil
+}
+
+func defaultEnviron(ctx context.Context, root, goBinary string) ([]string, error) {
+	cmd := exec.CommandContext(ctx, goBinary, "env", "GOCACHE", "GOMODCACHE", "GOPATH")
+	cmd.Dir = root
+	cmd.Stderr = os.Stderr
+
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("go env: %w", err)
+	}
+
+	values := strings.Split(strings.TrimSpace(string(out)), "\n")
+	if len(values) != 3 {
+		return nil, fmt.Errorf("go env: unexpected output %q", out)
+	}
+
+	return []string{
+		"PATH=" + os.Getenv("PATH"),
+		"HOME=" + os.Getenv("HOME"),
+		"GOCACHE=" + values[0],
+		"GOMODCACHE=" + values[1],
+		"GOPATH=" + values[2],
+		"GOTOOLCHAIN=local",
+	}, nil
+}
+
+func listPackages(ctx context.Context, root, goBinary string) ([]*goPackage, error) {
+	cmd := exec.CommandContext(ctx, goBinary, "list", "-e", "-json", "./...")
+	cmd.Dir = root
+
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("go list: %w: %s", err, bytes.TrimSpace(stderr.Bytes()))
+	}
+
+	var packages []*goPackage
+	dec := json.NewDecoder(bytes.NewReader(out))
+	for {
+		var pkg goPackage
+		if err := dec.Decode(&pkg); errors.Is(err, io.EOF) {
+			break
+		} else if err != nil {
+			return nil, fmt.Errorf("go list: %w", err)
+		}
+		packages = append(packages, &pkg)
+	}
+
+	sort.Slice(packages, func(i, j int) bool {
+		return packages[i].ImportPath < packages[j].ImportPath
+	})
+	return packages, nil
+}
+
+// addSource registers file from the module directory. relPath uses forward slashes.
+func (p *planner) addSource(relPath string) error {
+	if _, ok := p.sourceIDs[relPath]; ok {
+		return nil
+	}
+
+	content, err := os.ReadFile(filepath.Join(p.root, filepath.FromSlash(relPath)))
+	if err != nil {
+		return err
+	}
+
+	// Path is a part of the ID, so that files with equal content at different paths get different IDs.
+	h := sha1.New()
+	_, _ = io.WriteString(h, relPath)
+	_, _ = h.Write([]byte{0})
+	_, _ = h.Write(content)
+
+	var id build.ID
+	copy(id[:], h.Sum(nil))
+
+	p.sourceIDs[relPath] = id
+	p.graph.SourceFiles[id] = relPath
+	return nil
+}
+
+// pkgDir returns directory of the package relative to the module root.
+func (p *planner) pkgDir(pkg *goPackage) (string, error) {
+	rel, err := filepath.Rel(p.root, pkg.Dir)
+	if err != nil {
+		return "", err
+	}
+	return filepath.ToSlash(rel), nil
+}
+
+// pkgFiles registers files of the package and returns their paths relative to the module root.
+func (p *planner) pkgFiles(pkg *goPackage, names []string) ([]string, error) {
+	dir, err := p.pkgDir(pkg)
+	if err != nil {
+		return nil, err
+	}
+
+	var files []string
+	for _, name := range names {
+		relPath := path.Join(dir, name)
+		if err := p.addSource(relPath); err != nil {
+			return nil, err
+		}
+		files = append(files, relPath)
+	}
+	return files, nil
+}
+
+// testdataFiles registers content of the testdata directory of the package.
+func (p *planner) testdataFiles(pkg *goPackage) ([]string, error) {
+	var names []string
+
+	testdata := filepath.Join(pkg.Dir, "testdata")
+	err := filepath.WalkDir(testdata, func(filePath string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if !d.Type().IsRegular() {
+			return nil
+		}
+
+		rel, err := filepath.Rel(pkg.Dir, filePath)
+		if err != nil {
+			return err
+		}
+		names = append(names, filepath.ToSlash(rel))
+		return nil
+	})
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	return p.pkgFiles(pkg, names)
+}
+
+// localDeps returns packages of the module from the list of imports, together with their dependencies.
+func (p *planner) localDeps(imports []string) []*goPackage {
+	seen := map[string]bool{}
+	var deps []*goPackage
+
+	add := func(importPath string) {
+		if pkg, ok := p.packages[importPath]; ok && !seen[importPath] {
+			seen[importPath] = true
+			deps = append(deps, pkg)
+		}
+	}
+
+	for _, importPath := range imports {
+		add(importPath)
+
+		if pkg, ok := p.packages[importPath]; ok {
+			for _, dep := range pkg.Deps {
+				add(dep)
+			}
+		}
+	}
+	return deps
+}
+
+// inputs collects source files of the packages together with go.mod and go.sum.
+func (p *planner) inputs(pkgs []*goPackage, extra ...string) ([]string, error) {
+	set := map[string]struct{}{}
+	for _, name := range []string{"go.mod", "go.sum"} {
+		if _, ok := p.sourceIDs[name]; ok {
+			set[name] = struct{}{}
+		}
+	}
+
+	for _, pkg := range pkgs {
+		files, err := p.pkgFiles(pkg, pkg.files())
+		if err != nil {
+			return nil, err
+		}
+
+		for _, f := range files {
+			set[f] = struct{}{}
+		}
+	}
+
+	for _, f := range extra {
+		set[f] = struct{}{}
+	}
+
+	inputs := make([]string, 0, len(set))
+	for f := range set {
+		inputs = append(inputs, f)
+	}
+	sort.Strings(inputs)
+	return inputs, nil
+}
+
+func (p *planner) addPackage(pkg *goPackage) error {
+	if _, ok := p.compile[pkg.ImportPath]; ok {
+		return nil
+	}
+
+	// Jobs of the imported packages go first, since ID of the job depends on IDs of its dependencies.
+	for _, dep := range p.localDeps(pkg.Imports) {
+		if err := p.addPackage(dep); err != nil {
+			return err
+		}
+	}
+
+	dir, err := p.pkgDir(pkg)
+	if err != nil {
+		return err
+	}
+	target := "."
+	if dir != "." {
+		target = "./" + dir
+	}
+
+	inputs, err := p.inputs(append([]*goPackage{pkg}, p.localDeps(pkg.Imports)...))
+	if err != nil {
+		return err
+	}
+
+	buildCmd := []string{p.opts.GoBinary, "build"}
+	if pkg.Name == "main" {
+		buildCmd = append(buildCmd, "-o", "{{.OutputDir}}/"+path.Base(pkg.ImportPath))
+	}
+	buildCmd = append(buildCmd, target)
+
+	compileID := p.addJob("build "+pkg.ImportPath, inputs, p.compileDeps(pkg.Imports, pkg.ImportPath), buildCmd)
+	p.compile[pkg.ImportPath] = compileID
+
+	testFiles, err := p.pkgFiles(pkg, pkg.testFiles())
+	if err != nil {
+		return err
+	}
+
+	testImports := concat(pkg.Imports, pkg.TestImports, pkg.XTestImports)
+	testPkgs := append([]*goPackage{pkg}, p.localDeps(testImports)...)
+
+	vetInputs, err := p.inputs(testPkgs, testFiles...)
+	if err != nil {
+		return err
+	}
+	p.addJob("vet "+pkg.ImportPath, vetInputs, []build.ID{compileID}, []string{p.opts.GoBinary, "vet", target})
+
+	if !pkg.hasTests() {
+		return nil
+	}
+
+	testdata, err := p.testdataFiles(pkg)
+	if err != nil {
+		return err
+	}
+
+	testInputs, err := p.inputs(testPkgs, append(testFiles, testdata...)...)
+	if err != nil {
+		return err
+	}
+
+	testDeps := append([]build.ID{compileID}, p.compileDeps(concat(pkg.TestImports, pkg.XTestImports), pkg.ImportPath)...)
+	p.addJob("test "+pkg.ImportPath, testInputs, dedup(testDeps), []string{p.opts.GoBinary, "test", target})
+	return nil
+}
+
+// compileDeps returns build jobs of the imported packages of the module.
+func (p *planner) compileDeps(imports []string, self string) []build.ID {
+	var deps []build.ID
+	for _, importPath := range imports {
+		if id, ok := p.compile[importPath]; ok && importPath != self {
+			deps = append(deps, id)
+		}
+	}
+	return dedup(deps)
+}
+
+func dedup(ids []build.ID) []build.ID {
+	seen := map[build.ID]bool{}
+	out := ids[:0]
+	for _, id := range ids {
+		if !seen[id] {
+			seen[id] = true
+			out = append(out, id)
+		}
+	}
+	return out
+}
+
+func (p *planner) addJob(name string, inputs []string, deps []build.ID, exec []string) build.ID {
+	job := build.Job{
+		Name:   name,
+		Inputs: inputs,
+		Deps:   deps,
+		Cmds: []build.Cmd{{
+			Exec:             exec,
+			Environ:          p.opts.Environ,
+			WorkingDirectory: "{{.SourceDir}}",
+		}},
+	}
+
+	sources := make([]build.ID, len(inputs))
+	for i, f := range inputs {
+		sources[i] = p.sourceIDs[f]
+	}
+
+	h := sha1.New()
+	_ = json.NewEncoder(h).Encode(struct {
+		Job     build.Job
+		Sources []build.ID
+	}{job, sources})
+	copy(job.ID[:], h.Sum(nil))
+
+	p.graph.Jobs = append(p.graph.Jobs, job)
+	return job.ID
+}
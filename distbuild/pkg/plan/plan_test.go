@@ -0,0 +1,141 @@
+package plan
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"gitlab.com/slon/shad-go/distbuild/pkg/build"
+)
+
+func writeModule(t *testing.T, files map[string]string) string {
+	t.Helper()
+
+	dir := t.TempDir()
+	for path, content := range files {
+		absPath := filepath.Join(dir, filepath.FromSlash(path))
+		require.NoError(t, os.MkdirAll(filepath.Dir(absPath), 0777))
+		require.NoError(t, os.WriteFile(absPath, []byte(content), 0666))
+	}
+	return dir
+}
+
+var testModule = map[string]string{
+	"go.mod":                "module example.com/m\n\ngo 1.24\n",
+	"lib/lib.go":            "package lib\n\nfunc Answer() int { return 42 }\n",
+	"lib/lib_test.go":       "package lib\n\nimport \"testing\"\n\nfunc TestAnswer(t *testing.T) {}\n",
+	"lib/testdata/in.txt":   "input\n",
+	"cmd/app/main.go":       "package main\n\nimport \"example.com/m/lib\"\n\nfunc main() { println(lib.Answer()) }\n",
+	"cmd/app/app_test.go":   "package main\n\nimport \"testing\"\n\nfunc TestApp(t *testing.T) {}\n",
+	"internal/util/util.go": "package util\n",
+}
+
+var testOptions = Options{Environ: []string{"PATH=/usr/bin"}}
+
+func jobsByName(g *build.Graph) map[string]*build.Job {
+	jobs := map[string]*build.Job{}
+	for i := range g.Jobs {
+		jobs[g.Jobs[i].Name] = &g.Jobs[i]
+	}
+	return jobs
+}
+
+func TestGenerate(t *testing.T) {
+	dir := writeModule(t, testModule)
+
+	g, err := Generate(context.Background(), dir, testOptions)
+	require.NoError(t, err)
+
+	jobs := jobsByName(g)
+	require.ElementsMatch(t, []string{
+		"build example.com/m/cmd/app",
+		"vet example.com/m/cmd/app",
+		"test example.com/m/cmd/app",
+		"build example.com/m/internal/util",
+		"vet example.com/m/internal/util",
+		"build example.com/m/lib",
+		"vet example.com/m/lib",
+		"test example.com/m/lib",
+	}, func() []string {
+		var names []string
+		for name := range jobs {
+			names = append(names, name)
+		}
+		return names
+	}())
+
+	lib := jobs["build example.com/m/lib"]
+	app := jobs["build example.com/m/cmd/app"]
+
+	require.Equal(t, []string{"go.mod", "lib/lib.go"}, lib.Inputs)
+	require.Empty(t, lib.Deps)
+	require.Equal(t, []string{"go", "build", "./lib"}, lib.Cmds[0].Exec)
+	require.Equal(t, "{{.SourceDir}}", lib.Cmds[0].WorkingDirectory)
+	require.Equal(t, testOptions.Environ, lib.Cmds[0].Environ)
+
+	require.Equal(t, []string{"cmd/app/main.go", "go.mod", "lib/lib.go"}, app.Inputs)
+	require.Equal(t, []build.ID{lib.ID}, app.Deps)
+	require.Equal(t, []string{"go", "build", "-o", "{{.OutputDir}}/app", "./cmd/app"}, app.Cmds[0].Exec)
+
+	libTest := jobs["test example.com/m/lib"]
+	require.Equal(t, []string{"go.mod", "lib/lib.go", "lib/lib_test.go", "lib/testdata/in.txt"}, libTest.Inputs)
+	require.Equal(t, []build.ID{lib.ID}, libTest.Deps)
+
+	require.Equal(t, []build.ID{app.ID}, jobs["vet example.com/m/cmd/app"].Deps)
+
+	paths := map[string]bool{}
+	for _, path := range g.SourceFiles {
+		paths[path] = true
+	}
+	for _, job := range g.Jobs {
+		for _, input := range job.Inputs {
+			require.True(t, paths[input], "input %s is missing from source files", input)
+		}
+	}
+
+	require.NoError(t, build.Validate(*g))
+	require.Len(t, build.TopSort(g.Jobs), len(g.Jobs))
+}
+
+func TestGenerateDeterministic(t *testing.T) {
+	dir := writeModule(t, testModule)
+
+	first, err := Generate(context.Background(), dir, testOptions)
+	require.NoError(t, err)
+
+	second, err := Generate(context.Background(), dir, testOptions)
+	require.NoError(t, err)
+
+	require.Equal(t, first, second)
+}
+
+func TestGenerateContentHash(t *testing.T) {
+	dir := writeModule(t, testModule)
+
+	before, err := Generate(context.Background(), dir, testOptions)
+	require.NoError(t, err)
+
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "lib", "lib.go"), []byte("package lib\n\nfunc Answer() int { return 43 }\n"), 0666))
+
+	after, err := Generate(context.Background(), dir, testOptions)
+	require.NoError(t, err)
+
+	changed := func(name string) bool {
+		return jobsByName(before)[name].ID != jobsByName(after)[name].ID
+	}
+
+	require.True(t, changed("build example.com/m/lib"))
+	require.True(t, changed("test example.com/m/lib"))
+	require.True(t, changed("build example.com/m/cmd/app"), "change must propagate to dependent jobs")
+	require.False(t, changed("build example.com/m/internal/util"))
+}
+
+func TestGenerateNotModule(t *testing.T) {
+	dir := writeModule(t, map[string]string{"a.go": "package a\n"})
+
+	_, err := Generate(context.Background(), dir, testOptions)
+	require.Error(t, err)
+}
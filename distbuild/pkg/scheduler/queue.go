@@ -0,0 +1,152 @@
+//go:build !solution
+
+package scheduler
+
+import "container/heap"
+
+// compactThreshold is the number of stale entries a queue may hold above the number of live ones.
+const compactThreshold = 64
+
+// jobQueue is a priority queue of pending jobs.
+//
+// Jobs of every tenant are kept in a separate heap, so that scheduler picks tenant first and job second.
+// Jobs with higher priority are popped first. Jobs with equal priority are popped in FIFO order.
+// The same job may be present in several queues at once, so picked jobs are removed lazily.
+type jobQueue struct {
+	heaps map[*tenant]*jobHeap
+
+	// live is the number of distinct jobs waiting in the queue. entries is the number of heap entries,
+	// including stale ones.
+	live    int
+	entries int
+}
+
+type queueEntry struct {
+	job      *PendingJob
+	priority int
+	seq      uint64
+	gen      uint64
+}
+
+// stale reports whether the job was picked, retried or its priority was raised after the entry was pushed.
+func (e *queueEntry) stale() bool {
+	return e.job.picked || e.gen != e.job.gen || e.priority != e.job.priority
+}
+
+// push adds the job, which is not in the queue yet.
+func (q *jobQueue) push(job *PendingJob) {
+	q.live++
+	q.pushEntry(job)
+}
+
+// raise pushes the job, which is already in the queue, with its new priority.
+func (q *jobQueue) raise(job *PendingJob) {
+	q.pushEntry(job)
+}
+
+// remove is called when the job in the queue is picked. Its entries are removed lazily.
+func (q *jobQueue) remove() {
+	q.live--
+}
+
+func (q *jobQueue) pushEntry(job *PendingJob) {
+	if q.heaps == nil {
+		q.heaps = make(map[*tenant]*jobHeap)
+	}
+
+	h, ok := q.heaps[job.tenant]
+	if !ok {
+		h = &jobHeap{}
+		q.heaps[job.tenant] = h
+	}
+	heap.Push(h, queueEntry{job: job, priority: job.priority, seq: job.seq, gen: job.gen})
+	q.entries++
+
+	// Worker that doesn't pick jobs never pops stale entries of the jobs picked by others.
+	if q.entries > 2*q.live+compactThreshold {
+		q.compact()
+	}
+}
+
+func (q *jobQueue) compact() {
+	q.entries = 0
+	for t, h := range q.heaps {
+		live := (*h)[:0]
+		for _, e := range *h {
+			if !e.stale() {
+				live = append(live, e)
+			}
+		}
+		clear((*h)[len(live):])
+		*h = live
+
+		if len(live) == 0 {
+			delete(q.heaps, t)
+			continue
+		}
+		heap.Init(h)
+		q.entries += len(live)
+	}
+}
+
+// peek returns the most urgent job of the tenant that is still waiting to be picked.
+func (q *jobQueue) peek(t *tenant) *PendingJob {
+	h, ok := q.heaps[t]
+	if !ok {
+		return nil
+	}
+
+	for len(*h) != 0 {
+		top := &(*h)[0]
+		if !top.stale() {
+			return top.job
+		}
+		heap.Pop(h)
+		q.entries--
+	}
+
+	delete(q.heaps, t)
+	return nil
+}
+
+// jobs calls f for every job waiting in the queue. Job may be reported more than once.
+func (q *jobQueue) jobs(f func(job *PendingJob)) {
+	for _, h := range q.heaps {
+		for i := range *h {
+			if e := &(*h)[i]; !e.stale() {
+				f(e.job)
+			}
+		}
+	}
+}
+
+// len returns the number of distinct jobs waiting in the queue.
+func (q *jobQueue) len() int {
+	return q.live
+}
+
+type jobHeap []queueEntry
+
+func (h jobHeap) Len() int { return len(h) }
+
+func (h jobHeap) Less(i, j int) bool {
+	if h[i].priority != h[j].priority {
+		return h[i].priority > h[j].priority
+	}
+	return h[i].seq < h[j].seq
+}
+
+func (h jobHeap) Swap(i, j int) { h[i], h[j] = h[j], h[i] }
+
+func (h *jobHeap) Push(x any) {
+	*h = append(*h, x.(queueEntry))
+}
+
+func (h *jobHeap) Pop() any {
+	old := *h
+	n := len(old)
+	e := old[n-1]
+	old[n-1] = queueEntry{}
+	*h = old[:n-1]
+	return e
+}
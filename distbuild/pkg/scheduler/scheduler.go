@@ -4,6 +4,7 @@ package scheduler
 
 import (
 	"context"
+	"sync"
 	"time"
 
 	"go.uber.org/zap"
@@ -16,36 +17,672 @@ type PendingJob struct {
 	Job      *api.JobSpec
 	Finished chan struct{}
 	Result   *api.JobResult
+
+	priority int
+	seq      uint64
+
+	// gen is bumped every time the job is put back into the queues, so that queue entries
+	// of the previous attempts stay stale.
+	gen uint64
+
+	// refs counts builds waiting for this job.
+	refs int
+
+	// picked is set when some worker took this job. pickedCh is closed at the same moment.
+	picked   bool
+	pickedCh chan struct{}
+	workerID api.WorkerID
+
+	// depsStage is set when job is allowed to enter second local queues.
+	depsStage bool
+
+	// tenant is the tenant of the build that scheduled the job first. running is set while the job
+	// is counted against the limit of the tenant.
+	tenant  *tenant
+	running bool
+
+	// attempts holds failed attempts of the job, after which it was put back into the queues.
+	attempts []api.JobAttempt
+
+	queues map[*jobQueue]struct{}
 }
 
 type Config struct {
 	CacheTimeout time.Duration
 	DepsTimeout  time.Duration
+
+	// HeartbeatTimeout is how long worker may stay silent before it is considered lost.
+	// Jobs running on the lost worker are put back into the queues. Zero disables detection.
+	HeartbeatTimeout time.Duration
+
+	// MaxAttempts limits how many times a job is started, when it fails with transient error or
+	// its worker is lost. Zero means a single attempt.
+	MaxAttempts int
+
+	// QuarantineThreshold is the number of consecutive transient failures, after which worker
+	// gets no jobs during QuarantineDuration. Zero disables quarantine.
+	QuarantineThreshold int
+	QuarantineDuration  time.Duration
+}
+
+// workerQueues holds two local queues of a single worker, together with its health state.
+type workerQueues struct {
+	// cached contains jobs which results are already stored on this worker.
+	cached jobQueue
+	// deps contains jobs which dependencies are stored on this worker.
+	deps jobQueue
+
+	// alive is signalled on every heartbeat of the worker.
+	alive chan struct{}
+
+	// failures counts consecutive transient failures of the jobs on this worker.
+	failures    int
+	quarantined bool
 }
 
 type Scheduler struct {
+	l         *zap.Logger
+	config    Config
+	timeAfter func(d time.Duration) <-chan time.Time
+
+	mu        sync.Mutex
+	seq       uint64
+	pending   map[build.ID]*PendingJob
+	artifacts map[build.ID]map[api.WorkerID]struct{}
+	workers   map[api.WorkerID]*workerQueues
+	global    jobQueue
+	tenants   map[string]*tenant
+
+	// dependents indexes jobs in the deps stage, that are not picked yet, by their dependencies.
+	dependents map[build.ID]map[*PendingJob]struct{}
+
+	// cancelled holds running jobs that workers must stop.
+	cancelled map[api.WorkerID][]build.ID
+
+	// cacheHits and cacheMisses count new jobs, which artifact was or wasn't known at the moment of scheduling.
+	cacheHits   uint64
+	cacheMisses uint64
+
+	// wakeup is closed and replaced every time a new job is added to any queue.
+	wakeup chan struct{}
+
+	stop     chan struct{}
+	stopOnce sync.Once
+	wg       sync.WaitGroup
 }
 
 func NewScheduler(l *zap.Logger, config Config, timeAfter func(d time.Duration) <-chan time.Time) *Scheduler {
-	panic("implement me")
+	return &Scheduler{
+		l:         l,
+		config:    config,
+		timeAfter: timeAfter,
+		pending:   make(map[build.ID]*PendingJob),
+		artifacts: make(map[build.ID]map[api.WorkerID]struct{}),
+		workers:   make(map[api.WorkerID]*workerQueues),
+		tenants:   make(map[string]*tenant),
+		cancelled: make(map[api.WorkerID][]build.ID),
+
+		dependents: make(map[build.ID]map[*PendingJob]struct{}),
+		wakeup:     make(chan struct{}),
+		stop:       make(chan struct{}),
+	}
+}
+
+// RegisterWorker is called on every heartbeat of the worker.
+func (c *Scheduler) RegisterWorker(workerID api.WorkerID) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	w := c.registerWorkerLocked(workerID)
+	select {
+	case w.alive <- struct{}{}:
+	default:
+	}
+}
+
+func (c *Scheduler) registerWorkerLocked(workerID api.WorkerID) *workerQueues {
+	w, ok := c.workers[workerID]
+	if !ok {
+		w = &workerQueues{alive: make(chan struct{}, 1)}
+		c.workers[workerID] = w
+		c.l.Debug("worker registered", zap.Stringer("worker_id", workerID))
+
+		if c.config.HeartbeatTimeout > 0 {
+			c.wg.Add(1)
+			go c.watchWorker(workerID, w)
+		}
+	}
+	return w
+}
+
+// watchWorker detects worker that stopped sending heartbeats.
+func (c *Scheduler) watchWorker(workerID api.WorkerID, w *workerQueues) {
+	defer c.wg.Done()
+
+	for {
+		select {
+		case <-w.alive:
+		case <-c.timeAfter(c.config.HeartbeatTimeout):
+			c.onWorkerLost(workerID, w)
+			return
+		case <-c.stop:
+			return
+		}
+	}
+}
+
+// onWorkerLost forgets the worker and puts jobs running on it back into the queues.
+//
+// Artifacts of the worker are forgotten too. If worker comes back, it is registered as a new one.
+func (c *Scheduler) onWorkerLost(workerID api.WorkerID, w *workerQueues) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.workers[workerID] != w {
+		return
+	}
+
+	c.l.Warn("worker lost", zap.Stringer("worker_id", workerID))
+	delete(c.workers, workerID)
+	delete(c.cancelled, workerID)
+
+	// Queues of the worker are dropped together with it.
+	for _, q := range []*jobQueue{&w.cached, &w.deps} {
+		q.jobs(func(job *PendingJob) {
+			delete(job.queues, q)
+		})
+	}
+
+	for id, workers := range c.artifacts {
+		delete(workers, workerID)
+		if len(workers) == 0 {
+			delete(c.artifacts, id)
+		}
+	}
+
+	for _, job := range c.pending {
+		if !job.picked || job.workerID != workerID {
+			continue
+		}
+
+		attempt := api.JobAttempt{WorkerID: workerID, Error: "worker stopped sending heartbeats"}
+		if !c.retryLocked(job, attempt) {
+			errorString := attempt.Error
+			c.finishLocked(job, &api.JobResult{ID: job.Job.ID, Error: &errorString, Transient: true})
+		}
+	}
 }
 
 func (c *Scheduler) LocateArtifact(id build.ID) (api.WorkerID, bool) {
-	panic("implement me")
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for workerID := range c.artifacts[id] {
+		return workerID, true
+	}
+	return "", false
+}
+
+// RegisterArtifact records that artifact is stored in the cache of the worker.
+func (c *Scheduler) RegisterArtifact(workerID api.WorkerID, id build.ID) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.addArtifactLocked(workerID, id)
+}
+
+// RemoveArtifact records that artifact is no longer stored in the cache of the worker.
+func (c *Scheduler) RemoveArtifact(workerID api.WorkerID, id build.ID) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	workers, ok := c.artifacts[id]
+	if !ok {
+		return
+	}
+
+	delete(workers, workerID)
+	if len(workers) == 0 {
+		delete(c.artifacts, id)
+	}
+}
+
+func (c *Scheduler) addArtifactLocked(workerID api.WorkerID, id build.ID) {
+	workers, ok := c.artifacts[id]
+	if !ok {
+		workers = make(map[api.WorkerID]struct{})
+		c.artifacts[id] = workers
+	}
+
+	if _, ok := workers[workerID]; ok {
+		return
+	}
+	workers[workerID] = struct{}{}
+
+	w := c.registerWorkerLocked(workerID)
+	if job, ok := c.pending[id]; ok && !job.picked {
+		c.enqueueLocked(job, &w.cached)
+	}
+
+	for job := range c.dependents[id] {
+		c.enqueueLocked(job, &w.deps)
+	}
 }
 
+// OnJobComplete records result of the job and reports whether the pending job is finished.
+//
+// Job that failed with transient error is put back into the queues, until it runs out of attempts.
 func (c *Scheduler) OnJobComplete(workerID api.WorkerID, jobID build.ID, res *api.JobResult) bool {
-	panic("implement me")
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	// Failed jobs leave no artifact on the worker.
+	if res == nil || (res.Error == nil && res.ExitCode == 0) {
+		c.addArtifactLocked(workerID, jobID)
+	}
+
+	transient := res != nil && res.Transient
+	if res != nil {
+		c.onWorkerResultLocked(workerID, transient)
+	}
+
+	job, ok := c.pending[jobID]
+	if !ok {
+		return false
+	}
+
+	if transient {
+		// Result of the previous attempt is ignored, if the job is already given to another worker.
+		if !job.picked || job.workerID != workerID {
+			return false
+		}
+
+		errorString := ""
+		if res.Error != nil {
+			errorString = *res.Error
+		}
+
+		if c.retryLocked(job, api.JobAttempt{WorkerID: workerID, Error: errorString}) {
+			return false
+		}
+	}
+
+	c.finishLocked(job, res)
+	c.l.Debug("job completed", zap.Stringer("job_id", jobID), zap.Stringer("worker_id", workerID))
+	return true
+}
+
+func (c *Scheduler) finishLocked(job *PendingJob, res *api.JobResult) {
+	delete(c.pending, job.Job.ID)
+	c.markPickedLocked(job)
+	c.stopRunningLocked(job)
+	job.tenant.pending--
+	c.releaseLocked(job.tenant)
+
+	if res != nil {
+		res.Attempts = append(job.attempts, res.Attempts...)
+	}
+	job.Result = res
+	close(job.Finished)
 }
 
+// retryLocked records failed attempt and puts picked job back into the queues.
+//
+// retryLocked returns false, if the job has no attempts left. The last attempt is not recorded,
+// since it is described by the result of the job.
+func (c *Scheduler) retryLocked(job *PendingJob, attempt api.JobAttempt) bool {
+	if len(job.attempts)+1 >= max(c.config.MaxAttempts, 1) {
+		return false
+	}
+	job.attempts = append(job.attempts, attempt)
+
+	c.l.Info("retrying job",
+		zap.Stringer("job_id", job.Job.ID),
+		zap.Stringer("worker_id", attempt.WorkerID),
+		zap.Int("attempt", len(job.attempts)),
+		zap.String("error", attempt.Error))
+
+	c.stopRunningLocked(job)
+	job.gen++
+	job.picked = false
+	job.pickedCh = make(chan struct{})
+	job.queues = make(map[*jobQueue]struct{})
+	job.workerID = ""
+
+	// Timeouts of the local queues already passed, so the job goes to the global queue at once.
+	c.enterDepsStageLocked(job)
+	c.enqueueLocked(job, &c.global)
+	return true
+}
+
+// onWorkerResultLocked tracks consecutive transient failures of the worker and quarantines flaky workers.
+func (c *Scheduler) onWorkerResultLocked(workerID api.WorkerID, transient bool) {
+	w := c.registerWorkerLocked(workerID)
+	if !transient {
+		w.failures = 0
+		return
+	}
+
+	w.failures++
+	if c.config.QuarantineThreshold == 0 || w.failures < c.config.QuarantineThreshold || w.quarantined {
+		return
+	}
+
+	c.l.Warn("worker quarantined", zap.Stringer("worker_id", workerID), zap.Int("failures", w.failures))
+	w.quarantined = true
+
+	c.wg.Add(1)
+	go func() {
+		defer c.wg.Done()
+
+		select {
+		case <-c.timeAfter(c.config.QuarantineDuration):
+		case <-c.stop:
+			return
+		}
+
+		c.mu.Lock()
+		defer c.mu.Unlock()
+
+		c.l.Info("worker released from quarantine", zap.Stringer("worker_id", workerID))
+		w.quarantined = false
+		w.failures = 0
+		c.notifyLocked()
+	}()
+}
+
+// ScheduleJob puts job into the queue or returns already pending job with the same ID.
+//
+// Pending job is accounted to the tenant that scheduled it first. If the same job is scheduled again with higher priority, the priority of the pending job is raised.
 func (c *Scheduler) ScheduleJob(job *api.JobSpec) *PendingJob {
-	panic("implement me")
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if pending, ok := c.pending[job.ID]; ok {
+		pending.refs++
+		if job.Priority > pending.priority && !pending.picked {
+			pending.priority = job.Priority
+			for q := range pending.queues {
+				q.raise(pending)
+			}
+			c.notifyLocked()
+		}
+		return pending
+	}
+
+	t := c.tenantLocked(job.Tenant)
+	c.activateLocked(t)
+	t.pending++
+
+	c.seq++
+	pending := &PendingJob{
+		Job:      job,
+		Finished: make(chan struct{}),
+		priority: job.Priority,
+		seq:      c.seq,
+		refs:     1,
+		pickedCh: make(chan struct{}),
+		tenant:   t,
+		queues:   make(map[*jobQueue]struct{}),
+	}
+	c.pending[job.ID] = pending
+
+	cached := false
+	for workerID := range c.artifacts[job.ID] {
+		c.enqueueLocked(pending, &c.registerWorkerLocked(workerID).cached)
+		cached = true
+	}
+
+	if cached {
+		c.cacheHits++
+	} else {
+		c.cacheMisses++
+		c.enterDepsStageLocked(pending)
+	}
+
+	c.wg.Add(1)
+	go c.waitTimeouts(pending, pending.gen, pending.pickedCh, cached)
+
+	c.l.Debug("job scheduled",
+		zap.Stringer("job_id", job.ID),
+		zap.Int("priority", job.Priority),
+		zap.Bool("cached", cached))
+	return pending
+}
+
+// Stats is a snapshot of the scheduler state.
+type Stats struct {
+	Workers     int
+	Quarantined int
+
+	// Pending is the number of scheduled jobs that are not finished yet.
+	Pending int
+
+	// GlobalQueue, CachedQueue and DepsQueue are the numbers of jobs waiting in the queues.
+	// Local queues are summed over all workers.
+	GlobalQueue int
+	CachedQueue int
+	DepsQueue   int
+
+	// CacheHits and CacheMisses count jobs passed to ScheduleJob, which artifact was or wasn't
+	// already stored on some worker. Jobs that were pending already are not counted.
+	CacheHits   uint64
+	CacheMisses uint64
+}
+
+func (c *Scheduler) Stats() Stats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	s := Stats{
+		Workers:     len(c.workers),
+		Pending:     len(c.pending),
+		GlobalQueue: c.global.len(),
+		CacheHits:   c.cacheHits,
+		CacheMisses: c.cacheMisses,
+	}
+
+	for _, w := range c.workers {
+		if w.quarantined {
+			s.Quarantined++
+		}
+
+		s.CachedQueue += w.cached.len()
+		s.DepsQueue += w.deps.len()
+	}
+	return s
+}
+
+// CancelJob tells scheduler that one of the builds no longer waits for the job.
+//
+// When no build is waiting for the job, it is removed from the queues. If the job is already
+// running, the worker is asked to stop it with the next heartbeat.
+func (c *Scheduler) CancelJob(job *PendingJob) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.pending[job.Job.ID] != job {
+		return
+	}
+
+	job.refs--
+	if job.refs > 0 {
+		return
+	}
+
+	if job.picked {
+		c.cancelled[job.workerID] = append(c.cancelled[job.workerID], job.Job.ID)
+	}
+
+	errorString := "job cancelled"
+	c.finishLocked(job, &api.JobResult{ID: job.Job.ID, Error: &errorString})
+
+	c.l.Debug("job cancelled", zap.Stringer("job_id", job.Job.ID), zap.Stringer("worker_id", job.workerID))
+}
+
+// TakeCancelledJobs returns jobs that must be stopped on the worker.
+func (c *Scheduler) TakeCancelledJobs(workerID api.WorkerID) []build.ID {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	jobs := c.cancelled[workerID]
+	delete(c.cancelled, workerID)
+	return jobs
+}
+
+// waitTimeouts moves the job of the given generation to the next queues, until it is picked.
+// Retried job goes to the global queue at once, so timeouts of the old generation are dropped.
+func (c *Scheduler) waitTimeouts(job *PendingJob, gen uint64, pickedCh <-chan struct{}, cached bool) {
+	defer c.wg.Done()
+
+	if cached {
+		select {
+		case <-c.timeAfter(c.config.CacheTimeout):
+		case <-pickedCh:
+			return
+		case <-c.stop:
+			return
+		}
+
+		c.mu.Lock()
+		if !job.picked && job.gen == gen {
+			c.enterDepsStageLocked(job)
+		}
+		c.mu.Unlock()
+	}
+
+	select {
+	case <-c.timeAfter(c.config.DepsTimeout):
+	case <-pickedCh:
+		return
+	case <-c.stop:
+		return
+	}
+
+	c.mu.Lock()
+	if !job.picked && job.gen == gen {
+		c.enqueueLocked(job, &c.global)
+	}
+	c.mu.Unlock()
+}
+
+func (c *Scheduler) enterDepsStageLocked(job *PendingJob) {
+	job.depsStage = true
+
+	for _, dep := range job.Job.Deps {
+		jobs, ok := c.dependents[dep]
+		if !ok {
+			jobs = make(map[*PendingJob]struct{})
+			c.dependents[dep] = jobs
+		}
+		jobs[job] = struct{}{}
+
+		for workerID := range c.artifacts[dep] {
+			c.enqueueLocked(job, &c.registerWorkerLocked(workerID).deps)
+		}
+	}
+}
+
+func (c *Scheduler) enqueueLocked(job *PendingJob, q *jobQueue) {
+	if _, ok := job.queues[q]; ok {
+		return
+	}
+
+	job.queues[q] = struct{}{}
+	q.push(job)
+	c.notifyLocked()
+}
+
+func (c *Scheduler) notifyLocked() {
+	close(c.wakeup)
+	c.wakeup = make(chan struct{})
+}
+
+func (c *Scheduler) markPickedLocked(job *PendingJob) {
+	if job.picked {
+		return
+	}
+
+	job.picked = true
+	for q := range job.queues {
+		q.remove()
+	}
+	job.queues = nil
+	close(job.pickedCh)
+
+	if job.depsStage {
+		for _, dep := range job.Job.Deps {
+			delete(c.dependents[dep], job)
+			if len(c.dependents[dep]) == 0 {
+				delete(c.dependents, dep)
+			}
+		}
+	}
 }
 
+// pickLocked returns the most urgent job visible to the worker.
+//
+// Tenant with the smallest virtual time, which is below its limit of running jobs, is served first.
+// Among jobs of that tenant the job with the highest priority is picked. Among jobs with equal
+// priority, local queues are preferred over the global one.
+func (c *Scheduler) pickLocked(workerID api.WorkerID) *PendingJob {
+	w := c.registerWorkerLocked(workerID)
+	if w.quarantined {
+		return nil
+	}
+
+	var best *PendingJob
+	for _, q := range []*jobQueue{&w.cached, &w.deps, &c.global} {
+		for t := range q.heaps {
+			if t.full() {
+				continue
+			}
+
+			job := q.peek(t)
+			if job == nil {
+				continue
+			}
+
+			if best == nil || t.before(best.tenant) || t == best.tenant && job.priority > best.priority {
+				best = job
+			}
+		}
+	}
+
+	if best != nil {
+		c.markPickedLocked(best)
+		c.startRunningLocked(best)
+		best.workerID = workerID
+	}
+	return best
+}
+
+// PickJob blocks until a job is available for the worker or ctx is canceled.
 func (c *Scheduler) PickJob(ctx context.Context, workerID api.WorkerID) *PendingJob {
-	panic("implement me")
+	for {
+		c.mu.Lock()
+		job := c.pickLocked(workerID)
+		wakeup := c.wakeup
+		c.mu.Unlock()
+
+		if job != nil {
+			c.l.Debug("job picked", zap.Stringer("job_id", job.Job.ID), zap.Stringer("worker_id", workerID))
+			return job
+		}
+
+		select {
+		case <-wakeup:
+		case <-ctx.Done():
+			return nil
+		case <-c.stop:
+			return nil
+		}
+	}
 }
 
 func (c *Scheduler) Stop() {
-	panic("implement me")
+	c.stopOnce.Do(func() {
+		close(c.stop)
+	})
+	c.wg.Wait()
 }
@@ -0,0 +1,198 @@
+//go:build !solution
+
+package scheduler
+
+import (
+	"sort"
+
+	"go.uber.org/zap"
+)
+
+// TenantConfig sets the share of the cluster given to the tenant.
+type TenantConfig struct {
+	// Weight is the relative share of the tenant. Tenant with weight 2 starts twice as many jobs
+	// as tenant with weight 1, while both have jobs waiting. Zero means 1.
+	Weight float64
+
+	// MaxRunningJobs limits the number of jobs of the tenant running at the same time. Zero means no limit.
+	MaxRunningJobs int
+}
+
+// tenant tracks the state of weighted fair queuing for a single tenant.
+type tenant struct {
+	name   string
+	config TenantConfig
+
+	// configured is set by SetTenant. Tenants without config are forgotten, when they have no pending jobs.
+	configured bool
+
+	// vtime is the virtual time of the tenant. It grows by 1/weight with every started job,
+	// and the tenant with the smallest vtime is served first.
+	vtime float64
+
+	// pending counts jobs of the tenant that are not finished. running counts picked jobs among them.
+	pending int
+	running int
+}
+
+func (t *tenant) weight() float64 {
+	if t.config.Weight <= 0 {
+		return 1
+	}
+	return t.config.Weight
+}
+
+// full reports whether the tenant reached its limit of running jobs.
+func (t *tenant) full() bool {
+	return t.config.MaxRunningJobs > 0 && t.running >= t.config.MaxRunningJobs
+}
+
+// before reports whether t is served before other.
+func (t *tenant) before(other *tenant) bool {
+	if t.vtime != other.vtime {
+		return t.vtime < other.vtime
+	}
+	return t.name < other.name
+}
+
+// SetTenant changes the share of the tenant. Tenants without config get weight 1 and no limit.
+func (c *Scheduler) SetTenant(name string, config TenantConfig) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	t := c.tenantLocked(name)
+	t.config = config
+	t.configured = true
+	c.notifyLocked()
+}
+
+func (c *Scheduler) tenantLocked(name string) *tenant {
+	t, ok := c.tenants[name]
+	if !ok {
+		t = &tenant{name: name}
+		c.tenants[name] = t
+	}
+	return t
+}
+
+// releaseLocked is called when the tenant has no pending jobs left.
+//
+// Tenant without config is removed, so that the number of tenants doesn't grow with every name ever seen.
+// Its virtual time is lost, which only matters for the tenant, which was ahead of the others.
+func (c *Scheduler) releaseLocked(t *tenant) {
+	if t.pending != 0 || t.configured {
+		return
+	}
+
+	delete(c.tenants, t.name)
+	c.l.Debug("tenant released", zap.String("tenant", t.name))
+}
+
+// activateLocked is called when the tenant gets its first pending job.
+//
+// Idle tenant doesn't accumulate credit: its virtual time is moved forward to the smallest virtual time
+// among active tenants, so it can't starve others by the burst of jobs.
+func (c *Scheduler) activateLocked(t *tenant) {
+	if t.pending != 0 {
+		return
+	}
+
+	first := true
+	var minVTime float64
+	for _, other := range c.tenants {
+		if other == t || other.pending == 0 {
+			continue
+		}
+
+		if first || other.vtime < minVTime {
+			minVTime = other.vtime
+			first = false
+		}
+	}
+
+	if !first && t.vtime < minVTime {
+		t.vtime = minVTime
+	}
+	c.l.Debug("tenant activated", zap.String("tenant", t.name), zap.Float64("vtime", t.vtime))
+}
+
+func (c *Scheduler) startRunningLocked(job *PendingJob) {
+	job.running = true
+	job.tenant.running++
+	job.tenant.vtime += 1 / job.tenant.weight()
+}
+
+func (c *Scheduler) stopRunningLocked(job *PendingJob) {
+	if !job.running {
+		return
+	}
+
+	job.running = false
+	job.tenant.running--
+
+	// Tenant might be below its limit again.
+	c.notifyLocked()
+}
+
+// TenantStats describes the share of the tenant.
+type TenantStats struct {
+	Tenant         string
+	Weight         float64
+	MaxRunningJobs int
+
+	// Share is the fraction of the cluster the tenant is entitled to, among tenants having pending jobs.
+	Share float64
+
+	// Position is the place of the tenant in the order of service, starting from 1.
+	// Tenants without pending jobs have zero position.
+	Position int
+
+	Running int
+	Waiting int
+}
+
+// Tenants returns stats of all known tenants. Active tenants come first, in the order of service.
+func (c *Scheduler) Tenants() []TenantStats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	tenants := make([]*tenant, 0, len(c.tenants))
+	for _, t := range c.tenants {
+		tenants = append(tenants, t)
+	}
+
+	sort.Slice(tenants, func(i, j int) bool {
+		a, b := tenants[i], tenants[j]
+		if (a.pending != 0) != (b.pending != 0) {
+			return a.pending != 0
+		}
+		if a.pending == 0 {
+			return a.name < b.name
+		}
+		return a.before(b)
+	})
+
+	var totalWeight float64
+	for _, t := range tenants {
+		if t.pending != 0 {
+			totalWeight += t.weight()
+		}
+	}
+
+	stats := make([]TenantStats, len(tenants))
+	for i, t := range tenants {
+		stats[i] = TenantStats{
+			Tenant:         t.name,
+			Weight:         t.weight(),
+			MaxRunningJobs: t.config.MaxRunningJobs,
+			Running:        t.running,
+			Waiting:        t.pending - t.running,
+		}
+
+		if t.pending != 0 {
+			stats[i].Share = t.weight() / totalWeight
+			stats[i].Position = i + 1
+		}
+	}
+	return stats
+}
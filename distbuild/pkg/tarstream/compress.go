@@ -0,0 +1,77 @@
+package tarstream
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// Compression задаёт алгоритм сжатия потока. Значение совпадает с HTTP заголовком Content-Encoding.
+type Compression string
+
+const (
+	CompressionNone Compression = ""
+	CompressionGzip Compression = "gzip"
+	CompressionZstd Compression = "zstd"
+)
+
+// AcceptEncoding перечисляет поддерживаемые алгоритмы в порядке предпочтения, в формате HTTP заголовка Accept-Encoding.
+const AcceptEncoding = "zstd, gzip"
+
+// NegotiateCompression выбирает алгоритм сжатия по заголовку Accept-Encoding клиента.
+func NegotiateCompression(acceptEncoding string) Compression {
+	accepted := map[Compression]bool{}
+	for _, part := range strings.Split(acceptEncoding, ",") {
+		name, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		if strings.ReplaceAll(params, " ", "") == "q=0" {
+			continue
+		}
+		accepted[Compression(strings.ToLower(name))] = true
+	}
+
+	for _, c := range []Compression{CompressionZstd, CompressionGzip} {
+		if accepted[c] {
+			return c
+		}
+	}
+	return CompressionNone
+}
+
+type nopWriteCloser struct {
+	io.Writer
+}
+
+func (nopWriteCloser) Close() error { return nil }
+
+func compressWriter(w io.Writer, c Compression) (io.WriteCloser, error) {
+	switch c {
+	case CompressionNone:
+		return nopWriteCloser{w}, nil
+	case CompressionGzip:
+		return gzip.NewWriter(w), nil
+	case CompressionZstd:
+		return zstd.NewWriter(w, zstd.WithEncoderConcurrency(1))
+	default:
+		return nil, fmt.Errorf("tarstream: unsupported compression %q", c)
+	}
+}
+
+func decompressReader(r io.Reader, c Compression) (io.ReadCloser, error) {
+	switch c {
+	case CompressionNone:
+		return io.NopCloser(r), nil
+	case CompressionGzip:
+		return gzip.NewReader(r)
+	case CompressionZstd:
+		d, err := zstd.NewReader(r, zstd.WithDecoderConcurrency(1))
+		if err != nil {
+			return nil, err
+		}
+		return d.IOReadCloser(), nil
+	default:
+		return nil, fmt.Errorf("tarstream: unsupported compression %q", c)
+	}
+}
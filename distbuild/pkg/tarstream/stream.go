@@ -2,14 +2,51 @@ package tarstream
 
 import (
 	"archive/tar"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
 	"io"
 	"os"
 	"path/filepath"
+	"strings"
+	"time"
 )
 
-// Send рекурсивно обходит директорию и сериализует её содержимое в поток w.
-func Send(dir string, w io.Writer) error {
-	tw := tar.NewWriter(w)
+// ErrChecksum возвращается из Receive, если содержимое файла не совпало с манифестом.
+var ErrChecksum = errors.New("tarstream: checksum mismatch")
+
+// manifestRecord - ключ PAX записи в глобальном заголовке потока, в которой хранится манифест.
+const manifestRecord = "DISTBUILD.manifest"
+
+// Entry описывает один элемент директории в манифесте потока.
+type Entry struct {
+	Name string
+	Type byte
+
+	// SHA256 задаёт хеш содержимого для обычных файлов.
+	SHA256 string `json:",omitempty"`
+}
+
+// Options задаёт параметры сериализации.
+type Options struct {
+	Compression Compression
+
+	// Offset задаёт число элементов манифеста, которые получатель уже принял.
+	// Эти элементы не передаются повторно.
+	Offset int
+}
+
+type walkEntry struct {
+	Entry
+
+	path string
+	info os.FileInfo
+}
+
+func walk(dir string) ([]walkEntry, error) {
+	var entries []walkEntry
 
 	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
 		if err != nil {
@@ -25,76 +62,350 @@ func Send(dir string, w io.Writer) error {
 			return nil
 		}
 
+		e := walkEntry{Entry: Entry{Name: filepath.ToSlash(rel)}, path: path, info: info}
 		switch {
 		case info.IsDir():
-			return tw.WriteHeader(&tar.Header{
-				Name:     rel,
-				Typeflag: tar.TypeDir,
-			})
+			e.Type = tar.TypeDir
+
+		case info.Mode()&os.ModeSymlink != 0:
+			e.Type = tar.TypeSymlink
 
 		default:
-			h := &tar.Header{
-				Typeflag: tar.TypeReg,
-				Name:     rel,
-				Size:     info.Size(),
-				Mode:     int64(info.Mode()),
-			}
+			e.Type = tar.TypeReg
 
-			if err := tw.WriteHeader(h); err != nil {
+			if e.SHA256, err = fileHash(path); err != nil {
 				return err
 			}
+		}
 
-			f, err := os.Open(path)
-			if err != nil {
-				return err
-			}
-			defer f.Close()
+		entries = append(entries, e)
+		return nil
+	})
 
-			_, err = io.Copy(tw, f)
+	return entries, err
+}
+
+func fileHash(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// Send рекурсивно обходит директорию и сериализует её содержимое в поток w.
+func Send(dir string, w io.Writer) error {
+	return SendWithOptions(dir, w, Options{})
+}
+
+// SendWithOptions сериализует содержимое директории, сжимая поток и пропуская первые opts.Offset элементов.
+//
+// Поток начинается с манифеста, который содержит список всех элементов директории и хеши файлов.
+func SendWithOptions(dir string, w io.Writer, opts Options) error {
+	entries, err := walk(dir)
+	if err != nil {
+		return err
+	}
+
+	manifest := make([]Entry, len(entries))
+	for i := range entries {
+		manifest[i] = entries[i].Entry
+	}
+
+	manifestJSON, err := json.Marshal(manifest)
+	if err != nil {
+		return err
+	}
+
+	cw, err := compressWriter(w, opts.Compression)
+	if err != nil {
+		return err
+	}
+
+	tw := tar.NewWriter(cw)
+
+	err = tw.WriteHeader(&tar.Header{
+		Typeflag:   tar.TypeXGlobalHeader,
+		PAXRecords: map[string]string{manifestRecord: string(manifestJSON)},
+	})
+	if err != nil {
+		return err
+	}
+
+	for i := min(opts.Offset, len(entries)); i < len(entries); i++ {
+		if err := sendEntry(tw, &entries[i]); err != nil {
 			return err
 		}
-	})
+	}
 
-	if err != nil {
+	if err := tw.Close(); err != nil {
 		return err
 	}
+	return cw.Close()
+}
+
+func sendEntry(tw *tar.Writer, e *walkEntry) error {
+	h := &tar.Header{
+		Typeflag: e.Type,
+		Name:     e.Name,
+		Mode:     int64(e.info.Mode().Perm()),
+		ModTime:  e.info.ModTime(),
+		Format:   tar.FormatPAX,
+	}
+
+	switch e.Type {
+	case tar.TypeDir:
+		return tw.WriteHeader(h)
+
+	case tar.TypeSymlink:
+		target, err := os.Readlink(e.path)
+		if err != nil {
+			return err
+		}
+
+		h.Linkname = target
+		return tw.WriteHeader(h)
+
+	default:
+		f, err := os.Open(e.path)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
 
-	return tw.Close()
+		// Файл мог измениться после подсчёта хеша, поэтому размер берём из того же дескриптора.
+		st, err := f.Stat()
+		if err != nil {
+			return err
+		}
+
+		h.Size = st.Size()
+		if err := tw.WriteHeader(h); err != nil {
+			return err
+		}
+
+		_, err = io.Copy(tw, f)
+		return err
+	}
 }
 
 // Receive читает поток r и материализует содержимое потока внутри dir.
 func Receive(dir string, r io.Reader) error {
-	tr := tar.NewReader(r)
+	return NewReceiver(dir).Receive(r, CompressionNone)
+}
+
+// Receiver материализует содержимое директории, полученное за одну или несколько попыток.
+//
+// Если поток оборвался, следующая попытка должна запросить у отправителя поток с Options.Offset равным Offset().
+type Receiver struct {
+	dir string
+
+	manifest []Entry
+	received int
+
+	dirs []dirTime
+}
+
+type dirTime struct {
+	path    string
+	modTime time.Time
+}
+
+func NewReceiver(dir string) *Receiver {
+	return &Receiver{dir: dir}
+}
+
+// Offset возвращает число полностью принятых элементов.
+func (r *Receiver) Offset() int {
+	return r.received
+}
+
+// Receive принимает очередную часть потока.
+//
+// Если поток закончился раньше, чем были приняты все элементы манифеста, Receive возвращает io.ErrUnexpectedEOF.
+func (r *Receiver) Receive(stream io.Reader, compression Compression) error {
+	cr, err := decompressReader(stream, compression)
+	if err != nil {
+		return err
+	}
+	defer cr.Close()
+
+	tr := tar.NewReader(cr)
 
 	for {
 		h, err := tr.Next()
 		if err == io.EOF {
-			return nil
+			break
 		} else if err != nil {
 			return err
 		}
 
-		absPath := filepath.Join(dir, h.Name)
-
-		if h.Typeflag == tar.TypeDir {
-			if err := os.Mkdir(absPath, 0777); err != nil {
-				return err
-			}
-		} else {
-			writeFile := func() error {
-				f, err := os.OpenFile(absPath, os.O_CREATE|os.O_WRONLY, os.FileMode(h.Mode))
-				if err != nil {
-					return err
-				}
-				defer f.Close()
-
-				_, err = io.Copy(f, tr)
+		if h.Typeflag == tar.TypeXGlobalHeader {
+			if err := r.setManifest(h.PAXRecords[manifestRecord]); err != nil {
 				return err
 			}
+			continue
+		}
+
+		if err := r.receiveEntry(h, tr); err != nil {
+			return err
+		}
+	}
+
+	if r.manifest != nil && r.received != len(r.manifest) {
+		return io.ErrUnexpectedEOF
+	}
+
+	// Запись файлов меняет mtime директорий, поэтому его выставляем в самом конце, начиная с вложенных.
+	for i := len(r.dirs) - 1; i >= 0; i-- {
+		d := r.dirs[i]
+		if err := os.Chtimes(d.path, d.modTime, d.modTime); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r *Receiver) setManifest(value string) error {
+	var manifest []Entry
+	if err := json.Unmarshal([]byte(value), &manifest); err != nil {
+		return fmt.Errorf("tarstream: invalid manifest: %w", err)
+	}
+
+	if r.manifest == nil {
+		r.manifest = manifest
+		return nil
+	}
+
+	if len(manifest) != len(r.manifest) {
+		return fmt.Errorf("tarstream: manifest changed between attempts")
+	}
+	for i := range manifest {
+		if manifest[i] != r.manifest[i] {
+			return fmt.Errorf("tarstream: manifest changed between attempts")
+		}
+	}
+	return nil
+}
+
+func (r *Receiver) receiveEntry(h *tar.Header, tr io.Reader) error {
+	if !filepath.IsLocal(h.Name) {
+		return fmt.Errorf("tarstream: invalid path %q", h.Name)
+	}
+
+	var expected *Entry
+	if r.manifest != nil {
+		if r.received >= len(r.manifest) {
+			return fmt.Errorf("tarstream: unexpected entry %q", h.Name)
+		}
+
+		expected = &r.manifest[r.received]
+		if expected.Name != h.Name || expected.Type != h.Typeflag {
+			return fmt.Errorf("tarstream: entry %q does not match manifest", h.Name)
+		}
+	}
+
+	// Отправитель контролирует и манифест, и содержимое, поэтому запись через ранее созданный симлинк
+	// могла бы выйти за пределы r.dir.
+	if err := r.checkPath(h.Name, h.Typeflag); err != nil {
+		return err
+	}
 
-			if err := writeFile(); err != nil {
+	absPath := filepath.Join(r.dir, filepath.FromSlash(h.Name))
+
+	switch h.Typeflag {
+	case tar.TypeDir:
+		if err := os.MkdirAll(absPath, 0777); err != nil {
+			return err
+		}
+
+		if !h.ModTime.IsZero() {
+			r.dirs = append(r.dirs, dirTime{path: absPath, modTime: h.ModTime})
+		}
+
+	case tar.TypeSymlink:
+		target := filepath.FromSlash(h.Linkname)
+		if filepath.IsAbs(target) || !filepath.IsLocal(filepath.Join(filepath.Dir(filepath.FromSlash(h.Name)), target)) {
+			return fmt.Errorf("tarstream: symlink %q points outside of directory: %q", h.Name, h.Linkname)
+		}
+
+		if err := os.Remove(absPath); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+
+		if err := os.Symlink(h.Linkname, absPath); err != nil {
+			return err
+		}
+
+	default:
+		sum, err := writeFile(absPath, os.FileMode(h.Mode), tr)
+		if err != nil {
+			return err
+		}
+
+		if expected != nil && expected.SHA256 != sum {
+			return fmt.Errorf("%w: %s", ErrChecksum, h.Name)
+		}
+
+		if !h.ModTime.IsZero() {
+			if err := os.Chtimes(absPath, h.ModTime, h.ModTime); err != nil {
 				return err
 			}
 		}
 	}
+
+	r.received++
+	return nil
+}
+
+// checkPath проверяет, что ни один уже существующий компонент пути name не является симлинком.
+//
+// Последний компонент может быть симлинком, только если он заменяется новым симлинком.
+func (r *Receiver) checkPath(name string, typeflag byte) error {
+	parts := strings.Split(name, "/")
+
+	path := r.dir
+	for i, part := range parts {
+		path = filepath.Join(path, part)
+
+		st, err := os.Lstat(path)
+		if errors.Is(err, os.ErrNotExist) {
+			return nil
+		} else if err != nil {
+			return err
+		}
+
+		if st.Mode()&os.ModeSymlink == 0 {
+			continue
+		}
+
+		if i != len(parts)-1 || typeflag != tar.TypeSymlink {
+			return fmt.Errorf("tarstream: path %q goes through symlink", name)
+		}
+	}
+	return nil
+}
+
+func writeFile(path string, mode os.FileMode, r io.Reader) (string, error) {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, mode)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(f, io.TeeReader(r, h)); err != nil {
+		return "", err
+	}
+
+	if err := f.Close(); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
 }
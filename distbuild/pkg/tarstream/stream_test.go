@@ -1,10 +1,14 @@
 package tarstream_test
 
 import (
+	"archive/tar"
 	"bytes"
+	"errors"
+	"io"
 	"os"
 	"path/filepath"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/require"
 	"golang.org/x/sys/unix"
@@ -61,6 +65,143 @@ func TestTarStream(t *testing.T) {
 	checkFile(filepath.Join(to, "b", "c", "y.txt"), []byte("yyy"), 0644)
 }
 
+func prepareDir(t *testing.T) (from, to string) {
+	tmpDir := t.TempDir()
+
+	from = filepath.Join(tmpDir, "from")
+	to = filepath.Join(tmpDir, "to")
+
+	require.NoError(t, os.MkdirAll(filepath.Join(from, "pkg"), 0777))
+	require.NoError(t, os.Mkdir(to, 0777))
+
+	for _, name := range []string{"a.go", "b.go", "c.go"} {
+		require.NoError(t, os.WriteFile(filepath.Join(from, "pkg", name), bytes.Repeat([]byte(name), 1<<12), 0666))
+	}
+	require.NoError(t, os.Symlink("pkg/a.go", filepath.Join(from, "link")))
+
+	return
+}
+
+func TestTarStreamCompression(t *testing.T) {
+	for _, c := range []tarstream.Compression{tarstream.CompressionNone, tarstream.CompressionGzip, tarstream.CompressionZstd} {
+		t.Run(string(c), func(t *testing.T) {
+			from, to := prepareDir(t)
+
+			mtime := time.Date(2020, 1, 2, 3, 4, 5, 6, time.UTC)
+			require.NoError(t, os.Chtimes(filepath.Join(from, "pkg", "b.go"), mtime, mtime))
+			require.NoError(t, os.Chtimes(filepath.Join(from, "pkg"), mtime, mtime))
+
+			var buf bytes.Buffer
+			require.NoError(t, tarstream.SendWithOptions(from, &buf, tarstream.Options{Compression: c}))
+			require.NoError(t, tarstream.NewReceiver(to).Receive(&buf, c))
+
+			target, err := os.Readlink(filepath.Join(to, "link"))
+			require.NoError(t, err)
+			require.Equal(t, "pkg/a.go", target)
+
+			for _, path := range []string{filepath.Join("pkg", "b.go"), "pkg"} {
+				st, err := os.Stat(filepath.Join(to, path))
+				require.NoError(t, err)
+				require.True(t, mtime.Equal(st.ModTime()), "%s: %v", path, st.ModTime())
+			}
+		})
+	}
+}
+
+func TestTarStreamResume(t *testing.T) {
+	from, to := prepareDir(t)
+
+	var full bytes.Buffer
+	require.NoError(t, tarstream.SendWithOptions(from, &full, tarstream.Options{}))
+
+	r := tarstream.NewReceiver(to)
+
+	// Обрываем поток посередине pkg/b.go.
+	truncated := full.Bytes()[:full.Len()/2]
+	err := r.Receive(bytes.NewReader(truncated), tarstream.CompressionNone)
+	require.Truef(t, errors.Is(err, io.ErrUnexpectedEOF), "%v", err)
+	require.Equal(t, 3, r.Offset(), "link, pkg and pkg/a.go are received")
+
+	var rest bytes.Buffer
+	require.NoError(t, tarstream.SendWithOptions(from, &rest, tarstream.Options{Offset: r.Offset()}))
+	require.NoError(t, r.Receive(&rest, tarstream.CompressionNone))
+
+	for _, name := range []string{"a.go", "b.go", "c.go"} {
+		content, err := os.ReadFile(filepath.Join(to, "pkg", name))
+		require.NoError(t, err)
+		require.Equal(t, bytes.Repeat([]byte(name), 1<<12), content)
+	}
+}
+
+func TestTarStreamChecksum(t *testing.T) {
+	from, to := prepareDir(t)
+
+	var buf bytes.Buffer
+	require.NoError(t, tarstream.Send(from, &buf))
+
+	corrupted := bytes.Replace(buf.Bytes(), []byte("b.gob.go"), []byte("x.gox.go"), 1)
+	err := tarstream.Receive(to, bytes.NewReader(corrupted))
+	require.Truef(t, errors.Is(err, tarstream.ErrChecksum), "%v", err)
+}
+
 func init() {
 	unix.Umask(0022)
 }
+
+func writeStream(t *testing.T, headers ...*tar.Header) *bytes.Buffer {
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	for _, h := range headers {
+		require.NoError(t, tw.WriteHeader(h))
+		if h.Typeflag == tar.TypeReg {
+			_, err := tw.Write(make([]byte, h.Size))
+			require.NoError(t, err)
+		}
+	}
+	require.NoError(t, tw.Close())
+	return &buf
+}
+
+func TestTarStreamSymlinkEscape(t *testing.T) {
+	for _, tc := range []struct {
+		name    string
+		headers []*tar.Header
+	}{
+		{
+			name:    "AbsoluteTarget",
+			headers: []*tar.Header{{Typeflag: tar.TypeSymlink, Name: "out", Linkname: "/etc"}},
+		},
+		{
+			name:    "RelativeTarget",
+			headers: []*tar.Header{{Typeflag: tar.TypeSymlink, Name: "a/out", Linkname: "../../etc"}},
+		},
+		{
+			name: "WriteThroughSymlink",
+			headers: []*tar.Header{
+				{Typeflag: tar.TypeDir, Name: "a"},
+				{Typeflag: tar.TypeSymlink, Name: "out", Linkname: "a"},
+				{Typeflag: tar.TypeReg, Name: "out/passwd", Size: 1},
+			},
+		},
+		{
+			name: "OverwriteSymlink",
+			headers: []*tar.Header{
+				{Typeflag: tar.TypeReg, Name: "a", Size: 1},
+				{Typeflag: tar.TypeSymlink, Name: "out", Linkname: "a"},
+				{Typeflag: tar.TypeReg, Name: "out", Size: 1},
+			},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			dir := t.TempDir()
+			to := filepath.Join(dir, "to")
+			require.NoError(t, os.Mkdir(to, 0777))
+
+			require.Error(t, tarstream.Receive(to, writeStream(t, tc.headers...)))
+
+			entries, err := os.ReadDir(dir)
+			require.NoError(t, err)
+			require.Len(t, entries, 1)
+		})
+	}
+}
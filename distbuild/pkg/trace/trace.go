@@ -0,0 +1,163 @@
+// Package trace записывает трейсы сборок в формате, похожем на OpenTelemetry.
+//
+// Трейс хранится в памяти и целиком сохраняется в JSON файл, когда сборка закончена.
+package trace
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// StatusOK и StatusError задают значения поля Span.Status.
+const (
+	StatusOK    = "ok"
+	StatusError = "error"
+)
+
+// Span описывает один интервал трейса.
+type Span struct {
+	TraceID      string `json:"traceId"`
+	SpanID       string `json:"spanId"`
+	ParentSpanID string `json:"parentSpanId,omitempty"`
+
+	Name              string `json:"name"`
+	StartTimeUnixNano int64  `json:"startTimeUnixNano"`
+	EndTimeUnixNano   int64  `json:"endTimeUnixNano"`
+
+	Attributes map[string]string `json:"attributes,omitempty"`
+
+	Status        string `json:"status,omitempty"`
+	StatusMessage string `json:"statusMessage,omitempty"`
+}
+
+// Trace собирает интервалы одной сборки.
+type Trace struct {
+	id   string
+	root *ActiveSpan
+
+	mu    sync.Mutex
+	spans []Span
+}
+
+// ActiveSpan - незаконченный интервал трейса.
+type ActiveSpan struct {
+	t     *Trace
+	span  Span
+	ended bool
+}
+
+// New создаёт трейс с корневым интервалом name.
+func New(name string, attrs map[string]string) *Trace {
+	t := &Trace{id: randomID(16)}
+	t.root = t.start(name, "", attrs)
+	return t
+}
+
+// ID возвращает идентификатор трейса.
+func (t *Trace) ID() string {
+	return t.id
+}
+
+// Root возвращает корневой интервал трейса.
+func (t *Trace) Root() *ActiveSpan {
+	return t.root
+}
+
+// Start начинает интервал, вложенный в корневой.
+func (t *Trace) Start(name string, attrs map[string]string) *ActiveSpan {
+	return t.start(name, t.root.span.SpanID, attrs)
+}
+
+func (t *Trace) start(name, parent string, attrs map[string]string) *ActiveSpan {
+	if attrs == nil {
+		attrs = map[string]string{}
+	}
+
+	return &ActiveSpan{
+		t: t,
+		span: Span{
+			TraceID:           t.id,
+			SpanID:            randomID(8),
+			ParentSpanID:      parent,
+			Name:              name,
+			StartTimeUnixNano: time.Now().UnixNano(),
+			Attributes:        attrs,
+		},
+	}
+}
+
+// Spans возвращает законченные интервалы в порядке завершения.
+func (t *Trace) Spans() []Span {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	return append([]Span(nil), t.spans...)
+}
+
+type traceFile struct {
+	TraceID string `json:"traceId"`
+	Spans   []Span `json:"spans"`
+}
+
+// WriteFile сохраняет законченные интервалы трейса в файл path.
+func (t *Trace) WriteFile(path string) error {
+	content, err := json.MarshalIndent(traceFile{TraceID: t.id, Spans: t.Spans()}, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0777); err != nil {
+		return err
+	}
+
+	// Trace is written atomically, so that readers never see partially written file.
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, content, 0666); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// SetAttribute добавляет атрибут к интервалу. Атрибуты законченного интервала не меняются.
+func (s *ActiveSpan) SetAttribute(key, value string) {
+	s.t.mu.Lock()
+	defer s.t.mu.Unlock()
+
+	if !s.ended {
+		s.span.Attributes[key] = value
+	}
+}
+
+// End заканчивает интервал. Если err не nil, интервал помечается ошибкой.
+//
+// Повторные вызовы End ничего не делают.
+func (s *ActiveSpan) End(err error) {
+	s.t.mu.Lock()
+	defer s.t.mu.Unlock()
+
+	if s.ended {
+		return
+	}
+	s.ended = true
+
+	s.span.EndTimeUnixNano = time.Now().UnixNano()
+	if err != nil {
+		s.span.Status = StatusError
+		s.span.StatusMessage = err.Error()
+	} else {
+		s.span.Status = StatusOK
+	}
+
+	s.t.spans = append(s.t.spans, s.span)
+}
+
+func randomID(size int) string {
+	b := make([]byte, size)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
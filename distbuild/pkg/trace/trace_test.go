@@ -0,0 +1,59 @@
+package trace
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestTrace(t *testing.T) {
+	tr := New("build", map[string]string{"build_id": "1"})
+
+	job := tr.Start("job a", nil)
+	job.SetAttribute("exit_code", "1")
+	job.End(errors.New("exit code 1"))
+	job.End(nil)
+	job.SetAttribute("exit_code", "2")
+
+	tr.Root().End(nil)
+
+	spans := tr.Spans()
+	require.Len(t, spans, 2)
+
+	require.Equal(t, "job a", spans[0].Name)
+	require.Equal(t, tr.ID(), spans[0].TraceID)
+	require.Equal(t, spans[1].SpanID, spans[0].ParentSpanID)
+	require.Equal(t, StatusError, spans[0].Status)
+	require.Equal(t, "exit code 1", spans[0].StatusMessage)
+	require.Equal(t, map[string]string{"exit_code": "1"}, spans[0].Attributes)
+
+	require.Equal(t, "build", spans[1].Name)
+	require.Empty(t, spans[1].ParentSpanID)
+	require.Equal(t, StatusOK, spans[1].Status)
+	require.LessOrEqual(t, spans[1].StartTimeUnixNano, spans[0].StartTimeUnixNano)
+	require.GreaterOrEqual(t, spans[1].EndTimeUnixNano, spans[0].EndTimeUnixNano)
+}
+
+func TestWriteFile(t *testing.T) {
+	tr := New("build", map[string]string{"build_id": "1"})
+	tr.Start("upload", map[string]string{"files": "2"}).End(nil)
+	tr.Root().End(nil)
+
+	path := filepath.Join(t.TempDir(), "traces", "build.json")
+	require.NoError(t, tr.WriteFile(path))
+
+	content, err := os.ReadFile(path)
+	require.NoError(t, err)
+
+	var file struct {
+		TraceID string `json:"traceId"`
+		Spans   []Span `json:"spans"`
+	}
+	require.NoError(t, json.Unmarshal(content, &file))
+	require.Equal(t, tr.ID(), file.TraceID)
+	require.Equal(t, tr.Spans(), file.Spans)
+}
@@ -0,0 +1,387 @@
+//go:build !solution
+
+package worker
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+
+	"gitlab.com/slon/shad-go/distbuild/pkg/api"
+	"gitlab.com/slon/shad-go/distbuild/pkg/artifact"
+	"gitlab.com/slon/shad-go/distbuild/pkg/build"
+	"gitlab.com/slon/shad-go/distbuild/pkg/filecache"
+)
+
+// Layout of the artifact directory.
+const (
+	outputDirName = "output"
+	sourceDirName = "src"
+	tmpDirName    = "tmp"
+	homeDirName   = "home"
+	stdoutName    = "stdout"
+	stderrName    = "stderr"
+)
+
+// waitDelay limits how long worker waits for command output after the process is killed.
+const waitDelay = time.Second
+
+// runJob executes the job or takes its result from the artifact cache.
+//
+// runJob returns nil if ctx was canceled while the job was running.
+func (w *Worker) runJob(ctx context.Context, spec *api.JobSpec, job *runningJob) *api.JobResult {
+	l := w.log.With(zap.Stringer("job_id", spec.ID), zap.String("name", spec.Name))
+
+	res, err := w.cachedResult(spec.ID)
+	if err == nil {
+		l.Debug("job result found in cache")
+		w.metrics.cachedResults.Inc()
+		return res
+	} else if !errors.Is(err, artifact.ErrNotFound) {
+		return failedResult(spec.ID, err)
+	}
+
+	l.Debug("running job")
+	start := time.Now()
+	res, err = w.execute(ctx, spec, job)
+	if ctx.Err() != nil {
+		l.Debug("job stopped", zap.Error(ctx.Err()))
+		w.metrics.jobDuration.WithLabelValues("cancelled").Observe(time.Since(start).Seconds())
+		return nil
+	}
+
+	if err != nil {
+		l.Error("job failed", zap.Error(err))
+		w.metrics.jobDuration.WithLabelValues("failed").Observe(time.Since(start).Seconds())
+		return failedResult(spec.ID, err)
+	}
+
+	status := "ok"
+	if res.Error != nil || res.ExitCode != 0 {
+		status = "failed"
+	}
+	w.metrics.jobDuration.WithLabelValues(status).Observe(time.Since(start).Seconds())
+
+	l.Debug("job finished", zap.Int("exit_code", res.ExitCode))
+	return res
+}
+
+// failedResult reports error of the worker itself. Such job may succeed on another worker.
+func failedResult(id build.ID, err error) *api.JobResult {
+	errorString := err.Error()
+	return &api.JobResult{ID: id, Error: &errorString, Transient: true}
+}
+
+// JobResult returns result of the job, if its artifact is present in the cache.
+func (w *Worker) JobResult(ctx context.Context, jobID build.ID) (*api.JobResult, error) {
+	return w.cachedResult(jobID)
+}
+
+func (w *Worker) cachedResult(id build.ID) (*api.JobResult, error) {
+	path, unlock, err := w.artifacts.Get(id)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	res := &api.JobResult{ID: id}
+	if res.Stdout, err = os.ReadFile(filepath.Join(path, stdoutName)); err != nil {
+		return nil, err
+	}
+	if res.Stderr, err = os.ReadFile(filepath.Join(path, stderrName)); err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+func (w *Worker) execute(ctx context.Context, spec *api.JobSpec, job *runningJob) (*api.JobResult, error) {
+	path, commit, abort, err := w.artifacts.Create(spec.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	committed := false
+	defer func() {
+		if !committed {
+			_ = abort()
+		}
+	}()
+
+	jobCtx := build.JobContext{
+		SourceDir: filepath.Join(path, sourceDirName),
+		OutputDir: filepath.Join(path, outputDirName),
+		Deps:      make(map[build.ID]string, len(spec.Deps)),
+	}
+
+	if err := os.Mkdir(jobCtx.OutputDir, 0777); err != nil {
+		return nil, err
+	}
+
+	// Every job gets private temporary and home directories, removed together with the sources.
+	tmpDir, homeDir := filepath.Join(path, tmpDirName), filepath.Join(path, homeDirName)
+	for _, dir := range []string{tmpDir, homeDir} {
+		if err := os.Mkdir(dir, 0777); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := w.prepareSources(ctx, jobCtx.SourceDir, spec.SourceFiles); err != nil {
+		return nil, fmt.Errorf("prepare source files: %w", err)
+	}
+
+	for _, dep := range spec.Deps {
+		depPath, unlock, err := w.fetchArtifact(ctx, dep, spec.Artifacts[dep])
+		if err != nil {
+			return nil, fmt.Errorf("fetch artifact %s: %w", dep, err)
+		}
+		defer unlock()
+
+		jobCtx.Deps[dep] = filepath.Join(depPath, outputDirName)
+	}
+
+	readOnly := []string{jobCtx.SourceDir}
+	for _, dep := range spec.Deps {
+		readOnly = append(readOnly, filepath.Dir(jobCtx.Deps[dep]))
+	}
+
+	sb, err := newSandbox(path, readOnly)
+	if err != nil {
+		return nil, err
+	}
+
+	limits, err := newJobLimits(w.limits)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = limits.close() }()
+
+	cmdCtx := ctx
+	if w.limits.WallTime > 0 {
+		var cancel context.CancelFunc
+		cmdCtx, cancel = context.WithTimeout(ctx, w.limits.WallTime)
+		defer cancel()
+	}
+
+	res := &api.JobResult{ID: spec.ID}
+
+	for _, cmd := range spec.Cmds {
+		rendered, err := cmd.Render(jobCtx)
+		if err != nil {
+			return nil, err
+		}
+
+		if rendered.WorkingDirectory == "" {
+			rendered.WorkingDirectory = jobCtx.SourceDir
+		}
+
+		rendered.Environ = jobEnviron(rendered.Environ, tmpDir, homeDir)
+
+		exitCode, err := runCmd(cmdCtx, limits, rendered, job.stdout, job.stderr)
+		if errors.Is(cmdCtx.Err(), context.DeadlineExceeded) && ctx.Err() == nil {
+			err = &violationError{reason: "wall clock limit exceeded"}
+		}
+
+		var violation *violationError
+		if errors.As(err, &violation) {
+			res.Error = &violation.reason
+			break
+		} else if err != nil {
+			return nil, err
+		}
+
+		if exitCode != 0 {
+			res.ExitCode = exitCode
+			break
+		}
+	}
+
+	if res.Error == nil && res.ExitCode == 0 {
+		var violation *violationError
+		if err := sb.check(); errors.As(err, &violation) {
+			res.Error = &violation.reason
+		} else if err != nil {
+			return nil, err
+		}
+	}
+
+	res.Stdout = job.stdout.Bytes()
+	res.Stderr = job.stderr.Bytes()
+
+	if res.Error != nil || res.ExitCode != 0 || ctx.Err() != nil {
+		return res, nil
+	}
+
+	if err := os.WriteFile(filepath.Join(path, stdoutName), res.Stdout, 0666); err != nil {
+		return nil, err
+	}
+	if err := os.WriteFile(filepath.Join(path, stderrName), res.Stderr, 0666); err != nil {
+		return nil, err
+	}
+	for _, dir := range []string{jobCtx.SourceDir, tmpDir, homeDir} {
+		if err := os.RemoveAll(dir); err != nil {
+			return nil, err
+		}
+	}
+
+	committed = true
+	if err := commit(); err != nil {
+		return nil, err
+	}
+
+	w.mu.Lock()
+	w.added = append(w.added, spec.ID)
+	w.mu.Unlock()
+
+	return res, nil
+}
+
+// prepareSources copies source files from the file cache into the source directory of the job.
+func (w *Worker) prepareSources(ctx context.Context, sourceDir string, files map[build.ID]string) error {
+	if err := os.Mkdir(sourceDir, 0777); err != nil {
+		return err
+	}
+
+	for id, relPath := range files {
+		path, unlock, err := w.fileCache.Get(id)
+		if errors.Is(err, filecache.ErrNotFound) {
+			if err = w.files.Download(ctx, w.fileCache, id); err != nil {
+				return err
+			}
+			path, unlock, err = w.fileCache.Get(id)
+		}
+		if err != nil {
+			return err
+		}
+
+		err = copyFile(path, filepath.Join(sourceDir, relPath))
+		unlock()
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func copyFile(from, to string) error {
+	if err := os.MkdirAll(filepath.Dir(to), 0777); err != nil {
+		return err
+	}
+
+	src, err := os.Open(from)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	dst, err := os.OpenFile(to, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0666)
+	if err != nil {
+		return err
+	}
+
+	if _, err := io.Copy(dst, src); err != nil {
+		_ = dst.Close()
+		return err
+	}
+	return dst.Close()
+}
+
+// fetchArtifact locks artifact in the local cache, downloading it from another worker if needed.
+func (w *Worker) fetchArtifact(ctx context.Context, id build.ID, from api.WorkerID) (string, func(), error) {
+	path, unlock, err := w.artifacts.Get(id)
+	if !errors.Is(err, artifact.ErrNotFound) {
+		return path, unlock, err
+	}
+
+	if from == "" {
+		return "", nil, fmt.Errorf("artifact location is unknown")
+	}
+
+	w.log.Debug("downloading artifact", zap.Stringer("id", id), zap.Stringer("from", from))
+	if err := artifact.Download(ctx, from.String(), w.artifacts, id); err != nil {
+		return "", nil, err
+	}
+
+	w.mu.Lock()
+	w.added = append(w.added, id)
+	w.mu.Unlock()
+
+	return w.artifacts.Get(id)
+}
+
+// jobEnviron sets TMPDIR and HOME of the job, unless the command sets them itself.
+func jobEnviron(environ []string, tmpDir, homeDir string) []string {
+	env := append([]string{}, environ...)
+	for _, v := range []string{"TMPDIR=" + tmpDir, "HOME=" + homeDir} {
+		name, _, _ := strings.Cut(v, "=")
+		if !slices.ContainsFunc(environ, func(e string) bool { return strings.HasPrefix(e, name+"=") }) {
+			env = append(env, v)
+		}
+	}
+	return env
+}
+
+// runCmd executes single command of the job.
+//
+// Non-zero exit code of the process is not an error. Process killed for exceeding the limits
+// fails with *violationError.
+func runCmd(ctx context.Context, limits *jobLimits, cmd *build.Cmd, stdout, stderr io.Writer) (int, error) {
+	if cmd.CatOutput != "" {
+		return 0, os.WriteFile(cmd.CatOutput, []byte(cmd.CatTemplate), 0666)
+	}
+
+	if len(cmd.Exec) == 0 {
+		return 0, nil
+	}
+
+	c := exec.CommandContext(ctx, cmd.Exec[0], cmd.Exec[1:]...)
+	// Environment of the worker must not leak into the job.
+	c.Env = append([]string{}, cmd.Environ...)
+	c.Dir = cmd.WorkingDirectory
+	c.Stdout = stdout
+	c.Stderr = stderr
+	c.WaitDelay = waitDelay
+	setProcessGroup(c)
+
+	release, err := limits.prepare(c)
+	if err != nil {
+		return 0, err
+	}
+
+	err = c.Start()
+	if releaseErr := release(); err == nil {
+		err = releaseErr
+	}
+	if err != nil {
+		if c.Process != nil {
+			_ = c.Cancel()
+			_ = c.Wait()
+		}
+		return 0, err
+	}
+
+	stop := limits.watch(c.Process.Pid)
+	err = c.Wait()
+	stop()
+
+	if c.ProcessState != nil {
+		if reason := limits.finish(c.ProcessState); reason != "" {
+			return 0, &violationError{reason: reason}
+		}
+	}
+
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		return exitErr.ExitCode(), nil
+	}
+	return 0, err
+}
@@ -0,0 +1,340 @@
+//go:build !solution && linux
+
+package worker
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+const (
+	// sandboxExecArg is the first argument of the worker binary started as the exec helper.
+	sandboxExecArg = "-distbuild-sandbox-exec"
+
+	// monitorInterval is the period of checking resources used by the job.
+	monitorInterval = 20 * time.Millisecond
+
+	// clockTicks is the unit of CPU times in /proc, which is fixed by the kernel ABI.
+	clockTicks = 100
+)
+
+// sandboxExecEnabled is set by MaybeRunSandboxExec. Commands are started through the exec helper
+// only if the binary of the worker is able to run it.
+var sandboxExecEnabled atomic.Bool
+
+// MaybeRunSandboxExec must be called first in main of the binary that runs worker.
+//
+// If the process was started as the exec helper of the worker, MaybeRunSandboxExec sets rlimits
+// and replaces the process with the command of the job, so it never returns. Otherwise it enables
+// starting job commands through the helper and returns. Without the call commands run
+// without RLIMIT_CPU and only monitoring of the process group limits their CPU time.
+func MaybeRunSandboxExec() {
+	if len(os.Args) > 3 && os.Args[1] == sandboxExecArg {
+		sandboxExec(os.Args[2], os.Args[3], os.Args[4:])
+	}
+
+	sandboxExecEnabled.Store(true)
+}
+
+// sandboxExec runs inside the child process of the worker. It sets rlimits of the process and
+// replaces itself with the command of the job, so the command never runs without limits.
+func sandboxExec(cpuSeconds, path string, argv []string) {
+	seconds, err := strconv.ParseUint(cpuSeconds, 10, 64)
+	if err == nil {
+		// Process receives SIGXCPU at the soft limit and SIGKILL at the hard limit.
+		err = unix.Setrlimit(unix.RLIMIT_CPU, &unix.Rlimit{Cur: seconds, Max: seconds + 1})
+	}
+	if err == nil {
+		err = syscall.Exec(path, argv, os.Environ())
+	}
+
+	fmt.Fprintf(os.Stderr, "distbuild: exec %s: %v\n", path, err)
+	os.Exit(127)
+}
+
+// jobLimits enforces Limits on all processes of a single job.
+//
+// If Limits.Cgroup is set, the job runs in its own cgroup: memory.max limits memory, and CPU time
+// is taken from cpu.stat. Otherwise processes of the job are found by their process group in /proc,
+// and every process gets RLIMIT_CPU before exec, in case it leaves the group.
+type jobLimits struct {
+	limits Limits
+	cgroup string
+
+	// used is CPU time of the finished commands of the job, when cgroup is not used.
+	used time.Duration
+
+	mu        sync.Mutex
+	violation string
+}
+
+func newJobLimits(limits Limits) (*jobLimits, error) {
+	j := &jobLimits{limits: limits}
+	if limits.Cgroup == "" || limits.CPUTime <= 0 && limits.Memory <= 0 {
+		return j, nil
+	}
+
+	var err error
+	if j.cgroup, err = os.MkdirTemp(limits.Cgroup, "job-"); err != nil {
+		return nil, fmt.Errorf("create job cgroup: %w", err)
+	}
+
+	if limits.Memory > 0 {
+		if err := j.writeCgroup("memory.max", strconv.FormatInt(limits.Memory, 10)); err != nil {
+			_ = j.close()
+			return nil, err
+		}
+		// Swap is not available to the job, so memory.max limits all of its memory.
+		_ = j.writeCgroup("memory.swap.max", "0")
+	}
+
+	return j, nil
+}
+
+func (j *jobLimits) writeCgroup(file, value string) error {
+	return os.WriteFile(filepath.Join(j.cgroup, file), []byte(value), 0644)
+}
+
+// prepare sets up the command before it is started.
+//
+// Returned function releases resources of prepare and must be called after the command is started.
+func (j *jobLimits) prepare(c *exec.Cmd) (func() error, error) {
+	if j.cgroup != "" {
+		fd, err := unix.Open(j.cgroup, unix.O_PATH|unix.O_DIRECTORY|unix.O_CLOEXEC, 0)
+		if err != nil {
+			return nil, fmt.Errorf("open job cgroup: %w", err)
+		}
+
+		c.SysProcAttr.UseCgroupFD = true
+		c.SysProcAttr.CgroupFD = fd
+		return func() error { return unix.Close(fd) }, nil
+	}
+
+	if j.limits.CPUTime > 0 && c.Err == nil && sandboxExecEnabled.Load() {
+		self, err := os.Executable()
+		if err != nil {
+			return nil, err
+		}
+
+		left := max(j.limits.CPUTime-j.used, 0)
+		seconds := int64((left + time.Second - 1) / time.Second)
+		c.Args = append([]string{self, sandboxExecArg, strconv.FormatInt(max(seconds, 1), 10), c.Path}, c.Args...)
+		c.Path = self
+	}
+	return func() error { return nil }, nil
+}
+
+// watch checks resources used by the job until the returned function is called.
+// Job that exceeds the limits is killed.
+func (j *jobLimits) watch(pid int) func() {
+	if j.limits.CPUTime <= 0 && (j.limits.Memory <= 0 || j.cgroup != "") {
+		return func() {}
+	}
+
+	done := make(chan struct{})
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+
+		ticker := time.NewTicker(monitorInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+			case <-done:
+				return
+			}
+
+			if reason := j.check(pid); reason != "" {
+				j.setViolation(reason)
+				j.kill(pid)
+				return
+			}
+		}
+	}()
+
+	return func() {
+		close(done)
+		<-stopped
+	}
+}
+
+func (j *jobLimits) check(pid int) string {
+	var cpu time.Duration
+	var rss int64
+	if j.cgroup != "" {
+		cpu = j.cgroupCPU()
+	} else {
+		cpu, rss = groupUsage(pid)
+		cpu += j.used
+	}
+
+	switch {
+	case j.limits.CPUTime > 0 && cpu >= j.limits.CPUTime:
+		return "cpu time limit exceeded"
+	case j.limits.Memory > 0 && rss > j.limits.Memory:
+		return "memory limit exceeded"
+	default:
+		return ""
+	}
+}
+
+func (j *jobLimits) kill(pid int) {
+	if j.cgroup != "" {
+		if err := j.writeCgroup("cgroup.kill", "1"); err == nil {
+			return
+		}
+	}
+	_ = syscall.Kill(-pid, syscall.SIGKILL)
+}
+
+func (j *jobLimits) setViolation(reason string) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	if j.violation == "" {
+		j.violation = reason
+	}
+}
+
+// finish is called after the command exited. It explains why the process was killed.
+func (j *jobLimits) finish(state *os.ProcessState) string {
+	j.mu.Lock()
+	violation := j.violation
+	j.mu.Unlock()
+
+	if violation != "" {
+		return violation
+	}
+
+	if j.cgroup != "" {
+		if j.limits.Memory > 0 && j.cgroupEvent("memory.events", "oom_kill") > 0 {
+			return "memory limit exceeded"
+		}
+		if j.limits.CPUTime > 0 && j.cgroupCPU() >= j.limits.CPUTime {
+			return "cpu time limit exceeded"
+		}
+		return ""
+	}
+
+	j.used += state.UserTime() + state.SystemTime()
+
+	status, ok := state.Sys().(syscall.WaitStatus)
+	if !ok || !status.Signaled() || j.limits.CPUTime <= 0 {
+		return ""
+	}
+
+	switch status.Signal() {
+	case syscall.SIGXCPU:
+		return "cpu time limit exceeded"
+	case syscall.SIGKILL:
+		if j.used >= j.limits.CPUTime {
+			return "cpu time limit exceeded"
+		}
+	}
+	return ""
+}
+
+// close kills processes left in the cgroup of the job and removes it.
+func (j *jobLimits) close() error {
+	if j.cgroup == "" {
+		return nil
+	}
+
+	_ = j.writeCgroup("cgroup.kill", "1")
+
+	// Cgroup can't be removed until killed processes exit.
+	var err error
+	for range 50 {
+		if err = os.Remove(j.cgroup); err == nil || !errors.Is(err, unix.EBUSY) {
+			break
+		}
+		time.Sleep(monitorInterval)
+	}
+	return err
+}
+
+func (j *jobLimits) cgroupCPU() time.Duration {
+	return time.Duration(j.cgroupEvent("cpu.stat", "usage_usec")) * time.Microsecond
+}
+
+// cgroupEvent reads value of the key from the flat keyed file of the cgroup.
+func (j *jobLimits) cgroupEvent(file, key string) int64 {
+	content, err := os.ReadFile(filepath.Join(j.cgroup, file))
+	if err != nil {
+		return 0
+	}
+
+	scanner := bufio.NewScanner(bytes.NewReader(content))
+	for scanner.Scan() {
+		name, value, _ := strings.Cut(scanner.Text(), " ")
+		if name == key {
+			n, _ := strconv.ParseInt(value, 10, 64)
+			return n
+		}
+	}
+	return 0
+}
+
+// groupUsage sums CPU time and resident memory of the processes in the process group.
+//
+// CPU time of the exited processes is included, once they are waited for by their parents.
+func groupUsage(pgid int) (time.Duration, int64) {
+	entries, err := os.ReadDir("/proc")
+	if err != nil {
+		return 0, 0
+	}
+
+	pageSize := int64(os.Getpagesize())
+
+	var ticks, rss int64
+	for _, e := range entries {
+		if _, err := strconv.Atoi(e.Name()); err != nil {
+			continue
+		}
+
+		stat, err := os.ReadFile(filepath.Join("/proc", e.Name(), "stat"))
+		if err != nil {
+			continue
+		}
+
+		// Command name may contain spaces, so fields are counted after its closing parenthesis.
+		end := bytes.LastIndexByte(stat, ')')
+		if end < 0 {
+			continue
+		}
+		fields := strings.Fields(string(stat[end+1:]))
+		if len(fields) < 22 {
+			continue
+		}
+
+		// Fields are numbered as in proc(5), starting from state, which is the 3rd field.
+		field := func(n int) int64 {
+			v, _ := strconv.ParseInt(fields[n-3], 10, 64)
+			return v
+		}
+
+		if field(5) != int64(pgid) {
+			continue
+		}
+
+		ticks += field(14) + field(15) + field(16) + field(17)
+		rss += field(24) * pageSize
+	}
+
+	return time.Duration(ticks) * time.Second / clockTicks, rss
+}
@@ -0,0 +1,26 @@
+//go:build !solution && !linux
+
+package worker
+
+import (
+	"os"
+	"os/exec"
+)
+
+// MaybeRunSandboxExec is a no-op outside of linux.
+func MaybeRunSandboxExec() {}
+
+// jobLimits is a no-op outside of linux. Only the wall clock limit is enforced.
+type jobLimits struct{}
+
+func newJobLimits(limits Limits) (*jobLimits, error) { return &jobLimits{}, nil }
+
+func (j *jobLimits) prepare(c *exec.Cmd) (func() error, error) {
+	return func() error { return nil }, nil
+}
+
+func (j *jobLimits) watch(pid int) func() { return func() {} }
+
+func (j *jobLimits) finish(state *os.ProcessState) string { return "" }
+
+func (j *jobLimits) close() error { return nil }
@@ -0,0 +1,81 @@
+//go:build !solution
+
+package worker
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+)
+
+type workerMetrics struct {
+	registry *prometheus.Registry
+
+	jobDuration       *prometheus.HistogramVec
+	cachedResults     prometheus.Counter
+	heartbeatDuration prometheus.Histogram
+}
+
+func newWorkerMetrics(w *Worker) *workerMetrics {
+	m := &workerMetrics{
+		registry: prometheus.NewRegistry(),
+
+		jobDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: "distbuild",
+			Name:      "worker_job_duration_seconds",
+			Help:      "Time spent executing the job, including download of sources and artifacts.",
+			Buckets:   prometheus.ExponentialBuckets(0.01, 2, 16),
+		}, []string{"status"}),
+
+		cachedResults: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: "distbuild",
+			Name:      "worker_cached_results_total",
+			Help:      "Jobs which result was taken from the artifact cache.",
+		}),
+
+		heartbeatDuration: prometheus.NewHistogram(prometheus.HistogramOpts{
+			Namespace: "distbuild",
+			Name:      "worker_heartbeat_duration_seconds",
+			Help:      "Round trip time of the heartbeats sent to the coordinator.",
+			Buckets:   prometheus.ExponentialBuckets(0.001, 2, 12),
+		}),
+	}
+
+	m.registry.MustRegister(
+		collectors.NewGoCollector(),
+		m.jobDuration,
+		m.cachedResults,
+		m.heartbeatDuration,
+
+		prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+			Namespace: "distbuild",
+			Name:      "worker_slots",
+			Help:      "Number of jobs the worker runs at the same time.",
+		}, func() float64 {
+			w.mu.Lock()
+			defer w.mu.Unlock()
+
+			return float64(w.slots)
+		}),
+
+		prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+			Namespace: "distbuild",
+			Name:      "worker_running_jobs",
+			Help:      "Jobs running on the worker.",
+		}, func() float64 {
+			w.mu.Lock()
+			defer w.mu.Unlock()
+
+			return float64(len(w.running))
+		}),
+
+		prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+			Namespace: "distbuild",
+			Name:      "worker_artifact_cache_bytes",
+			Help:      "Size of the artifact cache.",
+		}, func() float64 {
+			return float64(w.artifacts.Size())
+		}),
+	)
+
+	return m
+}
@@ -0,0 +1,74 @@
+//go:build !solution
+
+package worker
+
+import (
+	"sync"
+)
+
+// defaultOutputLimit is the size limit of stdout and stderr of the job, when Limits.Output is not set.
+const defaultOutputLimit = 16 << 20
+
+const truncatedMarker = "\n[output truncated]\n"
+
+// outputBuffer captures output of the job and remembers which part of it was already streamed to the coordinator.
+//
+// Output above the limit is dropped, and marker is appended instead. Writes never fail, so that
+// the job is not killed because of its output.
+type outputBuffer struct {
+	limit int
+
+	mu        sync.Mutex
+	buf       []byte
+	sent      int
+	truncated bool
+}
+
+func newOutputBuffer(limit int) *outputBuffer {
+	return &outputBuffer{limit: limit}
+}
+
+func (b *outputBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.truncated {
+		return len(p), nil
+	}
+
+	if room := b.limit - len(b.buf); len(p) > room {
+		b.buf = append(b.buf, p[:room]...)
+		b.buf = append(b.buf, truncatedMarker...)
+		b.truncated = true
+		return len(p), nil
+	}
+
+	b.buf = append(b.buf, p...)
+	return len(p), nil
+}
+
+// Bytes returns the whole captured output.
+func (b *outputBuffer) Bytes() []byte {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return append([]byte(nil), b.buf...)
+}
+
+// next returns output that was not streamed yet, together with its offset.
+func (b *outputBuffer) next() (int, []byte) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	offset := b.sent
+	b.sent = len(b.buf)
+	return offset, append([]byte(nil), b.buf[offset:]...)
+}
+
+// rewind marks output starting at offset as not streamed, after the heartbeat carrying it failed.
+func (b *outputBuffer) rewind(offset int) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.sent = min(b.sent, offset)
+}
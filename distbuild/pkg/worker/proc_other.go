@@ -0,0 +1,7 @@
+//go:build !solution && !unix
+
+package worker
+
+import "os/exec"
+
+func setProcessGroup(c *exec.Cmd) {}
@@ -0,0 +1,153 @@
+//go:build !solution
+
+package worker
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// Limits describes resources available to a single job. Zero value of the field means no limit,
+// unless stated otherwise.
+type Limits struct {
+	// CPUTime limits total CPU time of all processes started by the job.
+	CPUTime time.Duration
+
+	// Memory limits total resident memory of all processes started by the job, in bytes.
+	Memory int64
+
+	// Cgroup is the cgroup v2 directory delegated to the worker, with cpu and memory controllers
+	// enabled for its children. If set, every job runs in its own child cgroup, so that the limits
+	// also apply to the processes that left the process group of the job.
+	Cgroup string
+
+	// WallTime limits duration of the whole job.
+	WallTime time.Duration
+
+	// Output limits size of stdout and stderr of the job, each, in bytes. Output above the limit
+	// is dropped. Zero value means defaultOutputLimit.
+	Output int
+}
+
+// violationError is returned when job breaks the sandbox rules.
+//
+// Such job fails, but its output is still reported to the client.
+type violationError struct {
+	reason string
+}
+
+func (e *violationError) Error() string {
+	return e.reason
+}
+
+// fileState is the part of the file metadata that changes on every write.
+type fileState struct {
+	mode    fs.FileMode
+	size    int64
+	modTime time.Time
+}
+
+type snapshot map[string]fileState
+
+// takeSnapshot records state of every file inside root. If recursive is false, only direct
+// children of root are recorded, and their modification time is ignored.
+func takeSnapshot(root string, recursive bool) (snapshot, error) {
+	s := snapshot{}
+
+	if !recursive {
+		entries, err := os.ReadDir(root)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, e := range entries {
+			s[e.Name()] = fileState{mode: e.Type()}
+		}
+		return s, nil
+	}
+
+	err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+
+		rel, err := filepath.Rel(root, path)
+		if err != nil {
+			return err
+		}
+
+		s[rel] = fileState{mode: info.Mode(), size: info.Size(), modTime: info.ModTime()}
+		return nil
+	})
+	return s, err
+}
+
+// diff returns the first path that differs between snapshots.
+func (s snapshot) diff(other snapshot) (string, bool) {
+	for path, st := range s {
+		if otherSt, ok := other[path]; !ok || otherSt != st {
+			return path, true
+		}
+	}
+
+	for path := range other {
+		if _, ok := s[path]; !ok {
+			return path, true
+		}
+	}
+
+	return "", false
+}
+
+// sandbox detects writes made by the job outside of its OutputDir.
+//
+// Source files and artifacts of dependencies are compared before and after the job. Job directory
+// itself must not get new entries besides the output and source directories. Writes to the rest of
+// the host file system are not visible to the worker.
+type sandbox struct {
+	root string
+
+	tracked   []string
+	snapshots []snapshot
+}
+
+func newSandbox(root string, readOnly []string) (*sandbox, error) {
+	s := &sandbox{
+		root:    root,
+		tracked: append([]string{root}, readOnly...),
+	}
+
+	for _, dir := range s.tracked {
+		snap, err := takeSnapshot(dir, dir != root)
+		if err != nil {
+			return nil, err
+		}
+		s.snapshots = append(s.snapshots, snap)
+	}
+
+	return s, nil
+}
+
+// check finds modifications made by the job outside of the output directory.
+func (s *sandbox) check() error {
+	for i, dir := range s.tracked {
+		snap, err := takeSnapshot(dir, dir != s.root)
+		if err != nil {
+			return err
+		}
+
+		if path, changed := s.snapshots[i].diff(snap); changed {
+			return &violationError{reason: fmt.Sprintf("write outside of output directory: %s", filepath.Join(dir, path))}
+		}
+	}
+
+	return nil
+}
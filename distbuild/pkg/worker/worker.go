@@ -5,15 +5,62 @@ package worker
 import (
 	"context"
 	"net/http"
+	"sync"
+	"time"
 
 	"go.uber.org/zap"
 
 	"gitlab.com/slon/shad-go/distbuild/pkg/api"
 	"gitlab.com/slon/shad-go/distbuild/pkg/artifact"
+	"gitlab.com/slon/shad-go/distbuild/pkg/build"
 	"gitlab.com/slon/shad-go/distbuild/pkg/filecache"
+	"gitlab.com/slon/shad-go/distbuild/pkg/metrics"
+)
+
+const (
+	// defaultSlots is the number of jobs worker runs at the same time.
+	defaultSlots = 1
+
+	// heartbeatInterval is the delay between heartbeats when worker has no free slots.
+	heartbeatInterval = time.Millisecond * 100
+
+	// retryInterval is the delay before retrying failed heartbeat.
+	retryInterval = time.Millisecond * 100
 )
 
 type Worker struct {
+	id        api.WorkerID
+	log       *zap.Logger
+	fileCache *filecache.Cache
+	artifacts *artifact.Cache
+
+	heartbeat *api.HeartbeatClient
+	files     *filecache.Client
+	metrics   *workerMetrics
+	mux       *http.ServeMux
+	handler   http.Handler
+
+	slots  int
+	limits Limits
+
+	mu        sync.Mutex
+	running   map[build.ID]*runningJob
+	finished  []api.JobResult
+	added     []build.ID
+	removed   []build.ID
+	cancelled []build.ID
+
+	// jobDone is signalled every time a job finishes, so that results are reported without delay.
+	jobDone chan struct{}
+}
+
+type runningJob struct {
+	cancel    context.CancelFunc
+	cancelled bool
+
+	// stdout and stderr capture output of the job, which is streamed to the coordinator with heartbeats.
+	stdout *outputBuffer
+	stderr *outputBuffer
 }
 
 func New(
@@ -23,13 +70,248 @@ func New(
 	fileCache *filecache.Cache,
 	artifacts *artifact.Cache,
 ) *Worker {
-	panic("implement me")
+	w := &Worker{
+		id:        workerID,
+		log:       log,
+		fileCache: fileCache,
+		artifacts: artifacts,
+		heartbeat: api.NewHeartbeatClient(log.Named("heartbeat"), coordinatorEndpoint),
+		files:     filecache.NewClient(log.Named("filecache"), coordinatorEndpoint),
+		mux:       http.NewServeMux(),
+		slots:     defaultSlots,
+		running:   make(map[build.ID]*runningJob),
+		jobDone:   make(chan struct{}, 1),
+	}
+
+	w.metrics = newWorkerMetrics(w)
+	w.handler = metrics.CountBytes(w.mux, w.metrics.registry)
+
+	artifact.NewHandler(log.Named("artifact"), artifacts).Register(w.mux)
+	api.NewResultHandler(log.Named("result"), w).Register(w.mux)
+	w.mux.Handle("GET /metrics", metrics.Handler(w.metrics.registry))
+	return w
+}
+
+// SetLimits sets resource limits of the jobs started by the worker.
+//
+// Must be called before Run.
+func (w *Worker) SetLimits(limits Limits) {
+	w.limits = limits
+}
+
+// SetSlots sets the number of jobs the worker runs at the same time.
+//
+// Must be called before Run.
+func (w *Worker) SetSlots(slots int) {
+	w.slots = slots
 }
 
 func (w *Worker) ServeHTTP(rw http.ResponseWriter, r *http.Request) {
-	panic("implement me")
+	w.handler.ServeHTTP(rw, r)
+}
+
+// nextRequest collects everything that happened since the previous heartbeat.
+func (w *Worker) nextRequest() *api.HeartbeatRequest {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	req := &api.HeartbeatRequest{
+		WorkerID:         w.id,
+		FreeSlots:        w.slots - len(w.running),
+		FinishedJob:      w.finished,
+		AddedArtifacts:   w.added,
+		RemovedArtifacts: w.removed,
+		CancelledJobs:    w.cancelled,
+	}
+	for id, job := range w.running {
+		req.RunningJobs = append(req.RunningJobs, id)
+
+		out := api.JobOutput{ID: id}
+		out.StdoutOffset, out.Stdout = job.stdout.next()
+		out.StderrOffset, out.Stderr = job.stderr.next()
+		if len(out.Stdout) != 0 || len(out.Stderr) != 0 {
+			req.JobOutput = append(req.JobOutput, out)
+		}
+	}
+
+	w.finished = nil
+	w.added = nil
+	w.removed = nil
+	w.cancelled = nil
+	return req
+}
+
+// restoreRequest puts reports from the failed heartbeat back, so they are sent next time.
+func (w *Worker) restoreRequest(req *api.HeartbeatRequest) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.finished = append(req.FinishedJob, w.finished...)
+	w.added = append(req.AddedArtifacts, w.added...)
+	w.removed = append(req.RemovedArtifacts, w.removed...)
+	w.cancelled = append(req.CancelledJobs, w.cancelled...)
+
+	for _, out := range req.JobOutput {
+		if job, ok := w.running[out.ID]; ok {
+			job.stdout.rewind(out.StdoutOffset)
+			job.stderr.rewind(out.StderrOffset)
+		}
+	}
+}
+
+func (w *Worker) hasReports() bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	return len(w.finished) != 0 || len(w.added) != 0 || len(w.removed) != 0 || len(w.cancelled) != 0
+}
+
+func (w *Worker) freeSlots() int {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	return w.slots - len(w.running)
 }
 
 func (w *Worker) Run(ctx context.Context) error {
-	panic("implement me")
+	var wg sync.WaitGroup
+	defer wg.Wait()
+
+	err := w.artifacts.Range(func(id build.ID) error {
+		w.added = append(w.added, id)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+
+		err := w.artifacts.RunEvictor(ctx, w.onEvict)
+		if ctx.Err() == nil {
+			w.log.Error("artifact evictor stopped", zap.Error(err))
+		}
+	}()
+
+	for {
+		if w.freeSlots() == 0 && !w.hasReports() {
+			select {
+			case <-w.jobDone:
+			case <-time.After(heartbeatInterval):
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		}
+
+		req := w.nextRequest()
+		start := time.Now()
+		rsp, err := w.heartbeat.Heartbeat(ctx, req)
+		w.metrics.heartbeatDuration.Observe(time.Since(start).Seconds())
+		if err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+
+			w.restoreRequest(req)
+			select {
+			case <-time.After(retryInterval):
+				continue
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		}
+
+		w.cancelJobs(rsp.JobsToCancel)
+
+		for id := range rsp.JobsToRun {
+			job := rsp.JobsToRun[id]
+			w.startJob(ctx, &wg, &job)
+		}
+	}
+}
+
+// onEvict reports artifacts removed from the cache, so that coordinator stops sending jobs for them.
+func (w *Worker) onEvict(evicted []build.ID) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	for _, id := range evicted {
+		w.log.Debug("artifact evicted", zap.Stringer("id", id))
+		w.added = dropID(w.added, id)
+		w.removed = append(w.removed, id)
+	}
+}
+
+func dropID(ids []build.ID, id build.ID) []build.ID {
+	out := ids[:0]
+	for _, other := range ids {
+		if other != id {
+			out = append(out, other)
+		}
+	}
+	return out
+}
+
+func (w *Worker) cancelJobs(ids []build.ID) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	for _, id := range ids {
+		if job, ok := w.running[id]; ok {
+			w.log.Info("cancelling job", zap.Stringer("job_id", id))
+			job.cancelled = true
+			job.cancel()
+		}
+	}
+}
+
+func (w *Worker) startJob(ctx context.Context, wg *sync.WaitGroup, spec *api.JobSpec) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if _, ok := w.running[spec.ID]; ok {
+		return
+	}
+
+	outputLimit := w.limits.Output
+	if outputLimit == 0 {
+		outputLimit = defaultOutputLimit
+	}
+
+	jobCtx, cancel := context.WithCancel(ctx)
+	job := &runningJob{
+		cancel: cancel,
+		stdout: newOutputBuffer(outputLimit),
+		stderr: newOutputBuffer(outputLimit),
+	}
+	w.running[spec.ID] = job
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		defer cancel()
+
+		res := w.runJob(jobCtx, spec, job)
+		w.finishJob(spec.ID, job, res)
+	}()
+}
+
+func (w *Worker) finishJob(id build.ID, job *runningJob, res *api.JobResult) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	delete(w.running, id)
+	if job.cancelled {
+		w.cancelled = append(w.cancelled, id)
+	} else if res != nil {
+		w.finished = append(w.finished, *res)
+		w.removed = dropID(w.removed, id)
+	}
+
+	select {
+	case w.jobDone <- struct{}{}:
+	default:
+	}
 }
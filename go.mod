@@ -17,6 +17,7 @@ require (
 	github.com/gorilla/websocket v1.4.2
 	github.com/jackc/pgx/v5 v5.5.3
 	github.com/jonboulle/clockwork v0.4.0
+	github.com/klauspost/compress v1.18.0
 	github.com/prometheus/client_golang v1.19.1
 	github.com/spf13/cobra v1.1.3
 	github.com/spf13/pflag v1.0.5
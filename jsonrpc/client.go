@@ -0,0 +1,165 @@
+//go:build !solution
+
+package jsonrpc
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"sync/atomic"
+)
+
+// Client calls methods of the service with JSON-RPC 2.0 protocol.
+type Client struct {
+	endpoint string
+	http     *http.Client
+	lastID   atomic.Uint64
+}
+
+// NewClient creates client of the handler returned by MakeHandler and served at endpoint.
+func NewClient(endpoint string) *Client {
+	return &Client{endpoint: endpoint, http: http.DefaultClient}
+}
+
+// BatchCall is a single call inside Client.Batch.
+type BatchCall struct {
+	Method string
+	Req    interface{}
+	// Rsp receives the result. It is ignored for notifications.
+	Rsp interface{}
+	// Notification calls get no response from the server.
+	Notification bool
+
+	// Err is set by Batch, if the call failed.
+	Err error
+}
+
+// Call calls the method and decodes its result into rsp. Errors of the server are returned as *Error.
+func (c *Client) Call(ctx context.Context, method string, req, rsp interface{}) error {
+	call := &BatchCall{Method: method, Req: req, Rsp: rsp}
+	if err := c.do(ctx, []*BatchCall{call}, false); err != nil {
+		return err
+	}
+	return call.Err
+}
+
+// Notify calls the method without waiting for its result. Errors of the method are not reported.
+func (c *Client) Notify(ctx context.Context, method string, req interface{}) error {
+	return c.do(ctx, []*BatchCall{{Method: method, Req: req, Notification: true}}, false)
+}
+
+// Batch sends all calls in a single request. Server processes calls concurrently.
+//
+// Returned error means the whole batch failed. Errors of the individual calls are stored in BatchCall.Err.
+func (c *Client) Batch(ctx context.Context, calls []*BatchCall) error {
+	if len(calls) == 0 {
+		return nil
+	}
+	return c.do(ctx, calls, true)
+}
+
+func (c *Client) do(ctx context.Context, calls []*BatchCall, batch bool) error {
+	requests := make([]request, len(calls))
+	pending := make(map[string]*BatchCall, len(calls))
+	for i, call := range calls {
+		params, err := json.Marshal(call.Req)
+		if err != nil {
+			return fmt.Errorf("jsonrpc: encode params of %s: %w", call.Method, err)
+		}
+
+		requests[i] = request{JSONRPC: version, Method: call.Method, Params: params}
+		if !call.Notification {
+			id := strconv.FormatUint(c.lastID.Add(1), 10)
+			requests[i].ID = json.RawMessage(id)
+			pending[id] = call
+		}
+	}
+
+	var body []byte
+	var err error
+	if batch {
+		body, err = json.Marshal(requests)
+	} else {
+		body, err = json.Marshal(requests[0])
+	}
+	if err != nil {
+		return err
+	}
+
+	content, err := c.post(ctx, body)
+	if err != nil {
+		return err
+	}
+
+	if len(pending) == 0 {
+		return nil
+	}
+
+	var responses []response
+	content = bytes.TrimSpace(content)
+	if len(content) != 0 && content[0] == '[' {
+		err = json.Unmarshal(content, &responses)
+	} else {
+		responses = make([]response, 1)
+		err = json.Unmarshal(content, &responses[0])
+	}
+	if err != nil {
+		return fmt.Errorf("jsonrpc: decode response: %w", err)
+	}
+
+	for _, rsp := range responses {
+		call, ok := pending[string(rsp.ID)]
+		if !ok {
+			// Errors without id are reported for the whole request, e.g. parse errors.
+			if rsp.Error != nil {
+				return rsp.Error
+			}
+			continue
+		}
+		delete(pending, string(rsp.ID))
+
+		switch {
+		case rsp.Error != nil:
+			call.Err = rsp.Error
+		case call.Rsp != nil:
+			if err := json.Unmarshal(rsp.Result, call.Rsp); err != nil {
+				call.Err = fmt.Errorf("jsonrpc: decode result of %s: %w", call.Method, err)
+			}
+		}
+	}
+
+	for _, call := range pending {
+		call.Err = fmt.Errorf("jsonrpc: no response to %s", call.Method)
+	}
+	return nil
+}
+
+func (c *Client) post(ctx context.Context, body []byte) ([]byte, error) {
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, c.endpoint, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+
+	httpRsp, err := c.http.Do(httpReq)
+	if err != nil {
+		return nil, err
+	}
+	defer httpRsp.Body.Close()
+
+	content, err := io.ReadAll(httpRsp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	switch httpRsp.StatusCode {
+	case http.StatusOK, http.StatusNoContent:
+		return content, nil
+	default:
+		return nil, fmt.Errorf("jsonrpc: %s: %s", httpRsp.Status, bytes.TrimSpace(content))
+	}
+}
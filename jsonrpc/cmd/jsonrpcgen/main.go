@@ -0,0 +1,343 @@
+//go:build !solution
+
+// Command jsonrpcgen generates typed client of the service interface, served by jsonrpc.MakeHandler.
+//
+// Usage:
+//
+//	//go:generate go run gitlab.com/slon/shad-go/jsonrpc/cmd/jsonrpcgen -type Service
+//
+// Every method of the interface must have signature
+//
+//	Method(ctx context.Context, req *Request) (*Response, error)
+//
+// Generated client checks that it implements the interface, so mismatches between the client
+// and the interface are compile errors.
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"go/ast"
+	"go/format"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"text/template"
+	"unicode"
+)
+
+const jsonrpcPath = "gitlab.com/slon/shad-go/jsonrpc"
+
+var (
+	flagType   = flag.String("type", "", "name of the service interface; required")
+	flagClient = flag.String("client", "", "name of the generated client; default <type>Client")
+	flagOutput = flag.String("output", "", "output file; default <type>_client.go in the directory of the interface")
+)
+
+func main() {
+	log.SetFlags(0)
+	log.SetPrefix("jsonrpcgen: ")
+
+	flag.Usage = func() {
+		fmt.Fprintf(os.Stderr, "usage: jsonrpcgen -type Service [flags] [dir]\n")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	if *flagType == "" || flag.NArg() > 1 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	dir := "."
+	if flag.NArg() == 1 {
+		dir = flag.Arg(0)
+	}
+
+	svc, err := parseService(dir, *flagType)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	if *flagClient != "" {
+		svc.Client = *flagClient
+	}
+
+	code, err := generate(svc)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	output := *flagOutput
+	if output == "" {
+		name := snakeCase(svc.Interface) + "_client"
+		if strings.HasSuffix(svc.file, "_test.go") {
+			name += "_test"
+		}
+		output = filepath.Join(dir, name+".go")
+	}
+
+	if err := os.WriteFile(output, code, 0666); err != nil {
+		log.Fatal(err)
+	}
+}
+
+type service struct {
+	Package   string
+	Interface string
+	Client    string
+	Imports   []string
+	Methods   []method
+
+	// Jsonrpc qualifies identifiers of package jsonrpc. It is empty, when client is generated
+	// inside package jsonrpc itself.
+	Jsonrpc string
+
+	// file declaring the interface.
+	file string
+}
+
+type method struct {
+	Name string
+	// Req and Rsp are the types of request and response structs, without pointer.
+	Req string
+	Rsp string
+}
+
+// parseService finds declaration of the interface among the files of the directory.
+func parseService(dir, name string) (*service, error) {
+	files, err := filepath.Glob(filepath.Join(dir, "*.go"))
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(files)
+
+	fset := token.NewFileSet()
+	for _, path := range files {
+		file, err := parser.ParseFile(fset, path, nil, parser.SkipObjectResolution)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, decl := range file.Decls {
+			gen, ok := decl.(*ast.GenDecl)
+			if !ok || gen.Tok != token.TYPE {
+				continue
+			}
+
+			for _, spec := range gen.Specs {
+				ts := spec.(*ast.TypeSpec)
+				if ts.Name.Name != name {
+					continue
+				}
+
+				iface, ok := ts.Type.(*ast.InterfaceType)
+				if !ok {
+					return nil, fmt.Errorf("%s: %s is not an interface", fset.Position(ts.Pos()), name)
+				}
+				return newService(fset, file, path, name, iface)
+			}
+		}
+	}
+
+	return nil, fmt.Errorf("interface %s not found in %s", name, dir)
+}
+
+func newService(fset *token.FileSet, file *ast.File, path, name string, iface *ast.InterfaceType) (*service, error) {
+	imports := map[string]string{}
+	jsonrpcName := ""
+	for _, spec := range file.Imports {
+		importPath, _ := strconv.Unquote(spec.Path.Value)
+
+		// Package name is not known without loading the package, so the last element of the path is used.
+		pkg := importPath[strings.LastIndex(importPath, "/")+1:]
+		if spec.Name != nil {
+			pkg = spec.Name.Name
+			imports[pkg] = spec.Name.Name + " " + spec.Path.Value
+		} else {
+			imports[pkg] = spec.Path.Value
+		}
+
+		if importPath == jsonrpcPath && pkg != "_" && pkg != "." {
+			jsonrpcName = pkg
+		}
+	}
+
+	svc := &service{
+		Package:   file.Name.Name,
+		Interface: name,
+		Client:    name + "Client",
+		file:      path,
+	}
+
+	used := map[string]bool{}
+	for _, field := range iface.Methods.List {
+		fn, ok := field.Type.(*ast.FuncType)
+		if !ok || len(field.Names) == 0 {
+			return nil, fmt.Errorf("%s: embedded interfaces are not supported", fset.Position(field.Pos()))
+		}
+
+		req, rsp, ok := signature(fn, imports)
+		if !ok {
+			return nil, fmt.Errorf("%s: method %s must have signature func(context.Context, *Request) (*Response, error)",
+				fset.Position(field.Pos()), field.Names[0].Name)
+		}
+
+		for _, typ := range []ast.Expr{req, rsp} {
+			ast.Inspect(typ, func(n ast.Node) bool {
+				if sel, ok := n.(*ast.SelectorExpr); ok {
+					if pkg, ok := sel.X.(*ast.Ident); ok {
+						used[pkg.Name] = true
+					}
+				}
+				return true
+			})
+		}
+
+		svc.Methods = append(svc.Methods, method{
+			Name: field.Names[0].Name,
+			Req:  types.ExprString(req),
+			Rsp:  types.ExprString(rsp),
+		})
+	}
+
+	// Client calls jsonrpc.Call. Import of the interface file is reused, so that package is not imported twice.
+	if svc.Package != "jsonrpc" {
+		if jsonrpcName == "" {
+			jsonrpcName = "jsonrpc"
+			imports[jsonrpcName] = strconv.Quote(jsonrpcPath)
+		}
+		used[jsonrpcName] = true
+		svc.Jsonrpc = jsonrpcName + "."
+	}
+
+	for pkg := range used {
+		spec, ok := imports[pkg]
+		if !ok {
+			return nil, fmt.Errorf("%s: import of package %s not found", fset.Position(iface.Pos()), pkg)
+		}
+		svc.Imports = append(svc.Imports, spec)
+	}
+	sort.Strings(svc.Imports)
+
+	return svc, nil
+}
+
+// signature checks the signature of the method and returns its request and response types.
+func signature(fn *ast.FuncType, imports map[string]string) (req, rsp ast.Expr, ok bool) {
+	params := fieldTypes(fn.Params)
+	results := fieldTypes(fn.Results)
+	if len(params) != 2 || len(results) != 2 {
+		return nil, nil, false
+	}
+
+	if !isSelector(params[0], imports, `"context"`, "Context") {
+		return nil, nil, false
+	}
+	if ident, ok := results[1].(*ast.Ident); !ok || ident.Name != "error" {
+		return nil, nil, false
+	}
+
+	reqPtr, ok := params[1].(*ast.StarExpr)
+	if !ok {
+		return nil, nil, false
+	}
+	rspPtr, ok := results[0].(*ast.StarExpr)
+	if !ok {
+		return nil, nil, false
+	}
+	return reqPtr.X, rspPtr.X, true
+}
+
+// fieldTypes expands grouped parameters, like (a, b int).
+func fieldTypes(fields *ast.FieldList) []ast.Expr {
+	if fields == nil {
+		return nil
+	}
+
+	var list []ast.Expr
+	for _, field := range fields.List {
+		for range max(len(field.Names), 1) {
+			list = append(list, field.Type)
+		}
+	}
+	return list
+}
+
+func isSelector(expr ast.Expr, imports map[string]string, path, name string) bool {
+	sel, ok := expr.(*ast.SelectorExpr)
+	if !ok || sel.Sel.Name != name {
+		return false
+	}
+
+	pkg, ok := sel.X.(*ast.Ident)
+	return ok && strings.HasSuffix(imports[pkg.Name], path)
+}
+
+var clientTemplate = template.Must(template.New("client").Parse(`// Code generated by jsonrpcgen -type {{.Interface}}; DO NOT EDIT.
+
+package {{.Package}}
+
+import (
+	"context"
+{{range .Imports}}
+	{{.}}
+{{- end}}
+)
+
+// {{.Client}} calls methods of {{.Interface}} served by jsonrpc.MakeHandler.
+type {{.Client}} struct {
+	endpoint string
+}
+
+var _ {{.Interface}} = (*{{.Client}})(nil)
+
+// New{{.Client}} creates client of the service served at endpoint.
+func New{{.Client}}(endpoint string) *{{.Client}} {
+	return &{{.Client}}{endpoint: endpoint}
+}
+{{range .Methods}}
+func (c *{{$.Client}}) {{.Name}}(ctx context.Context, req *{{.Req}}) (*{{.Rsp}}, error) {
+	rsp := new({{.Rsp}})
+	if err := {{$.Jsonrpc}}Call(ctx, c.endpoint, "{{.Name}}", req, rsp); err != nil {
+		return nil, err
+	}
+	return rsp, nil
+}
+{{end}}`))
+
+func generate(svc *service) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := clientTemplate.Execute(&buf, svc); err != nil {
+		return nil, err
+	}
+
+	code, err := format.Source(buf.Bytes())
+	if err != nil {
+		return nil, fmt.Errorf("format generated code: %w", err)
+	}
+	return code, nil
+}
+
+// snakeCase converts CamelCase name of the interface into the file name.
+func snakeCase(name string) string {
+	var b strings.Builder
+	runes := []rune(name)
+	for i, r := range runes {
+		if unicode.IsUpper(r) {
+			if i > 0 && (unicode.IsLower(runes[i-1]) || i+1 < len(runes) && unicode.IsLower(runes[i+1])) {
+				b.WriteByte('_')
+			}
+			r = unicode.ToLower(r)
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
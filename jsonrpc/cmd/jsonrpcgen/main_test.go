@@ -0,0 +1,177 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func writeSource(t *testing.T, source string) string {
+	t.Helper()
+
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "service.go"), []byte(source), 0666))
+	return dir
+}
+
+func TestGenerate(t *testing.T) {
+	dir := writeSource(t, `package storage
+
+import (
+	ctx "context"
+
+	"example.com/storage/api"
+	"example.com/storage/unused"
+)
+
+type BlobStore interface {
+	Put(c ctx.Context, req *api.PutRequest) (*api.PutResponse, error)
+	Get(ctx.Context, *GetRequest) (*GetResponse, error)
+}
+
+var _ unused.Thing
+`)
+
+	svc, err := parseService(dir, "BlobStore")
+	require.NoError(t, err)
+
+	code, err := generate(svc)
+	require.NoError(t, err)
+
+	expected := `// Code generated by jsonrpcgen -type BlobStore; DO NOT EDIT.
+
+package storage
+
+import (
+	"context"
+
+	"example.com/storage/api"
+	"gitlab.com/slon/shad-go/jsonrpc"
+)
+
+// BlobStoreClient calls methods of BlobStore served by jsonrpc.MakeHandler.
+type BlobStoreClient struct {
+	endpoint string
+}
+
+var _ BlobStore = (*BlobStoreClient)(nil)
+
+// NewBlobStoreClient creates client of the service served at endpoint.
+func NewBlobStoreClient(endpoint string) *BlobStoreClient {
+	return &BlobStoreClient{endpoint: endpoint}
+}
+
+func (c *BlobStoreClient) Put(ctx context.Context, req *api.PutRequest) (*api.PutResponse, error) {
+	rsp := new(api.PutResponse)
+	if err := jsonrpc.Call(ctx, c.endpoint, "Put", req, rsp); err != nil {
+		return nil, err
+	}
+	return rsp, nil
+}
+
+func (c *BlobStoreClient) Get(ctx context.Context, req *GetRequest) (*GetResponse, error) {
+	rsp := new(GetResponse)
+	if err := jsonrpc.Call(ctx, c.endpoint, "Get", req, rsp); err != nil {
+		return nil, err
+	}
+	return rsp, nil
+}
+`
+	require.Equal(t, expected, string(code))
+}
+
+func TestGenerateImportsJsonrpc(t *testing.T) {
+	dir := writeSource(t, `package storage
+
+import (
+	"context"
+
+	rpc "gitlab.com/slon/shad-go/jsonrpc"
+)
+
+type Raw interface {
+	Echo(ctx context.Context, req *rpc.Error) (*rpc.Error, error)
+}
+`)
+
+	svc, err := parseService(dir, "Raw")
+	require.NoError(t, err)
+
+	code, err := generate(svc)
+	require.NoError(t, err)
+	require.Contains(t, string(code), `
+import (
+	"context"
+
+	rpc "gitlab.com/slon/shad-go/jsonrpc"
+)
+`)
+	require.Contains(t, string(code), `rpc.Call(ctx, c.endpoint, "Echo", req, rsp)`)
+}
+
+func TestGenerateInsideJsonrpc(t *testing.T) {
+	dir := writeSource(t, `package jsonrpc
+
+import "context"
+
+type Echo interface {
+	Echo(ctx context.Context, req *EchoRequest) (*EchoResponse, error)
+}
+`)
+
+	svc, err := parseService(dir, "Echo")
+	require.NoError(t, err)
+
+	code, err := generate(svc)
+	require.NoError(t, err)
+	require.Contains(t, string(code), "import (\n\t\"context\"\n)\n")
+	require.Contains(t, string(code), `if err := Call(ctx, c.endpoint, "Echo", req, rsp); err != nil {`)
+	require.NotContains(t, string(code), "jsonrpc.Call")
+}
+
+func TestParseServiceErrors(t *testing.T) {
+	for _, tc := range []struct {
+		name   string
+		source string
+		err    string
+	}{
+		{
+			name:   "NotFound",
+			source: "package p\n",
+			err:    "interface Service not found",
+		},
+		{
+			name:   "NotInterface",
+			source: "package p\ntype Service struct{}\n",
+			err:    "Service is not an interface",
+		},
+		{
+			name:   "Embedded",
+			source: "package p\ntype Service interface{ Other }\n",
+			err:    "embedded interfaces are not supported",
+		},
+		{
+			name:   "NoContext",
+			source: "package p\ntype Service interface{ Do(req *Req) (*Rsp, error) }\n",
+			err:    "method Do must have signature",
+		},
+		{
+			name:   "NotPointer",
+			source: "package p\nimport \"context\"\ntype Service interface{ Do(ctx context.Context, req Req) (*Rsp, error) }\n",
+			err:    "method Do must have signature",
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := parseService(writeSource(t, tc.source), "Service")
+			require.ErrorContains(t, err, tc.err)
+		})
+	}
+}
+
+func TestSnakeCase(t *testing.T) {
+	require.Equal(t, "blob_store", snakeCase("BlobStore"))
+	require.Equal(t, "http_service", snakeCase("HTTPService"))
+	require.Equal(t, "service", snakeCase("service"))
+}
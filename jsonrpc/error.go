@@ -0,0 +1,38 @@
+//go:build !solution
+
+package jsonrpc
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// Error codes defined by JSON-RPC 2.0 specification.
+const (
+	CodeParseError     = -32700
+	CodeInvalidRequest = -32600
+	CodeMethodNotFound = -32601
+	CodeInvalidParams  = -32602
+	CodeInternalError  = -32603
+
+	// CodeServerError is used for errors returned by the service methods, unless method returns *Error.
+	CodeServerError = -32000
+)
+
+// Error is JSON-RPC error object.
+//
+// Service method may return *Error to choose the code, otherwise error is sent with CodeServerError.
+// Client returns errors of the server as *Error.
+type Error struct {
+	Code    int             `json:"code"`
+	Message string          `json:"message"`
+	Data    json.RawMessage `json:"data,omitempty"`
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("jsonrpc: %s (code %d)", e.Message, e.Code)
+}
+
+func newError(code int, format string, args ...interface{}) *Error {
+	return &Error{Code: code, Message: fmt.Sprintf(format, args...)}
+}
@@ -0,0 +1,62 @@
+package jsonrpc_test
+
+import (
+	"context"
+	"errors"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"gitlab.com/slon/shad-go/jsonrpc"
+)
+
+//go:generate go run ./cmd/jsonrpcgen -type Calculator
+
+type Calculator interface {
+	Mul(ctx context.Context, req *MulRequest) (*MulResponse, error)
+	Div(ctx context.Context, req *DivRequest) (*DivResponse, error)
+}
+
+type MulRequest struct{ A, B int }
+type MulResponse struct{ Product int }
+
+type DivRequest struct{ A, B int }
+type DivResponse struct{ Quotient int }
+
+type calculator struct{}
+
+var _ Calculator = calculator{}
+
+func (calculator) Mul(ctx context.Context, req *MulRequest) (*MulResponse, error) {
+	return &MulResponse{Product: req.A * req.B}, nil
+}
+
+func (calculator) Div(ctx context.Context, req *DivRequest) (*DivResponse, error) {
+	if req.B == 0 {
+		return nil, &jsonrpc.Error{Code: 1, Message: "division by zero"}
+	}
+	return &DivResponse{Quotient: req.A / req.B}, nil
+}
+
+func TestGeneratedClient(t *testing.T) {
+	server := httptest.NewServer(jsonrpc.MakeHandler(calculator{}))
+	defer server.Close()
+
+	ctx := context.Background()
+	client := NewCalculatorClient(server.URL)
+
+	mul, err := client.Mul(ctx, &MulRequest{A: 6, B: 7})
+	require.NoError(t, err)
+	require.Equal(t, 42, mul.Product)
+
+	div, err := client.Div(ctx, &DivRequest{A: 7, B: 2})
+	require.NoError(t, err)
+	require.Equal(t, 3, div.Quotient)
+
+	_, err = client.Div(ctx, &DivRequest{A: 1})
+
+	var rpcErr *jsonrpc.Error
+	require.Truef(t, errors.As(err, &rpcErr), "%v", err)
+	require.Equal(t, "division by zero", rpcErr.Message)
+}
@@ -3,14 +3,130 @@
 package jsonrpc
 
 import (
+	"bytes"
 	"context"
+	"encoding/json"
+	"fmt"
+	"io"
 	"net/http"
+	"reflect"
+	"strings"
 )
 
+// maxBodySize limits the size of the request body.
+const maxBodySize = 32 << 20
+
+// MakeHandler creates handler serving RPC methods of the service.
+//
+// POST to the root path is handled as JSON-RPC 2.0 request or batch. POST to /Method is handled
+// by the simple protocol of Call: body is the request of the method, and response body is its response.
+//
+// GET of the root path returns OpenRPC document describing the methods. The same document is returned
+// by the JSON-RPC method rpc.discover.
 func MakeHandler(service interface{}) http.Handler {
-	panic("implement me")
+	s := newService(service)
+
+	t := reflect.TypeOf(service)
+	if t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+
+	return &handler{service: s, doc: newDocument(t.Name(), s)}
+}
+
+type handler struct {
+	service *service
+	doc     *document
+}
+
+func (h *handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	name := strings.TrimPrefix(r.URL.Path, "/")
+	if r.Method == http.MethodGet && name == "" {
+		writeJSON(w, http.StatusOK, h.doc)
+		return
+	}
+
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxBodySize))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if name == "" {
+		h.serveJSONRPC(w, r.Context(), body)
+		return
+	}
+
+	h.serveMethod(w, r.Context(), name, body)
 }
 
+func writeJSON(w http.ResponseWriter, code int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+// serveMethod handles the simple protocol. Errors are sent as *Error with HTTP status matching the code.
+func (h *handler) serveMethod(w http.ResponseWriter, ctx context.Context, name string, body []byte) {
+	m, ok := h.service.methods[name]
+	if !ok {
+		writeJSON(w, http.StatusNotFound, newError(CodeMethodNotFound, "method %s not found", name))
+		return
+	}
+
+	rsp, rpcErr := m.call(ctx, body)
+	if rpcErr != nil {
+		code := http.StatusInternalServerError
+		if rpcErr.Code == CodeInvalidParams {
+			code = http.StatusBadRequest
+		}
+		writeJSON(w, code, rpcErr)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, rsp)
+}
+
+// Call calls the method with the simple protocol of MakeHandler: request is sent to endpoint/method.
+//
+// Errors of the server are returned as *Error.
 func Call(ctx context.Context, endpoint string, method string, req, rsp interface{}) error {
-	panic("implement me")
+	body, err := json.Marshal(req)
+	if err != nil {
+		return err
+	}
+
+	url := strings.TrimSuffix(endpoint, "/") + "/" + method
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+
+	httpRsp, err := http.DefaultClient.Do(httpReq)
+	if err != nil {
+		return err
+	}
+	defer httpRsp.Body.Close()
+
+	content, err := io.ReadAll(httpRsp.Body)
+	if err != nil {
+		return err
+	}
+
+	if httpRsp.StatusCode != http.StatusOK {
+		rpcErr := new(Error)
+		if err := json.Unmarshal(content, rpcErr); err != nil || rpcErr.Message == "" {
+			return fmt.Errorf("jsonrpc: %s: %s", httpRsp.Status, bytes.TrimSpace(content))
+		}
+		return rpcErr
+	}
+
+	return json.Unmarshal(content, rsp)
 }
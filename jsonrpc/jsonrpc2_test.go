@@ -0,0 +1,321 @@
+package jsonrpc
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+type specService struct {
+	testService
+
+	notified atomic.Int32
+
+	// sleeping counts running Sleep calls. maxSleeping is the largest value it had.
+	sleeping    atomic.Int32
+	maxSleeping atomic.Int32
+}
+
+type NotifyRequest struct{ N int32 }
+type NotifyResponse struct{}
+
+func (s *specService) Notify(ctx context.Context, req *NotifyRequest) (*NotifyResponse, error) {
+	s.notified.Add(req.N)
+	return &NotifyResponse{}, nil
+}
+
+type SleepRequest struct{ Duration time.Duration }
+type SleepResponse struct{}
+
+func (s *specService) Sleep(ctx context.Context, req *SleepRequest) (*SleepResponse, error) {
+	n := s.sleeping.Add(1)
+	defer s.sleeping.Add(-1)
+
+	for {
+		old := s.maxSleeping.Load()
+		if n <= old || s.maxSleeping.CompareAndSwap(old, n) {
+			break
+		}
+	}
+
+	time.Sleep(req.Duration)
+	return &SleepResponse{}, nil
+}
+
+type PanicRequest struct{}
+type PanicResponse struct{}
+
+func (*specService) Panic(ctx context.Context, req *PanicRequest) (*PanicResponse, error) {
+	panic("boom")
+}
+
+type DenyRequest struct{}
+type DenyResponse struct{}
+
+const codeDenied = 42
+
+func (*specService) Deny(ctx context.Context, req *DenyRequest) (*DenyResponse, error) {
+	return nil, &Error{Code: codeDenied, Message: "denied", Data: []byte(`{"reason":"test"}`)}
+}
+
+func post(t *testing.T, url, body string) (int, string) {
+	t.Helper()
+
+	rsp, err := http.Post(url, "application/json", strings.NewReader(body))
+	require.NoError(t, err)
+	defer rsp.Body.Close()
+
+	content, err := io.ReadAll(rsp.Body)
+	require.NoError(t, err)
+	return rsp.StatusCode, strings.TrimSpace(string(content))
+}
+
+func TestJSONRPC2_Spec(t *testing.T) {
+	service := &specService{}
+	server := httptest.NewServer(MakeHandler(service))
+	defer server.Close()
+
+	for _, tc := range []struct {
+		name     string
+		request  string
+		code     int
+		response string
+	}{
+		{
+			name:     "Call",
+			request:  `{"jsonrpc":"2.0","method":"Add","params":{"A":1,"B":2},"id":1}`,
+			code:     http.StatusOK,
+			response: `{"jsonrpc":"2.0","result":{"Sum":3},"id":1}`,
+		},
+		{
+			name:     "PositionalParams",
+			request:  `{"jsonrpc":"2.0","method":"Add","params":[{"A":2,"B":2}],"id":"a"}`,
+			code:     http.StatusOK,
+			response: `{"jsonrpc":"2.0","result":{"Sum":4},"id":"a"}`,
+		},
+		{
+			name:     "NullID",
+			request:  `{"jsonrpc":"2.0","method":"Ping","id":null}`,
+			code:     http.StatusOK,
+			response: `{"jsonrpc":"2.0","result":{},"id":null}`,
+		},
+		{
+			name:    "Notification",
+			request: `{"jsonrpc":"2.0","method":"Notify","params":{"N":1}}`,
+			code:    http.StatusNoContent,
+		},
+		{
+			name:     "ParseError",
+			request:  `{"jsonrpc":"2.0","method":"Add",`,
+			code:     http.StatusOK,
+			response: `{"jsonrpc":"2.0","error":{"code":-32700,"message":"parse error"},"id":null}`,
+		},
+		{
+			name:     "Panic",
+			request:  `{"jsonrpc":"2.0","method":"Panic","id":1}`,
+			code:     http.StatusOK,
+			response: `{"jsonrpc":"2.0","error":{"code":-32603,"message":"method Panic panicked: boom"},"id":1}`,
+		},
+		{
+			name:     "MethodNotFound",
+			request:  `{"jsonrpc":"2.0","method":"Sub","id":1}`,
+			code:     http.StatusOK,
+			response: `{"jsonrpc":"2.0","error":{"code":-32601,"message":"method Sub not found"},"id":1}`,
+		},
+		{
+			name:     "InvalidVersion",
+			request:  `{"jsonrpc":"1.0","method":"Ping","id":1}`,
+			code:     http.StatusOK,
+			response: `{"jsonrpc":"2.0","error":{"code":-32600,"message":"invalid request"},"id":1}`,
+		},
+		{
+			name:     "InvalidID",
+			request:  `{"jsonrpc":"2.0","method":"Ping","id":{}}`,
+			code:     http.StatusOK,
+			response: `{"jsonrpc":"2.0","error":{"code":-32600,"message":"invalid request"},"id":{}}`,
+		},
+		{
+			name:     "EmptyBatch",
+			request:  `[]`,
+			code:     http.StatusOK,
+			response: `{"jsonrpc":"2.0","error":{"code":-32600,"message":"invalid request: empty batch"},"id":null}`,
+		},
+		{
+			name:    "NotificationBatch",
+			request: `[{"jsonrpc":"2.0","method":"Notify","params":{"N":1}},{"jsonrpc":"2.0","method":"Notify","params":{"N":1}}]`,
+			code:    http.StatusNoContent,
+		},
+		{
+			name: "Batch",
+			request: `[
+				{"jsonrpc":"2.0","method":"Add","params":{"A":1,"B":1},"id":1},
+				{"jsonrpc":"2.0","method":"Notify","params":{"N":1}},
+				{"jsonrpc":"2.0","method":"Error","id":2},
+				1
+			]`,
+			code: http.StatusOK,
+			response: `[` +
+				`{"jsonrpc":"2.0","result":{"Sum":2},"id":1},` +
+				`{"jsonrpc":"2.0","error":{"code":-32000,"message":"cache is empty"},"id":2},` +
+				`{"jsonrpc":"2.0","error":{"code":-32600,"message":"invalid request: json: cannot unmarshal number into Go value of type jsonrpc.request"},"id":null}` +
+				`]`,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			code, rsp := post(t, server.URL, tc.request)
+			require.Equal(t, tc.code, code)
+			if tc.response == "" {
+				require.Empty(t, rsp)
+			} else {
+				require.JSONEq(t, tc.response, rsp)
+			}
+		})
+	}
+
+	t.Run("InvalidParams", func(t *testing.T) {
+		_, rsp := post(t, server.URL, `{"jsonrpc":"2.0","method":"Add","params":{"A":"1"},"id":1}`)
+		require.Contains(t, rsp, `"code":-32602`)
+
+		_, rsp = post(t, server.URL, `{"jsonrpc":"2.0","method":"Add","params":[{},{}],"id":1}`)
+		require.Contains(t, rsp, `"code":-32602`)
+	})
+
+	require.Equal(t, int32(4), service.notified.Load())
+}
+
+func TestJSONRPC2_MethodNotAllowed(t *testing.T) {
+	server := httptest.NewServer(MakeHandler(&specService{}))
+	defer server.Close()
+
+	req, err := http.NewRequest(http.MethodPut, server.URL, nil)
+	require.NoError(t, err)
+
+	rsp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	defer rsp.Body.Close()
+
+	require.Equal(t, http.StatusMethodNotAllowed, rsp.StatusCode)
+	require.Equal(t, http.MethodPost, rsp.Header.Get("Allow"))
+}
+
+func TestJSONRPC2_GetDocument(t *testing.T) {
+	server := httptest.NewServer(MakeHandler(&specService{}))
+	defer server.Close()
+
+	rsp, err := http.Get(server.URL)
+	require.NoError(t, err)
+	defer rsp.Body.Close()
+
+	require.Equal(t, http.StatusOK, rsp.StatusCode)
+
+	var doc struct {
+		OpenRPC string `json:"openrpc"`
+		Methods []struct {
+			Name string `json:"name"`
+		} `json:"methods"`
+	}
+	require.NoError(t, json.NewDecoder(rsp.Body).Decode(&doc))
+	require.NotEmpty(t, doc.OpenRPC)
+	require.NotEmpty(t, doc.Methods)
+}
+
+func TestClient(t *testing.T) {
+	service := &specService{}
+	server := httptest.NewServer(MakeHandler(service))
+	defer server.Close()
+
+	ctx := context.Background()
+	client := NewClient(server.URL)
+
+	t.Run("Call", func(t *testing.T) {
+		var rsp AddResponse
+		require.NoError(t, client.Call(ctx, "Add", &AddRequest{A: 1, B: 2}, &rsp))
+		require.Equal(t, 3, rsp.Sum)
+	})
+
+	t.Run("Error", func(t *testing.T) {
+		err := client.Call(ctx, "Deny", &DenyRequest{}, &DenyResponse{})
+
+		var rpcErr *Error
+		require.Truef(t, errors.As(err, &rpcErr), "%v", err)
+		require.Equal(t, codeDenied, rpcErr.Code)
+		require.Equal(t, "denied", rpcErr.Message)
+		require.JSONEq(t, `{"reason":"test"}`, string(rpcErr.Data))
+
+		err = client.Call(ctx, "Missing", &PingRequest{}, &PingResponse{})
+		require.Truef(t, errors.As(err, &rpcErr), "%v", err)
+		require.Equal(t, CodeMethodNotFound, rpcErr.Code)
+	})
+
+	t.Run("LegacyError", func(t *testing.T) {
+		err := Call(ctx, server.URL, "Deny", &DenyRequest{}, &DenyResponse{})
+
+		var rpcErr *Error
+		require.Truef(t, errors.As(err, &rpcErr), "%v", err)
+		require.Equal(t, codeDenied, rpcErr.Code)
+	})
+
+	t.Run("Notify", func(t *testing.T) {
+		before := service.notified.Load()
+		require.NoError(t, client.Notify(ctx, "Notify", &NotifyRequest{N: 5}))
+		require.Equal(t, before+5, service.notified.Load())
+	})
+
+	t.Run("Batch", func(t *testing.T) {
+		var sums [3]AddResponse
+		calls := []*BatchCall{
+			{Method: "Add", Req: &AddRequest{A: 1}, Rsp: &sums[0]},
+			{Method: "Add", Req: &AddRequest{A: 2}, Rsp: &sums[1]},
+			{Method: "Notify", Req: &NotifyRequest{N: 1}, Notification: true},
+			{Method: "Error", Req: &ErrorRequest{}, Rsp: &ErrorResponse{}},
+			{Method: "Add", Req: &AddRequest{A: 3}, Rsp: &sums[2]},
+		}
+
+		require.NoError(t, client.Batch(ctx, calls))
+		require.Equal(t, [3]AddResponse{{Sum: 1}, {Sum: 2}, {Sum: 3}}, sums)
+
+		for i, call := range calls {
+			if i == 3 {
+				require.ErrorContains(t, call.Err, "cache is empty")
+			} else {
+				require.NoError(t, call.Err)
+			}
+		}
+	})
+
+	t.Run("ConcurrentBatch", func(t *testing.T) {
+		const n = 10
+
+		var calls []*BatchCall
+		for range n {
+			calls = append(calls, &BatchCall{Method: "Sleep", Req: &SleepRequest{Duration: 100 * time.Millisecond}, Rsp: &SleepResponse{}})
+		}
+
+		start := time.Now()
+		require.NoError(t, client.Batch(ctx, calls))
+		require.Less(t, time.Since(start), n*100*time.Millisecond/2)
+
+		for _, call := range calls {
+			require.NoError(t, call.Err)
+		}
+	})
+
+	t.Run("BatchConcurrencyLimit", func(t *testing.T) {
+		var calls []*BatchCall
+		for range 4 * maxBatchConcurrency {
+			calls = append(calls, &BatchCall{Method: "Sleep", Req: &SleepRequest{Duration: 10 * time.Millisecond}, Rsp: &SleepResponse{}})
+		}
+
+		require.NoError(t, client.Batch(ctx, calls))
+		require.LessOrEqual(t, service.maxSleeping.Load(), int32(maxBatchConcurrency))
+	})
+}
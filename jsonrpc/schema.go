@@ -0,0 +1,300 @@
+//go:build !solution
+
+package jsonrpc
+
+import (
+	"cmp"
+	"encoding"
+	"encoding/json"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	openRPCVersion = "1.2.6"
+
+	// discoverMethod returns the OpenRPC document of the service, as defined by the OpenRPC specification.
+	discoverMethod = "rpc.discover"
+)
+
+// document is OpenRPC document describing the service.
+//
+// Every method takes its request as the only positional parameter, which is also accepted by the handler.
+type document struct {
+	OpenRPC    string      `json:"openrpc"`
+	Info       info        `json:"info"`
+	Methods    []methodDoc `json:"methods"`
+	Components components  `json:"components"`
+}
+
+type info struct {
+	Title   string `json:"title"`
+	Version string `json:"version"`
+}
+
+type methodDoc struct {
+	Name           string       `json:"name"`
+	ParamStructure string       `json:"paramStructure"`
+	Params         []contentDoc `json:"params"`
+	Result         contentDoc   `json:"result"`
+	Errors         []errorDoc   `json:"errors,omitempty"`
+}
+
+type contentDoc struct {
+	Name     string  `json:"name"`
+	Required bool    `json:"required,omitempty"`
+	Schema   *schema `json:"schema"`
+}
+
+type errorDoc struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+type components struct {
+	Schemas map[string]*schema `json:"schemas"`
+}
+
+// schema is the subset of JSON Schema describing values produced by encoding/json.
+type schema struct {
+	Ref                  string             `json:"$ref,omitempty"`
+	Type                 string             `json:"type,omitempty"`
+	Format               string             `json:"format,omitempty"`
+	ContentEncoding      string             `json:"contentEncoding,omitempty"`
+	Items                *schema            `json:"items,omitempty"`
+	Properties           map[string]*schema `json:"properties,omitempty"`
+	AdditionalProperties *schema            `json:"additionalProperties,omitempty"`
+}
+
+var (
+	timeType          = reflect.TypeOf(time.Time{})
+	jsonMarshalerType = reflect.TypeOf((*json.Marshaler)(nil)).Elem()
+	textMarshalerType = reflect.TypeOf((*encoding.TextMarshaler)(nil)).Elem()
+)
+
+// newDocument describes methods of the service. Named structs are placed into components
+// and referenced by name, so recursive types are supported.
+func newDocument(title string, s *service) *document {
+	g := &schemaGenerator{
+		schemas: make(map[string]*schema),
+		names:   make(map[reflect.Type]string),
+	}
+
+	doc := &document{
+		OpenRPC: openRPCVersion,
+		Info:    info{Title: title, Version: "0.0.0"},
+		Methods: []methodDoc{},
+	}
+	for _, m := range s.methods {
+		doc.Methods = append(doc.Methods, methodDoc{
+			Name:           m.name,
+			ParamStructure: "by-position",
+			Params:         []contentDoc{{Name: "req", Required: true, Schema: g.schema(m.req)}},
+			Result:         contentDoc{Name: "rsp", Schema: g.schema(m.rsp)},
+			Errors: []errorDoc{
+				{Code: CodeInvalidParams, Message: "invalid params"},
+				{Code: CodeServerError, Message: "server error"},
+			},
+		})
+	}
+	sort.Slice(doc.Methods, func(i, j int) bool {
+		return doc.Methods[i].Name < doc.Methods[j].Name
+	})
+
+	doc.Components.Schemas = g.schemas
+	return doc
+}
+
+type schemaGenerator struct {
+	schemas map[string]*schema
+	names   map[reflect.Type]string
+}
+
+func (g *schemaGenerator) schema(t reflect.Type) *schema {
+	switch {
+	case t == timeType:
+		return &schema{Type: "string", Format: "date-time"}
+	case t.Implements(jsonMarshalerType) || reflect.PointerTo(t).Implements(jsonMarshalerType):
+		// Encoding is defined by the type itself, so any value is allowed.
+		return &schema{}
+	case t.Implements(textMarshalerType) || reflect.PointerTo(t).Implements(textMarshalerType):
+		return &schema{Type: "string"}
+	}
+
+	switch t.Kind() {
+	case reflect.Bool:
+		return &schema{Type: "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return &schema{Type: "integer"}
+	case reflect.Float32, reflect.Float64:
+		return &schema{Type: "number"}
+	case reflect.String:
+		return &schema{Type: "string"}
+	case reflect.Pointer:
+		return g.schema(t.Elem())
+	case reflect.Slice, reflect.Array:
+		if t.Kind() == reflect.Slice && t.Elem().Kind() == reflect.Uint8 {
+			return &schema{Type: "string", ContentEncoding: "base64"}
+		}
+		return &schema{Type: "array", Items: g.schema(t.Elem())}
+	case reflect.Map:
+		return &schema{Type: "object", AdditionalProperties: g.schema(t.Elem())}
+	case reflect.Struct:
+		if t.Name() == "" {
+			return g.object(t)
+		}
+		return &schema{Ref: "#/components/schemas/" + g.define(t)}
+	default:
+		return &schema{}
+	}
+}
+
+// define adds schema of the named struct to components and returns its name.
+func (g *schemaGenerator) define(t reflect.Type) string {
+	if name, ok := g.names[t]; ok {
+		return name
+	}
+
+	name := t.Name()
+	for i := 2; g.schemas[name] != nil; i++ {
+		name = t.Name() + strconv.Itoa(i)
+	}
+
+	// Name is reserved before the fields are visited, so that recursive references resolve.
+	g.names[t] = name
+	g.schemas[name] = &schema{}
+	*g.schemas[name] = *g.object(t)
+	return name
+}
+
+func (g *schemaGenerator) object(t reflect.Type) *schema {
+	s := &schema{Type: "object", Properties: make(map[string]*schema)}
+	g.fields(t, s.Properties)
+	return s
+}
+
+// fields follows the rules of encoding/json: fields of embedded structs are promoted. Of the fields
+// with the same name, the least nested one wins. Fields at the same depth are resolved by json tag,
+// and are dropped, if that doesn't help.
+//
+// Embedded structs are visited breadth first, every struct once, so that struct embedding
+// a pointer to itself is expanded once.
+func (g *schemaGenerator) fields(t reflect.Type, properties map[string]*schema) {
+	type field struct {
+		name   string
+		typ    reflect.Type
+		quoted bool
+		depth  int
+		tagged bool
+	}
+
+	var fields []field
+	visited := make(map[reflect.Type]bool)
+
+	// count holds the number of times the struct is embedded at the current depth.
+	var current []reflect.Type
+	next := []reflect.Type{t}
+	count, nextCount := map[reflect.Type]int{}, map[reflect.Type]int{t: 1}
+
+	for depth := 0; len(next) > 0; depth++ {
+		current, next = next, nil
+		count, nextCount = nextCount, map[reflect.Type]int{}
+
+		for _, st := range current {
+			if visited[st] {
+				continue
+			}
+			visited[st] = true
+
+			for i := range st.NumField() {
+				f := st.Field(i)
+
+				ft := f.Type
+				if ft.Name() == "" && ft.Kind() == reflect.Pointer {
+					ft = ft.Elem()
+				}
+
+				if f.Anonymous {
+					if !f.IsExported() && ft.Kind() != reflect.Struct {
+						continue
+					}
+				} else if !f.IsExported() {
+					continue
+				}
+
+				tag := f.Tag.Get("json")
+				if tag == "-" {
+					continue
+				}
+				name, opts, _ := strings.Cut(tag, ",")
+
+				if name != "" || !f.Anonymous || ft.Kind() != reflect.Struct {
+					fields = append(fields, field{
+						name:   cmp.Or(name, f.Name),
+						typ:    f.Type,
+						quoted: strings.Contains(opts, "string"),
+						depth:  depth,
+						tagged: name != "",
+					})
+
+					// Struct embedded twice at the same depth has its fields duplicated, so that they cancel out.
+					if count[st] > 1 {
+						fields = append(fields, fields[len(fields)-1])
+					}
+					continue
+				}
+
+				nextCount[ft]++
+				if nextCount[ft] == 1 {
+					next = append(next, ft)
+				}
+			}
+		}
+	}
+
+	// Names are resolved in the order of the fields, so that names of the nested schemas are stable.
+	var names []string
+	byName := make(map[string][]field)
+	for _, f := range fields {
+		if _, ok := byName[f.name]; !ok {
+			names = append(names, f.name)
+		}
+		byName[f.name] = append(byName[f.name], f)
+	}
+
+	for _, name := range names {
+		candidates := byName[name]
+		depth := candidates[0].depth
+		for _, f := range candidates {
+			depth = min(depth, f.depth)
+		}
+
+		var dominant, tagged []field
+		for _, f := range candidates {
+			if f.depth != depth {
+				continue
+			}
+			dominant = append(dominant, f)
+			if f.tagged {
+				tagged = append(tagged, f)
+			}
+		}
+
+		if len(dominant) > 1 {
+			if len(tagged) != 1 {
+				continue
+			}
+			dominant = tagged
+		}
+
+		if f := dominant[0]; f.quoted {
+			properties[name] = &schema{Type: "string"}
+		} else {
+			properties[name] = g.schema(f.typ)
+		}
+	}
+}
@@ -0,0 +1,194 @@
+package jsonrpc
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+type treeService struct{}
+
+type Node struct {
+	Name     string
+	Children []*Node `json:"children,omitempty"`
+}
+
+type Meta struct {
+	Created time.Time
+}
+
+type InsertRequest struct {
+	Meta
+	Root    *Node
+	Labels  map[string]int
+	Blob    []byte
+	ID      int64 `json:"id,string"`
+	Ignored int   `json:"-"`
+	private int
+}
+
+type InsertResponse struct {
+	Raw   json.RawMessage
+	Score float64 `json:"score"`
+	Tree  struct{ Depth int }
+}
+
+func (*treeService) Insert(ctx context.Context, req *InsertRequest) (*InsertResponse, error) {
+	return &InsertResponse{}, nil
+}
+
+func (*treeService) Ping(ctx context.Context, req *PingRequest) (*PingResponse, error) {
+	return &PingResponse{}, nil
+}
+
+const treeDocument = `{
+	"openrpc": "1.2.6",
+	"info": {"title": "treeService", "version": "0.0.0"},
+	"methods": [
+		{
+			"name": "Insert",
+			"paramStructure": "by-position",
+			"params": [{"name": "req", "required": true, "schema": {"$ref": "#/components/schemas/InsertRequest"}}],
+			"result": {"name": "rsp", "schema": {"$ref": "#/components/schemas/InsertResponse"}},
+			"errors": [{"code": -32602, "message": "invalid params"}, {"code": -32000, "message": "server error"}]
+		},
+		{
+			"name": "Ping",
+			"paramStructure": "by-position",
+			"params": [{"name": "req", "required": true, "schema": {"$ref": "#/components/schemas/PingRequest"}}],
+			"result": {"name": "rsp", "schema": {"$ref": "#/components/schemas/PingResponse"}},
+			"errors": [{"code": -32602, "message": "invalid params"}, {"code": -32000, "message": "server error"}]
+		}
+	],
+	"components": {
+		"schemas": {
+			"InsertRequest": {
+				"type": "object",
+				"properties": {
+					"Created": {"type": "string", "format": "date-time"},
+					"Root": {"$ref": "#/components/schemas/Node"},
+					"Labels": {"type": "object", "additionalProperties": {"type": "integer"}},
+					"Blob": {"type": "string", "contentEncoding": "base64"},
+					"id": {"type": "string"}
+				}
+			},
+			"InsertResponse": {
+				"type": "object",
+				"properties": {
+					"Raw": {},
+					"score": {"type": "number"},
+					"Tree": {"type": "object", "properties": {"Depth": {"type": "integer"}}}
+				}
+			},
+			"Node": {
+				"type": "object",
+				"properties": {
+					"Name": {"type": "string"},
+					"children": {"type": "array", "items": {"$ref": "#/components/schemas/Node"}}
+				}
+			},
+			"PingRequest": {"type": "object"},
+			"PingResponse": {"type": "object"}
+		}
+	}
+}`
+
+func TestSchema(t *testing.T) {
+	server := httptest.NewServer(MakeHandler(&treeService{}))
+	defer server.Close()
+
+	t.Run("Get", func(t *testing.T) {
+		rsp, err := http.Get(server.URL)
+		require.NoError(t, err)
+		defer rsp.Body.Close()
+
+		require.Equal(t, http.StatusOK, rsp.StatusCode)
+
+		var doc json.RawMessage
+		require.NoError(t, json.NewDecoder(rsp.Body).Decode(&doc))
+		require.JSONEq(t, treeDocument, string(doc))
+	})
+
+	t.Run("Discover", func(t *testing.T) {
+		var doc json.RawMessage
+		require.NoError(t, NewClient(server.URL).Call(context.Background(), "rpc.discover", nil, &doc))
+		require.JSONEq(t, treeDocument, string(doc))
+	})
+}
+
+type Chain struct {
+	*Chain
+	Value int
+}
+
+type chainService struct{}
+
+func (*chainService) Next(ctx context.Context, req *Chain) (*Chain, error) {
+	return req, nil
+}
+
+func TestSchema_recursiveEmbedding(t *testing.T) {
+	doc := newDocument("chainService", newService(&chainService{}))
+
+	data, err := json.Marshal(doc.Components.Schemas["Chain"])
+	require.NoError(t, err)
+	require.JSONEq(t, `{"type": "object", "properties": {"Value": {"type": "integer"}}}`, string(data))
+}
+
+type DomLeaf struct{ Common string }
+
+type DomDeep struct{ X string }
+
+type DomA struct {
+	X   int
+	Amb int
+	T   int
+	DomLeaf
+}
+
+type DomB struct {
+	DomDeep
+	Amb string
+	T   string `json:"T"`
+	DomLeaf
+}
+
+type DomOuter struct {
+	DomA
+	DomB
+	Own bool
+}
+
+type domService struct{}
+
+func (*domService) Get(ctx context.Context, req *DomOuter) (*DomOuter, error) {
+	return req, nil
+}
+
+func TestSchema_embeddedDominance(t *testing.T) {
+	doc := newDocument("domService", newService(&domService{}))
+
+	data, err := json.Marshal(doc.Components.Schemas["DomOuter"])
+	require.NoError(t, err)
+	require.JSONEq(t, `{"type": "object", "properties": {
+		"X": {"type": "integer"},
+		"T": {"type": "string"},
+		"Own": {"type": "boolean"}
+	}}`, string(data))
+
+	// Schema has the same properties, as encoding/json produces.
+	encoded, err := json.Marshal(DomOuter{})
+	require.NoError(t, err)
+
+	var fields map[string]any
+	require.NoError(t, json.Unmarshal(encoded, &fields))
+	for name := range fields {
+		require.Contains(t, doc.Components.Schemas["DomOuter"].Properties, name)
+	}
+	require.Len(t, doc.Components.Schemas["DomOuter"].Properties, len(fields))
+}
@@ -0,0 +1,165 @@
+//go:build !solution
+
+package jsonrpc
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"sync"
+)
+
+const version = "2.0"
+
+// maxBatchConcurrency limits the number of requests of one batch processed at the same time.
+const maxBatchConcurrency = 16
+
+type request struct {
+	JSONRPC string          `json:"jsonrpc"`
+	Method  string          `json:"method"`
+	Params  json.RawMessage `json:"params,omitempty"`
+	// ID is nil for notifications. Request with "id": null is not a notification.
+	ID json.RawMessage `json:"id,omitempty"`
+}
+
+type response struct {
+	JSONRPC string          `json:"jsonrpc"`
+	Result  json.RawMessage `json:"result,omitempty"`
+	Error   *Error          `json:"error,omitempty"`
+	ID      json.RawMessage `json:"id"`
+}
+
+var nullID = json.RawMessage("null")
+
+func errorResponse(id json.RawMessage, err *Error) *response {
+	if id == nil {
+		id = nullID
+	}
+	return &response{JSONRPC: version, Error: err, ID: id}
+}
+
+// serveJSONRPC handles JSON-RPC 2.0 request or batch. Requests of the batch are processed concurrently,
+// at most maxBatchConcurrency at a time.
+func (h *handler) serveJSONRPC(w http.ResponseWriter, ctx context.Context, body []byte) {
+	body = bytes.TrimSpace(body)
+	if !json.Valid(body) {
+		writeJSON(w, http.StatusOK, errorResponse(nil, newError(CodeParseError, "parse error")))
+		return
+	}
+
+	if len(body) == 0 || body[0] != '[' {
+		if rsp := h.handleRequest(ctx, body); rsp != nil {
+			writeJSON(w, http.StatusOK, rsp)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	var batch []json.RawMessage
+	if err := json.Unmarshal(body, &batch); err != nil || len(batch) == 0 {
+		writeJSON(w, http.StatusOK, errorResponse(nil, newError(CodeInvalidRequest, "invalid request: empty batch")))
+		return
+	}
+
+	responses := make([]*response, len(batch))
+	sem := make(chan struct{}, maxBatchConcurrency)
+	var wg sync.WaitGroup
+	for i, raw := range batch {
+		sem <- struct{}{}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer func() { <-sem }()
+			responses[i] = h.handleRequest(ctx, raw)
+		}()
+	}
+	wg.Wait()
+
+	var replies []*response
+	for _, rsp := range responses {
+		if rsp != nil {
+			replies = append(replies, rsp)
+		}
+	}
+
+	// Batch of notifications has no response at all.
+	if len(replies) == 0 {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	writeJSON(w, http.StatusOK, replies)
+}
+
+// handleRequest returns nil for notifications.
+func (h *handler) handleRequest(ctx context.Context, raw json.RawMessage) *response {
+	var req request
+	if err := json.Unmarshal(raw, &req); err != nil {
+		return errorResponse(nil, newError(CodeInvalidRequest, "invalid request: %v", err))
+	}
+
+	if req.JSONRPC != version || req.Method == "" || !validID(req.ID) {
+		return errorResponse(req.ID, newError(CodeInvalidRequest, "invalid request"))
+	}
+
+	rsp := h.call(ctx, &req)
+	if req.ID == nil {
+		return nil
+	}
+	return rsp
+}
+
+// validID checks that id is string, number or null, as required by the specification.
+func validID(id json.RawMessage) bool {
+	if id == nil {
+		return true
+	}
+
+	switch id[0] {
+	case '"', 'n', '-', '0', '1', '2', '3', '4', '5', '6', '7', '8', '9':
+		return true
+	default:
+		return false
+	}
+}
+
+func (h *handler) call(ctx context.Context, req *request) *response {
+	if req.Method == discoverMethod {
+		data, err := json.Marshal(h.doc)
+		if err != nil {
+			return errorResponse(req.ID, newError(CodeInternalError, "encode result: %v", err))
+		}
+		return &response{JSONRPC: version, Result: data, ID: req.ID}
+	}
+
+	m, ok := h.service.methods[req.Method]
+	if !ok {
+		return errorResponse(req.ID, newError(CodeMethodNotFound, "method %s not found", req.Method))
+	}
+
+	params := bytes.TrimSpace(req.Params)
+	if len(params) != 0 && params[0] == '[' {
+		// Positional params must contain the only argument of the method.
+		var positional []json.RawMessage
+		if err := json.Unmarshal(params, &positional); err != nil || len(positional) > 1 {
+			return errorResponse(req.ID, newError(CodeInvalidParams, "method %s takes one parameter", req.Method))
+		}
+
+		params = nil
+		if len(positional) == 1 {
+			params = positional[0]
+		}
+	}
+
+	result, rpcErr := m.call(ctx, params)
+	if rpcErr != nil {
+		return errorResponse(req.ID, rpcErr)
+	}
+
+	data, err := json.Marshal(result)
+	if err != nil {
+		return errorResponse(req.ID, newError(CodeInternalError, "encode result: %v", err))
+	}
+	return &response{JSONRPC: version, Result: data, ID: req.ID}
+}
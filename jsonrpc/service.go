@@ -0,0 +1,87 @@
+//go:build !solution
+
+package jsonrpc
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"reflect"
+)
+
+var (
+	contextType = reflect.TypeOf((*context.Context)(nil)).Elem()
+	errorType   = reflect.TypeOf((*error)(nil)).Elem()
+)
+
+// method is RPC method of the service, with signature
+//
+//	func(ctx context.Context, req *Request) (*Response, error)
+type method struct {
+	name string
+	fn   reflect.Value
+	// req and rsp are struct types, not pointers.
+	req reflect.Type
+	rsp reflect.Type
+}
+
+type service struct {
+	methods map[string]*method
+}
+
+// newService finds RPC methods of the service. Methods with other signatures are ignored.
+func newService(rcvr interface{}) *service {
+	s := &service{methods: make(map[string]*method)}
+
+	v := reflect.ValueOf(rcvr)
+	t := v.Type()
+	for i := range t.NumMethod() {
+		m := t.Method(i)
+		ft := m.Type
+
+		// Receiver is the first argument of the method.
+		if ft.NumIn() != 3 || ft.NumOut() != 2 ||
+			ft.In(1) != contextType ||
+			ft.In(2).Kind() != reflect.Pointer ||
+			ft.Out(0).Kind() != reflect.Pointer ||
+			ft.Out(1) != errorType {
+			continue
+		}
+
+		s.methods[m.Name] = &method{
+			name: m.Name,
+			fn:   v.Method(i),
+			req:  ft.In(2).Elem(),
+			rsp:  ft.Out(0).Elem(),
+		}
+	}
+	return s
+}
+
+// call decodes params and calls the method. Returned error is always *Error.
+//
+// Panic of the method is reported as CodeInternalError, so that it doesn't crash the server.
+func (m *method) call(ctx context.Context, params json.RawMessage) (result interface{}, rpcErr *Error) {
+	defer func() {
+		if r := recover(); r != nil {
+			result, rpcErr = nil, newError(CodeInternalError, "method %s panicked: %v", m.name, r)
+		}
+	}()
+
+	req := reflect.New(m.req)
+	if len(params) != 0 {
+		if err := json.Unmarshal(params, req.Interface()); err != nil {
+			return nil, newError(CodeInvalidParams, "invalid params of %s: %v", m.name, err)
+		}
+	}
+
+	out := m.fn.Call([]reflect.Value{reflect.ValueOf(ctx), req})
+	if err, _ := out[1].Interface().(error); err != nil {
+		var rpcErr *Error
+		if errors.As(err, &rpcErr) {
+			return nil, rpcErr
+		}
+		return nil, &Error{Code: CodeServerError, Message: err.Error()}
+	}
+	return out[0].Interface(), nil
+}
@@ -0,0 +1,27 @@
+//go:build !solution
+
+package lrucache
+
+// GenericCache is Cache with keys and values of arbitrary types.
+//
+// Cache is kept as is for int keys and values. ShardedCache[int, int] implements both interfaces.
+type GenericCache[K comparable, V any] interface {
+	// Get returns value associated with the key.
+	//
+	// The second value is a bool that is true if the key exists in the cache,
+	// and false if not.
+	Get(key K) (V, bool)
+	// Set updates value associated with the key.
+	//
+	// If there is no key in the cache new (key, value) pair is created.
+	Set(key K, value V)
+	// Range calls function f on all elements of the cache
+	// in increasing access time order.
+	//
+	// Caches with other eviction policies iterate in the order elements would be evicted.
+	//
+	// Stops earlier if f returns false.
+	Range(f func(key K, value V) bool)
+	// Clear removes all keys and values from the cache.
+	Clear()
+}
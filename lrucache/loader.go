@@ -0,0 +1,170 @@
+//go:build !solution
+
+package lrucache
+
+import (
+	"context"
+	"time"
+)
+
+// Loader returns the value of the key missing in the cache.
+type Loader[K comparable, V any] func(ctx context.Context, key K) (V, error)
+
+// flight is a running call of the loader, shared by all callers waiting for the key.
+type flight[V any] struct {
+	done   chan struct{}
+	cancel context.CancelFunc
+
+	// waiters is guarded by the shard lock.
+	waiters int
+	// background flights refresh entries that are still in the cache. Nobody waits for them,
+	// so they are canceled only by Close.
+	background bool
+
+	// value and err are set before done is closed.
+	value V
+	err   error
+}
+
+// failure is the cached error of the loader.
+type failure struct {
+	err     error
+	expires time.Time
+}
+
+// GetOrLoad returns the value of the key, calling loader when the key is missing or expired.
+//
+// Concurrent calls for the same key share one call of the loader. Loader runs in its own context,
+// which is canceled when all waiting callers are canceled, or when the cache is closed.
+// Canceled caller returns ctx.Err() immediately, without waiting for the loader.
+//
+// Loaded value is stored with the TTL of the cache. Error of the loader is returned to all waiting
+// callers and, if ErrorTTL is set, to the callers arriving during ErrorTTL after it.
+func (c *ShardedCache[K, V]) GetOrLoad(ctx context.Context, key K, loader Loader[K, V]) (V, error) {
+	s := c.shard(key)
+
+	s.mu.Lock()
+	now := c.now()
+
+	var expired []eviction[K, V]
+	if e, ok := s.entries[key]; ok {
+		if !e.expired(now) {
+			s.policy.Access(key)
+			if c.needsRefresh(e, now) && s.flights[key] == nil {
+				c.startLocked(s, key, loader, true)
+			}
+			value := e.value
+			s.mu.Unlock()
+
+			c.hits.Add(1)
+			return value, nil
+		}
+
+		expired = append(expired, s.removeLocked(key, EvictExpired))
+	}
+
+	var (
+		fl  *flight[V]
+		err error
+	)
+	if f, ok := s.failures[key]; ok && now.Before(f.expires) {
+		err = f.err
+	} else {
+		delete(s.failures, key)
+
+		fl = s.flights[key]
+		if fl == nil {
+			fl = c.startLocked(s, key, loader, false)
+		}
+		fl.waiters++
+	}
+	s.mu.Unlock()
+
+	c.misses.Add(1)
+	c.report(expired)
+
+	var zero V
+	if fl == nil {
+		return zero, err
+	}
+
+	select {
+	case <-fl.done:
+		return fl.value, fl.err
+
+	case <-ctx.Done():
+		s.mu.Lock()
+		fl.waiters--
+		if fl.waiters == 0 && !fl.background {
+			fl.cancel()
+			// Next caller starts a new flight instead of joining the canceled one.
+			if s.flights[key] == fl {
+				delete(s.flights, key)
+			}
+		}
+		s.mu.Unlock()
+
+		return zero, ctx.Err()
+	}
+}
+
+func (c *ShardedCache[K, V]) needsRefresh(e *entry[V], now time.Time) bool {
+	return c.refreshAhead > 0 && !e.expires.IsZero() && e.expires.Sub(now) <= c.refreshAhead
+}
+
+func (c *ShardedCache[K, V]) startLocked(s *shard[K, V], key K, loader Loader[K, V], background bool) *flight[V] {
+	ctx, cancel := context.WithCancel(c.ctx)
+	fl := &flight[V]{
+		done:       make(chan struct{}),
+		cancel:     cancel,
+		background: background,
+	}
+	s.flights[key] = fl
+
+	c.wg.Add(1)
+	go c.load(ctx, s, key, fl, loader)
+	return fl
+}
+
+func (c *ShardedCache[K, V]) load(ctx context.Context, s *shard[K, V], key K, fl *flight[V], loader Loader[K, V]) {
+	defer c.wg.Done()
+	defer fl.cancel()
+
+	c.loads.Add(1)
+	value, err := loader(ctx, key)
+	if err != nil {
+		c.loadErrors.Add(1)
+	}
+
+	var evicted []eviction[K, V]
+
+	s.mu.Lock()
+	// Result of the flight, that was abandoned by its callers, is dropped.
+	current := s.flights[key] == fl
+	if current {
+		delete(s.flights, key)
+	}
+
+	switch {
+	case !current:
+	case err == nil:
+		e := &entry[V]{value: value}
+		if c.ttl > 0 {
+			e.expires = c.now().Add(c.ttl)
+		}
+		evicted = s.setLocked(key, e)
+		delete(s.failures, key)
+
+	case fl.background:
+		// Failed refresh keeps the old value until it expires.
+
+	case c.errorTTL > 0 && ctx.Err() == nil:
+		s.failures[key] = &failure{err: err, expires: c.now().Add(c.errorTTL)}
+	}
+
+	fl.value, fl.err = value, err
+	s.mu.Unlock()
+
+	close(fl.done)
+	c.report(evicted)
+}
@@ -0,0 +1,225 @@
+package lrucache
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/goleak"
+)
+
+func TestGetOrLoad_Coalescing(t *testing.T) {
+	defer goleak.VerifyNone(t)
+
+	c := NewCache(Options[string, int]{Capacity: 10})
+	defer c.Close()
+
+	var calls atomic.Int32
+	release := make(chan struct{})
+	loader := func(ctx context.Context, key string) (int, error) {
+		calls.Add(1)
+		<-release
+		return len(key), nil
+	}
+
+	const N = 10
+	var wg sync.WaitGroup
+	for range N {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			v, err := c.GetOrLoad(context.Background(), "foo", loader)
+			assert.NoError(t, err)
+			assert.Equal(t, 3, v)
+		}()
+	}
+
+	require.Eventually(t, func() bool {
+		return c.Stats().Misses == N
+	}, time.Second, time.Millisecond)
+	close(release)
+	wg.Wait()
+
+	require.Equal(t, int32(1), calls.Load())
+
+	v, err := c.GetOrLoad(context.Background(), "foo", loader)
+	require.NoError(t, err)
+	require.Equal(t, 3, v)
+	require.Equal(t, Stats{Hits: 1, Misses: N, Loads: 1}, c.Stats())
+}
+
+func TestGetOrLoad_Cancel(t *testing.T) {
+	defer goleak.VerifyNone(t)
+
+	c := NewCache(Options[string, int]{Capacity: 10})
+	defer c.Close()
+
+	started := make(chan struct{})
+	canceled := make(chan struct{})
+	release := make(chan struct{})
+	loader := func(ctx context.Context, key string) (int, error) {
+		close(started)
+		select {
+		case <-ctx.Done():
+			close(canceled)
+			return 0, ctx.Err()
+		case <-release:
+			return 42, nil
+		}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	first := make(chan error, 1)
+	go func() {
+		_, err := c.GetOrLoad(ctx, "foo", loader)
+		first <- err
+	}()
+	<-started
+
+	second := make(chan int, 1)
+	go func() {
+		v, err := c.GetOrLoad(context.Background(), "foo", loader)
+		assert.NoError(t, err)
+		second <- v
+	}()
+	require.Eventually(t, func() bool {
+		return c.Stats().Misses == 2
+	}, time.Second, time.Millisecond)
+
+	cancel()
+	require.ErrorIs(t, <-first, context.Canceled)
+
+	select {
+	case <-canceled:
+		t.Fatal("loader is canceled while another caller is waiting")
+	default:
+	}
+
+	close(release)
+	require.Equal(t, 42, <-second)
+}
+
+func TestGetOrLoad_CancelAll(t *testing.T) {
+	defer goleak.VerifyNone(t)
+
+	c := NewCache(Options[string, int]{Capacity: 10})
+	defer c.Close()
+
+	canceled := make(chan struct{})
+	loader := func(ctx context.Context, key string) (int, error) {
+		<-ctx.Done()
+		close(canceled)
+		return 0, ctx.Err()
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	_, err := c.GetOrLoad(ctx, "foo", loader)
+	require.ErrorIs(t, err, context.DeadlineExceeded)
+	<-canceled
+
+	v, err := c.GetOrLoad(context.Background(), "foo", func(ctx context.Context, key string) (int, error) {
+		return 1, nil
+	})
+	require.NoError(t, err)
+	require.Equal(t, 1, v)
+}
+
+func TestGetOrLoad_NegativeCaching(t *testing.T) {
+	defer goleak.VerifyNone(t)
+
+	clock := &fakeClock{now: time.Unix(0, 0)}
+	c := NewCache(Options[string, int]{
+		Capacity: 10,
+		ErrorTTL: time.Second,
+		Now:      clock.Now,
+	})
+	defer c.Close()
+
+	errBackend := errors.New("backend is down")
+	var calls int
+	loader := func(ctx context.Context, key string) (int, error) {
+		calls++
+		if calls == 1 {
+			return 0, errBackend
+		}
+		return 42, nil
+	}
+
+	_, err := c.GetOrLoad(context.Background(), "foo", loader)
+	require.ErrorIs(t, err, errBackend)
+
+	_, err = c.GetOrLoad(context.Background(), "foo", loader)
+	require.ErrorIs(t, err, errBackend)
+	require.Equal(t, 1, calls)
+
+	clock.Advance(time.Second)
+
+	v, err := c.GetOrLoad(context.Background(), "foo", loader)
+	require.NoError(t, err)
+	require.Equal(t, 42, v)
+	require.Equal(t, Stats{Misses: 3, Loads: 2, LoadErrors: 1}, c.Stats())
+}
+
+func TestGetOrLoad_RefreshAhead(t *testing.T) {
+	defer goleak.VerifyNone(t)
+
+	clock := &fakeClock{now: time.Unix(0, 0)}
+	c := NewCache(Options[string, int]{
+		Capacity:     10,
+		TTL:          time.Minute,
+		RefreshAhead: 10 * time.Second,
+		Now:          clock.Now,
+	})
+	defer c.Close()
+
+	var version atomic.Int32
+	refreshed := make(chan struct{}, 1)
+	loader := func(ctx context.Context, key string) (int, error) {
+		v := version.Add(1)
+		if v == 3 {
+			return 0, errors.New("refresh failed")
+		}
+		if v > 1 {
+			refreshed <- struct{}{}
+		}
+		return int(v), nil
+	}
+
+	v, err := c.GetOrLoad(context.Background(), "foo", loader)
+	require.NoError(t, err)
+	require.Equal(t, 1, v)
+
+	clock.Advance(55 * time.Second)
+
+	v, err = c.GetOrLoad(context.Background(), "foo", loader)
+	require.NoError(t, err)
+	require.Equal(t, 1, v)
+
+	<-refreshed
+	require.Eventually(t, func() bool {
+		v, ok := c.Get("foo")
+		return ok && v == 2
+	}, time.Second, time.Millisecond)
+
+	clock.Advance(55 * time.Second)
+
+	v, err = c.GetOrLoad(context.Background(), "foo", loader)
+	require.NoError(t, err)
+	require.Equal(t, 2, v)
+
+	require.Eventually(t, func() bool {
+		return c.Stats().LoadErrors == 1
+	}, time.Second, time.Millisecond)
+
+	v, ok := c.Get("foo")
+	require.True(t, ok)
+	require.Equal(t, 2, v)
+}
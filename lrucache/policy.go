@@ -0,0 +1,560 @@
+//go:build !solution
+
+package lrucache
+
+import (
+	"container/heap"
+	"container/list"
+	"hash/maphash"
+	"math/bits"
+)
+
+// Policy decides which keys are evicted from the cache.
+//
+// Cache calls policy under its lock, so implementations need not be safe for concurrent use.
+type Policy[K comparable] interface {
+	// Insert records a key that is not in the cache yet.
+	//
+	// Insert calls evict for every key that must leave the cache to keep it within capacity.
+	// Policy may reject the new key, by calling evict for the key itself.
+	Insert(key K, evict func(K))
+	// Access records a hit of the key stored in the cache.
+	Access(key K)
+	// Remove forgets the key deleted from the cache for other reasons, e.g. expired.
+	Remove(key K)
+	// Range calls f on all keys in the order they would be evicted.
+	Range(f func(K) bool)
+	// Clear forgets all keys.
+	Clear()
+}
+
+// LRUPolicy evicts the least recently used key.
+func LRUPolicy[K comparable](capacity int) Policy[K] {
+	return &lruPolicy[K]{
+		capacity: capacity,
+		elems:    make(map[K]*list.Element, capacity),
+		order:    list.New(),
+	}
+}
+
+type lruPolicy[K comparable] struct {
+	capacity int
+	elems    map[K]*list.Element
+	// order holds keys from the least to the most recently used.
+	order *list.List
+}
+
+func (p *lruPolicy[K]) Insert(key K, evict func(K)) {
+	if p.capacity <= 0 {
+		evict(key)
+		return
+	}
+
+	if p.order.Len() >= p.capacity {
+		oldest := p.order.Remove(p.order.Front()).(K)
+		delete(p.elems, oldest)
+		evict(oldest)
+	}
+	p.elems[key] = p.order.PushBack(key)
+}
+
+func (p *lruPolicy[K]) Access(key K) {
+	if e, ok := p.elems[key]; ok {
+		p.order.MoveToBack(e)
+	}
+}
+
+func (p *lruPolicy[K]) Remove(key K) {
+	if e, ok := p.elems[key]; ok {
+		p.order.Remove(e)
+		delete(p.elems, key)
+	}
+}
+
+func (p *lruPolicy[K]) Range(f func(K) bool) {
+	for e := p.order.Front(); e != nil; e = e.Next() {
+		if !f(e.Value.(K)) {
+			return
+		}
+	}
+}
+
+func (p *lruPolicy[K]) Clear() {
+	p.elems = make(map[K]*list.Element, p.capacity)
+	p.order.Init()
+}
+
+// LFUPolicy evicts the least frequently used key. Among keys with equal number of hits,
+// the least recently used key is evicted.
+func LFUPolicy[K comparable](capacity int) Policy[K] {
+	return &lfuPolicy[K]{
+		capacity: capacity,
+		items:    make(map[K]*lfuItem[K], capacity),
+	}
+}
+
+type lfuItem[K comparable] struct {
+	key   K
+	hits  int
+	tick  uint64
+	index int
+}
+
+type lfuPolicy[K comparable] struct {
+	capacity int
+	tick     uint64
+	items    map[K]*lfuItem[K]
+	heap     lfuHeap[K]
+}
+
+func (p *lfuPolicy[K]) Insert(key K, evict func(K)) {
+	if p.capacity <= 0 {
+		evict(key)
+		return
+	}
+
+	if len(p.heap) >= p.capacity {
+		victim := heap.Pop(&p.heap).(*lfuItem[K])
+		delete(p.items, victim.key)
+		evict(victim.key)
+	}
+
+	p.tick++
+	item := &lfuItem[K]{key: key, tick: p.tick}
+	p.items[key] = item
+	heap.Push(&p.heap, item)
+}
+
+func (p *lfuPolicy[K]) Access(key K) {
+	item, ok := p.items[key]
+	if !ok {
+		return
+	}
+
+	p.tick++
+	item.hits++
+	item.tick = p.tick
+	heap.Fix(&p.heap, item.index)
+}
+
+func (p *lfuPolicy[K]) Remove(key K) {
+	if item, ok := p.items[key]; ok {
+		heap.Remove(&p.heap, item.index)
+		delete(p.items, key)
+	}
+}
+
+func (p *lfuPolicy[K]) Range(f func(K) bool) {
+	sorted := make(lfuHeap[K], len(p.heap))
+	copy(sorted, p.heap)
+
+	// Items are copied by pointer, so indexes are restored after iteration.
+	defer func() {
+		for i, item := range p.heap {
+			item.index = i
+		}
+	}()
+
+	for sorted.Len() != 0 {
+		if !f(heap.Pop(&sorted).(*lfuItem[K]).key) {
+			return
+		}
+	}
+}
+
+func (p *lfuPolicy[K]) Clear() {
+	p.items = make(map[K]*lfuItem[K], p.capacity)
+	p.heap = nil
+}
+
+type lfuHeap[K comparable] []*lfuItem[K]
+
+func (h lfuHeap[K]) Len() int { return len(h) }
+
+func (h lfuHeap[K]) Less(i, j int) bool {
+	if h[i].hits != h[j].hits {
+		return h[i].hits < h[j].hits
+	}
+	return h[i].tick < h[j].tick
+}
+
+func (h lfuHeap[K]) Swap(i, j int) {
+	h[i], h[j] = h[j], h[i]
+	h[i].index = i
+	h[j].index = j
+}
+
+func (h *lfuHeap[K]) Push(x any) {
+	item := x.(*lfuItem[K])
+	item.index = len(*h)
+	*h = append(*h, item)
+}
+
+func (h *lfuHeap[K]) Pop() any {
+	old := *h
+	n := len(old)
+	item := old[n-1]
+	old[n-1] = nil
+	*h = old[:n-1]
+	return item
+}
+
+// ARCPolicy implements Adaptive Replacement Cache.
+//
+// ARC keeps recently used keys (T1) apart from frequently used keys (T2), and remembers keys
+// recently evicted from both lists (B1 and B2). Hits in the ghost lists move the target size of T1,
+// so the cache adapts to the workload. Range iterates over T1 and then over T2.
+func ARCPolicy[K comparable](capacity int) Policy[K] {
+	return &arcPolicy[K]{
+		capacity: capacity,
+		t1:       list.New(),
+		t2:       list.New(),
+		b1:       list.New(),
+		b2:       list.New(),
+		where:    make(map[K]*list.Element),
+	}
+}
+
+type arcEntry[K comparable] struct {
+	key  K
+	list *list.List
+}
+
+type arcPolicy[K comparable] struct {
+	capacity int
+	// target is the adaptive target size of t1.
+	target int
+
+	t1, t2, b1, b2 *list.List
+	where          map[K]*list.Element
+}
+
+func (p *arcPolicy[K]) push(l *list.List, key K) {
+	p.where[key] = l.PushBack(&arcEntry[K]{key: key, list: l})
+}
+
+func (p *arcPolicy[K]) move(e *list.Element, to *list.List) {
+	entry := e.Value.(*arcEntry[K])
+	entry.list.Remove(e)
+	p.push(to, entry.key)
+}
+
+func (p *arcPolicy[K]) drop(e *list.Element) {
+	entry := e.Value.(*arcEntry[K])
+	entry.list.Remove(e)
+	delete(p.where, entry.key)
+}
+
+// replace evicts the LRU key of t1 or t2 into the corresponding ghost list.
+func (p *arcPolicy[K]) replace(inB2 bool, evict func(K)) {
+	if p.t1.Len()+p.t2.Len() < p.capacity {
+		return
+	}
+
+	if p.t1.Len() > 0 && (p.t1.Len() > p.target || inB2 && p.t1.Len() == p.target) {
+		e := p.t1.Front()
+		p.move(e, p.b1)
+		evict(e.Value.(*arcEntry[K]).key)
+	} else {
+		e := p.t2.Front()
+		p.move(e, p.b2)
+		evict(e.Value.(*arcEntry[K]).key)
+	}
+}
+
+func (p *arcPolicy[K]) Insert(key K, evict func(K)) {
+	if p.capacity <= 0 {
+		evict(key)
+		return
+	}
+
+	if e, ok := p.where[key]; ok {
+		switch e.Value.(*arcEntry[K]).list {
+		case p.b1:
+			p.target = min(p.capacity, p.target+max(p.b2.Len()/p.b1.Len(), 1))
+			p.replace(false, evict)
+			p.move(e, p.t2)
+			return
+
+		case p.b2:
+			p.target = max(0, p.target-max(p.b1.Len()/p.b2.Len(), 1))
+			p.replace(true, evict)
+			p.move(e, p.t2)
+			return
+		}
+	}
+
+	switch total := p.t1.Len() + p.t2.Len() + p.b1.Len() + p.b2.Len(); {
+	case p.t1.Len()+p.b1.Len() >= p.capacity:
+		if p.t1.Len() < p.capacity {
+			p.drop(p.b1.Front())
+			p.replace(false, evict)
+		} else {
+			e := p.t1.Front()
+			p.drop(e)
+			evict(e.Value.(*arcEntry[K]).key)
+		}
+
+	case total >= p.capacity:
+		if total >= 2*p.capacity {
+			p.drop(p.b2.Front())
+		}
+		p.replace(false, evict)
+	}
+
+	p.push(p.t1, key)
+}
+
+func (p *arcPolicy[K]) Access(key K) {
+	e, ok := p.where[key]
+	if !ok {
+		return
+	}
+
+	if l := e.Value.(*arcEntry[K]).list; l == p.t1 || l == p.t2 {
+		p.move(e, p.t2)
+	}
+}
+
+func (p *arcPolicy[K]) Remove(key K) {
+	e, ok := p.where[key]
+	if !ok {
+		return
+	}
+
+	if l := e.Value.(*arcEntry[K]).list; l == p.t1 || l == p.t2 {
+		p.drop(e)
+	}
+}
+
+func (p *arcPolicy[K]) Range(f func(K) bool) {
+	for _, l := range []*list.List{p.t1, p.t2} {
+		for e := l.Front(); e != nil; e = e.Next() {
+			if !f(e.Value.(*arcEntry[K]).key) {
+				return
+			}
+		}
+	}
+}
+
+func (p *arcPolicy[K]) Clear() {
+	p.target = 0
+	p.where = make(map[K]*list.Element)
+	for _, l := range []*list.List{p.t1, p.t2, p.b1, p.b2} {
+		l.Init()
+	}
+}
+
+// TinyLFUPolicy implements W-TinyLFU.
+//
+// New keys enter a small LRU window. Key leaving the window is admitted to the main cache only if
+// it was used more often than the key the main cache would evict. Frequencies are estimated by
+// a count-min sketch, which is halved periodically, so that old hits are forgotten. The main cache is
+// a segmented LRU: keys hit in the probation segment move to the protected one.
+// Range iterates over probation, window and protected segments.
+func TinyLFUPolicy[K comparable](capacity int) Policy[K] {
+	window := max(capacity/100, 1)
+	main := max(capacity-window, 0)
+
+	return &tinyLFUPolicy[K]{
+		capacity:     capacity,
+		windowCap:    window,
+		protectedCap: main * 4 / 5,
+		window:       list.New(),
+		probation:    list.New(),
+		protected:    list.New(),
+		where:        make(map[K]*list.Element),
+		sketch:       newCountMinSketch[K](capacity),
+	}
+}
+
+type tinyLFUEntry[K comparable] struct {
+	key  K
+	list *list.List
+}
+
+type tinyLFUPolicy[K comparable] struct {
+	capacity     int
+	windowCap    int
+	protectedCap int
+
+	window, probation, protected *list.List
+	where                        map[K]*list.Element
+
+	sketch *countMinSketch[K]
+}
+
+func (p *tinyLFUPolicy[K]) push(l *list.List, key K) {
+	p.where[key] = l.PushBack(&tinyLFUEntry[K]{key: key, list: l})
+}
+
+func (p *tinyLFUPolicy[K]) move(e *list.Element, to *list.List) {
+	entry := e.Value.(*tinyLFUEntry[K])
+	entry.list.Remove(e)
+	p.push(to, entry.key)
+}
+
+func (p *tinyLFUPolicy[K]) drop(e *list.Element) K {
+	entry := e.Value.(*tinyLFUEntry[K])
+	entry.list.Remove(e)
+	delete(p.where, entry.key)
+	return entry.key
+}
+
+func (p *tinyLFUPolicy[K]) Insert(key K, evict func(K)) {
+	if p.capacity <= 0 {
+		evict(key)
+		return
+	}
+
+	p.sketch.increment(key)
+	p.push(p.window, key)
+	if p.window.Len() <= p.windowCap {
+		return
+	}
+
+	candidate := p.window.Front()
+	if p.probation.Len()+p.protected.Len() < p.capacity-p.windowCap {
+		p.move(candidate, p.probation)
+		return
+	}
+
+	victim := p.probation.Front()
+	if victim == nil {
+		victim = p.protected.Front()
+	}
+	if victim == nil {
+		evict(p.drop(candidate))
+		return
+	}
+
+	if p.sketch.estimate(candidate.Value.(*tinyLFUEntry[K]).key) > p.sketch.estimate(victim.Value.(*tinyLFUEntry[K]).key) {
+		evict(p.drop(victim))
+		p.move(candidate, p.probation)
+	} else {
+		evict(p.drop(candidate))
+	}
+}
+
+func (p *tinyLFUPolicy[K]) Access(key K) {
+	e, ok := p.where[key]
+	if !ok {
+		return
+	}
+
+	p.sketch.increment(key)
+	switch e.Value.(*tinyLFUEntry[K]).list {
+	case p.window:
+		p.window.MoveToBack(e)
+
+	case p.probation:
+		p.move(e, p.protected)
+		if p.protected.Len() > p.protectedCap {
+			p.move(p.protected.Front(), p.probation)
+		}
+
+	case p.protected:
+		p.protected.MoveToBack(e)
+	}
+}
+
+func (p *tinyLFUPolicy[K]) Remove(key K) {
+	if e, ok := p.where[key]; ok {
+		p.drop(e)
+	}
+}
+
+func (p *tinyLFUPolicy[K]) Range(f func(K) bool) {
+	for _, l := range []*list.List{p.probation, p.window, p.protected} {
+		for e := l.Front(); e != nil; e = e.Next() {
+			if !f(e.Value.(*tinyLFUEntry[K]).key) {
+				return
+			}
+		}
+	}
+}
+
+func (p *tinyLFUPolicy[K]) Clear() {
+	p.where = make(map[K]*list.Element)
+	for _, l := range []*list.List{p.window, p.probation, p.protected} {
+		l.Init()
+	}
+	p.sketch.clear()
+}
+
+const (
+	sketchDepth      = 4
+	sketchMaxCounter = 15
+)
+
+// countMinSketch estimates frequencies of the keys.
+//
+// Counters are halved after the number of increments reaches sampleSize.
+type countMinSketch[K comparable] struct {
+	seed     maphash.Seed
+	mask     uint64
+	counters [sketchDepth][]uint8
+
+	increments int
+	sampleSize int
+}
+
+func newCountMinSketch[K comparable](capacity int) *countMinSketch[K] {
+	width := uint64(1) << bits.Len64(uint64(max(2*capacity, 256))-1)
+
+	s := &countMinSketch[K]{
+		seed:       maphash.MakeSeed(),
+		mask:       width - 1,
+		sampleSize: 10 * max(capacity, 1),
+	}
+	for i := range s.counters {
+		s.counters[i] = make([]uint8, width)
+	}
+	return s
+}
+
+// index returns position of the key in the i-th row, using double hashing.
+func (s *countMinSketch[K]) index(h uint64, i int) uint64 {
+	return (h + uint64(i)*(h>>32|1)) & s.mask
+}
+
+func (s *countMinSketch[K]) increment(key K) {
+	h := maphash.Comparable(s.seed, key)
+	for i := range s.counters {
+		if c := &s.counters[i][s.index(h, i)]; *c < sketchMaxCounter {
+			*c++
+		}
+	}
+
+	s.increments++
+	if s.increments >= s.sampleSize {
+		s.reset()
+	}
+}
+
+func (s *countMinSketch[K]) estimate(key K) uint8 {
+	h := maphash.Comparable(s.seed, key)
+
+	estimate := uint8(sketchMaxCounter)
+	for i := range s.counters {
+		estimate = min(estimate, s.counters[i][s.index(h, i)])
+	}
+	return estimate
+}
+
+// reset halves all counters, so that frequencies of the old keys decay.
+func (s *countMinSketch[K]) reset() {
+	for i := range s.counters {
+		for j := range s.counters[i] {
+			s.counters[i][j] /= 2
+		}
+	}
+	s.increments /= 2
+}
+
+func (s *countMinSketch[K]) clear() {
+	for i := range s.counters {
+		clear(s.counters[i])
+	}
+	s.increments = 0
+}
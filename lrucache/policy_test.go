@@ -0,0 +1,151 @@
+package lrucache
+
+import (
+	"math/rand"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+var policies = map[string]func(capacity int) Policy[int]{
+	"LRU":     LRUPolicy[int],
+	"LFU":     LFUPolicy[int],
+	"ARC":     ARCPolicy[int],
+	"TinyLFU": TinyLFUPolicy[int],
+}
+
+func keys(c GenericCache[int, int]) []int {
+	var keys []int
+	c.Range(func(key, value int) bool {
+		keys = append(keys, key)
+		return true
+	})
+	return keys
+}
+
+func TestPolicy_consistency(t *testing.T) {
+	for name, policy := range policies {
+		t.Run(name, func(t *testing.T) {
+			const capacity = 32
+			c := NewCache(Options[int, int]{Capacity: capacity, Policy: policy})
+
+			r := rand.New(rand.NewSource(0))
+			values := map[int]int{}
+			for i := 0; i < 10000; i++ {
+				key := r.Intn(100)
+				if r.Intn(2) == 0 {
+					c.Set(key, i)
+					values[key] = i
+				} else if v, ok := c.Get(key); ok {
+					require.Equal(t, values[key], v, "key %d", key)
+				}
+
+				require.LessOrEqual(t, c.Len(), capacity)
+			}
+
+			require.Len(t, keys(c), c.Len())
+		})
+	}
+}
+
+func TestPolicy_zeroCapacity(t *testing.T) {
+	for name, policy := range policies {
+		t.Run(name, func(t *testing.T) {
+			c := NewCache(Options[int, int]{Policy: policy})
+
+			c.Set(1, 1)
+			_, ok := c.Get(1)
+			require.False(t, ok)
+		})
+	}
+}
+
+func TestLFUPolicy(t *testing.T) {
+	c := NewCache(Options[int, int]{Capacity: 3, Policy: LFUPolicy[int]})
+
+	for i := 0; i < 3; i++ {
+		c.Set(i, i)
+	}
+
+	c.Get(0)
+	c.Get(0)
+	c.Get(2)
+
+	c.Set(3, 3)
+	require.Equal(t, []int{3, 2, 0}, keys(c))
+}
+
+func TestARCPolicy_scanResistance(t *testing.T) {
+	for name, expectHot := range map[string]bool{"LRU": false, "ARC": true, "TinyLFU": true} {
+		t.Run(name, func(t *testing.T) {
+			c := NewCache(Options[int, int]{Capacity: 8, Policy: policies[name]})
+
+			for _, hot := range []int{-1, -2} {
+				c.Set(hot, hot)
+				for i := 0; i < 3; i++ {
+					c.Get(hot)
+				}
+			}
+
+			for i := 0; i < 100; i++ {
+				c.Set(i, i)
+			}
+
+			for _, hot := range []int{-1, -2} {
+				_, ok := c.Get(hot)
+				require.Equal(t, expectHot, ok, strconv.Itoa(hot))
+			}
+		})
+	}
+}
+
+func TestARCPolicy_ghostHit(t *testing.T) {
+	p := ARCPolicy[int](2).(*arcPolicy[int])
+
+	var evicted []int
+	evict := func(key int) { evicted = append(evicted, key) }
+
+	p.Insert(1, evict)
+	p.Access(1)
+	p.Insert(2, evict)
+	p.Insert(3, evict)
+	require.Equal(t, []int{2}, evicted)
+
+	// Key 2 is remembered in B1, so its return grows the target size of T1.
+	p.Insert(2, evict)
+	require.Equal(t, []int{2, 1}, evicted)
+	require.Equal(t, 1, p.target)
+	require.Equal(t, 1, p.t2.Len())
+}
+
+func TestTinyLFUPolicy_admission(t *testing.T) {
+	p := TinyLFUPolicy[int](4)
+
+	var evicted []int
+	evict := func(key int) { evicted = append(evicted, key) }
+
+	for i := 1; i <= 4; i++ {
+		p.Insert(i, evict)
+	}
+	require.Empty(t, evicted)
+
+	// Key 4 leaves the window, but it is used no more often than key 1 from the main cache.
+	p.Insert(5, evict)
+	require.Equal(t, []int{4}, evicted)
+
+	for i := 0; i < 3; i++ {
+		p.Access(5)
+	}
+
+	// Frequently used key 5 replaces key 1.
+	p.Insert(6, evict)
+	require.Equal(t, []int{4, 1}, evicted)
+
+	var keys []int
+	p.Range(func(key int) bool {
+		keys = append(keys, key)
+		return true
+	})
+	require.Equal(t, []int{2, 3, 5, 6}, keys)
+}
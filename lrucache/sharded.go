@@ -0,0 +1,394 @@
+//go:build !solution
+
+package lrucache
+
+import (
+	"context"
+	"hash/maphash"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// EvictReason tells why the entry left the cache.
+type EvictReason int
+
+const (
+	// EvictCapacity means the entry was evicted by the policy to make room for another one.
+	EvictCapacity EvictReason = iota
+	// EvictExpired means TTL of the entry passed.
+	EvictExpired
+	// EvictDeleted means the entry was removed by Delete.
+	EvictDeleted
+)
+
+func (r EvictReason) String() string {
+	switch r {
+	case EvictCapacity:
+		return "capacity"
+	case EvictExpired:
+		return "expired"
+	case EvictDeleted:
+		return "deleted"
+	default:
+		return "unknown"
+	}
+}
+
+type Options[K comparable, V any] struct {
+	// Capacity is the total number of entries in all shards.
+	Capacity int
+	// Shards is the number of independently locked parts of the cache. Zero means 1.
+	//
+	// Every shard has its own policy, so with several shards eviction order is only approximate.
+	Shards int
+	// Policy creates eviction policy of a shard. Nil means LRUPolicy.
+	Policy func(capacity int) Policy[K]
+
+	// TTL is the lifetime of the entries added by Set. Zero means entries never expire.
+	TTL time.Duration
+	// CleanupInterval enables background removal of the expired entries. Otherwise expired
+	// entries are removed lazily, when they are accessed.
+	CleanupInterval time.Duration
+
+	// ErrorTTL is how long errors of the loader passed to GetOrLoad are cached. Zero disables
+	// negative caching.
+	ErrorTTL time.Duration
+	// RefreshAhead enables asynchronous refresh of the entries loaded by GetOrLoad. Entry accessed
+	// less than RefreshAhead before its expiration is reloaded in background, while the old value
+	// is still returned.
+	RefreshAhead time.Duration
+
+	// OnEvict is called after the entry left the cache, outside of the cache lock.
+	// Entries replaced by Set and removed by Clear are not reported.
+	OnEvict func(key K, value V, reason EvictReason)
+
+	// Now returns current time. Nil means time.Now.
+	Now func() time.Time
+}
+
+// Stats holds counters of the cache.
+type Stats struct {
+	Hits        uint64
+	Misses      uint64
+	Evictions   uint64
+	Expirations uint64
+
+	// Loads counts calls of the loaders passed to GetOrLoad, including refreshes. LoadErrors counts
+	// failed calls among them.
+	Loads      uint64
+	LoadErrors uint64
+}
+
+// ShardedCache is a generic cache, safe for concurrent use.
+type ShardedCache[K comparable, V any] struct {
+	shards       []*shard[K, V]
+	seed         maphash.Seed
+	ttl          time.Duration
+	errorTTL     time.Duration
+	refreshAhead time.Duration
+	now          func() time.Time
+	onEvict      func(key K, value V, reason EvictReason)
+
+	hits        atomic.Uint64
+	misses      atomic.Uint64
+	evictions   atomic.Uint64
+	expirations atomic.Uint64
+	loads       atomic.Uint64
+	loadErrors  atomic.Uint64
+
+	// ctx is canceled by Close. Background cleanup and loaders are running inside this context.
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+var _ GenericCache[string, any] = (*ShardedCache[string, any])(nil)
+
+type shard[K comparable, V any] struct {
+	mu      sync.Mutex
+	entries map[K]*entry[V]
+	policy  Policy[K]
+
+	// flights holds running loads, failures holds cached errors of the loaders.
+	flights  map[K]*flight[V]
+	failures map[K]*failure
+}
+
+type entry[V any] struct {
+	value V
+	// expires is zero for entries without TTL.
+	expires time.Time
+}
+
+func (e *entry[V]) expired(now time.Time) bool {
+	return !e.expires.IsZero() && !now.Before(e.expires)
+}
+
+// eviction is collected under the shard lock and reported after it is released.
+type eviction[K comparable, V any] struct {
+	key    K
+	value  V
+	reason EvictReason
+}
+
+// NewCache creates cache. If CleanupInterval is set, cache must be stopped with Close.
+func NewCache[K comparable, V any](opts Options[K, V]) *ShardedCache[K, V] {
+	n := max(opts.Shards, 1)
+	newPolicy := opts.Policy
+	if newPolicy == nil {
+		newPolicy = LRUPolicy[K]
+	}
+
+	c := &ShardedCache[K, V]{
+		shards:       make([]*shard[K, V], n),
+		seed:         maphash.MakeSeed(),
+		ttl:          opts.TTL,
+		errorTTL:     opts.ErrorTTL,
+		refreshAhead: opts.RefreshAhead,
+		now:          opts.Now,
+		onEvict:      opts.OnEvict,
+	}
+	c.ctx, c.cancel = context.WithCancel(context.Background())
+	if c.now == nil {
+		c.now = time.Now
+	}
+
+	for i := range c.shards {
+		capacity := max(opts.Capacity, 0) / n
+		if i < max(opts.Capacity, 0)%n {
+			capacity++
+		}
+
+		c.shards[i] = &shard[K, V]{
+			entries:  make(map[K]*entry[V], capacity),
+			policy:   newPolicy(capacity),
+			flights:  make(map[K]*flight[V]),
+			failures: make(map[K]*failure),
+		}
+	}
+
+	if opts.CleanupInterval > 0 {
+		c.wg.Add(1)
+		go c.cleanup(opts.CleanupInterval)
+	}
+	return c
+}
+
+func (c *ShardedCache[K, V]) cleanup(interval time.Duration) {
+	defer c.wg.Done()
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			c.DeleteExpired()
+		case <-c.ctx.Done():
+			return
+		}
+	}
+}
+
+// Close stops background cleanup, cancels loaders started by GetOrLoad and waits for them to exit.
+// GetOrLoad must not be called after Close.
+func (c *ShardedCache[K, V]) Close() {
+	c.cancel()
+	c.wg.Wait()
+}
+
+func (c *ShardedCache[K, V]) shard(key K) *shard[K, V] {
+	if len(c.shards) == 1 {
+		return c.shards[0]
+	}
+	return c.shards[maphash.Comparable(c.seed, key)%uint64(len(c.shards))]
+}
+
+func (c *ShardedCache[K, V]) report(evicted []eviction[K, V]) {
+	for _, e := range evicted {
+		switch e.reason {
+		case EvictCapacity:
+			c.evictions.Add(1)
+		case EvictExpired:
+			c.expirations.Add(1)
+		}
+
+		if c.onEvict != nil {
+			c.onEvict(e.key, e.value, e.reason)
+		}
+	}
+}
+
+// removeLocked deletes the entry from the shard and from its policy.
+func (s *shard[K, V]) removeLocked(key K, reason EvictReason) eviction[K, V] {
+	e := s.entries[key]
+	delete(s.entries, key)
+	s.policy.Remove(key)
+	return eviction[K, V]{key: key, value: e.value, reason: reason}
+}
+
+func (c *ShardedCache[K, V]) Get(key K) (V, bool) {
+	s := c.shard(key)
+
+	s.mu.Lock()
+	e, ok := s.entries[key]
+	switch {
+	case !ok:
+		s.mu.Unlock()
+
+	case e.expired(c.now()):
+		expired := s.removeLocked(key, EvictExpired)
+		s.mu.Unlock()
+		c.report([]eviction[K, V]{expired})
+
+	default:
+		s.policy.Access(key)
+		value := e.value
+		s.mu.Unlock()
+
+		c.hits.Add(1)
+		return value, true
+	}
+
+	c.misses.Add(1)
+	var zero V
+	return zero, false
+}
+
+func (c *ShardedCache[K, V]) Set(key K, value V) {
+	c.SetWithTTL(key, value, c.ttl)
+}
+
+// SetWithTTL adds the entry, which expires after ttl. Zero ttl means the entry never expires.
+func (c *ShardedCache[K, V]) SetWithTTL(key K, value V, ttl time.Duration) {
+	e := &entry[V]{value: value}
+	if ttl > 0 {
+		e.expires = c.now().Add(ttl)
+	}
+
+	s := c.shard(key)
+	s.mu.Lock()
+	evicted := s.setLocked(key, e)
+	s.mu.Unlock()
+
+	c.report(evicted)
+}
+
+func (s *shard[K, V]) setLocked(key K, e *entry[V]) []eviction[K, V] {
+	if _, ok := s.entries[key]; ok {
+		s.entries[key] = e
+		s.policy.Access(key)
+		return nil
+	}
+
+	var evicted []eviction[K, V]
+	s.entries[key] = e
+	s.policy.Insert(key, func(victim K) {
+		ev := s.entries[victim]
+		delete(s.entries, victim)
+		evicted = append(evicted, eviction[K, V]{key: victim, value: ev.value, reason: EvictCapacity})
+	})
+	return evicted
+}
+
+// Delete removes the entry and reports whether it was present.
+func (c *ShardedCache[K, V]) Delete(key K) bool {
+	s := c.shard(key)
+
+	s.mu.Lock()
+	if _, ok := s.entries[key]; !ok {
+		s.mu.Unlock()
+		return false
+	}
+	deleted := s.removeLocked(key, EvictDeleted)
+	s.mu.Unlock()
+
+	c.report([]eviction[K, V]{deleted})
+	return true
+}
+
+// DeleteExpired removes all expired entries. It is called periodically, when CleanupInterval is set.
+func (c *ShardedCache[K, V]) DeleteExpired() {
+	for _, s := range c.shards {
+		var expired []eviction[K, V]
+
+		s.mu.Lock()
+		now := c.now()
+		for key, e := range s.entries {
+			if e.expired(now) {
+				expired = append(expired, s.removeLocked(key, EvictExpired))
+			}
+		}
+		for key, f := range s.failures {
+			if !now.Before(f.expires) {
+				delete(s.failures, key)
+			}
+		}
+		s.mu.Unlock()
+
+		c.report(expired)
+	}
+}
+
+// Range iterates over every shard in the eviction order of its policy. Expired entries are skipped.
+//
+// f is called outside of the cache lock, so it may access the cache.
+func (c *ShardedCache[K, V]) Range(f func(key K, value V) bool) {
+	type item struct {
+		key   K
+		value V
+	}
+
+	for _, s := range c.shards {
+		var items []item
+
+		s.mu.Lock()
+		now := c.now()
+		s.policy.Range(func(key K) bool {
+			if e := s.entries[key]; !e.expired(now) {
+				items = append(items, item{key: key, value: e.value})
+			}
+			return true
+		})
+		s.mu.Unlock()
+
+		for _, it := range items {
+			if !f(it.key, it.value) {
+				return
+			}
+		}
+	}
+}
+
+func (c *ShardedCache[K, V]) Clear() {
+	for _, s := range c.shards {
+		s.mu.Lock()
+		s.entries = make(map[K]*entry[V], len(s.entries))
+		s.failures = make(map[K]*failure)
+		s.policy.Clear()
+		s.mu.Unlock()
+	}
+}
+
+// Len returns the number of entries, including expired entries that are not removed yet.
+func (c *ShardedCache[K, V]) Len() int {
+	n := 0
+	for _, s := range c.shards {
+		s.mu.Lock()
+		n += len(s.entries)
+		s.mu.Unlock()
+	}
+	return n
+}
+
+func (c *ShardedCache[K, V]) Stats() Stats {
+	return Stats{
+		Hits:        c.hits.Load(),
+		Misses:      c.misses.Load(),
+		Evictions:   c.evictions.Load(),
+		Expirations: c.expirations.Load(),
+		Loads:       c.loads.Load(),
+		LoadErrors:  c.loadErrors.Load(),
+	}
+}
@@ -0,0 +1,147 @@
+package lrucache
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/goleak"
+)
+
+type fakeClock struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *fakeClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+}
+
+type evicted struct {
+	key    string
+	value  int
+	reason EvictReason
+}
+
+func TestShardedCache_TTL(t *testing.T) {
+	clock := &fakeClock{now: time.Unix(0, 0)}
+
+	var events []evicted
+	c := NewCache(Options[string, int]{
+		Capacity: 10,
+		TTL:      time.Minute,
+		Now:      clock.Now,
+		OnEvict: func(key string, value int, reason EvictReason) {
+			events = append(events, evicted{key, value, reason})
+		},
+	})
+
+	c.Set("a", 1)
+	c.SetWithTTL("b", 2, time.Hour)
+	c.SetWithTTL("c", 3, 0)
+
+	clock.Advance(time.Minute)
+
+	_, ok := c.Get("a")
+	require.False(t, ok)
+	require.Equal(t, []evicted{{"a", 1, EvictExpired}}, events)
+
+	v, ok := c.Get("b")
+	require.True(t, ok)
+	require.Equal(t, 2, v)
+
+	clock.Advance(time.Hour)
+	c.DeleteExpired()
+	require.Equal(t, 1, c.Len())
+	require.Equal(t, evicted{"b", 2, EvictExpired}, events[1])
+
+	v, ok = c.Get("c")
+	require.True(t, ok)
+	require.Equal(t, 3, v)
+
+	require.Equal(t, Stats{Hits: 2, Misses: 1, Expirations: 2}, c.Stats())
+}
+
+func TestShardedCache_BackgroundCleanup(t *testing.T) {
+	defer goleak.VerifyNone(t)
+
+	clock := &fakeClock{now: time.Unix(0, 0)}
+	c := NewCache(Options[string, int]{
+		Capacity:        10,
+		TTL:             time.Minute,
+		CleanupInterval: time.Millisecond,
+		Now:             clock.Now,
+	})
+	defer c.Close()
+
+	c.Set("a", 1)
+	clock.Advance(time.Minute)
+
+	require.Eventually(t, func() bool {
+		return c.Len() == 0
+	}, time.Second, time.Millisecond)
+}
+
+func TestShardedCache_Evictions(t *testing.T) {
+	var events []evicted
+	c := NewCache(Options[string, int]{
+		Capacity: 2,
+		OnEvict: func(key string, value int, reason EvictReason) {
+			events = append(events, evicted{key, value, reason})
+		},
+	})
+
+	c.Set("a", 1)
+	c.Set("b", 2)
+	c.Set("a", 3)
+	c.Set("c", 4)
+	require.True(t, c.Delete("a"))
+	require.False(t, c.Delete("a"))
+
+	require.Equal(t, []evicted{{"b", 2, EvictCapacity}, {"a", 3, EvictDeleted}}, events)
+	require.Equal(t, Stats{Evictions: 1}, c.Stats())
+}
+
+func TestShardedCache_Concurrent(t *testing.T) {
+	const (
+		capacity = 100
+		shards   = 8
+	)
+
+	for name, policy := range policies {
+		t.Run(name, func(t *testing.T) {
+			c := NewCache(Options[int, int]{Capacity: capacity, Shards: shards, Policy: policy})
+
+			var wg sync.WaitGroup
+			for g := 0; g < 8; g++ {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+
+					for i := 0; i < 1000; i++ {
+						key := (g*1000 + i) % 300
+						c.Set(key, key)
+						if v, ok := c.Get(key); ok {
+							assert.Equal(t, key, v)
+						}
+					}
+				}()
+			}
+			wg.Wait()
+
+			require.LessOrEqual(t, c.Len(), capacity)
+			stats := c.Stats()
+			require.Equal(t, uint64(8000), stats.Hits+stats.Misses)
+		})
+	}
+}
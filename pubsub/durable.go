@@ -0,0 +1,356 @@
+//go:build !solution
+
+package pubsub
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+var (
+	ErrNotDurable = errors.New("subject is not durable")
+	// ErrNotBytes is returned by Publish, when message published to the durable subject is neither
+	// []byte nor json.RawMessage.
+	ErrNotBytes = errors.New("message of durable subject must be []byte")
+)
+
+const (
+	DefaultAckWait     = 30 * time.Second
+	DefaultMaxInFlight = 1024
+)
+
+// Message is delivered to durable subscriptions.
+type Message struct {
+	Subject string
+	Offset  int64
+	Time    time.Time
+	Data    []byte
+
+	sub *DurableSubscription
+}
+
+// Ack confirms that the message is processed. Unacknowledged message is delivered again after AckWait.
+//
+// If the subscription has DurableSubscribeOptions.Consumer, offset before the oldest unacknowledged
+// message is saved next to the log.
+func (m *Message) Ack() {
+	m.sub.ack(m.Offset)
+}
+
+type DurableHandler func(msg *Message)
+
+// StartPosition selects the first message of the durable subscription. Zero value starts from
+// the oldest message kept in the log.
+type StartPosition struct {
+	offset int64
+	time   time.Time
+	latest bool
+}
+
+// StartAtOffset starts from the message with the given offset. If it was removed by retention,
+// subscription starts from the oldest kept message.
+func StartAtOffset(offset int64) StartPosition {
+	return StartPosition{offset: offset}
+}
+
+// StartAtTime starts from the first message published not before t.
+func StartAtTime(t time.Time) StartPosition {
+	return StartPosition{time: t}
+}
+
+// StartLatest starts from the next published message.
+func StartLatest() StartPosition {
+	return StartPosition{latest: true}
+}
+
+type DurableSubscribeOptions struct {
+	Start StartPosition
+	// AckWait is the time after which unacknowledged message is delivered again. Zero means DefaultAckWait.
+	AckWait time.Duration
+	// MaxInFlight limits the number of delivered, but not acknowledged messages. Zero means DefaultMaxInFlight.
+	MaxInFlight int
+
+	// Consumer names the reader of the subject, that resumes after restart. Acknowledged offset of
+	// the consumer is saved in the log directory. If the consumer has saved offset, subscription starts
+	// from the first message, that was not acknowledged, and Start is ignored.
+	//
+	// Consumer must be a valid file name. Empty Consumer keeps acknowledgements in memory only.
+	Consumer string
+}
+
+// Persist makes the subject durable. Messages published to it are appended to the log in opts.Dir,
+// and can be replayed by SubscribeDurable. Log that already exists in opts.Dir is reopened.
+func (p *MyPubSub) Persist(subj string, opts LogOptions) error {
+	if _, err := parseSubject(subj, false); err != nil {
+		return err
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.closed {
+		return ErrClosed
+	}
+	if _, ok := p.logs[subj]; ok {
+		return fmt.Errorf("subject %q is already durable", subj)
+	}
+
+	log, err := openLog(opts)
+	if err != nil {
+		return fmt.Errorf("open log of %q: %w", subj, err)
+	}
+	p.logs[subj] = log
+	return nil
+}
+
+var _ Subscription = (*DurableSubscription)(nil)
+
+// DurableSubscription reads messages of the durable subject from its log.
+type DurableSubscription struct {
+	ps   *MyPubSub
+	subj string
+	log  *subjectLog
+	cb   DurableHandler
+	opts DurableSubscribeOptions
+
+	stopOnce sync.Once
+	stop     chan struct{}
+	// acked wakes up the delivery goroutine waiting for room in the in-flight window.
+	acked chan struct{}
+
+	mu       sync.Mutex
+	inflight map[int64]*inflightMsg
+	// next is the offset of the next message read from the log.
+	next int64
+	err  error
+
+	// commitMu orders saving of the consumer offset.
+	commitMu  sync.Mutex
+	committed int64
+}
+
+type inflightMsg struct {
+	msg      *Message
+	deadline time.Time
+}
+
+// SubscribeDurable subscribes to the durable subject. Handler is called from one goroutine,
+// redelivered messages may come out of order.
+//
+// Without opts.Consumer, acknowledgements are not persisted: subscriber that restarts must track
+// offsets itself and pass them in opts.Start.
+func (p *MyPubSub) SubscribeDurable(subj string, cb DurableHandler, opts DurableSubscribeOptions) (*DurableSubscription, error) {
+	if opts.Consumer != "" && (filepath.Base(opts.Consumer) != opts.Consumer || !filepath.IsLocal(opts.Consumer)) {
+		return nil, fmt.Errorf("invalid consumer name %q", opts.Consumer)
+	}
+	if opts.AckWait <= 0 {
+		opts.AckWait = DefaultAckWait
+	}
+	if opts.MaxInFlight <= 0 {
+		opts.MaxInFlight = DefaultMaxInFlight
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.closed {
+		return nil, ErrClosed
+	}
+
+	log, ok := p.logs[subj]
+	if !ok {
+		return nil, fmt.Errorf("%w: %q", ErrNotDurable, subj)
+	}
+
+	s := &DurableSubscription{
+		ps:       p,
+		subj:     subj,
+		log:      log,
+		cb:       cb,
+		opts:     opts,
+		stop:     make(chan struct{}),
+		acked:    make(chan struct{}, 1),
+		inflight: make(map[int64]*inflightMsg),
+	}
+
+	var start int64
+	switch {
+	case opts.Start.latest:
+		_, start = log.bounds()
+	case !opts.Start.time.IsZero():
+		start = log.offsetAt(opts.Start.time)
+	default:
+		start = opts.Start.offset
+	}
+
+	if opts.Consumer != "" {
+		committed, ok, err := log.loadConsumer(opts.Consumer)
+		if err != nil {
+			return nil, fmt.Errorf("load consumer %q: %w", opts.Consumer, err)
+		}
+		if ok {
+			start = committed
+		}
+	}
+	s.next, s.committed = start, start
+
+	p.durables[s] = struct{}{}
+	p.wg.Add(1)
+	go s.run(start)
+	return s, nil
+}
+
+// Unsubscribe stops the delivery. Running handler is not waited for.
+func (s *DurableSubscription) Unsubscribe() {
+	s.ps.mu.Lock()
+	delete(s.ps.durables, s)
+	s.ps.mu.Unlock()
+
+	s.close()
+}
+
+func (s *DurableSubscription) close() {
+	s.stopOnce.Do(func() {
+		close(s.stop)
+	})
+}
+
+// Err returns error reading the log, that stopped the subscription, or error saving the consumer offset.
+func (s *DurableSubscription) Err() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.err
+}
+
+func (s *DurableSubscription) ack(offset int64) {
+	s.mu.Lock()
+	delete(s.inflight, offset)
+	committed := s.next
+	for offset := range s.inflight {
+		committed = min(committed, offset)
+	}
+	s.mu.Unlock()
+
+	if s.opts.Consumer != "" {
+		s.commit(committed)
+	}
+
+	select {
+	case s.acked <- struct{}{}:
+	default:
+	}
+}
+
+// commit saves offset of the consumer, if it moved forward.
+func (s *DurableSubscription) commit(offset int64) {
+	s.commitMu.Lock()
+	defer s.commitMu.Unlock()
+
+	if offset <= s.committed {
+		return
+	}
+
+	if err := s.log.saveConsumer(s.opts.Consumer, offset); err != nil {
+		s.mu.Lock()
+		s.err = fmt.Errorf("save consumer %q: %w", s.opts.Consumer, err)
+		s.mu.Unlock()
+		return
+	}
+	s.committed = offset
+}
+
+// expired returns messages to redeliver, the earliest deadline of the remaining ones
+// and whether there is room for a new message.
+func (s *DurableSubscription) expired(now time.Time) (redeliver []*Message, deadline time.Time, room bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, m := range s.inflight {
+		if !now.Before(m.deadline) {
+			redeliver = append(redeliver, m.msg)
+			m.deadline = now.Add(s.opts.AckWait)
+		}
+
+		if deadline.IsZero() || m.deadline.Before(deadline) {
+			deadline = m.deadline
+		}
+	}
+	return redeliver, deadline, len(s.inflight) < s.opts.MaxInFlight
+}
+
+func (s *DurableSubscription) deliver(msg *Message) bool {
+	select {
+	case <-s.stop:
+		return false
+	default:
+	}
+
+	s.cb(msg)
+	return true
+}
+
+func (s *DurableSubscription) run(next int64) {
+	defer s.ps.wg.Done()
+
+	timer := time.NewTimer(time.Hour)
+	timer.Stop()
+	defer timer.Stop()
+
+	for {
+		changed := s.log.changed()
+
+		redeliver, deadline, room := s.expired(time.Now())
+		for _, msg := range redeliver {
+			if !s.deliver(msg) {
+				return
+			}
+		}
+
+		if room {
+			rec, ok, err := s.log.read(next)
+			if err != nil {
+				s.mu.Lock()
+				s.err = err
+				s.mu.Unlock()
+				return
+			}
+
+			if ok {
+				next = rec.offset + 1
+
+				msg := &Message{Subject: s.subj, Offset: rec.offset, Time: rec.time, Data: rec.data, sub: s}
+				s.mu.Lock()
+				s.inflight[msg.Offset] = &inflightMsg{msg: msg, deadline: time.Now().Add(s.opts.AckWait)}
+				s.next = next
+				s.mu.Unlock()
+
+				if !s.deliver(msg) {
+					return
+				}
+				continue
+			}
+		} else {
+			// Append is ignored until some message is acknowledged.
+			changed = nil
+		}
+
+		var timeout <-chan time.Time
+		if !deadline.IsZero() {
+			timer.Reset(time.Until(deadline))
+			timeout = timer.C
+		}
+
+		select {
+		case <-changed:
+		case <-s.acked:
+		case <-timeout:
+		case <-s.stop:
+			return
+		}
+		timer.Stop()
+	}
+}
@@ -0,0 +1,347 @@
+package pubsub
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// collector records messages of the durable subscription.
+type collector struct {
+	mu   sync.Mutex
+	msgs []string
+	// ack is called before the message is recorded. Nil means every message is acknowledged.
+	ack func(msg *Message) bool
+}
+
+func (c *collector) handle(msg *Message) {
+	if c.ack == nil || c.ack(msg) {
+		msg.Ack()
+	}
+	c.add(string(msg.Data))
+}
+
+func (c *collector) add(msg string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.msgs = append(c.msgs, msg)
+}
+
+func (c *collector) received() []string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([]string(nil), c.msgs...)
+}
+
+func (c *collector) wait(t *testing.T, expected ...string) {
+	t.Helper()
+
+	require.Eventually(t, func() bool {
+		return len(c.received()) >= len(expected)
+	}, 5*time.Second, time.Millisecond)
+	require.Equal(t, expected, c.received())
+}
+
+func publishN(t *testing.T, p *MyPubSub, subj string, from, to int) {
+	for i := from; i < to; i++ {
+		require.NoError(t, p.Publish(subj, []byte(fmt.Sprint(i))))
+	}
+}
+
+func TestDurable_replay(t *testing.T) {
+	dir := t.TempDir()
+
+	p := New()
+	require.NoError(t, p.Persist("audit", LogOptions{Dir: dir}))
+	require.Error(t, p.Persist("audit", LogOptions{Dir: dir}))
+	require.Error(t, p.Persist("audit.*", LogOptions{Dir: t.TempDir()}))
+
+	var live collector
+	_, err := p.Subscribe("audit", func(msg interface{}) {
+		live.add(string(msg.([]byte)))
+	})
+	require.NoError(t, err)
+
+	publishN(t, p, "audit", 0, 5)
+	require.ErrorIs(t, p.Publish("audit", "not bytes"), ErrNotBytes)
+	live.wait(t, "0", "1", "2", "3", "4")
+
+	_, err = p.SubscribeDurable("other", func(*Message) {}, DurableSubscribeOptions{})
+	require.ErrorIs(t, err, ErrNotDurable)
+
+	var all collector
+	_, err = p.SubscribeDurable("audit", all.handle, DurableSubscribeOptions{})
+	require.NoError(t, err)
+	all.wait(t, "0", "1", "2", "3", "4")
+
+	publishN(t, p, "audit", 5, 6)
+	all.wait(t, "0", "1", "2", "3", "4", "5")
+	checkedClose(t, p)
+
+	// Subscriber restarts and continues from the offset it remembered.
+	p = New()
+	defer checkedClose(t, p)
+	require.NoError(t, p.Persist("audit", LogOptions{Dir: dir}))
+
+	var fromOffset, latest collector
+	_, err = p.SubscribeDurable("audit", fromOffset.handle, DurableSubscribeOptions{Start: StartAtOffset(4)})
+	require.NoError(t, err)
+	_, err = p.SubscribeDurable("audit", latest.handle, DurableSubscribeOptions{Start: StartLatest()})
+	require.NoError(t, err)
+
+	fromOffset.wait(t, "4", "5")
+
+	publishN(t, p, "audit", 6, 7)
+	fromOffset.wait(t, "4", "5", "6")
+	latest.wait(t, "6")
+}
+
+func TestDurable_startAtTime(t *testing.T) {
+	p := New()
+	defer checkedClose(t, p)
+	require.NoError(t, p.Persist("audit", LogOptions{Dir: t.TempDir()}))
+
+	publishN(t, p, "audit", 0, 3)
+	time.Sleep(10 * time.Millisecond)
+	start := time.Now()
+	publishN(t, p, "audit", 3, 5)
+
+	var c collector
+	_, err := p.SubscribeDurable("audit", c.handle, DurableSubscribeOptions{Start: StartAtTime(start)})
+	require.NoError(t, err)
+	c.wait(t, "3", "4")
+}
+
+func TestDurable_redelivery(t *testing.T) {
+	p := New()
+	defer checkedClose(t, p)
+	require.NoError(t, p.Persist("audit", LogOptions{Dir: t.TempDir()}))
+
+	var (
+		mu   sync.Mutex
+		seen = map[string]int{}
+	)
+	c := collector{ack: func(msg *Message) bool {
+		mu.Lock()
+		defer mu.Unlock()
+
+		// Message "1" is acknowledged only on the second delivery.
+		seen[string(msg.Data)]++
+		return string(msg.Data) != "1" || seen["1"] > 1
+	}}
+
+	_, err := p.SubscribeDurable("audit", c.handle, DurableSubscribeOptions{AckWait: 50 * time.Millisecond})
+	require.NoError(t, err)
+
+	publishN(t, p, "audit", 0, 3)
+	c.wait(t, "0", "1", "2", "1")
+
+	time.Sleep(100 * time.Millisecond)
+	require.Len(t, c.received(), 4)
+}
+
+func TestDurable_maxInFlight(t *testing.T) {
+	p := New()
+	defer checkedClose(t, p)
+	require.NoError(t, p.Persist("audit", LogOptions{Dir: t.TempDir()}))
+
+	delivered := make(chan *Message, 10)
+	_, err := p.SubscribeDurable("audit", func(msg *Message) {
+		delivered <- msg
+	}, DurableSubscribeOptions{MaxInFlight: 1})
+	require.NoError(t, err)
+
+	publishN(t, p, "audit", 0, 2)
+
+	first := <-delivered
+	select {
+	case <-delivered:
+		t.Fatal("message delivered before previous one is acknowledged")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	first.Ack()
+	require.Equal(t, "1", string((<-delivered).Data))
+}
+
+func segmentFiles(t *testing.T, dir string) []string {
+	files, err := filepath.Glob(filepath.Join(dir, "*.log"))
+	require.NoError(t, err)
+	return files
+}
+
+func TestDurable_retention(t *testing.T) {
+	t.Run("Size", func(t *testing.T) {
+		dir := t.TempDir()
+
+		p := New()
+		defer checkedClose(t, p)
+		require.NoError(t, p.Persist("audit", LogOptions{
+			Dir:         dir,
+			SegmentSize: 2 * (recordHeaderSize + 1),
+			MaxBytes:    4 * (recordHeaderSize + 1),
+		}))
+
+		publishN(t, p, "audit", 0, 10)
+		require.Len(t, segmentFiles(t, dir), 2)
+
+		// Removed messages are skipped.
+		var c collector
+		_, err := p.SubscribeDurable("audit", c.handle, DurableSubscribeOptions{})
+		require.NoError(t, err)
+		c.wait(t, "6", "7", "8", "9")
+	})
+
+	t.Run("Age", func(t *testing.T) {
+		dir := t.TempDir()
+
+		p := New()
+		defer checkedClose(t, p)
+		require.NoError(t, p.Persist("audit", LogOptions{
+			Dir:         dir,
+			SegmentSize: recordHeaderSize + 1,
+			MaxAge:      50 * time.Millisecond,
+		}))
+
+		publishN(t, p, "audit", 0, 3)
+		require.Len(t, segmentFiles(t, dir), 3)
+
+		time.Sleep(100 * time.Millisecond)
+		publishN(t, p, "audit", 3, 4)
+		require.Len(t, segmentFiles(t, dir), 1)
+	})
+}
+
+func TestDurable_syncAlways(t *testing.T) {
+	dir := t.TempDir()
+	opts := LogOptions{Dir: dir, SegmentSize: recordHeaderSize + 1, Sync: SyncAlways}
+
+	p := New()
+	require.NoError(t, p.Persist("audit", opts))
+	publishN(t, p, "audit", 0, 3)
+	checkedClose(t, p)
+	require.Len(t, segmentFiles(t, dir), 3)
+
+	p = New()
+	defer checkedClose(t, p)
+	require.NoError(t, p.Persist("audit", opts))
+
+	var c collector
+	_, err := p.SubscribeDurable("audit", c.handle, DurableSubscribeOptions{})
+	require.NoError(t, err)
+	c.wait(t, "0", "1", "2")
+}
+
+func TestDurable_corruptedTail(t *testing.T) {
+	dir := t.TempDir()
+
+	p := New()
+	require.NoError(t, p.Persist("audit", LogOptions{Dir: dir}))
+	publishN(t, p, "audit", 0, 3)
+	checkedClose(t, p)
+
+	files := segmentFiles(t, dir)
+	require.Len(t, files, 1)
+
+	// Crash in the middle of the write leaves incomplete record.
+	f, err := os.OpenFile(files[0], os.O_APPEND|os.O_WRONLY, 0666)
+	require.NoError(t, err)
+	_, err = f.Write([]byte{3, 0, 0, 0})
+	require.NoError(t, err)
+	require.NoError(t, f.Close())
+
+	p = New()
+	defer checkedClose(t, p)
+	require.NoError(t, p.Persist("audit", LogOptions{Dir: dir}))
+	publishN(t, p, "audit", 3, 4)
+
+	var c collector
+	_, err = p.SubscribeDurable("audit", c.handle, DurableSubscribeOptions{})
+	require.NoError(t, err)
+	c.wait(t, "0", "1", "2", "3")
+}
+
+func TestDurable_corruptedLength(t *testing.T) {
+	dir := t.TempDir()
+
+	p := New()
+	require.NoError(t, p.Persist("audit", LogOptions{Dir: dir}))
+	publishN(t, p, "audit", 0, 2)
+	checkedClose(t, p)
+
+	files := segmentFiles(t, dir)
+	require.Len(t, files, 1)
+
+	// Length of the second record points far beyond the end of the file.
+	f, err := os.OpenFile(files[0], os.O_WRONLY, 0666)
+	require.NoError(t, err)
+	_, err = f.WriteAt([]byte{0xff, 0xff, 0xff, 0xff}, recordHeaderSize+1+16)
+	require.NoError(t, err)
+	require.NoError(t, f.Close())
+
+	p = New()
+	defer checkedClose(t, p)
+	require.NoError(t, p.Persist("audit", LogOptions{Dir: dir}))
+	publishN(t, p, "audit", 1, 2)
+
+	var c collector
+	_, err = p.SubscribeDurable("audit", c.handle, DurableSubscribeOptions{})
+	require.NoError(t, err)
+	c.wait(t, "0", "1")
+}
+
+func TestDurable_closeStopsSubscriptions(t *testing.T) {
+	p := New()
+	require.NoError(t, p.Persist("audit", LogOptions{Dir: t.TempDir()}))
+
+	s, err := p.SubscribeDurable("audit", func(*Message) {}, DurableSubscribeOptions{})
+	require.NoError(t, err)
+	s.Unsubscribe()
+
+	_, err = p.SubscribeDurable("audit", func(*Message) {}, DurableSubscribeOptions{})
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	require.NoError(t, p.Close(ctx))
+}
+
+func TestDurable_consumerOffset(t *testing.T) {
+	dir := t.TempDir()
+
+	p := New()
+	require.NoError(t, p.Persist("audit", LogOptions{Dir: dir}))
+
+	_, err := p.SubscribeDurable("audit", func(*Message) {}, DurableSubscribeOptions{Consumer: "../escape"})
+	require.Error(t, err)
+
+	// Message "2" is never acknowledged, so the consumer has to see it again after restart.
+	c := collector{ack: func(msg *Message) bool { return string(msg.Data) != "2" }}
+	s, err := p.SubscribeDurable("audit", c.handle, DurableSubscribeOptions{Consumer: "indexer"})
+	require.NoError(t, err)
+
+	publishN(t, p, "audit", 0, 4)
+	c.wait(t, "0", "1", "2", "3")
+	require.NoError(t, s.Err())
+	checkedClose(t, p)
+
+	p = New()
+	defer checkedClose(t, p)
+	require.NoError(t, p.Persist("audit", LogOptions{Dir: dir}))
+	publishN(t, p, "audit", 4, 5)
+
+	var resumed, other collector
+	_, err = p.SubscribeDurable("audit", resumed.handle, DurableSubscribeOptions{Consumer: "indexer", Start: StartLatest()})
+	require.NoError(t, err)
+	_, err = p.SubscribeDurable("audit", other.handle, DurableSubscribeOptions{Consumer: "other", Start: StartAtOffset(3)})
+	require.NoError(t, err)
+
+	resumed.wait(t, "2", "3", "4")
+	other.wait(t, "3", "4")
+}
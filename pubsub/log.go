@@ -0,0 +1,437 @@
+//go:build !solution
+
+package pubsub
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultSegmentSize is the size of the log segment, when LogOptions.SegmentSize is not set.
+const DefaultSegmentSize = 64 << 20
+
+// Record is stored as offset, unix time in nanoseconds, data length, crc32 of data and data itself.
+const recordHeaderSize = 8 + 8 + 4 + 4
+
+const (
+	segmentExt  = ".log"
+	consumerExt = ".consumer"
+)
+
+var errCorrupted = errors.New("corrupted record")
+
+// SyncPolicy defines when appended messages are flushed to disk.
+type SyncPolicy int
+
+const (
+	// SyncNever leaves flushing to the OS. Published messages survive crash of the process,
+	// but the last ones may be lost on crash of the machine. This is the default.
+	SyncNever SyncPolicy = iota
+	// SyncAlways calls fsync before Publish returns. Publish becomes much slower.
+	SyncAlways
+)
+
+type LogOptions struct {
+	// Dir holds segment files of the subject log. Every durable subject needs its own directory.
+	Dir string
+	// SegmentSize is the size, after which new segment file is started.
+	SegmentSize int64
+
+	// Oldest segments are removed, when total size of the log exceeds MaxBytes, or when their last
+	// message is older than MaxAge. Zero disables the limit. Retention is applied on Publish,
+	// and never removes the segment that is being written.
+	MaxBytes int64
+	MaxAge   time.Duration
+
+	// Sync defines when messages are flushed to disk. Default is SyncNever.
+	Sync SyncPolicy
+}
+
+type record struct {
+	offset int64
+	time   time.Time
+	data   []byte
+}
+
+type segment struct {
+	base  int64
+	f     *os.File
+	size  int64
+	index []indexEntry
+}
+
+// indexEntry describes one record of the segment.
+type indexEntry struct {
+	pos  int64
+	time int64
+}
+
+func (s *segment) lastTime() time.Time {
+	return time.Unix(0, s.index[len(s.index)-1].time)
+}
+
+// subjectLog is append-only log of the messages of one subject, split into segment files.
+//
+// Offsets of the messages are sequential. Segment file is named by the offset of its first message.
+type subjectLog struct {
+	opts LogOptions
+
+	mu       sync.Mutex
+	segments []*segment
+	next     int64
+	size     int64
+	// notify is closed and replaced on every append.
+	notify chan struct{}
+	closed bool
+}
+
+func openLog(opts LogOptions) (*subjectLog, error) {
+	if opts.SegmentSize <= 0 {
+		opts.SegmentSize = DefaultSegmentSize
+	}
+
+	if err := os.MkdirAll(opts.Dir, 0777); err != nil {
+		return nil, err
+	}
+
+	files, err := os.ReadDir(opts.Dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var bases []int64
+	for _, file := range files {
+		name, ok := strings.CutSuffix(file.Name(), segmentExt)
+		if !ok {
+			continue
+		}
+
+		base, err := strconv.ParseInt(name, 10, 64)
+		if err != nil {
+			continue
+		}
+		bases = append(bases, base)
+	}
+	slices.Sort(bases)
+
+	l := &subjectLog{opts: opts, notify: make(chan struct{})}
+	for _, base := range bases {
+		s, err := l.openSegment(base)
+		if err != nil {
+			l.close()
+			return nil, err
+		}
+
+		l.segments = append(l.segments, s)
+		l.size += s.size
+		l.next = base + int64(len(s.index))
+	}
+
+	if len(l.segments) == 0 {
+		if err := l.rollLocked(); err != nil {
+			return nil, err
+		}
+	}
+	return l, nil
+}
+
+func (l *subjectLog) segmentPath(base int64) string {
+	return filepath.Join(l.opts.Dir, fmt.Sprintf("%020d%s", base, segmentExt))
+}
+
+// openSegment reads index of the segment. Incomplete or corrupted tail, left by the crash, is truncated.
+func (l *subjectLog) openSegment(base int64) (*segment, error) {
+	f, err := os.OpenFile(l.segmentPath(base), os.O_RDWR, 0666)
+	if err != nil {
+		return nil, err
+	}
+
+	info, err := f.Stat()
+	if err != nil {
+		_ = f.Close()
+		return nil, err
+	}
+
+	s := &segment{base: base, f: f}
+	r := bufio.NewReader(f)
+	for {
+		rec, n, err := readRecord(r, info.Size()-s.size)
+		if err != nil || rec.offset != base+int64(len(s.index)) {
+			break
+		}
+
+		s.index = append(s.index, indexEntry{pos: s.size, time: rec.time.UnixNano()})
+		s.size += n
+	}
+
+	if err := f.Truncate(s.size); err != nil {
+		_ = f.Close()
+		return nil, err
+	}
+	return s, nil
+}
+
+// readRecord reads the record from r, which has at most limit bytes left.
+//
+// Length of the data is checked against limit before the data is allocated, so that corrupted
+// header doesn't cause huge allocation.
+func readRecord(r io.Reader, limit int64) (record, int64, error) {
+	var header [recordHeaderSize]byte
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		return record{}, 0, err
+	}
+
+	size := int64(binary.LittleEndian.Uint32(header[16:]))
+	if size > limit-recordHeaderSize {
+		return record{}, 0, errCorrupted
+	}
+
+	rec := record{
+		offset: int64(binary.LittleEndian.Uint64(header[0:])),
+		time:   time.Unix(0, int64(binary.LittleEndian.Uint64(header[8:]))),
+		data:   make([]byte, size),
+	}
+	if _, err := io.ReadFull(r, rec.data); err != nil {
+		return record{}, 0, err
+	}
+
+	if crc32.ChecksumIEEE(rec.data) != binary.LittleEndian.Uint32(header[20:]) {
+		return record{}, 0, errCorrupted
+	}
+	return rec, int64(recordHeaderSize + len(rec.data)), nil
+}
+
+// rollLocked starts new segment.
+func (l *subjectLog) rollLocked() error {
+	f, err := os.OpenFile(l.segmentPath(l.next), os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0666)
+	if err != nil {
+		return err
+	}
+
+	if l.opts.Sync == SyncAlways {
+		if err := syncDir(l.opts.Dir); err != nil {
+			_ = f.Close()
+			return err
+		}
+	}
+
+	l.segments = append(l.segments, &segment{base: l.next, f: f})
+	return nil
+}
+
+// consumerPath returns the file holding committed offset of the consumer.
+func (l *subjectLog) consumerPath(name string) string {
+	return filepath.Join(l.opts.Dir, name+consumerExt)
+}
+
+// loadConsumer returns committed offset of the consumer. ok is false, if the consumer never committed.
+func (l *subjectLog) loadConsumer(name string) (offset int64, ok bool, err error) {
+	content, err := os.ReadFile(l.consumerPath(name))
+	if errors.Is(err, os.ErrNotExist) {
+		return 0, false, nil
+	} else if err != nil {
+		return 0, false, err
+	}
+
+	offset, err = strconv.ParseInt(strings.TrimSpace(string(content)), 10, 64)
+	if err != nil {
+		return 0, false, fmt.Errorf("invalid offset of consumer %q: %w", name, err)
+	}
+	return offset, true, nil
+}
+
+// saveConsumer replaces committed offset of the consumer. File is replaced by rename, so crash
+// leaves either the old or the new offset.
+func (l *subjectLog) saveConsumer(name string, offset int64) error {
+	f, err := os.CreateTemp(l.opts.Dir, name+consumerExt+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer func() { _ = os.Remove(f.Name()) }()
+
+	_, err = f.WriteString(strconv.FormatInt(offset, 10))
+	if err == nil && l.opts.Sync == SyncAlways {
+		err = f.Sync()
+	}
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+
+	if err := os.Rename(f.Name(), l.consumerPath(name)); err != nil {
+		return err
+	}
+
+	if l.opts.Sync == SyncAlways {
+		return syncDir(l.opts.Dir)
+	}
+	return nil
+}
+
+// syncDir flushes directory entries, so that the new segment file is not lost on crash of the machine.
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = d.Close() }()
+
+	return d.Sync()
+}
+
+// append writes the message to the log. It returns ErrClosed, if the log is closed concurrently.
+func (l *subjectLog) append(data []byte, now time.Time) (int64, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.closed {
+		return 0, ErrClosed
+	}
+
+	size := int64(recordHeaderSize + len(data))
+	if s := l.segments[len(l.segments)-1]; s.size != 0 && s.size+size > l.opts.SegmentSize {
+		if err := l.rollLocked(); err != nil {
+			return 0, err
+		}
+	}
+
+	buf := make([]byte, size)
+	binary.LittleEndian.PutUint64(buf[0:], uint64(l.next))
+	binary.LittleEndian.PutUint64(buf[8:], uint64(now.UnixNano()))
+	binary.LittleEndian.PutUint32(buf[16:], uint32(len(data)))
+	binary.LittleEndian.PutUint32(buf[20:], crc32.ChecksumIEEE(data))
+	copy(buf[recordHeaderSize:], data)
+
+	s := l.segments[len(l.segments)-1]
+	if _, err := s.f.WriteAt(buf, s.size); err != nil {
+		return 0, err
+	}
+	if l.opts.Sync == SyncAlways {
+		if err := s.f.Sync(); err != nil {
+			return 0, err
+		}
+	}
+
+	s.index = append(s.index, indexEntry{pos: s.size, time: now.UnixNano()})
+	s.size += size
+	l.size += size
+
+	offset := l.next
+	l.next++
+
+	l.retainLocked(now)
+
+	close(l.notify)
+	l.notify = make(chan struct{})
+	return offset, nil
+}
+
+func (l *subjectLog) retainLocked(now time.Time) {
+	for len(l.segments) > 1 {
+		first := l.segments[0]
+
+		empty := len(first.index) == 0
+		tooBig := l.opts.MaxBytes > 0 && l.size > l.opts.MaxBytes
+		tooOld := l.opts.MaxAge > 0 && !empty && now.Sub(first.lastTime()) > l.opts.MaxAge
+		if !empty && !tooBig && !tooOld {
+			return
+		}
+
+		_ = first.f.Close()
+		_ = os.Remove(first.f.Name())
+
+		l.size -= first.size
+		l.segments = l.segments[1:]
+	}
+}
+
+// changed returns channel, that is closed on the next append.
+func (l *subjectLog) changed() <-chan struct{} {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	return l.notify
+}
+
+// read returns the first available message starting from offset. Messages removed by retention
+// are skipped. If there are no such messages yet, ok is false.
+func (l *subjectLog) read(offset int64) (rec record, ok bool, err error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if offset >= l.next {
+		return record{}, false, nil
+	}
+	offset = max(offset, l.segments[0].base)
+
+	i := sort.Search(len(l.segments), func(i int) bool {
+		return l.segments[i].base > offset
+	}) - 1
+
+	// Segment may end before the next one starts, if its corrupted tail was truncated.
+	s := l.segments[i]
+	for offset-s.base >= int64(len(s.index)) {
+		if i++; i == len(l.segments) {
+			return record{}, false, nil
+		}
+		s = l.segments[i]
+		offset = s.base
+	}
+	pos := s.index[offset-s.base].pos
+
+	rec, _, err = readRecord(io.NewSectionReader(s.f, pos, s.size-pos), s.size-pos)
+	if err != nil {
+		return record{}, false, fmt.Errorf("read offset %d: %w", offset, err)
+	}
+	return rec, true, nil
+}
+
+// offsetAt returns offset of the first message published not before t.
+func (l *subjectLog) offsetAt(t time.Time) int64 {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	for _, s := range l.segments {
+		if len(s.index) == 0 || s.lastTime().Before(t) {
+			continue
+		}
+
+		i := sort.Search(len(s.index), func(i int) bool {
+			return s.index[i].time >= t.UnixNano()
+		})
+		return s.base + int64(i)
+	}
+	return l.next
+}
+
+// bounds returns offset of the first available message and offset of the next message.
+func (l *subjectLog) bounds() (first, next int64) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	return l.segments[0].base, l.next
+}
+
+func (l *subjectLog) close() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.closed = true
+	for _, s := range l.segments {
+		_ = s.f.Close()
+	}
+}
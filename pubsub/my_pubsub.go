@@ -2,32 +2,239 @@
 
 package pubsub
 
-import "context"
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
 
-var _ Subscription = (*MySubscription)(nil)
+var (
+	ErrClosed         = errors.New("pubsub is closed")
+	ErrInvalidSubject = errors.New("invalid subject")
+	// ErrSlowConsumer is returned by MySubscription.Err, when subscription with Disconnect
+	// overflow policy was removed.
+	ErrSlowConsumer = errors.New("slow consumer")
+)
 
-type MySubscription struct{}
+// DefaultBuffer is the number of pending messages of the subscription, when SubscribeOptions.Buffer is not set.
+const DefaultBuffer = 1 << 16
 
-func (s *MySubscription) Unsubscribe() {
-	panic("implement me")
+// Overflow defines what happens, when message is published to the subscription with full buffer.
+type Overflow int
+
+const (
+	// DropNewest drops the published message.
+	DropNewest Overflow = iota
+	// DropOldest drops the oldest pending message to make room for the published one.
+	DropOldest
+	// Block blocks Publish until there is room in the buffer.
+	Block
+	// Disconnect removes the subscription. Pending messages are still delivered.
+	Disconnect
+)
+
+type SubscribeOptions struct {
+	// Queue is the name of the queue group. Every message is delivered to only one member of the group.
+	// Groups with the same name, but different subjects, are independent.
+	Queue string
+
+	// Buffer is the maximal number of pending messages. Zero means DefaultBuffer.
+	Buffer   int
+	Overflow Overflow
 }
 
 var _ PubSub = (*MyPubSub)(nil)
 
-type MyPubSub struct{}
+// MyPubSub is in-memory PubSub with NATS-style subjects.
+//
+// Every subscription has its own goroutine and buffer, so slow subscriber does not block the others.
+type MyPubSub struct {
+	mu       sync.RWMutex
+	root     *node
+	subs     map[*MySubscription]struct{}
+	logs     map[string]*subjectLog
+	durables map[*DurableSubscription]struct{}
+	closed   bool
+
+	// wg tracks delivery goroutines of the subscriptions.
+	wg sync.WaitGroup
+}
 
 func NewPubSub() PubSub {
-	panic("implement me")
+	return New()
+}
+
+func New() *MyPubSub {
+	return &MyPubSub{
+		root:     newNode(),
+		subs:     make(map[*MySubscription]struct{}),
+		logs:     make(map[string]*subjectLog),
+		durables: make(map[*DurableSubscription]struct{}),
+	}
 }
 
+// Subscribe subscribes to the subject with default options. Subject may contain wildcards.
 func (p *MyPubSub) Subscribe(subj string, cb MsgHandler) (Subscription, error) {
-	panic("implement me")
+	return p.SubscribeWith(subj, cb, SubscribeOptions{})
+}
+
+// QueueSubscribe subscribes to the subject as a member of the queue group.
+func (p *MyPubSub) QueueSubscribe(subj, queue string, cb MsgHandler) (Subscription, error) {
+	return p.SubscribeWith(subj, cb, SubscribeOptions{Queue: queue})
+}
+
+func (p *MyPubSub) SubscribeWith(subj string, cb MsgHandler, opts SubscribeOptions) (*MySubscription, error) {
+	tokens, err := parseSubject(subj, true)
+	if err != nil {
+		return nil, err
+	}
+
+	if opts.Buffer <= 0 {
+		opts.Buffer = DefaultBuffer
+	}
+
+	s := newSubscription(p, tokens, cb, opts)
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.closed {
+		return nil, ErrClosed
+	}
+
+	p.root.insert(tokens, s)
+	p.subs[s] = struct{}{}
+
+	p.wg.Add(1)
+	go s.run()
+	return s, nil
+}
+
+// remove deletes the subscription from the subject tree and reports whether it was there.
+func (p *MyPubSub) remove(s *MySubscription) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if _, ok := p.subs[s]; !ok {
+		return false
+	}
+
+	delete(p.subs, s)
+	p.root.remove(s.tokens, s)
+	return true
 }
 
+// Publish delivers msg to all subscriptions matching the subject, and to one member of every
+// matching queue group. Subject must not contain wildcards.
+//
+// Message of the durable subject is appended to its log before the delivery.
 func (p *MyPubSub) Publish(subj string, msg interface{}) error {
-	panic("implement me")
+	tokens, err := parseSubject(subj, false)
+	if err != nil {
+		return err
+	}
+
+	p.mu.RLock()
+	if p.closed {
+		p.mu.RUnlock()
+		return ErrClosed
+	}
+	log, durable := p.logs[subj]
+	p.mu.RUnlock()
+
+	// Append may wait for fsync, so it runs without the lock.
+	if durable {
+		data, ok := durableData(msg)
+		if !ok {
+			return ErrNotBytes
+		}
+
+		if _, err := log.append(data, time.Now()); errors.Is(err, ErrClosed) {
+			return ErrClosed
+		} else if err != nil {
+			return fmt.Errorf("persist message of %q: %w", subj, err)
+		}
+	}
+
+	p.mu.RLock()
+	if p.closed {
+		p.mu.RUnlock()
+		return ErrClosed
+	}
+
+	var targets []*MySubscription
+	p.root.match(tokens, func(n *node) {
+		targets = append(targets, n.subs...)
+		for _, g := range n.groups {
+			targets = append(targets, g.pick())
+		}
+	})
+	p.mu.RUnlock()
+
+	// Lock is released, because push may block with Block overflow policy.
+	for _, s := range targets {
+		s.push(msg)
+	}
+	return nil
 }
 
+// Close waits until pending messages are delivered. If ctx is canceled, pending messages are dropped
+// and Close returns without waiting for the running handlers.
+//
+// Durable subscriptions are stopped without waiting for acknowledgements, their messages stay in the log.
 func (p *MyPubSub) Close(ctx context.Context) error {
-	panic("implement me")
+	p.mu.Lock()
+	p.closed = true
+	subs := make([]*MySubscription, 0, len(p.subs))
+	for s := range p.subs {
+		subs = append(subs, s)
+	}
+	durables := p.durables
+	p.durables = make(map[*DurableSubscription]struct{})
+	logs := p.logs
+	p.logs = make(map[string]*subjectLog)
+	p.mu.Unlock()
+
+	for _, s := range subs {
+		s.stop(true)
+	}
+	for s := range durables {
+		s.close()
+	}
+
+	done := make(chan struct{})
+	go func() {
+		p.wg.Wait()
+		// Logs are closed after the durable subscriptions stop reading them.
+		for _, log := range logs {
+			log.close()
+		}
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		for _, s := range subs {
+			s.stop(false)
+		}
+		return ctx.Err()
+	}
+}
+
+// durableData returns bytes of the message published to the durable subject. JSON messages
+// published through remote server are stored as is.
+func durableData(msg interface{}) ([]byte, bool) {
+	switch msg := msg.(type) {
+	case []byte:
+		return msg, true
+	case json.RawMessage:
+		return msg, true
+	default:
+		return nil, false
+	}
 }
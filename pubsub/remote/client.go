@@ -0,0 +1,298 @@
+//go:build !solution
+
+package remote
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+
+	"gitlab.com/slon/shad-go/pubsub"
+)
+
+var (
+	ErrClosed = errors.New("client is closed")
+	// ErrDisconnected is returned by Publish, while the client is reconnecting to the server.
+	ErrDisconnected = errors.New("client is disconnected")
+)
+
+const (
+	minReconnectDelay = 50 * time.Millisecond
+	maxReconnectDelay = 5 * time.Second
+)
+
+var _ pubsub.PubSub = (*Client)(nil)
+
+// Client is PubSub, that forwards all calls to the Server.
+//
+// Handlers receive messages as json.RawMessage. Messages received from the server are queued in
+// local pubsub.MyPubSub, so slow handler does not block the connection.
+//
+// When connection breaks, client reconnects and subscribes again. Messages published to the server
+// while client was disconnected are lost.
+type Client struct {
+	dial  func(ctx context.Context) (conn, error)
+	local *pubsub.MyPubSub
+
+	// ctx is canceled by Close and stops reconnects.
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+
+	mu      sync.Mutex
+	conn    conn
+	subs    map[uint64]*subscription
+	pending map[uint64]chan error
+	nextID  uint64
+	closed  bool
+}
+
+// Dial connects to the server listening TCP address.
+func Dial(ctx context.Context, addr string) (*Client, error) {
+	return newClient(ctx, func(ctx context.Context) (conn, error) {
+		var d net.Dialer
+		c, err := d.DialContext(ctx, "tcp", addr)
+		if err != nil {
+			return nil, err
+		}
+		return newTCPConn(c), nil
+	})
+}
+
+// DialWebSocket connects to the server handling WebSocket requests at url, e.g. ws://localhost:8080/pubsub.
+func DialWebSocket(ctx context.Context, url string) (*Client, error) {
+	return newClient(ctx, func(ctx context.Context) (conn, error) {
+		ws, _, err := websocket.DefaultDialer.DialContext(ctx, url, nil)
+		if err != nil {
+			return nil, err
+		}
+		return newWSConn(ws), nil
+	})
+}
+
+// newClient makes the first connection synchronously, so that bad address is reported to the caller.
+func newClient(ctx context.Context, dial func(ctx context.Context) (conn, error)) (*Client, error) {
+	first, err := dial(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	c := &Client{
+		dial:    dial,
+		local:   pubsub.New(),
+		conn:    first,
+		subs:    make(map[uint64]*subscription),
+		pending: make(map[uint64]chan error),
+	}
+	c.ctx, c.cancel = context.WithCancel(context.Background())
+
+	c.wg.Add(1)
+	go c.run(first)
+	return c, nil
+}
+
+func (c *Client) run(next conn) {
+	defer c.wg.Done()
+
+	delay := minReconnectDelay
+	for {
+		if next != nil {
+			c.serve(next)
+			delay = minReconnectDelay
+		}
+
+		select {
+		case <-c.ctx.Done():
+			return
+		case <-time.After(delay):
+		}
+
+		var err error
+		if next, err = c.dial(c.ctx); err != nil {
+			delay = min(2*delay, maxReconnectDelay)
+		}
+	}
+}
+
+// serve subscribes again and reads frames, until the connection breaks.
+func (c *Client) serve(conn conn) {
+	defer conn.Close()
+
+	c.mu.Lock()
+	if c.closed {
+		c.mu.Unlock()
+		return
+	}
+
+	c.conn = conn
+	// Replies to these requests have zero ID and are ignored.
+	for _, s := range c.subs {
+		if err := conn.write(s.frame(0)); err != nil {
+			break
+		}
+	}
+	c.mu.Unlock()
+
+	defer func() {
+		c.mu.Lock()
+		defer c.mu.Unlock()
+
+		c.conn = nil
+		for id, ch := range c.pending {
+			ch <- ErrDisconnected
+			delete(c.pending, id)
+		}
+	}()
+
+	for {
+		f, err := conn.read()
+		if err != nil {
+			return
+		}
+
+		switch f.Op {
+		case opMsg:
+			_ = c.local.Publish(localSubject(f.SID), f.Data)
+
+		case opOK, opErr:
+			c.mu.Lock()
+			ch, ok := c.pending[f.ID]
+			delete(c.pending, f.ID)
+			c.mu.Unlock()
+
+			if !ok {
+				continue
+			}
+
+			if f.Op == opErr {
+				ch <- errors.New(f.Error)
+			} else {
+				ch <- nil
+			}
+		}
+	}
+}
+
+// request sends the frame and waits for the reply.
+func (c *Client) request(f *frame) error {
+	c.mu.Lock()
+	if c.closed {
+		c.mu.Unlock()
+		return ErrClosed
+	}
+
+	conn := c.conn
+	if conn == nil {
+		c.mu.Unlock()
+		return ErrDisconnected
+	}
+
+	c.nextID++
+	f.ID = c.nextID
+	reply := make(chan error, 1)
+	c.pending[f.ID] = reply
+	c.mu.Unlock()
+
+	if err := conn.write(f); err != nil {
+		c.mu.Lock()
+		delete(c.pending, f.ID)
+		c.mu.Unlock()
+		return err
+	}
+	return <-reply
+}
+
+func localSubject(sid uint64) string {
+	return "sid." + strconv.FormatUint(sid, 10)
+}
+
+func (c *Client) Subscribe(subj string, cb pubsub.MsgHandler) (pubsub.Subscription, error) {
+	return c.QueueSubscribe(subj, "", cb)
+}
+
+// QueueSubscribe subscribes to the subject as a member of the queue group.
+// Server PubSub must support queue groups.
+//
+// If the client is disconnected, subscription is sent to the server after reconnect.
+func (c *Client) QueueSubscribe(subj, queue string, cb pubsub.MsgHandler) (pubsub.Subscription, error) {
+	c.mu.Lock()
+	if c.closed {
+		c.mu.Unlock()
+		return nil, ErrClosed
+	}
+	c.nextID++
+	sid := c.nextID
+	c.mu.Unlock()
+
+	local, err := c.local.Subscribe(localSubject(sid), cb)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &subscription{c: c, sid: sid, subject: subj, queue: queue, local: local}
+	c.mu.Lock()
+	c.subs[sid] = s
+	c.mu.Unlock()
+
+	err = c.request(s.frame(0))
+	if err != nil && !errors.Is(err, ErrDisconnected) {
+		s.Unsubscribe()
+		return nil, err
+	}
+	return s, nil
+}
+
+// Publish sends the message encoded with json.Marshal, and waits until the server publishes it.
+func (c *Client) Publish(subj string, msg interface{}) error {
+	data, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+	return c.request(&frame{Op: opPub, Subject: subj, Data: data})
+}
+
+// Close disconnects from the server and waits until received messages are delivered to the handlers,
+// or until ctx is canceled.
+func (c *Client) Close(ctx context.Context) error {
+	c.mu.Lock()
+	c.closed = true
+	if c.conn != nil {
+		_ = c.conn.Close()
+	}
+	c.mu.Unlock()
+
+	c.cancel()
+	c.wg.Wait()
+
+	return c.local.Close(ctx)
+}
+
+type subscription struct {
+	c       *Client
+	sid     uint64
+	subject string
+	queue   string
+	local   pubsub.Subscription
+}
+
+func (s *subscription) frame(id uint64) *frame {
+	return &frame{Op: opSub, ID: id, SID: s.sid, Subject: s.subject, Queue: s.queue}
+}
+
+// Unsubscribe stops local delivery immediately, and removes the subscription from the server
+// if the client is connected.
+func (s *subscription) Unsubscribe() {
+	s.local.Unsubscribe()
+
+	s.c.mu.Lock()
+	delete(s.c.subs, s.sid)
+	s.c.mu.Unlock()
+
+	_ = s.c.request(&frame{Op: opUnsub, SID: s.sid})
+}
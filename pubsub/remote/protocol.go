@@ -0,0 +1,140 @@
+//go:build !solution
+
+// Package remote exposes pubsub.PubSub over the network.
+package remote
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+
+	"github.com/gorilla/websocket"
+)
+
+const (
+	opSub   = "sub"
+	opUnsub = "unsub"
+	opPub   = "pub"
+	opMsg   = "msg"
+	opOK    = "ok"
+	opErr   = "err"
+)
+
+// maxFrameSize limits the size of the frame read from TCP connection.
+const maxFrameSize = 16 << 20
+
+// frame is the unit of the protocol. Over TCP frame is sent as 4 byte big endian length followed
+// by JSON, over WebSocket every frame is one text message with JSON.
+//
+// Requests sub, unsub and pub are answered by ok or err with the same ID. Messages of the subscription
+// are sent by the server as msg frames with the subscription ID chosen by the client.
+type frame struct {
+	Op      string          `json:"op"`
+	ID      uint64          `json:"id,omitempty"`
+	SID     uint64          `json:"sid,omitempty"`
+	Subject string          `json:"subject,omitempty"`
+	Queue   string          `json:"queue,omitempty"`
+	Data    json.RawMessage `json:"data,omitempty"`
+	Error   string          `json:"error,omitempty"`
+}
+
+// conn is framed connection. write is safe for concurrent use, read is called from one goroutine.
+type conn interface {
+	read() (*frame, error)
+	write(f *frame) error
+	Close() error
+}
+
+type tcpConn struct {
+	c net.Conn
+	r *bufio.Reader
+
+	mu sync.Mutex
+	w  *bufio.Writer
+}
+
+func newTCPConn(c net.Conn) *tcpConn {
+	return &tcpConn{c: c, r: bufio.NewReader(c), w: bufio.NewWriter(c)}
+}
+
+func (c *tcpConn) read() (*frame, error) {
+	var header [4]byte
+	if _, err := io.ReadFull(c.r, header[:]); err != nil {
+		return nil, err
+	}
+
+	size := binary.BigEndian.Uint32(header[:])
+	if size > maxFrameSize {
+		return nil, fmt.Errorf("frame size %d exceeds limit", size)
+	}
+
+	body := make([]byte, size)
+	if _, err := io.ReadFull(c.r, body); err != nil {
+		return nil, err
+	}
+
+	f := new(frame)
+	if err := json.Unmarshal(body, f); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+func (c *tcpConn) write(f *frame) error {
+	body, err := json.Marshal(f)
+	if err != nil {
+		return err
+	}
+
+	var header [4]byte
+	binary.BigEndian.PutUint32(header[:], uint32(len(body)))
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if _, err := c.w.Write(header[:]); err != nil {
+		return err
+	}
+	if _, err := c.w.Write(body); err != nil {
+		return err
+	}
+	return c.w.Flush()
+}
+
+func (c *tcpConn) Close() error {
+	return c.c.Close()
+}
+
+type wsConn struct {
+	c *websocket.Conn
+
+	mu sync.Mutex
+}
+
+func newWSConn(c *websocket.Conn) *wsConn {
+	c.SetReadLimit(maxFrameSize)
+	return &wsConn{c: c}
+}
+
+func (c *wsConn) read() (*frame, error) {
+	f := new(frame)
+	if err := c.c.ReadJSON(f); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+func (c *wsConn) write(f *frame) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.c.WriteJSON(f)
+}
+
+func (c *wsConn) Close() error {
+	return c.c.Close()
+}
@@ -0,0 +1,259 @@
+package remote
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"go.uber.org/goleak"
+
+	"gitlab.com/slon/shad-go/pubsub"
+)
+
+func TestMain(m *testing.M) {
+	goleak.VerifyTestMain(m)
+}
+
+type env struct {
+	backend *pubsub.MyPubSub
+	server  *Server
+	addr    string
+}
+
+func startTCP(t *testing.T, backend *pubsub.MyPubSub, addr string) *env {
+	l, err := net.Listen("tcp", addr)
+	require.NoError(t, err)
+
+	e := &env{backend: backend, server: NewServer(backend), addr: l.Addr().String()}
+
+	served := make(chan error, 1)
+	go func() {
+		served <- e.server.Serve(l)
+	}()
+
+	t.Cleanup(func() {
+		require.NoError(t, e.server.Close())
+		require.NoError(t, <-served)
+	})
+	return e
+}
+
+func closeClient(t *testing.T, c *Client) {
+	require.NoError(t, c.Close(context.Background()))
+}
+
+// inbox collects messages of the subscription.
+type inbox struct {
+	mu   sync.Mutex
+	msgs []string
+}
+
+func (b *inbox) handle(msg interface{}) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch msg := msg.(type) {
+	case json.RawMessage:
+		b.msgs = append(b.msgs, string(msg))
+	default:
+		b.msgs = append(b.msgs, "unexpected")
+	}
+}
+
+func (b *inbox) wait(t *testing.T, expected ...string) {
+	t.Helper()
+
+	require.Eventually(t, func() bool {
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		return len(b.msgs) >= len(expected)
+	}, 5*time.Second, time.Millisecond)
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	require.Equal(t, expected, b.msgs)
+}
+
+func testPubSub(t *testing.T, backend *pubsub.MyPubSub, dial func() (*Client, error)) {
+	c, err := dial()
+	require.NoError(t, err)
+	defer closeClient(t, c)
+
+	var remote, local inbox
+	_, err = c.Subscribe("orders.*", remote.handle)
+	require.NoError(t, err)
+	_, err = backend.Subscribe("orders.created", local.handle)
+	require.NoError(t, err)
+
+	require.NoError(t, c.Publish("orders.created", map[string]int{"id": 1}))
+	require.NoError(t, backend.Publish("orders.created", json.RawMessage(`{"id":2}`)))
+
+	remote.wait(t, `{"id":1}`, `{"id":2}`)
+	local.wait(t, `{"id":1}`, `{"id":2}`)
+
+	require.Error(t, c.Publish("orders.*", "wildcard"))
+	_, err = c.Subscribe("orders..created", remote.handle)
+	require.Error(t, err)
+}
+
+func TestTCP(t *testing.T) {
+	backend := pubsub.New()
+	defer func() { require.NoError(t, backend.Close(context.Background())) }()
+
+	e := startTCP(t, backend, "127.0.0.1:0")
+	testPubSub(t, backend, func() (*Client, error) {
+		return Dial(context.Background(), e.addr)
+	})
+}
+
+func TestWebSocket(t *testing.T) {
+	backend := pubsub.New()
+	defer func() { require.NoError(t, backend.Close(context.Background())) }()
+
+	server := NewServer(backend)
+	http := httptest.NewServer(server)
+	defer http.Close()
+	defer func() { require.NoError(t, server.Close()) }()
+
+	testPubSub(t, backend, func() (*Client, error) {
+		return DialWebSocket(context.Background(), "ws"+strings.TrimPrefix(http.URL, "http"))
+	})
+}
+
+func TestPublishDurable(t *testing.T) {
+	backend := pubsub.New()
+	defer func() { require.NoError(t, backend.Close(context.Background())) }()
+	require.NoError(t, backend.Persist("audit", pubsub.LogOptions{Dir: t.TempDir()}))
+
+	e := startTCP(t, backend, "127.0.0.1:0")
+	c, err := Dial(context.Background(), e.addr)
+	require.NoError(t, err)
+	defer closeClient(t, c)
+
+	require.NoError(t, c.Publish("audit", map[string]int{"id": 1}))
+
+	received := make(chan string, 1)
+	_, err = backend.SubscribeDurable("audit", func(msg *pubsub.Message) {
+		msg.Ack()
+		received <- string(msg.Data)
+	}, pubsub.DurableSubscribeOptions{})
+	require.NoError(t, err)
+
+	select {
+	case data := <-received:
+		require.Equal(t, `{"id":1}`, data)
+	case <-time.After(5 * time.Second):
+		t.Fatal("message is not delivered")
+	}
+}
+
+func TestQueueGroup(t *testing.T) {
+	backend := pubsub.New()
+	defer func() { require.NoError(t, backend.Close(context.Background())) }()
+
+	e := startTCP(t, backend, "127.0.0.1:0")
+
+	var inboxes [2]inbox
+	for i := range inboxes {
+		c, err := Dial(context.Background(), e.addr)
+		require.NoError(t, err)
+		defer closeClient(t, c)
+
+		_, err = c.QueueSubscribe("jobs", "workers", inboxes[i].handle)
+		require.NoError(t, err)
+	}
+
+	require.NoError(t, backend.Publish("jobs", 1))
+	require.NoError(t, backend.Publish("jobs", 2))
+
+	inboxes[0].wait(t, "1")
+	inboxes[1].wait(t, "2")
+}
+
+func TestUnsubscribe(t *testing.T) {
+	backend := pubsub.New()
+	defer func() { require.NoError(t, backend.Close(context.Background())) }()
+
+	e := startTCP(t, backend, "127.0.0.1:0")
+
+	c, err := Dial(context.Background(), e.addr)
+	require.NoError(t, err)
+	defer closeClient(t, c)
+
+	s, err := c.Subscribe("topic", func(msg interface{}) {
+		t.Error("unsubscribed handler must not be called")
+	})
+	require.NoError(t, err)
+	s.Unsubscribe()
+
+	var b inbox
+	_, err = c.Subscribe("topic", b.handle)
+	require.NoError(t, err)
+
+	require.NoError(t, c.Publish("topic", "pew-pew"))
+	b.wait(t, `"pew-pew"`)
+}
+
+func TestReconnect(t *testing.T) {
+	backend := pubsub.New()
+	defer func() { require.NoError(t, backend.Close(context.Background())) }()
+
+	first := startTCP(t, backend, "127.0.0.1:0")
+
+	c, err := Dial(context.Background(), first.addr)
+	require.NoError(t, err)
+	defer closeClient(t, c)
+
+	var b inbox
+	_, err = c.Subscribe("topic", b.handle)
+	require.NoError(t, err)
+
+	require.NoError(t, first.server.Close())
+	require.Eventually(t, func() bool {
+		return c.Publish("topic", 0) != nil
+	}, 5*time.Second, time.Millisecond)
+
+	startTCP(t, backend, first.addr)
+
+	// Subscription is restored together with the connection.
+	require.Eventually(t, func() bool {
+		return c.Publish("topic", 1) == nil
+	}, 5*time.Second, 10*time.Millisecond)
+	b.wait(t, "1")
+}
+
+func TestClose(t *testing.T) {
+	backend := pubsub.New()
+	defer func() { require.NoError(t, backend.Close(context.Background())) }()
+
+	e := startTCP(t, backend, "127.0.0.1:0")
+
+	c, err := Dial(context.Background(), e.addr)
+	require.NoError(t, err)
+
+	release := make(chan struct{})
+	started := make(chan struct{})
+	_, err = c.Subscribe("topic", func(msg interface{}) {
+		close(started)
+		<-release
+	})
+	require.NoError(t, err)
+
+	require.NoError(t, c.Publish("topic", 1))
+	<-started
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	require.ErrorIs(t, c.Close(ctx), context.DeadlineExceeded)
+	close(release)
+
+	require.ErrorIs(t, c.Publish("topic", 2), ErrClosed)
+	_, err = c.Subscribe("topic", func(msg interface{}) {})
+	require.ErrorIs(t, err, ErrClosed)
+}
@@ -0,0 +1,219 @@
+//go:build !solution
+
+package remote
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"sync"
+
+	"github.com/gorilla/websocket"
+
+	"gitlab.com/slon/shad-go/pubsub"
+)
+
+// queueSubscriber is implemented by PubSub supporting queue groups, like pubsub.MyPubSub.
+type queueSubscriber interface {
+	QueueSubscribe(subj, queue string, cb pubsub.MsgHandler) (pubsub.Subscription, error)
+}
+
+// Server exposes PubSub to the clients connected over TCP or WebSocket.
+//
+// Messages published by the clients are passed to PubSub as json.RawMessage. Messages delivered
+// to the clients are encoded with json.Marshal.
+type Server struct {
+	ps       pubsub.PubSub
+	upgrader websocket.Upgrader
+
+	mu        sync.Mutex
+	listeners map[net.Listener]struct{}
+	conns     map[conn]struct{}
+	closed    bool
+	wg        sync.WaitGroup
+}
+
+func NewServer(ps pubsub.PubSub) *Server {
+	return &Server{
+		ps:        ps,
+		listeners: make(map[net.Listener]struct{}),
+		conns:     make(map[conn]struct{}),
+	}
+}
+
+// Serve accepts TCP connections, until the listener fails or the server is closed.
+// After Close it returns nil.
+func (s *Server) Serve(l net.Listener) error {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		return l.Close()
+	}
+	s.listeners[l] = struct{}{}
+	s.mu.Unlock()
+
+	defer func() {
+		s.mu.Lock()
+		delete(s.listeners, l)
+		s.mu.Unlock()
+	}()
+
+	for {
+		c, err := l.Accept()
+		if err != nil {
+			s.mu.Lock()
+			closed := s.closed
+			s.mu.Unlock()
+
+			if closed {
+				return nil
+			}
+			return err
+		}
+
+		if !s.track(newTCPConn(c)) {
+			return nil
+		}
+	}
+}
+
+// ServeHTTP upgrades the request to WebSocket and serves it until the connection is closed.
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	ws, err := s.upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		// Upgrader already replied with an error.
+		return
+	}
+
+	c := newWSConn(ws)
+
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		_ = c.Close()
+		return
+	}
+	s.conns[c] = struct{}{}
+	s.wg.Add(1)
+	s.mu.Unlock()
+
+	s.serveConn(c)
+}
+
+// track starts serving the connection in a new goroutine.
+func (s *Server) track(c conn) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.closed {
+		_ = c.Close()
+		return false
+	}
+
+	s.conns[c] = struct{}{}
+	s.wg.Add(1)
+	go s.serveConn(c)
+	return true
+}
+
+// Close closes listeners and connections, and removes subscriptions of the clients.
+// PubSub itself is not closed.
+func (s *Server) Close() error {
+	s.mu.Lock()
+	s.closed = true
+	for l := range s.listeners {
+		_ = l.Close()
+	}
+	for c := range s.conns {
+		_ = c.Close()
+	}
+	s.mu.Unlock()
+
+	s.wg.Wait()
+	return nil
+}
+
+func (s *Server) serveConn(c conn) {
+	defer s.wg.Done()
+
+	subs := map[uint64]pubsub.Subscription{}
+	defer func() {
+		for _, sub := range subs {
+			sub.Unsubscribe()
+		}
+
+		_ = c.Close()
+
+		s.mu.Lock()
+		delete(s.conns, c)
+		s.mu.Unlock()
+	}()
+
+	for {
+		f, err := c.read()
+		if err != nil {
+			return
+		}
+
+		switch f.Op {
+		case opSub:
+			// Subscription is sent again after reconnect, and may race with the original request.
+			if old, ok := subs[f.SID]; ok {
+				old.Unsubscribe()
+				delete(subs, f.SID)
+			}
+
+			var sub pubsub.Subscription
+			sub, err = s.subscribe(c, f)
+			if err == nil {
+				subs[f.SID] = sub
+			}
+
+		case opUnsub:
+			if sub, ok := subs[f.SID]; ok {
+				sub.Unsubscribe()
+				delete(subs, f.SID)
+			}
+
+		case opPub:
+			err = s.ps.Publish(f.Subject, f.Data)
+
+		default:
+			err = fmt.Errorf("unknown op %q", f.Op)
+		}
+
+		reply := &frame{Op: opOK, ID: f.ID}
+		if err != nil {
+			reply = &frame{Op: opErr, ID: f.ID, Error: err.Error()}
+		}
+
+		if err := c.write(reply); err != nil {
+			return
+		}
+	}
+}
+
+func (s *Server) subscribe(c conn, f *frame) (pubsub.Subscription, error) {
+	sid := f.SID
+	cb := func(msg interface{}) {
+		data, err := json.Marshal(msg)
+		if err != nil {
+			return
+		}
+
+		// Errors are ignored: when connection breaks, read fails and subscription is removed.
+		_ = c.write(&frame{Op: opMsg, SID: sid, Data: data})
+	}
+
+	if f.Queue == "" {
+		return s.ps.Subscribe(f.Subject, cb)
+	}
+
+	qs, ok := s.ps.(queueSubscriber)
+	if !ok {
+		return nil, errors.New("queue groups are not supported")
+	}
+	return qs.QueueSubscribe(f.Subject, f.Queue, cb)
+}
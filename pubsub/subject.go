@@ -0,0 +1,136 @@
+//go:build !solution
+
+package pubsub
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"sync/atomic"
+)
+
+// Subjects consist of tokens separated by dots. In subscriptions token "*" matches any single
+// token, and last token ">" matches one or more tokens.
+const (
+	tokenAny  = "*"
+	tokenTail = ">"
+)
+
+func parseSubject(subj string, wildcards bool) ([]string, error) {
+	tokens := strings.Split(subj, ".")
+	for i, token := range tokens {
+		switch {
+		case token == "":
+			return nil, fmt.Errorf("%w %q: empty token", ErrInvalidSubject, subj)
+		case !wildcards && (token == tokenAny || token == tokenTail):
+			return nil, fmt.Errorf("%w %q: wildcards are allowed only in subscriptions", ErrInvalidSubject, subj)
+		case token == tokenTail && i != len(tokens)-1:
+			return nil, fmt.Errorf("%w %q: %q must be the last token", ErrInvalidSubject, subj, tokenTail)
+		}
+	}
+	return tokens, nil
+}
+
+// node is a node of the subscription tree. Wildcard tokens are stored in children as any other token.
+type node struct {
+	children map[string]*node
+	subs     []*MySubscription
+	groups   map[string]*group
+}
+
+// group is a queue group. Every message is delivered to one of its members, in round-robin order.
+type group struct {
+	members []*MySubscription
+	next    atomic.Uint64
+}
+
+func (g *group) pick() *MySubscription {
+	return g.members[(g.next.Add(1)-1)%uint64(len(g.members))]
+}
+
+func newNode() *node {
+	return &node{
+		children: make(map[string]*node),
+		groups:   make(map[string]*group),
+	}
+}
+
+func (n *node) empty() bool {
+	return len(n.children) == 0 && len(n.subs) == 0 && len(n.groups) == 0
+}
+
+func (n *node) insert(tokens []string, s *MySubscription) {
+	for _, token := range tokens {
+		child, ok := n.children[token]
+		if !ok {
+			child = newNode()
+			n.children[token] = child
+		}
+		n = child
+	}
+
+	if s.queue == "" {
+		n.subs = append(n.subs, s)
+		return
+	}
+
+	g, ok := n.groups[s.queue]
+	if !ok {
+		g = &group{}
+		n.groups[s.queue] = g
+	}
+	g.members = append(g.members, s)
+}
+
+// remove deletes subscription from the tree, together with the nodes left empty.
+func (n *node) remove(tokens []string, s *MySubscription) {
+	if len(tokens) != 0 {
+		child, ok := n.children[tokens[0]]
+		if !ok {
+			return
+		}
+
+		child.remove(tokens[1:], s)
+		if child.empty() {
+			delete(n.children, tokens[0])
+		}
+		return
+	}
+
+	if s.queue == "" {
+		n.subs = removeSub(n.subs, s)
+		return
+	}
+
+	if g, ok := n.groups[s.queue]; ok {
+		g.members = removeSub(g.members, s)
+		if len(g.members) == 0 {
+			delete(n.groups, s.queue)
+		}
+	}
+}
+
+func removeSub(subs []*MySubscription, s *MySubscription) []*MySubscription {
+	if i := slices.Index(subs, s); i != -1 {
+		return slices.Delete(subs, i, i+1)
+	}
+	return subs
+}
+
+// match calls visit for every node, whose subscriptions match the subject.
+func (n *node) match(tokens []string, visit func(n *node)) {
+	if len(tokens) == 0 {
+		visit(n)
+		return
+	}
+
+	if child, ok := n.children[tokens[0]]; ok {
+		child.match(tokens[1:], visit)
+	}
+	if child, ok := n.children[tokenAny]; ok {
+		child.match(tokens[1:], visit)
+	}
+	if child, ok := n.children[tokenTail]; ok {
+		visit(child)
+	}
+}
@@ -0,0 +1,89 @@
+package pubsub
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseSubject(t *testing.T) {
+	for _, tc := range []struct {
+		subj      string
+		wildcards bool
+		ok        bool
+	}{
+		{"orders", false, true},
+		{"orders.created", false, true},
+		{"orders.*", false, false},
+		{"orders.*", true, true},
+		{"orders.>", true, true},
+		{"*.created.>", true, true},
+		{"orders.>.created", true, false},
+		{"orders..created", true, false},
+		{"", true, false},
+		{"orders.", false, false},
+	} {
+		_, err := parseSubject(tc.subj, tc.wildcards)
+		if tc.ok {
+			require.NoError(t, err, tc.subj)
+		} else {
+			require.Truef(t, errors.Is(err, ErrInvalidSubject), "%q: %v", tc.subj, err)
+		}
+	}
+}
+
+func TestPubSub_wildcards(t *testing.T) {
+	p := New()
+	defer checkedClose(t, p)
+
+	var (
+		mu       sync.Mutex
+		received = map[string][]string{}
+	)
+
+	for _, subj := range []string{"orders.created", "orders.*", "orders.>", "*.created", ">"} {
+		_, err := p.Subscribe(subj, func(msg interface{}) {
+			mu.Lock()
+			defer mu.Unlock()
+			received[subj] = append(received[subj], msg.(string))
+		})
+		require.NoError(t, err)
+	}
+
+	for _, subj := range []string{"orders.created", "orders.eu.created", "users.created", "orders"} {
+		require.NoError(t, p.Publish(subj, subj))
+	}
+
+	require.Error(t, p.Publish("orders.*", "wildcard"))
+	require.NoError(t, p.Close(context.Background()))
+
+	for _, msgs := range received {
+		sort.Strings(msgs)
+	}
+	require.Equal(t, map[string][]string{
+		"orders.created": {"orders.created"},
+		"orders.*":       {"orders.created"},
+		"orders.>":       {"orders.created", "orders.eu.created"},
+		"*.created":      {"orders.created", "users.created"},
+		">":              {"orders", "orders.created", "orders.eu.created", "users.created"},
+	}, received)
+}
+
+func TestPubSub_unsubscribeWildcard(t *testing.T) {
+	p := New()
+	defer checkedClose(t, p)
+
+	s, err := p.Subscribe("orders.>", func(msg interface{}) {
+		t.Error("unsubscribed handler must not be called")
+	})
+	require.NoError(t, err)
+	s.Unsubscribe()
+	s.Unsubscribe()
+
+	require.True(t, p.root.empty())
+	require.NoError(t, p.Publish("orders.created", "pew-pew"))
+}
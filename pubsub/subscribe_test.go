@@ -0,0 +1,175 @@
+package pubsub
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestPubSub_queueGroup(t *testing.T) {
+	p := New()
+
+	const N = 100
+
+	var (
+		members [3]atomic.Int32
+		plain   atomic.Int32
+	)
+	for i := range members {
+		_, err := p.QueueSubscribe("jobs.*", "workers", func(msg interface{}) {
+			members[i].Add(1)
+		})
+		require.NoError(t, err)
+	}
+
+	_, err := p.Subscribe("jobs.*", func(msg interface{}) {
+		plain.Add(1)
+	})
+	require.NoError(t, err)
+
+	for range N {
+		require.NoError(t, p.Publish("jobs.build", "job"))
+	}
+	checkedClose(t, p)
+
+	var total int32
+	for i := range members {
+		require.NotZero(t, members[i].Load())
+		total += members[i].Load()
+	}
+	require.Equal(t, int32(N), total)
+	require.Equal(t, int32(N), plain.Load())
+}
+
+// stuck returns handler that blocks on the first message until release is closed, and records all messages.
+func stuck(release <-chan struct{}, started chan<- struct{}) (MsgHandler, func() []interface{}) {
+	var (
+		mu   sync.Mutex
+		msgs []interface{}
+		once sync.Once
+	)
+
+	cb := func(msg interface{}) {
+		once.Do(func() {
+			close(started)
+			<-release
+		})
+
+		mu.Lock()
+		defer mu.Unlock()
+		msgs = append(msgs, msg)
+	}
+
+	return cb, func() []interface{} {
+		mu.Lock()
+		defer mu.Unlock()
+		return msgs
+	}
+}
+
+func TestPubSub_overflow(t *testing.T) {
+	for _, tc := range []struct {
+		name     string
+		overflow Overflow
+		expected []interface{}
+		dropped  uint64
+	}{
+		{"DropNewest", DropNewest, []interface{}{0, 1, 2}, 2},
+		{"DropOldest", DropOldest, []interface{}{0, 3, 4}, 2},
+		{"Disconnect", Disconnect, []interface{}{0, 1, 2}, 1},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			p := New()
+			defer checkedClose(t, p)
+
+			release, started := make(chan struct{}), make(chan struct{})
+			cb, received := stuck(release, started)
+
+			s, err := p.SubscribeWith("topic", cb, SubscribeOptions{Buffer: 2, Overflow: tc.overflow})
+			require.NoError(t, err)
+
+			require.NoError(t, p.Publish("topic", 0))
+			<-started
+
+			for i := 1; i < 5; i++ {
+				require.NoError(t, p.Publish("topic", i))
+			}
+			close(release)
+
+			require.Eventually(t, func() bool {
+				return len(received()) == len(tc.expected)
+			}, time.Second, time.Millisecond)
+			require.Equal(t, tc.expected, received())
+			require.Equal(t, tc.dropped, s.Dropped())
+
+			if tc.overflow == Disconnect {
+				require.ErrorIs(t, s.Err(), ErrSlowConsumer)
+				require.True(t, p.root.empty())
+			} else {
+				require.NoError(t, s.Err())
+			}
+		})
+	}
+}
+
+func TestPubSub_overflowBlock(t *testing.T) {
+	p := New()
+
+	release, started := make(chan struct{}), make(chan struct{})
+	cb, received := stuck(release, started)
+
+	_, err := p.SubscribeWith("topic", cb, SubscribeOptions{Buffer: 1, Overflow: Block})
+	require.NoError(t, err)
+
+	require.NoError(t, p.Publish("topic", 0))
+	<-started
+	require.NoError(t, p.Publish("topic", 1))
+
+	published := make(chan struct{})
+	go func() {
+		defer close(published)
+		require.NoError(t, p.Publish("topic", 2))
+	}()
+
+	select {
+	case <-published:
+		t.Fatal("publish must block on full buffer")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	close(release)
+	<-published
+
+	checkedClose(t, p)
+	require.Equal(t, []interface{}{0, 1, 2}, received())
+}
+
+func TestPubSub_closeUnblocksPublish(t *testing.T) {
+	p := New()
+
+	release, started := make(chan struct{}), make(chan struct{})
+	defer close(release)
+	cb, _ := stuck(release, started)
+
+	_, err := p.SubscribeWith("topic", cb, SubscribeOptions{Buffer: 1, Overflow: Block})
+	require.NoError(t, err)
+
+	require.NoError(t, p.Publish("topic", 0))
+	<-started
+	require.NoError(t, p.Publish("topic", 1))
+
+	published := make(chan struct{})
+	go func() {
+		defer close(published)
+		_ = p.Publish("topic", 2)
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	require.ErrorIs(t, p.Close(ctx), context.DeadlineExceeded)
+	<-published
+}
@@ -0,0 +1,153 @@
+//go:build !solution
+
+package pubsub
+
+import "sync"
+
+var _ Subscription = (*MySubscription)(nil)
+
+type MySubscription struct {
+	ps       *MyPubSub
+	tokens   []string
+	queue    string
+	cb       MsgHandler
+	limit    int
+	overflow Overflow
+
+	mu   sync.Mutex
+	cond *sync.Cond
+	// pending messages are msgs[head:].
+	msgs    []interface{}
+	head    int
+	stopped bool
+	dropped uint64
+	err     error
+}
+
+func newSubscription(ps *MyPubSub, tokens []string, cb MsgHandler, opts SubscribeOptions) *MySubscription {
+	s := &MySubscription{
+		ps:       ps,
+		tokens:   tokens,
+		queue:    opts.Queue,
+		cb:       cb,
+		limit:    opts.Buffer,
+		overflow: opts.Overflow,
+	}
+	s.cond = sync.NewCond(&s.mu)
+	return s
+}
+
+// Unsubscribe removes the subscription. Pending messages are dropped, running handler is not waited for.
+func (s *MySubscription) Unsubscribe() {
+	s.ps.remove(s)
+	s.stop(false)
+}
+
+// Dropped returns the number of messages dropped because of the full buffer.
+func (s *MySubscription) Dropped() uint64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.dropped
+}
+
+// Err returns ErrSlowConsumer, if the subscription was disconnected because of the full buffer.
+func (s *MySubscription) Err() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.err
+}
+
+func (s *MySubscription) pendingLocked() int {
+	return len(s.msgs) - s.head
+}
+
+func (s *MySubscription) popLocked() interface{} {
+	msg := s.msgs[s.head]
+	s.msgs[s.head] = nil
+	s.head++
+
+	// Consumed prefix is reclaimed, once it is the larger half of the slice.
+	if s.head*2 >= len(s.msgs) {
+		n := copy(s.msgs, s.msgs[s.head:])
+		clear(s.msgs[n:])
+		s.msgs = s.msgs[:n]
+		s.head = 0
+	}
+	return msg
+}
+
+func (s *MySubscription) push(msg interface{}) {
+	s.mu.Lock()
+
+	for !s.stopped && s.pendingLocked() >= s.limit {
+		if s.overflow == Block {
+			s.cond.Wait()
+			continue
+		}
+
+		s.dropped++
+		switch s.overflow {
+		case DropOldest:
+			s.popLocked()
+
+		case Disconnect:
+			s.err = ErrSlowConsumer
+			s.stopped = true
+			s.cond.Broadcast()
+			s.mu.Unlock()
+
+			s.ps.remove(s)
+			return
+
+		default:
+			s.mu.Unlock()
+			return
+		}
+	}
+
+	if !s.stopped {
+		s.msgs = append(s.msgs, msg)
+		s.cond.Broadcast()
+	}
+	s.mu.Unlock()
+}
+
+// stop makes subscription reject new messages. Pending messages are delivered if drain is set,
+// and dropped otherwise.
+func (s *MySubscription) stop(drain bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.stopped = true
+	if !drain {
+		clear(s.msgs)
+		s.msgs, s.head = nil, 0
+	}
+	s.cond.Broadcast()
+}
+
+// run delivers messages to the handler, until the subscription is stopped and has no pending messages.
+func (s *MySubscription) run() {
+	defer s.ps.wg.Done()
+
+	for {
+		s.mu.Lock()
+		for s.pendingLocked() == 0 && !s.stopped {
+			s.cond.Wait()
+		}
+
+		if s.pendingLocked() == 0 {
+			s.mu.Unlock()
+			return
+		}
+
+		msg := s.popLocked()
+		// Wakes publishers blocked on the full buffer.
+		s.cond.Broadcast()
+		s.mu.Unlock()
+
+		s.cb(msg)
+	}
+}
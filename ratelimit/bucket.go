@@ -0,0 +1,158 @@
+//go:build !solution
+
+package ratelimit
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+var _ RateLimiter = (*TokenBucket)(nil)
+
+// TokenBucket is rate limiter that allows bursts.
+//
+// Bucket holds up to burst tokens and is refilled with count tokens every interval. Unlike Limiter,
+// TokenBucket does not remember individual grants, so its state has constant size.
+type TokenBucket struct {
+	// every is the time to refill one token. Zero means no limit.
+	every time.Duration
+	burst int
+	start time.Time
+
+	mu sync.Mutex
+	// full is the time when bucket becomes full, if no tokens are taken. It is in the future,
+	// when tokens are reserved ahead.
+	full    time.Duration
+	stopped bool
+	stop    chan struct{}
+}
+
+// NewTokenBucket returns limiter that allows count events per interval on average,
+// and bursts of up to burst events.
+func NewTokenBucket(count int, interval time.Duration, burst int) *TokenBucket {
+	var every time.Duration
+	if count > 0 {
+		every = interval / time.Duration(count)
+	}
+
+	return &TokenBucket{
+		every: every,
+		burst: burst,
+		start: time.Now(),
+		stop:  make(chan struct{}),
+	}
+}
+
+func (b *TokenBucket) now() time.Duration {
+	return time.Since(b.start)
+}
+
+// nextLocked returns the time when n tokens are available, and the new value of full after taking them.
+func (b *TokenBucket) nextLocked(now time.Duration, n int) (at, full time.Duration) {
+	full = max(b.full, now) + time.Duration(n)*b.every
+	at = max(full-time.Duration(b.burst)*b.every, now)
+	return at, full
+}
+
+func (b *TokenBucket) Allow() bool {
+	return b.AllowN(1)
+}
+
+func (b *TokenBucket) AllowN(n int) bool {
+	if n > b.burst {
+		return false
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.stopped {
+		return false
+	}
+
+	now := b.now()
+	at, full := b.nextLocked(now, n)
+	if at > now {
+		return false
+	}
+	b.full = full
+	return true
+}
+
+func (b *TokenBucket) Reserve() (time.Duration, error) {
+	return b.ReserveN(1)
+}
+
+func (b *TokenBucket) ReserveN(n int) (time.Duration, error) {
+	if n > b.burst {
+		return 0, ErrExceedsLimit
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.stopped {
+		return 0, ErrStopped
+	}
+
+	now := b.now()
+	at, full := b.nextLocked(now, n)
+	b.full = full
+	return at - now, nil
+}
+
+func (b *TokenBucket) Acquire(ctx context.Context) error {
+	return b.AcquireN(ctx, 1)
+}
+
+func (b *TokenBucket) AcquireN(ctx context.Context, n int) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	delay, err := b.ReserveN(n)
+	if err != nil {
+		return err
+	}
+
+	if err := wait(ctx, b.stop, delay); err != nil {
+		// Later reservations keep their delays, so returned tokens never let them through
+		// earlier than allowed.
+		b.mu.Lock()
+		b.full -= time.Duration(n) * b.every
+		b.mu.Unlock()
+		return err
+	}
+	return nil
+}
+
+func (b *TokenBucket) Status() Status {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	now := b.now()
+	status := Status{Limit: b.burst, Remaining: b.burst}
+	if b.burst > 0 {
+		at, _ := b.nextLocked(now, 1)
+		status.RetryAfter = at - now
+	}
+
+	if debt := b.full - now; debt > 0 && b.every > 0 {
+		// Token that is only partially refilled is not available yet.
+		used := int((debt + b.every - 1) / b.every)
+		status.Remaining = max(b.burst-used, 0)
+		status.Reset = debt
+	}
+	return status
+}
+
+func (b *TokenBucket) Stop() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if !b.stopped {
+		b.stopped = true
+		close(b.stop)
+	}
+}
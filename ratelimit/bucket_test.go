@@ -0,0 +1,118 @@
+package ratelimit
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"go.uber.org/goleak"
+	"golang.org/x/sync/errgroup"
+)
+
+func TestTokenBucketBurst(t *testing.T) {
+	bucket := NewTokenBucket(1, time.Hour, 3)
+	defer bucket.Stop()
+
+	require.True(t, bucket.AllowN(2))
+	require.True(t, bucket.Allow())
+	require.False(t, bucket.Allow())
+	require.False(t, bucket.AllowN(4))
+
+	delay, err := bucket.Reserve()
+	require.NoError(t, err)
+	require.InDelta(t, time.Hour, delay, float64(time.Second))
+
+	delay, err = bucket.Reserve()
+	require.NoError(t, err)
+	require.InDelta(t, 2*time.Hour, delay, float64(time.Second))
+
+	_, err = bucket.ReserveN(4)
+	require.ErrorIs(t, err, ErrExceedsLimit)
+}
+
+func TestTokenBucketRefill(t *testing.T) {
+	defer goleak.VerifyNone(t)
+
+	const interval = 100 * time.Millisecond
+
+	bucket := NewTokenBucket(10, interval, 10)
+	defer bucket.Stop()
+
+	start := time.Now()
+	for range 30 {
+		require.NoError(t, bucket.Acquire(context.Background()))
+	}
+
+	// First 10 tokens are the burst, next 20 are refilled during 2 intervals.
+	elapsed := time.Since(start)
+	require.GreaterOrEqual(t, elapsed, 2*interval-10*time.Millisecond)
+	require.Less(t, elapsed, 3*interval)
+}
+
+func TestTokenBucketCancel(t *testing.T) {
+	defer goleak.VerifyNone(t)
+
+	bucket := NewTokenBucket(1, 100*time.Millisecond, 1)
+	defer bucket.Stop()
+
+	require.True(t, bucket.Allow())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	require.ErrorIs(t, bucket.Acquire(ctx), context.DeadlineExceeded)
+
+	start := time.Now()
+	require.NoError(t, bucket.Acquire(context.Background()))
+	require.Less(t, time.Since(start), 150*time.Millisecond)
+
+	bucket.Stop()
+	require.ErrorIs(t, bucket.Acquire(context.Background()), ErrStopped)
+}
+
+func TestTokenBucketNoLimit(t *testing.T) {
+	bucket := NewTokenBucket(1, 0, 1)
+	defer bucket.Stop()
+
+	for range 100 {
+		require.True(t, bucket.Allow())
+	}
+}
+
+func TestTokenBucketStress(t *testing.T) {
+	defer goleak.VerifyNone(t)
+
+	const (
+		N = 100
+		G = 100
+	)
+
+	bucket := NewTokenBucket(N, 10*time.Millisecond, N)
+	defer bucket.Stop()
+
+	var eg errgroup.Group
+	for range G {
+		eg.Go(func() error {
+			for range N {
+				if err := bucket.Acquire(context.Background()); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+	}
+
+	require.NoError(t, eg.Wait())
+}
+
+func BenchmarkTokenBucketAllow(b *testing.B) {
+	bucket := NewTokenBucket(1000, time.Millisecond, 1000)
+	defer bucket.Stop()
+
+	b.ReportAllocs()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			bucket.Allow()
+		}
+	})
+}
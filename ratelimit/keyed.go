@@ -0,0 +1,127 @@
+//go:build !solution
+
+package ratelimit
+
+import (
+	"container/list"
+	"context"
+	"sync"
+	"time"
+)
+
+type KeyedOptions struct {
+	// New creates limiter for the key seen for the first time.
+	New func() RateLimiter
+	// IdleTimeout is how long limiter of the unused key is kept. Zero means forever.
+	//
+	// IdleTimeout should be longer than the interval of the limiter, otherwise key is forgotten
+	// while its permits still count.
+	IdleTimeout time.Duration
+	// MaxKeys caps the number of keys. When it is reached, the least recently used key is evicted.
+	// Zero means no limit.
+	MaxKeys int
+}
+
+// KeyedLimiter holds separate limiter for every key, e.g. client IP or user name.
+//
+// Evicted limiters are not stopped, so calls already waiting on them finish normally.
+type KeyedLimiter struct {
+	opts KeyedOptions
+
+	mu      sync.Mutex
+	keys    map[string]*list.Element
+	lru     *list.List // of *keyedEntry, most recently used first.
+	stopped bool
+}
+
+type keyedEntry struct {
+	key      string
+	limiter  RateLimiter
+	lastUsed time.Time
+}
+
+func NewKeyedLimiter(opts KeyedOptions) *KeyedLimiter {
+	return &KeyedLimiter{
+		opts: opts,
+		keys: make(map[string]*list.Element),
+		lru:  list.New(),
+	}
+}
+
+// Limiter returns limiter of the key, creating it if needed.
+func (k *KeyedLimiter) Limiter(key string) (RateLimiter, error) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	if k.stopped {
+		return nil, ErrStopped
+	}
+
+	now := time.Now()
+	k.evictIdleLocked(now)
+
+	if el, ok := k.keys[key]; ok {
+		e := el.Value.(*keyedEntry)
+		e.lastUsed = now
+		k.lru.MoveToFront(el)
+		return e.limiter, nil
+	}
+
+	if k.opts.MaxKeys > 0 && k.lru.Len() >= k.opts.MaxKeys {
+		k.removeLocked(k.lru.Back())
+	}
+
+	e := &keyedEntry{key: key, limiter: k.opts.New(), lastUsed: now}
+	k.keys[key] = k.lru.PushFront(e)
+	return e.limiter, nil
+}
+
+func (k *KeyedLimiter) evictIdleLocked(now time.Time) {
+	if k.opts.IdleTimeout <= 0 {
+		return
+	}
+
+	for el := k.lru.Back(); el != nil; el = k.lru.Back() {
+		if now.Sub(el.Value.(*keyedEntry).lastUsed) < k.opts.IdleTimeout {
+			return
+		}
+		k.removeLocked(el)
+	}
+}
+
+func (k *KeyedLimiter) removeLocked(el *list.Element) {
+	delete(k.keys, el.Value.(*keyedEntry).key)
+	k.lru.Remove(el)
+}
+
+func (k *KeyedLimiter) Allow(key string) bool {
+	l, err := k.Limiter(key)
+	return err == nil && l.Allow()
+}
+
+func (k *KeyedLimiter) Acquire(ctx context.Context, key string) error {
+	l, err := k.Limiter(key)
+	if err != nil {
+		return err
+	}
+	return l.Acquire(ctx)
+}
+
+// Len returns the number of keys, including idle keys that are not evicted yet.
+func (k *KeyedLimiter) Len() int {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	return k.lru.Len()
+}
+
+// Stop stops limiters of all keys. Later calls fail with ErrStopped.
+func (k *KeyedLimiter) Stop() {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	k.stopped = true
+	for el := k.lru.Front(); el != nil; el = el.Next() {
+		el.Value.(*keyedEntry).limiter.Stop()
+	}
+}
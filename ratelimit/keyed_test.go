@@ -0,0 +1,93 @@
+package ratelimit
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func newKeyed(opts KeyedOptions) *KeyedLimiter {
+	opts.New = func() RateLimiter {
+		return NewLimiter(1, time.Hour)
+	}
+	return NewKeyedLimiter(opts)
+}
+
+func TestKeyedLimiter(t *testing.T) {
+	k := newKeyed(KeyedOptions{})
+	defer k.Stop()
+
+	require.True(t, k.Allow("a"))
+	require.False(t, k.Allow("a"))
+	require.True(t, k.Allow("b"))
+	require.Equal(t, 2, k.Len())
+
+	k.Stop()
+	require.False(t, k.Allow("c"))
+	require.ErrorIs(t, k.Acquire(context.Background(), "c"), ErrStopped)
+}
+
+func TestKeyedLimiterMaxKeys(t *testing.T) {
+	k := newKeyed(KeyedOptions{MaxKeys: 2})
+	defer k.Stop()
+
+	require.True(t, k.Allow("a"))
+	require.True(t, k.Allow("b"))
+	require.False(t, k.Allow("a"))
+
+	// b is the least recently used key.
+	require.True(t, k.Allow("c"))
+	require.Equal(t, 2, k.Len())
+
+	require.False(t, k.Allow("a"))
+	require.True(t, k.Allow("b"))
+}
+
+func TestKeyedLimiterIdle(t *testing.T) {
+	k := newKeyed(KeyedOptions{IdleTimeout: 100 * time.Millisecond})
+	defer k.Stop()
+
+	require.True(t, k.Allow("a"))
+	require.True(t, k.Allow("b"))
+
+	time.Sleep(40 * time.Millisecond)
+	require.False(t, k.Allow("a"))
+
+	time.Sleep(70 * time.Millisecond)
+	require.True(t, k.Allow("c"))
+	require.Equal(t, 2, k.Len())
+
+	time.Sleep(120 * time.Millisecond)
+	require.True(t, k.Allow("a"))
+	require.Equal(t, 1, k.Len())
+}
+
+func TestStatus(t *testing.T) {
+	for _, tc := range []struct {
+		name  string
+		limit RateLimiter
+	}{
+		{"Limiter", NewLimiter(3, time.Hour)},
+		{"TokenBucket", NewTokenBucket(3, time.Hour, 3)},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			defer tc.limit.Stop()
+
+			status := tc.limit.Status()
+			require.Equal(t, Status{Limit: 3, Remaining: 3}, status)
+
+			require.True(t, tc.limit.AllowN(2))
+			status = tc.limit.Status()
+			require.Equal(t, 1, status.Remaining)
+			require.Zero(t, status.RetryAfter)
+			require.Greater(t, status.Reset, 30*time.Minute)
+
+			require.True(t, tc.limit.Allow())
+			status = tc.limit.Status()
+			require.Equal(t, 0, status.Remaining)
+			require.Greater(t, status.RetryAfter, time.Duration(0))
+		})
+	}
+}
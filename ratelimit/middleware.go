@@ -0,0 +1,80 @@
+//go:build !solution
+
+package ratelimit
+
+import (
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+
+	"gitlab.com/slon/shad-go/middleware/auth"
+)
+
+// KeyFunc selects the key, whose limiter is applied to the request. Empty key disables limiting.
+type KeyFunc func(r *http.Request) string
+
+// KeyByIP limits requests by the IP address of the client.
+//
+// Proxy headers like X-Forwarded-For are ignored, because client can set them to any value.
+func KeyByIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return "ip:" + r.RemoteAddr
+	}
+	return "ip:" + host
+}
+
+// KeyByUser limits requests by the user set by auth.CheckAuth, and anonymous requests by IP.
+func KeyByUser(r *http.Request) string {
+	if u, ok := auth.ContextUser(r.Context()); ok {
+		return "user:" + u.Name
+	}
+	return KeyByIP(r)
+}
+
+// Limit returns middleware that replies 429 Too Many Requests, when limiter of the request key
+// has no permits.
+//
+// Every response carries X-RateLimit-Limit, X-RateLimit-Remaining and X-RateLimit-Reset headers,
+// and rejected responses carry Retry-After. Durations are in seconds, rounded up.
+func Limit(limiter *KeyedLimiter, key KeyFunc) func(next http.Handler) http.Handler {
+	mdw := func(next http.Handler) http.Handler {
+		f := func(w http.ResponseWriter, r *http.Request) {
+			k := key(r)
+			if k == "" {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			l, err := limiter.Limiter(k)
+			if err != nil {
+				w.WriteHeader(http.StatusServiceUnavailable)
+				return
+			}
+
+			allowed := l.Allow()
+			status := l.Status()
+
+			h := w.Header()
+			h.Set("X-RateLimit-Limit", strconv.Itoa(status.Limit))
+			h.Set("X-RateLimit-Remaining", strconv.Itoa(status.Remaining))
+			h.Set("X-RateLimit-Reset", seconds(status.Reset))
+
+			if !allowed {
+				h.Set("Retry-After", seconds(max(status.RetryAfter, time.Second)))
+				w.WriteHeader(http.StatusTooManyRequests)
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		}
+		return http.HandlerFunc(f)
+	}
+	return mdw
+}
+
+func seconds(d time.Duration) string {
+	return strconv.Itoa(int(math.Ceil(d.Seconds())))
+}
@@ -0,0 +1,87 @@
+package ratelimit_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"gitlab.com/slon/shad-go/middleware/auth"
+	"gitlab.com/slon/shad-go/ratelimit"
+)
+
+type fakeChecker map[string]*auth.User
+
+func (c fakeChecker) CheckToken(ctx context.Context, token string) (*auth.User, error) {
+	return c[token], nil
+}
+
+func TestMiddleware(t *testing.T) {
+	limiter := ratelimit.NewKeyedLimiter(ratelimit.KeyedOptions{
+		New: func() ratelimit.RateLimiter {
+			return ratelimit.NewLimiter(2, time.Minute)
+		},
+	})
+	defer limiter.Stop()
+
+	ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+	h := ratelimit.Limit(limiter, ratelimit.KeyByIP)(ok)
+
+	do := func(remoteAddr string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest("GET", "/", nil)
+		r.RemoteAddr = remoteAddr
+		h.ServeHTTP(w, r)
+		return w
+	}
+
+	w := do("10.0.0.1:1234")
+	require.Equal(t, http.StatusOK, w.Code)
+	require.Equal(t, "2", w.Header().Get("X-RateLimit-Limit"))
+	require.Equal(t, "1", w.Header().Get("X-RateLimit-Remaining"))
+	require.Equal(t, "60", w.Header().Get("X-RateLimit-Reset"))
+
+	require.Equal(t, http.StatusOK, do("10.0.0.1:4321").Code)
+
+	w = do("10.0.0.1:1234")
+	require.Equal(t, http.StatusTooManyRequests, w.Code)
+	require.Equal(t, "0", w.Header().Get("X-RateLimit-Remaining"))
+	require.Equal(t, "60", w.Header().Get("Retry-After"))
+
+	require.Equal(t, http.StatusOK, do("10.0.0.2:1234").Code)
+}
+
+func TestMiddlewareByUser(t *testing.T) {
+	limiter := ratelimit.NewKeyedLimiter(ratelimit.KeyedOptions{
+		New: func() ratelimit.RateLimiter {
+			return ratelimit.NewTokenBucket(1, time.Minute, 1)
+		},
+	})
+	defer limiter.Stop()
+
+	ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+	checker := fakeChecker{
+		"token0": {Name: "alice"},
+		"token1": {Name: "bob"},
+	}
+	h := auth.CheckAuth(checker)(ratelimit.Limit(limiter, ratelimit.KeyByUser)(ok))
+
+	do := func(token string) int {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest("GET", "/", nil)
+		r.Header.Set("Authorization", "Bearer "+token)
+		h.ServeHTTP(w, r)
+		return w.Code
+	}
+
+	require.Equal(t, http.StatusOK, do("token0"))
+	require.Equal(t, http.StatusTooManyRequests, do("token0"))
+	require.Equal(t, http.StatusOK, do("token1"))
+}
@@ -5,60 +5,227 @@ package ratelimit
 import (
 	"context"
 	"errors"
+	"sync"
 	"time"
 )
 
+var (
+	ErrStopped = errors.New("limiter stopped")
+	// ErrExceedsLimit is returned when more permits are requested at once than limiter ever allows.
+	ErrExceedsLimit = errors.New("number of permits exceeds limit")
+)
+
+// RateLimiter is implemented by Limiter and TokenBucket.
+type RateLimiter interface {
+	// Allow takes a permit if it is available now.
+	Allow() bool
+	AllowN(n int) bool
+
+	// Reserve takes a permit that becomes available after the returned delay. Caller must wait
+	// for the delay before doing the rate limited action. Reservation can't be canceled.
+	Reserve() (time.Duration, error)
+	ReserveN(n int) (time.Duration, error)
+
+	// Acquire waits for a permit. Permit is returned back to the limiter, if ctx is canceled
+	// or the limiter is stopped during the wait.
+	Acquire(ctx context.Context) error
+	AcquireN(ctx context.Context, n int) error
+
+	// Status describes current state of the limiter.
+	Status() Status
+
+	// Stop fails all running and future calls with ErrStopped.
+	Stop()
+}
+
+// Status describes state of the limiter at the moment.
+type Status struct {
+	// Limit is the maximal number of permits available at once.
+	Limit int
+	// Remaining is the number of permits available now.
+	Remaining int
+	// Reset is the time until all Limit permits are available again.
+	Reset time.Duration
+	// RetryAfter is the time until the next permit is available. It is zero when Remaining is not zero.
+	RetryAfter time.Duration
+}
+
+var _ RateLimiter = (*Limiter)(nil)
+
 // Limiter is precise rate limiter with context support.
+//
+// Limiter keeps log of the grant times of the recent permits and never grants more than
+// maxCount permits during any interval (sliding window log).
 type Limiter struct {
-	sema      chan struct{}
-	releaseTs chan time.Time
-	interval  time.Duration
-	stopped   bool
-	abortJob  chan struct{}
-}
+	maxCount int
+	interval time.Duration
+	start    time.Time
 
-var ErrStopped = errors.New("limiter stopped")
+	mu sync.Mutex
+	// log holds grant times of the permits, that may still affect next grants, in increasing order.
+	// Times of the reserved permits are in the future.
+	log     timeRing
+	stopped bool
+	stop    chan struct{}
+}
 
 // NewLimiter returns limiter that throttles rate of successful Acquire() calls
 // to maxSize events at any given interval.
 func NewLimiter(maxCount int, interval time.Duration) *Limiter {
-	limiter := &Limiter{
-		sema:      make(chan struct{}, maxCount),
-		releaseTs: make(chan time.Time, maxCount),
-		interval:  interval,
-		stopped:   false,
-		abortJob:  make(chan struct{}, 1),
+	return &Limiter{
+		maxCount: maxCount,
+		interval: interval,
+		start:    time.Now(),
+		log:      newTimeRing(maxCount),
+		stop:     make(chan struct{}),
 	}
-	go limiter.releaseJob()
-	return limiter
 }
 
-func (l *Limiter) Acquire(ctx context.Context) error {
+func (l *Limiter) now() time.Duration {
+	return time.Since(l.start)
+}
+
+// nextLocked returns the earliest time when n permits can be granted.
+func (l *Limiter) nextLocked(now time.Duration, n int) time.Duration {
+	l.log.dropUntil(now - l.interval)
+
+	// Permits are granted in order, otherwise earlier grant could overflow window of the later one.
+	at := now
+	if l.log.len() > 0 {
+		at = max(at, l.log.back())
+	}
+
+	// Window (at-interval, at] must contain at most maxCount-n old grants.
+	if k := l.log.len() - (l.maxCount - n); k > 0 {
+		at = max(at, l.log.at(k-1)+l.interval)
+	}
+	return at
+}
+
+func (l *Limiter) commitLocked(at time.Duration, n int) {
+	for range n {
+		l.log.push(at)
+	}
+}
+
+func (l *Limiter) Allow() bool {
+	return l.AllowN(1)
+}
+
+func (l *Limiter) AllowN(n int) bool {
+	if n > l.maxCount {
+		return false
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
 	if l.stopped {
-		return ErrStopped
+		return false
 	}
-	select {
-	case <-ctx.Done():
-		return ctx.Err()
-	case l.sema <- struct{}{}:
-		l.releaseTs <- time.Now().Add(l.interval)
+
+	now := l.now()
+	at := l.nextLocked(now, n)
+	if at > now {
+		return false
+	}
+	l.commitLocked(at, n)
+	return true
+}
+
+func (l *Limiter) Reserve() (time.Duration, error) {
+	return l.ReserveN(1)
+}
+
+func (l *Limiter) ReserveN(n int) (time.Duration, error) {
+	_, delay, err := l.reserve(n)
+	return delay, err
+}
+
+func (l *Limiter) reserve(n int) (at, delay time.Duration, err error) {
+	if n > l.maxCount {
+		return 0, 0, ErrExceedsLimit
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.stopped {
+		return 0, 0, ErrStopped
+	}
+
+	now := l.now()
+	at = l.nextLocked(now, n)
+	l.commitLocked(at, n)
+	return at, at - now, nil
+}
+
+func (l *Limiter) Acquire(ctx context.Context) error {
+	return l.AcquireN(ctx, 1)
+}
+
+func (l *Limiter) AcquireN(ctx context.Context, n int) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	at, delay, err := l.reserve(n)
+	if err != nil {
+		return err
+	}
+
+	if err := wait(ctx, l.stop, delay); err != nil {
+		l.mu.Lock()
+		l.log.remove(at, n)
+		l.mu.Unlock()
+		return err
 	}
 	return nil
 }
 
+func (l *Limiter) Status() Status {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	status := Status{Limit: l.maxCount}
+	if l.maxCount > 0 {
+		status.RetryAfter = l.nextLocked(now, 1) - now
+	}
+
+	// After nextLocked log holds only grants inside the current window and the reserved ones.
+	status.Remaining = max(l.maxCount-l.log.len(), 0)
+	if l.log.len() > 0 {
+		status.Reset = max(l.log.back()+l.interval-now, 0)
+	}
+	return status
+}
+
 func (l *Limiter) Stop() {
-	l.stopped = true
-	l.abortJob <- struct{}{}
-	close(l.releaseTs)
-}
-
-func (l *Limiter) releaseJob() {
-	for ts := range l.releaseTs {
-		select {
-		case <-time.After(time.Until(ts)):
-			<-l.sema
-		case <-l.abortJob:
-			return
-		}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if !l.stopped {
+		l.stopped = true
+		close(l.stop)
+	}
+}
+
+// wait sleeps for delay. It returns early with error when ctx is canceled or stop is closed.
+func wait(ctx context.Context, stop <-chan struct{}, delay time.Duration) error {
+	if delay <= 0 {
+		return nil
+	}
+
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-stop:
+		return ErrStopped
 	}
 }
@@ -222,3 +222,100 @@ func TestStressNoBlocking(t *testing.T) {
 
 	require.NoError(t, eg.Wait())
 }
+
+func TestAllowReserve(t *testing.T) {
+	limit := NewLimiter(2, time.Hour)
+	defer limit.Stop()
+
+	require.True(t, limit.Allow())
+	require.True(t, limit.Allow())
+	require.False(t, limit.Allow())
+
+	delay, err := limit.Reserve()
+	require.NoError(t, err)
+	require.InDelta(t, time.Hour, delay, float64(time.Second))
+
+	_, err = limit.ReserveN(3)
+	require.ErrorIs(t, err, ErrExceedsLimit)
+
+	limit.Stop()
+	require.False(t, limit.Allow())
+	_, err = limit.Reserve()
+	require.ErrorIs(t, err, ErrStopped)
+}
+
+func TestAcquireN(t *testing.T) {
+	defer goleak.VerifyNone(t)
+
+	const interval = 100 * time.Millisecond
+
+	limit := NewLimiter(3, interval)
+	defer limit.Stop()
+
+	start := time.Now()
+	require.NoError(t, limit.AcquireN(context.Background(), 2))
+	require.NoError(t, limit.AcquireN(context.Background(), 2))
+	require.GreaterOrEqual(t, time.Since(start), interval)
+
+	require.ErrorIs(t, limit.AcquireN(context.Background(), 4), ErrExceedsLimit)
+}
+
+func TestCanceledAcquireReturnsPermit(t *testing.T) {
+	defer goleak.VerifyNone(t)
+
+	limit := NewLimiter(1, 100*time.Millisecond)
+	defer limit.Stop()
+
+	require.True(t, limit.Allow())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	require.ErrorIs(t, limit.Acquire(ctx), context.DeadlineExceeded)
+
+	// Canceled Acquire must not delay the next one by another interval.
+	start := time.Now()
+	require.NoError(t, limit.Acquire(context.Background()))
+	require.Less(t, time.Since(start), 150*time.Millisecond)
+}
+
+func TestStopWakesWaiters(t *testing.T) {
+	defer goleak.VerifyNone(t)
+
+	limit := NewLimiter(1, time.Hour)
+	require.True(t, limit.Allow())
+
+	errs := make(chan error)
+	go func() {
+		errs <- limit.Acquire(context.Background())
+	}()
+
+	time.Sleep(10 * time.Millisecond)
+	limit.Stop()
+	require.ErrorIs(t, <-errs, ErrStopped)
+}
+
+func BenchmarkAllow(b *testing.B) {
+	limit := NewLimiter(1000, time.Millisecond)
+	defer limit.Stop()
+
+	b.ReportAllocs()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			limit.Allow()
+		}
+	})
+}
+
+func BenchmarkAcquire(b *testing.B) {
+	limit := NewLimiter(b.N, time.Hour)
+	defer limit.Stop()
+
+	ctx := context.Background()
+
+	b.ReportAllocs()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			_ = limit.Acquire(ctx)
+		}
+	})
+}
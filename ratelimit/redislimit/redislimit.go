@@ -0,0 +1,248 @@
+//go:build !solution
+
+// Package redislimit implements rate limiter shared by many processes through Redis.
+package redislimit
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+
+	"gitlab.com/slon/shad-go/ratelimit"
+)
+
+// Fallback defines what Limiter does, when Redis is unavailable.
+type Fallback int
+
+const (
+	// FailClosed returns the Redis error from Acquire.
+	FailClosed Fallback = iota
+	// FailOpen lets all calls through.
+	FailOpen
+	// FailLocal uses Options.Local limiter of this process.
+	FailLocal
+)
+
+type Options struct {
+	// Key is the Redis key holding the state of the limiter. Processes using the same key share the limit.
+	Key string
+
+	// Limiter allows Count events per Interval on average, and bursts of up to Burst events.
+	// Zero Burst means Count. Zero Count or Interval means no limit.
+	Count    int
+	Interval time.Duration
+	Burst    int
+
+	Fallback Fallback
+	// Local is used with FailLocal and must be set with it. It usually allows only a part of the global rate.
+	Local ratelimit.RateLimiter
+}
+
+// Limiter is distributed token bucket, implemented with GCRA (generic cell rate algorithm).
+//
+// Whole state is one timestamp in Redis, updated by Lua script, so concurrent calls from different
+// processes are atomic. Time is taken from Redis, so clocks of the processes don't matter.
+type Limiter struct {
+	rdb  redis.UniversalClient
+	opts Options
+	// every is the time to refill one token. Zero means no limit.
+	every time.Duration
+
+	stopOnce sync.Once
+	stop     chan struct{}
+}
+
+// acquireScript reserves ARGV[3] tokens and returns delay in microseconds, after which they are
+// available. If ARGV[4] is "0" and tokens are not available now, nothing is reserved and -1 is returned.
+//
+// Key holds the time when the bucket becomes full, in microseconds, and expires at that time.
+var acquireScript = redis.NewScript(`
+local every = tonumber(ARGV[1])
+local burst = tonumber(ARGV[2])
+local n = tonumber(ARGV[3])
+local wait = ARGV[4] == "1"
+
+local t = redis.call("TIME")
+local now = tonumber(t[1]) * 1000000 + tonumber(t[2])
+
+local full = tonumber(redis.call("GET", KEYS[1])) or 0
+if full < now then
+	full = now
+end
+full = full + n * every
+
+local at = full - burst * every
+if at < now then
+	at = now
+end
+
+if at > now and not wait then
+	return -1
+end
+
+redis.call("SET", KEYS[1], string.format("%.0f", full), "PX", string.format("%.0f", math.max(1, math.ceil((full - now) / 1000))))
+return at - now
+`)
+
+// cancelScript returns ARGV[1] microseconds of reserved tokens back.
+var cancelScript = redis.NewScript(`
+if redis.call("EXISTS", KEYS[1]) == 1 then
+	redis.call("DECRBY", KEYS[1], ARGV[1])
+end
+return 0
+`)
+
+// New creates limiter. It panics, if opts.Fallback is FailLocal and opts.Local is not set.
+func New(rdb redis.UniversalClient, opts Options) *Limiter {
+	if opts.Fallback == FailLocal && opts.Local == nil {
+		panic("redislimit: FailLocal fallback requires Options.Local")
+	}
+
+	l := &Limiter{
+		rdb:  rdb,
+		opts: opts,
+		stop: make(chan struct{}),
+	}
+	if opts.Count > 0 && opts.Interval > 0 {
+		// State is kept in microseconds.
+		l.every = max(opts.Interval/time.Duration(opts.Count), time.Microsecond)
+	}
+	if l.opts.Burst <= 0 {
+		l.opts.Burst = opts.Count
+	}
+	return l
+}
+
+func (l *Limiter) Acquire(ctx context.Context) error {
+	return l.AcquireN(ctx, 1)
+}
+
+// AcquireN waits for n permits. Permits are returned back, if ctx is canceled or the limiter
+// is stopped during the wait.
+func (l *Limiter) AcquireN(ctx context.Context, n int) error {
+	if l.every != 0 && n > l.opts.Burst {
+		return ratelimit.ErrExceedsLimit
+	}
+
+	select {
+	case <-l.stop:
+		return ratelimit.ErrStopped
+	default:
+	}
+
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	// Zero permits are always available and don't touch Redis.
+	if l.every == 0 || n <= 0 {
+		return nil
+	}
+
+	delay, err := l.reserve(ctx, n, true)
+	if err != nil {
+		return l.fallback(ctx, n, err)
+	}
+
+	if delay <= 0 {
+		return nil
+	}
+
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		l.cancel(n)
+		return ctx.Err()
+	case <-l.stop:
+		l.cancel(n)
+		return ratelimit.ErrStopped
+	}
+}
+
+// AllowN takes n permits, if they are available now.
+func (l *Limiter) AllowN(ctx context.Context, n int) (bool, error) {
+	if l.every != 0 && n > l.opts.Burst {
+		return false, nil
+	}
+
+	select {
+	case <-l.stop:
+		return false, ratelimit.ErrStopped
+	default:
+	}
+
+	if l.every == 0 || n <= 0 {
+		return true, nil
+	}
+
+	delay, err := l.reserve(ctx, n, false)
+	if err != nil {
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return false, ctxErr
+		}
+
+		switch l.opts.Fallback {
+		case FailOpen:
+			return true, nil
+		case FailLocal:
+			return l.opts.Local.AllowN(n), nil
+		default:
+			return false, err
+		}
+	}
+	return delay >= 0, nil
+}
+
+func (l *Limiter) reserve(ctx context.Context, n int, wait bool) (time.Duration, error) {
+	waitArg := "0"
+	if wait {
+		waitArg = "1"
+	}
+
+	us, err := acquireScript.Run(ctx, l.rdb, []string{l.opts.Key},
+		l.every.Microseconds(), l.opts.Burst, n, waitArg).Int64()
+	if err != nil {
+		return 0, err
+	}
+	if us < 0 {
+		return -1, nil
+	}
+	return time.Duration(us) * time.Microsecond, nil
+}
+
+// fallback handles the Redis error according to Options.Fallback.
+func (l *Limiter) fallback(ctx context.Context, n int, err error) error {
+	if ctxErr := ctx.Err(); ctxErr != nil {
+		return ctxErr
+	}
+
+	switch l.opts.Fallback {
+	case FailOpen:
+		return nil
+	case FailLocal:
+		return l.opts.Local.AcquireN(ctx, n)
+	default:
+		return err
+	}
+}
+
+// cancel returns reserved tokens. Errors are ignored: at worst the tokens are lost until the bucket refills.
+func (l *Limiter) cancel(n int) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	_ = cancelScript.Run(ctx, l.rdb, []string{l.opts.Key}, int64(n)*l.every.Microseconds()).Err()
+}
+
+// Stop fails all running and future calls with ErrStopped. It does not close Redis client.
+func (l *Limiter) Stop() {
+	l.stopOnce.Do(func() {
+		close(l.stop)
+	})
+}
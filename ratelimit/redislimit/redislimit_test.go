@@ -0,0 +1,221 @@
+package redislimit
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/goleak"
+
+	"gitlab.com/slon/shad-go/ratelimit"
+	"gitlab.com/slon/shad-go/redisfixture"
+	"gitlab.com/slon/shad-go/tools/testtool"
+)
+
+func newClient(t *testing.T) *redis.Client {
+	rdb := redis.NewClient(&redis.Options{
+		Addr: redisfixture.StartRedis(t),
+	})
+	t.Cleanup(func() { _ = rdb.Close() })
+	return rdb
+}
+
+func TestLimiter_Burst(t *testing.T) {
+	rdb := newClient(t)
+	ctx := context.Background()
+
+	l := New(rdb, Options{Key: "burst", Count: 1, Interval: time.Hour, Burst: 3})
+	defer l.Stop()
+
+	for range 3 {
+		ok, err := l.AllowN(ctx, 1)
+		require.NoError(t, err)
+		require.True(t, ok)
+	}
+
+	ok, err := l.AllowN(ctx, 1)
+	require.NoError(t, err)
+	require.False(t, ok)
+
+	ok, err = l.AllowN(ctx, 4)
+	require.NoError(t, err)
+	require.False(t, ok)
+	require.ErrorIs(t, l.AcquireN(ctx, 4), ratelimit.ErrExceedsLimit)
+}
+
+func TestLimiter_DefaultBurst(t *testing.T) {
+	port, err := testtool.GetFreePort()
+	require.NoError(t, err)
+
+	// Redis is not running, so calls that pass the burst check are let through by FailOpen.
+	rdb := redis.NewClient(&redis.Options{
+		Addr:       "localhost:" + port,
+		MaxRetries: -1,
+	})
+	defer func() { _ = rdb.Close() }()
+
+	ctx := context.Background()
+
+	l := New(rdb, Options{Key: "default-burst", Count: 3, Interval: time.Hour, Fallback: FailOpen})
+	defer l.Stop()
+
+	require.NoError(t, l.AcquireN(ctx, 3))
+	require.ErrorIs(t, l.AcquireN(ctx, 4), ratelimit.ErrExceedsLimit)
+
+	ok, err := l.AllowN(ctx, 3)
+	require.NoError(t, err)
+	require.True(t, ok)
+
+	unlimited := New(rdb, Options{Key: "unlimited"})
+	defer unlimited.Stop()
+	require.NoError(t, unlimited.AcquireN(ctx, 100))
+}
+
+func TestLimiter_ZeroPermits(t *testing.T) {
+	port, err := testtool.GetFreePort()
+	require.NoError(t, err)
+
+	// Redis is not running and FailClosed returns its errors, so any call to Redis fails.
+	rdb := redis.NewClient(&redis.Options{
+		Addr:       "localhost:" + port,
+		MaxRetries: -1,
+	})
+	defer func() { _ = rdb.Close() }()
+
+	ctx := context.Background()
+
+	l := New(rdb, Options{Key: "zero", Count: 3, Interval: time.Hour})
+	defer l.Stop()
+
+	require.NoError(t, l.AcquireN(ctx, 0))
+
+	ok, err := l.AllowN(ctx, 0)
+	require.NoError(t, err)
+	require.True(t, ok)
+
+	require.Error(t, l.AcquireN(ctx, 1))
+}
+
+func TestNew_FailLocalRequiresLocal(t *testing.T) {
+	require.Panics(t, func() {
+		New(nil, Options{Key: "local", Count: 3, Interval: time.Hour, Fallback: FailLocal})
+	})
+}
+
+func TestLimiter_Shared(t *testing.T) {
+	rdb := newClient(t)
+	ctx := context.Background()
+
+	opts := Options{Key: "shared", Count: 1, Interval: time.Hour, Burst: 2}
+	a, b := New(rdb, opts), New(rdb, opts)
+	defer a.Stop()
+	defer b.Stop()
+
+	require.NoError(t, a.Acquire(ctx))
+	require.NoError(t, b.Acquire(ctx))
+
+	ok, err := a.AllowN(ctx, 1)
+	require.NoError(t, err)
+	require.False(t, ok)
+
+	other := New(rdb, Options{Key: "other", Count: 1, Interval: time.Hour, Burst: 2})
+	ok, err = other.AllowN(ctx, 1)
+	require.NoError(t, err)
+	require.True(t, ok)
+}
+
+func TestLimiter_Rate(t *testing.T) {
+	defer goleak.VerifyNone(t)
+
+	rdb := newClient(t)
+	ctx := context.Background()
+
+	const interval = 100 * time.Millisecond
+
+	l := New(rdb, Options{Key: "rate", Count: 10, Interval: interval, Burst: 1})
+	defer l.Stop()
+
+	start := time.Now()
+	for range 11 {
+		require.NoError(t, l.Acquire(ctx))
+	}
+	require.GreaterOrEqual(t, time.Since(start), interval-5*time.Millisecond)
+}
+
+func TestLimiter_Cancel(t *testing.T) {
+	rdb := newClient(t)
+
+	l := New(rdb, Options{Key: "cancel", Count: 1, Interval: 200 * time.Millisecond, Burst: 1})
+	defer l.Stop()
+
+	require.NoError(t, l.Acquire(context.Background()))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	require.ErrorIs(t, l.Acquire(ctx), context.DeadlineExceeded)
+
+	// Canceled reservation is returned, so the next Acquire waits one interval, not two.
+	start := time.Now()
+	require.NoError(t, l.Acquire(context.Background()))
+	require.Less(t, time.Since(start), 300*time.Millisecond)
+
+	errs := make(chan error)
+	go func() {
+		errs <- l.Acquire(context.Background())
+	}()
+
+	time.Sleep(10 * time.Millisecond)
+	l.Stop()
+	require.ErrorIs(t, <-errs, ratelimit.ErrStopped)
+}
+
+func TestLimiter_Fallback(t *testing.T) {
+	port, err := testtool.GetFreePort()
+	require.NoError(t, err)
+
+	rdb := redis.NewClient(&redis.Options{
+		Addr:       "localhost:" + port,
+		MaxRetries: -1,
+	})
+	defer func() { _ = rdb.Close() }()
+
+	ctx := context.Background()
+	opts := Options{Key: "fallback", Count: 1, Interval: time.Hour, Burst: 1}
+
+	t.Run("FailClosed", func(t *testing.T) {
+		l := New(rdb, opts)
+		require.Error(t, l.Acquire(ctx))
+
+		_, err := l.AllowN(ctx, 1)
+		require.Error(t, err)
+	})
+
+	t.Run("FailOpen", func(t *testing.T) {
+		opts := opts
+		opts.Fallback = FailOpen
+
+		l := New(rdb, opts)
+		require.NoError(t, l.Acquire(ctx))
+		require.NoError(t, l.Acquire(ctx))
+	})
+
+	t.Run("FailLocal", func(t *testing.T) {
+		opts := opts
+		opts.Fallback = FailLocal
+		opts.Local = ratelimit.NewLimiter(1, time.Hour)
+		defer opts.Local.Stop()
+
+		l := New(rdb, opts)
+		require.NoError(t, l.Acquire(ctx))
+
+		ok, err := l.AllowN(ctx, 1)
+		require.NoError(t, err)
+		require.False(t, ok)
+
+		ctx, cancel := context.WithTimeout(ctx, 10*time.Millisecond)
+		defer cancel()
+		require.ErrorIs(t, l.Acquire(ctx), context.DeadlineExceeded)
+	})
+}
@@ -0,0 +1,68 @@
+//go:build !solution
+
+package ratelimit
+
+import "time"
+
+// timeRing is a double-ended queue of grant times, measured from the start of the limiter.
+//
+// It grows only when more permits are reserved ahead than it can hold, so in steady state
+// it does not allocate.
+type timeRing struct {
+	buf  []time.Duration
+	head int
+	size int
+}
+
+func newTimeRing(capacity int) timeRing {
+	return timeRing{buf: make([]time.Duration, max(capacity, 1))}
+}
+
+func (r *timeRing) len() int {
+	return r.size
+}
+
+// at returns i-th entry, counting from the oldest one.
+func (r *timeRing) at(i int) time.Duration {
+	return r.buf[(r.head+i)%len(r.buf)]
+}
+
+func (r *timeRing) back() time.Duration {
+	return r.at(r.size - 1)
+}
+
+func (r *timeRing) push(t time.Duration) {
+	if r.size == len(r.buf) {
+		buf := make([]time.Duration, 2*len(r.buf))
+		for i := range r.size {
+			buf[i] = r.at(i)
+		}
+		r.buf, r.head = buf, 0
+	}
+
+	r.buf[(r.head+r.size)%len(r.buf)] = t
+	r.size++
+}
+
+// dropUntil removes entries that are not after t.
+func (r *timeRing) dropUntil(t time.Duration) {
+	for r.size > 0 && r.buf[r.head] <= t {
+		r.head = (r.head + 1) % len(r.buf)
+		r.size--
+	}
+}
+
+// remove deletes up to n entries equal to t, starting from the newest ones.
+func (r *timeRing) remove(t time.Duration, n int) {
+	for i := r.size - 1; i >= 0 && n > 0; i-- {
+		if r.at(i) != t {
+			continue
+		}
+
+		for j := i; j < r.size-1; j++ {
+			r.buf[(r.head+j)%len(r.buf)] = r.at(j + 1)
+		}
+		r.size--
+		n--
+	}
+}
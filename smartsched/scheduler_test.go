@@ -18,6 +18,7 @@ import (
 
 const (
 	workerID0 api.WorkerID = "w0"
+	workerID1 api.WorkerID = "w1"
 )
 
 var (
@@ -34,6 +35,10 @@ type testScheduler struct {
 }
 
 func newTestScheduler(t *testing.T) *testScheduler {
+	return newTestSchedulerWithConfig(t, config)
+}
+
+func newTestSchedulerWithConfig(t *testing.T, config scheduler.Config) *testScheduler {
 	log := zaptest.NewLogger(t)
 
 	fakeClock := clockwork.NewFakeClock()
@@ -148,3 +153,366 @@ func TestScheduler_DependencyLocalScheduling(t *testing.T) {
 	secondPickedJob := s.PickJob(context.Background(), workerID0)
 	require.Equal(t, pendingJob2, secondPickedJob)
 }
+
+func TestScheduler_PriorityOrder(t *testing.T) {
+	s := newTestScheduler(t)
+	defer s.stop(t)
+
+	lowJob := &api.JobSpec{Job: build.Job{ID: build.NewID()}, Priority: 1}
+	highJob := &api.JobSpec{Job: build.Job{ID: build.NewID()}, Priority: 5}
+
+	s.RegisterWorker(workerID0)
+	s.OnJobComplete(workerID0, lowJob.ID, &api.JobResult{})
+	s.OnJobComplete(workerID0, highJob.ID, &api.JobResult{})
+
+	pendingLowJob := s.ScheduleJob(lowJob)
+	pendingHighJob := s.ScheduleJob(highJob)
+
+	s.BlockUntil(2) // both jobs are in the first local queue
+
+	firstPickedJob := s.PickJob(context.Background(), workerID0)
+	require.Equal(t, pendingHighJob, firstPickedJob)
+
+	secondPickedJob := s.PickJob(context.Background(), workerID0)
+	require.Equal(t, pendingLowJob, secondPickedJob)
+}
+
+func TestScheduler_PriorityRaise(t *testing.T) {
+	s := newTestScheduler(t)
+	defer s.stop(t)
+
+	job0 := &api.JobSpec{Job: build.Job{ID: build.NewID()}, Priority: 1}
+	job1 := &api.JobSpec{Job: build.Job{ID: build.NewID()}, Priority: 2}
+
+	s.RegisterWorker(workerID0)
+	s.OnJobComplete(workerID0, job0.ID, &api.JobResult{})
+	s.OnJobComplete(workerID0, job1.ID, &api.JobResult{})
+
+	pendingJob0 := s.ScheduleJob(job0)
+	pendingJob1 := s.ScheduleJob(job1)
+
+	// Same job scheduled by another build with higher priority.
+	require.Equal(t, pendingJob0, s.ScheduleJob(&api.JobSpec{Job: job0.Job, Priority: 3}))
+
+	firstPickedJob := s.PickJob(context.Background(), workerID0)
+	require.Equal(t, pendingJob0, firstPickedJob)
+
+	secondPickedJob := s.PickJob(context.Background(), workerID0)
+	require.Equal(t, pendingJob1, secondPickedJob)
+}
+
+func TestScheduler_QueueStats(t *testing.T) {
+	s := newTestScheduler(t)
+	defer s.stop(t)
+
+	job0 := &api.JobSpec{Job: build.Job{ID: build.NewID()}, Priority: 1}
+	job1 := &api.JobSpec{Job: build.Job{ID: build.NewID(), Deps: []build.ID{job0.ID}}}
+
+	s.RegisterWorker(workerID0)
+	s.RegisterWorker(workerID1)
+	s.OnJobComplete(workerID0, job0.ID, &api.JobResult{})
+	s.OnJobComplete(workerID1, job0.ID, &api.JobResult{})
+
+	pendingJob0 := s.ScheduleJob(job0)
+	s.ScheduleJob(&api.JobSpec{Job: job0.Job, Priority: 2})
+	s.ScheduleJob(job1)
+
+	stats := s.Stats()
+	require.Equal(t, 2, stats.CachedQueue)
+	require.Equal(t, 2, stats.DepsQueue)
+
+	require.Equal(t, pendingJob0, s.PickJob(context.Background(), workerID0))
+
+	stats = s.Stats()
+	require.Equal(t, 0, stats.CachedQueue)
+	require.Equal(t, 2, stats.DepsQueue)
+}
+
+func TestScheduler_CancelJob(t *testing.T) {
+	s := newTestScheduler(t)
+	defer s.stop(t)
+
+	job0 := &api.JobSpec{Job: build.Job{ID: build.NewID()}}
+	s.RegisterWorker(workerID0)
+	s.OnJobComplete(workerID0, job0.ID, &api.JobResult{})
+
+	// Two builds are waiting for the same job.
+	pendingJob0 := s.ScheduleJob(job0)
+	require.Equal(t, pendingJob0, s.ScheduleJob(job0))
+
+	require.Equal(t, pendingJob0, s.PickJob(context.Background(), workerID0))
+
+	s.CancelJob(pendingJob0)
+	require.Empty(t, s.TakeCancelledJobs(workerID0))
+
+	s.CancelJob(pendingJob0)
+	require.Equal(t, []build.ID{job0.ID}, s.TakeCancelledJobs(workerID0))
+
+	select {
+	case <-pendingJob0.Finished:
+		require.NotNil(t, pendingJob0.Result.Error)
+	default:
+		t.Fatalf("job0 is not finished")
+	}
+}
+
+func TestScheduler_RemoveArtifact(t *testing.T) {
+	s := newTestScheduler(t)
+	defer s.stop(t)
+
+	id := build.NewID()
+
+	s.RegisterWorker(workerID0)
+	s.RegisterArtifact(workerID0, id)
+
+	workerID, ok := s.LocateArtifact(id)
+	require.True(t, ok)
+	require.Equal(t, workerID0, workerID)
+
+	s.RemoveArtifact(workerID0, id)
+
+	_, ok = s.LocateArtifact(id)
+	require.False(t, ok)
+}
+
+func TestScheduler_LostWorker(t *testing.T) {
+	config := config
+	config.HeartbeatTimeout = 10 * time.Second
+	config.MaxAttempts = 2
+
+	s := newTestSchedulerWithConfig(t, config)
+	defer s.stop(t)
+
+	job0 := &api.JobSpec{Job: build.Job{ID: build.NewID()}}
+	pendingJob0 := s.ScheduleJob(job0)
+
+	s.BlockUntil(1)
+	s.Advance(config.DepsTimeout) // At this point job must be in global queue.
+
+	artifact := build.NewID()
+	s.RegisterWorker(workerID0)
+	s.RegisterArtifact(workerID0, artifact)
+	require.Equal(t, pendingJob0, s.PickJob(context.Background(), workerID0))
+
+	s.BlockUntil(1)
+	s.Advance(config.HeartbeatTimeout) // Worker is lost, job goes back to global queue.
+
+	s.RegisterWorker(workerID1)
+	require.Equal(t, pendingJob0, s.PickJob(context.Background(), workerID1))
+
+	_, ok := s.LocateArtifact(artifact)
+	require.False(t, ok)
+
+	// Late result of the lost worker is accepted.
+	require.True(t, s.OnJobComplete(workerID0, job0.ID, &api.JobResult{ID: job0.ID}))
+
+	select {
+	case <-pendingJob0.Finished:
+		require.Equal(t, []api.JobAttempt{
+			{WorkerID: workerID0, Error: "worker stopped sending heartbeats"},
+		}, pendingJob0.Result.Attempts)
+
+	default:
+		t.Fatalf("job0 is not finished")
+	}
+}
+
+func TestScheduler_TransientRetry(t *testing.T) {
+	config := config
+	config.MaxAttempts = 2
+
+	s := newTestSchedulerWithConfig(t, config)
+	defer s.stop(t)
+
+	job0 := &api.JobSpec{Job: build.Job{ID: build.NewID()}}
+	pendingJob0 := s.ScheduleJob(job0)
+
+	s.BlockUntil(1)
+	s.Advance(config.DepsTimeout)
+
+	transient := func() *api.JobResult {
+		errorString := "download failed"
+		return &api.JobResult{ID: job0.ID, Error: &errorString, Transient: true}
+	}
+
+	s.RegisterWorker(workerID0)
+	require.Equal(t, pendingJob0, s.PickJob(context.Background(), workerID0))
+	require.False(t, s.OnJobComplete(workerID0, job0.ID, transient()))
+
+	// Result of the non-running job is ignored.
+	require.False(t, s.OnJobComplete(workerID1, job0.ID, transient()))
+
+	require.Equal(t, pendingJob0, s.PickJob(context.Background(), workerID0))
+	require.True(t, s.OnJobComplete(workerID0, job0.ID, transient()))
+
+	select {
+	case <-pendingJob0.Finished:
+		require.Equal(t, "download failed", *pendingJob0.Result.Error)
+		require.Equal(t, []api.JobAttempt{
+			{WorkerID: workerID0, Error: "download failed"},
+		}, pendingJob0.Result.Attempts)
+
+	default:
+		t.Fatalf("job0 is not finished")
+	}
+}
+
+func TestScheduler_RetryDropsLocalQueues(t *testing.T) {
+	config := config
+	config.MaxAttempts = 2
+
+	s := newTestSchedulerWithConfig(t, config)
+	defer s.stop(t)
+
+	job0 := &api.JobSpec{Job: build.Job{ID: build.NewID()}}
+	job1 := &api.JobSpec{Job: build.Job{ID: build.NewID()}}
+
+	s.RegisterWorker(workerID0)
+	s.RegisterWorker(workerID1)
+	s.OnJobComplete(workerID0, job0.ID, &api.JobResult{})
+	s.OnJobComplete(workerID0, job1.ID, &api.JobResult{})
+	s.OnJobComplete(workerID1, job1.ID, &api.JobResult{})
+
+	pendingJob0 := s.ScheduleJob(job0)
+	pendingJob1 := s.ScheduleJob(job1)
+
+	transient := func(id build.ID) *api.JobResult {
+		errorString := "download failed"
+		return &api.JobResult{ID: id, Error: &errorString, Transient: true}
+	}
+
+	require.Equal(t, pendingJob0, s.PickJob(context.Background(), workerID0))
+	require.Equal(t, pendingJob1, s.PickJob(context.Background(), workerID0))
+	require.False(t, s.OnJobComplete(workerID0, job0.ID, transient(job0.ID)))
+	require.False(t, s.OnJobComplete(workerID0, job1.ID, transient(job1.ID)))
+
+	// Retried jobs are waiting in the global queue only. Old entry of job1 in the cache queue of w1 is ignored.
+	stats := s.Stats()
+	require.Equal(t, 2, stats.GlobalQueue)
+	require.Equal(t, 0, stats.CachedQueue)
+
+	require.Equal(t, pendingJob0, s.PickJob(context.Background(), workerID1))
+	require.Equal(t, pendingJob1, s.PickJob(context.Background(), workerID1))
+}
+
+func TestScheduler_Quarantine(t *testing.T) {
+	config := config
+	config.MaxAttempts = 10
+	config.QuarantineThreshold = 2
+	config.QuarantineDuration = time.Hour
+
+	s := newTestSchedulerWithConfig(t, config)
+	defer s.stop(t)
+
+	job0 := &api.JobSpec{Job: build.Job{ID: build.NewID()}}
+	pendingJob0 := s.ScheduleJob(job0)
+
+	s.BlockUntil(1)
+	s.Advance(config.DepsTimeout)
+
+	errorString := "download failed"
+	s.RegisterWorker(workerID0)
+	for i := 0; i < config.QuarantineThreshold; i++ {
+		require.Equal(t, pendingJob0, s.PickJob(context.Background(), workerID0))
+		s.OnJobComplete(workerID0, job0.ID, &api.JobResult{ID: job0.ID, Error: &errorString, Transient: true})
+	}
+
+	require.Equal(t, 1, s.Stats().Quarantined)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	require.Nil(t, s.PickJob(ctx, workerID0))
+
+	// Healthy worker still gets the job.
+	s.RegisterWorker(workerID1)
+	require.Equal(t, pendingJob0, s.PickJob(context.Background(), workerID1))
+
+	s.BlockUntil(1)
+	s.Advance(config.QuarantineDuration)
+
+	require.Eventually(t, func() bool {
+		return s.Stats().Quarantined == 0
+	}, time.Second, time.Millisecond)
+}
+
+func TestScheduler_FairShare(t *testing.T) {
+	s := newTestScheduler(t)
+	defer s.stop(t)
+
+	s.SetTenant("a", scheduler.TenantConfig{Weight: 2})
+	s.SetTenant("b", scheduler.TenantConfig{Weight: 1})
+	s.RegisterWorker(workerID0)
+
+	tenants := map[*scheduler.PendingJob]string{}
+	for _, tenant := range []string{"a", "b"} {
+		for i := 0; i < 6; i++ {
+			job := &api.JobSpec{Job: build.Job{ID: build.NewID()}, Tenant: tenant}
+			s.OnJobComplete(workerID0, job.ID, &api.JobResult{})
+			tenants[s.ScheduleJob(job)] = tenant
+		}
+	}
+
+	s.BlockUntil(12) // all jobs are in the first local queue
+
+	shares := s.Tenants()
+	require.Len(t, shares, 2)
+	assert.Equal(t, scheduler.TenantStats{Tenant: "a", Weight: 2, Share: 2. / 3, Position: 1, Waiting: 6}, shares[0])
+	assert.Equal(t, scheduler.TenantStats{Tenant: "b", Weight: 1, Share: 1. / 3, Position: 2, Waiting: 6}, shares[1])
+
+	var picked []string
+	for i := 0; i < 9; i++ {
+		picked = append(picked, tenants[s.PickJob(context.Background(), workerID0)])
+	}
+	require.Equal(t, []string{"a", "b", "a", "a", "b", "a", "a", "b", "a"}, picked)
+}
+
+func TestScheduler_TenantLimit(t *testing.T) {
+	s := newTestScheduler(t)
+	defer s.stop(t)
+
+	s.SetTenant("a", scheduler.TenantConfig{MaxRunningJobs: 1})
+	s.RegisterWorker(workerID0)
+
+	schedule := func(tenant string) *scheduler.PendingJob {
+		job := &api.JobSpec{Job: build.Job{ID: build.NewID()}, Tenant: tenant}
+		s.OnJobComplete(workerID0, job.ID, &api.JobResult{})
+		return s.ScheduleJob(job)
+	}
+
+	a0, a1, b0 := schedule("a"), schedule("a"), schedule("b")
+	s.BlockUntil(3)
+
+	require.Equal(t, a0, s.PickJob(context.Background(), workerID0))
+	require.Equal(t, b0, s.PickJob(context.Background(), workerID0))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	require.Nil(t, s.PickJob(ctx, workerID0), "tenant a is at its limit")
+
+	s.OnJobComplete(workerID0, a0.Job.ID, &api.JobResult{ID: a0.Job.ID})
+	require.Equal(t, a1, s.PickJob(context.Background(), workerID0))
+}
+
+func TestScheduler_ReleaseTenant(t *testing.T) {
+	s := newTestScheduler(t)
+	defer s.stop(t)
+
+	s.SetTenant("a", scheduler.TenantConfig{Weight: 2})
+	s.RegisterWorker(workerID0)
+
+	schedule := func(tenant string) *scheduler.PendingJob {
+		job := &api.JobSpec{Job: build.Job{ID: build.NewID()}, Tenant: tenant}
+		s.OnJobComplete(workerID0, job.ID, &api.JobResult{})
+		return s.ScheduleJob(job)
+	}
+
+	a0, b0 := schedule("a"), schedule("b")
+	require.Len(t, s.Tenants(), 2)
+
+	for _, job := range []*scheduler.PendingJob{a0, b0} {
+		s.OnJobComplete(workerID0, job.Job.ID, &api.JobResult{ID: job.Job.ID})
+	}
+
+	// Tenant b has no config, so it is forgotten when its last job is finished.
+	require.Equal(t, []scheduler.TenantStats{{Tenant: "a", Weight: 2}}, s.Tenants())
+}